@@ -0,0 +1,193 @@
+package laozi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FlushingLogger is implemented by loggers that can be flushed on demand, see Laozi.Flush.
+type FlushingLogger interface {
+	Logger
+	// Flush persists the events logged so far, returning once done.
+	Flush() error
+}
+
+// Flush flushes the logger of a partition key now, if it is a FlushingLogger.
+func (r *laozi) Flush(key string) error {
+	r.RLock()
+	l, found := r.routingMap[key]
+	r.RUnlock()
+	if !found {
+		return ErrUnknownPartition
+	}
+
+	var err error
+	flushed := unwrap(l, func(l Logger) bool {
+		fl, ok := l.(FlushingLogger)
+		if ok {
+			err = fl.Flush()
+		}
+		return ok
+	})
+	if !flushed {
+		return fmt.Errorf("logger of %s can't be flushed", key)
+	}
+	return err
+}
+
+// Evict closes the logger of a partition key now, as if it timed out, returning the error of
+// its final flush. Events of the key logged later go to a new logger.
+func (r *laozi) Evict(key string) error {
+	r.Lock()
+	l, found := r.routingMap[key]
+	if !found {
+		r.Unlock()
+		return ErrUnknownPartition
+	}
+	delete(r.routingMap, key)
+	if r.closing == nil {
+		r.closing = map[string]*closingLogger{}
+	}
+	// events of the key wait for the logger to be closed
+	c := &closingLogger{Logger: l, started: true, done: make(chan struct{})}
+	r.closing[key] = c
+	r.Unlock()
+	return r.closeLogger(key, c)
+}
+
+// AdminServer is an http.Handler exposing operations on a router, a control plane for
+// long-running archivers. Serve it on an address only operators can reach, e.g.
+//
+//	go http.ListenAndServe("localhost:8081", &laozi.AdminServer{Router: r})
+//
+// It serves:
+//
+//	GET  /partitions       the partitions and their loggers, as DumpState
+//	POST /flush?key=<key>  flushes the logger of a partition
+//	POST /evict?key=<key>  closes the logger of a partition
+//	POST /pause            pauses the router
+//	POST /resume           resumes the router
+//	GET  /stats            the counters of the Stats
+//	GET  /thresholds       the FlushThresholds, as {"flush_interval": "30s", "records": 0, "bytes": 0}
+//	PUT  /thresholds       replaces the FlushThresholds
+type AdminServer struct {
+	Router Laozi
+	// Stats and Thresholds optionally are those of the logger factory of the router, e.g. the
+	// s3.S3Stats of an s3.S3LoggerFactory.
+	Stats      StatsCounter
+	Thresholds *FlushThresholds
+}
+
+// StatsCounter is implemented by the stats of logger factories served by the AdminServer.
+type StatsCounter interface {
+	// Counters returns the counters by name, e.g. "put_requests".
+	Counters() map[string]int64
+}
+
+// adminThresholds is the JSON representation of FlushThresholds.
+type adminThresholds struct {
+	FlushInterval string `json:"flush_interval"`
+	Records       int    `json:"records"`
+	Bytes         int    `json:"bytes"`
+}
+
+func (a *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/partitions":
+		if a.allow(w, r, http.MethodGet) {
+			w.Header().Set("Content-Type", "application/json")
+			a.Router.DumpState(w)
+		}
+	case "/flush", "/evict":
+		if !a.allow(w, r, http.MethodPost) {
+			return
+		}
+		key := r.URL.Query().Get("key")
+		var err error
+		if r.URL.Path == "/flush" {
+			err = a.Router.Flush(key)
+		} else {
+			err = a.Router.Evict(key)
+		}
+		switch {
+		case errors.Is(err, ErrUnknownPartition):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case "/pause", "/resume":
+		if !a.allow(w, r, http.MethodPost) {
+			return
+		}
+		if r.URL.Path == "/pause" {
+			a.Router.Pause()
+		} else {
+			a.Router.Resume()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "/stats":
+		if !a.allow(w, r, http.MethodGet) {
+			return
+		}
+		if a.Stats == nil {
+			http.Error(w, "no stats", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, a.Stats.Counters())
+	case "/thresholds":
+		a.serveThresholds(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *AdminServer) serveThresholds(w http.ResponseWriter, r *http.Request) {
+	if !a.allow(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	if a.Thresholds == nil {
+		http.Error(w, "no thresholds", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPut {
+		var t adminThresholds
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var interval time.Duration
+		if t.FlushInterval != "" {
+			var err error
+			if interval, err = time.ParseDuration(t.FlushInterval); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		a.Thresholds.Set(interval, t.Records, t.Bytes)
+	}
+	interval, records, bytes := a.Thresholds.Get()
+	writeJSON(w, adminThresholds{FlushInterval: interval.String(), Records: records, Bytes: bytes})
+}
+
+// allow reports whether the request has one of the methods, replying with an error otherwise.
+func (a *AdminServer) allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
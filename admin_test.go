@@ -0,0 +1,109 @@
+package laozi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminServerOperatesRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	r := NewLaozi(&Config{
+		LoggerFactory:    MockReportingLoggerFactory{sink},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "a/b", nil },
+	})
+	defer r.Close()
+	srv := httptest.NewServer(&AdminServer{Router: r})
+	defer srv.Close()
+	do := func(method, path string) int {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(err) {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	r.Log([]byte("e"))
+	r.(*laozi).awaitRouted(1)
+
+	resp, err := http.Get(srv.URL + "/partitions")
+	if assert.NoError(err) {
+		var state routerState
+		assert.NoError(json.NewDecoder(resp.Body).Decode(&state))
+		resp.Body.Close()
+		if assert.Len(state.Partitions, 1) {
+			assert.Equal("a/b", state.Partitions[0].Key)
+		}
+	}
+
+	assert.Equal(http.StatusMethodNotAllowed, do(http.MethodGet, "/flush?key=a/b"))
+	assert.Equal(http.StatusNoContent, do(http.MethodPost, "/flush?key=a/b"))
+	sink.Lock()
+	assert.Len(sink.batches, 1)
+	sink.Unlock()
+
+	assert.Equal(http.StatusNoContent, do(http.MethodPost, "/evict?key=a/b"))
+	assert.Equal(http.StatusNotFound, do(http.MethodPost, "/evict?key=a/b"))
+	assert.Equal(http.StatusNotFound, do(http.MethodPost, "/flush?key=c"))
+
+	assert.Equal(http.StatusNoContent, do(http.MethodPost, "/pause"))
+	assert.NotNil(r.(*laozi).paused())
+	assert.Equal(http.StatusNoContent, do(http.MethodPost, "/resume"))
+	assert.Nil(r.(*laozi).paused())
+
+	assert.Equal(http.StatusNotFound, do(http.MethodGet, "/stats"))
+	assert.Equal(http.StatusNotFound, do(http.MethodGet, "/thresholds"))
+}
+
+func TestAdminServerAdjustsThresholds(t *testing.T) {
+	assert := assert.New(t)
+
+	thresholds := &FlushThresholds{}
+	srv := httptest.NewServer(&AdminServer{Router: MockLaozi{}, Stats: mockCounter{"put_requests": 2}, Thresholds: thresholds})
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/thresholds",
+		strings.NewReader(`{"flush_interval": "30s", "records": 100}`))
+	resp, err := http.DefaultClient.Do(req)
+	if assert.NoError(err) {
+		var t adminThresholds
+		assert.NoError(json.NewDecoder(resp.Body).Decode(&t))
+		resp.Body.Close()
+		assert.Equal(adminThresholds{FlushInterval: "30s", Records: 100}, t)
+	}
+	interval, records, bytes := thresholds.Get()
+	assert.Equal(30*time.Second, interval)
+	assert.Equal(100, records)
+	assert.Equal(0, bytes)
+
+	req, _ = http.NewRequest(http.MethodPut, srv.URL+"/thresholds", strings.NewReader(`{"flush_interval": "soon"}`))
+	resp, err = http.DefaultClient.Do(req)
+	if assert.NoError(err) {
+		resp.Body.Close()
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/stats")
+	if assert.NoError(err) {
+		var stats map[string]int64
+		assert.NoError(json.NewDecoder(resp.Body).Decode(&stats))
+		resp.Body.Close()
+		assert.Equal(int64(2), stats["put_requests"])
+	}
+}
+
+type mockCounter map[string]int64
+
+func (c mockCounter) Counters() map[string]int64 {
+	return c
+}
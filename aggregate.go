@@ -0,0 +1,155 @@
+package laozi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Summary is what an AggregatingLogger archives in place of the events of a window: how many
+// events had a value of the By field, and the sums of their Sum fields.
+type Summary struct {
+	Window time.Time          `json:"window"`
+	By     string             `json:"by,omitempty"`
+	Count  int64              `json:"count"`
+	Sums   map[string]float64 `json:"sums,omitempty"`
+}
+
+// AggregatingLogger is a Logger archiving summaries of events rather than the events, for
+// partitions the archive only needs metrics of. The events matched, JSON objects, are counted
+// by the value of a field and their numeric fields summed, then written to the wrapped logger
+// as one Summary per value, in JSON lines, at the end of every window and on Close. The events
+// not matched are logged as they are.
+type AggregatingLogger struct {
+	Logger
+	window time.Duration
+	by     string
+	sums   []string
+	match  func(e []byte) bool
+
+	start     time.Time
+	summaries map[string]*Summary
+	active    time.Time
+	logChan   chan []byte
+	quitChan  chan struct{}
+}
+
+// Aggregating returns a Middleware wrapping loggers in AggregatingLoggers, see
+// NewAggregatingLogger.
+func Aggregating(window time.Duration, match func(e []byte) bool, by string, sums ...string) Middleware {
+	return func(l Logger) Logger {
+		return NewAggregatingLogger(l, window, match, by, sums...)
+	}
+}
+
+// NewAggregatingLogger starts an AggregatingLogger summarizing the events match returns true
+// for, all if match is nil, per window of time, which must be positive, by the value of their
+// by field, if set, and summing their sums fields.
+func NewAggregatingLogger(l Logger, window time.Duration, match func(e []byte) bool, by string, sums ...string) *AggregatingLogger {
+	a := &AggregatingLogger{
+		Logger:    l,
+		window:    window,
+		by:        by,
+		sums:      sums,
+		match:     match,
+		summaries: make(map[string]*Summary),
+		active:    time.Now(),
+		logChan:   make(chan []byte),
+		quitChan:  make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+// Log causes the event to be added to the summaries of the window if matched, or to be logged
+// otherwise.
+func (a *AggregatingLogger) Log(e []byte) {
+	a.logChan <- e
+	a.active = time.Now()
+}
+
+func (a *AggregatingLogger) loop() {
+	var windowChan <-chan time.Time
+	for {
+		select {
+		case <-windowChan:
+			a.flush()
+			windowChan = nil
+		case e := <-a.logChan:
+			if a.match != nil && !a.match(e) {
+				a.Logger.Log(e)
+				continue
+			}
+			now := time.Now()
+			if start := now.Truncate(a.window); !start.Equal(a.start) {
+				a.flush()
+				a.start = start
+				windowChan = time.After(start.Add(a.window).Sub(now))
+			}
+			a.add(e)
+		case <-a.quitChan:
+			return
+		}
+	}
+}
+
+func (a *AggregatingLogger) add(e []byte) {
+	var fields map[string]interface{}
+	// events that aren't JSON objects are counted without a value
+	json.Unmarshal(e, &fields)
+
+	var value string
+	if v, ok := fields[a.by]; ok && a.by != "" {
+		value = fmt.Sprint(v)
+	}
+	s, ok := a.summaries[value]
+	if !ok {
+		s = &Summary{Window: a.start, By: value}
+		a.summaries[value] = s
+	}
+	s.Count++
+	for _, name := range a.sums {
+		if n, ok := fields[name].(float64); ok {
+			if s.Sums == nil {
+				s.Sums = make(map[string]float64)
+			}
+			s.Sums[name] += n
+		}
+	}
+}
+
+// flush logs the summaries of the window, ordered by value.
+func (a *AggregatingLogger) flush() {
+	values := make([]string, 0, len(a.summaries))
+	for value := range a.summaries {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		data, err := json.Marshal(a.summaries[value])
+		if err != nil {
+			fmt.Printf(" [laozi] Error! Could not encode summary: %s\n", err)
+			continue
+		}
+		a.Logger.Log(append(data, '\n'))
+	}
+	a.summaries = make(map[string]*Summary)
+}
+
+// Close logs the summaries of the current window and closes the wrapped logger.
+func (a *AggregatingLogger) Close() error {
+	a.quitChan <- struct{}{}
+	a.flush()
+	return a.Logger.Close()
+}
+
+// LastActive is used to know when the logger last logged, summarized events included.
+func (a *AggregatingLogger) LastActive() time.Time {
+	return a.active
+}
+
+// Unwrap returns the wrapped logger.
+func (a *AggregatingLogger) Unwrap() Logger {
+	return a.Logger
+}
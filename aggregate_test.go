@@ -0,0 +1,75 @@
+package laozi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregatingLoggerLogsSummaries(t *testing.T) {
+	assert := assert.New(t)
+
+	ml := &MockLogger{}
+	isRequest := func(e []byte) bool { return bytes.Contains(e, []byte(`"request"`)) }
+	l := NewAggregatingLogger(ml, time.Hour, isRequest, "method", "bytes")
+
+	l.Log([]byte(`{"type":"request","method":"GET","bytes":10}` + "\n"))
+	l.Log([]byte(`{"type":"error","message":"down"}` + "\n"))
+	l.Log([]byte(`{"type":"request","method":"POST","bytes":5}` + "\n"))
+	l.Log([]byte(`{"type":"request","method":"GET","bytes":2.5}` + "\n"))
+	assert.NoError(l.Close())
+	assert.True(ml.closed)
+
+	lines := strings.Split(strings.TrimSuffix(string(ml.bytes), "\n"), "\n")
+	if !assert.Len(lines, 3) {
+		return
+	}
+	// the events not matched are logged as they are
+	assert.Equal(`{"type":"error","message":"down"}`, lines[0])
+
+	var get, post Summary
+	assert.NoError(json.Unmarshal([]byte(lines[1]), &get))
+	assert.NoError(json.Unmarshal([]byte(lines[2]), &post))
+	assert.Equal("GET", get.By)
+	assert.Equal(int64(2), get.Count)
+	assert.Equal(12.5, get.Sums["bytes"])
+	assert.Equal("POST", post.By)
+	assert.Equal(int64(1), post.Count)
+	assert.Equal(time.Now().Truncate(time.Hour).Unix(), post.Window.Unix())
+}
+
+func TestAggregatingLoggerLogsEveryWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	r := NewLaozi(&Config{
+		LoggerFactory:    WithMiddleware(MockReportingLoggerFactory{sink}, Aggregating(20*time.Millisecond, nil, "")),
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "key", nil },
+	})
+	r.Log([]byte("a\n"))
+	r.Log([]byte("b\n"))
+	time.Sleep(50 * time.Millisecond)
+	r.Log([]byte("c\n"))
+	r.Close()
+
+	sink.Lock()
+	defer sink.Unlock()
+	// a window ended between b and c, if not between a and b
+	var summaries int
+	var count int64
+	for _, b := range sink.batches {
+		for _, e := range b.Events {
+			var s Summary
+			assert.NoError(json.Unmarshal(e, &s))
+			summaries++
+			count += s.Count
+		}
+	}
+	assert.True(summaries >= 2)
+	assert.Equal(int64(3), count)
+}
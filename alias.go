@@ -0,0 +1,31 @@
+package laozi
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// ShardKeys returns a KeyAliasFunc logging the events of every partition key to one of n
+// shards, named prefix followed by the shard number, e.g. "users/" and 16 for users/0 to
+// users/15.
+func ShardKeys(prefix string, n int) func(key string) string {
+	if n <= 0 {
+		panic("ShardKeys requires a positive number of shards")
+	}
+	return func(key string) string {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return prefix + strconv.Itoa(int(h.Sum32()%uint32(n)))
+	}
+}
+
+// AliasKeys returns a KeyAliasFunc logging the events of the keys of aliases to their value,
+// and the events of other keys as is.
+func AliasKeys(aliases map[string]string) func(key string) string {
+	return func(key string) string {
+		if alias, ok := aliases[key]; ok {
+			return alias
+		}
+		return key
+	}
+}
@@ -0,0 +1,50 @@
+package laozi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	shard := ShardKeys("users/", 4)
+	assert.Equal(shard("alice"), shard("alice"))
+	shards := map[string]bool{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		shards[shard(key)] = true
+	}
+	assert.True(len(shards) > 1)
+	assert.True(len(shards) <= 4)
+	assert.Panics(func() { ShardKeys("users/", 0) })
+}
+
+func TestRouterAliasesKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			KeyAliasFunc:     AliasKeys(map[string]string{"1": "shared", "2": "shared"}),
+		},
+	}
+	go l.route()
+
+	l.EventChan <- []byte("1")
+	l.EventChan <- []byte("2")
+	l.EventChan <- []byte("3")
+
+	l.awaitRouted(3)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(2, len(l.routingMap))
+	assert.Equal([]byte("12"), l.routingMap["shared"].(*MockLogger).bytes)
+	assert.Equal([]byte("3"), l.routingMap["3"].(*MockLogger).bytes)
+}
@@ -0,0 +1,40 @@
+package laozi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// RoutingDecision records that an event was handed to the logger of a partition, see
+// Config.AuditFunc.
+type RoutingDecision struct {
+	// Hash is the EventHash of the event as logged.
+	Hash string `json:"hash"`
+	// Partition is the key of the logger, a sub-partition once split, see Config.SplitBytes.
+	Partition string `json:"partition"`
+	// Logger is the type of the logger.
+	Logger string    `json:"logger"`
+	Time   time.Time `json:"time"`
+}
+
+// EventHash returns the hex SHA-256 of an event, the way RoutingDecisions identify it, e.g. to
+// look up where a record was archived.
+func EventHash(e []byte) string {
+	sum := sha256.Sum256(e)
+	return hex.EncodeToString(sum[:])
+}
+
+// audit passes the routing decision of an event to the AuditFunc, if any.
+func (r *laozi) audit(key string, l Logger, e []byte) {
+	if r.AuditFunc == nil {
+		return
+	}
+	r.AuditFunc(RoutingDecision{
+		Hash:      EventHash(e),
+		Partition: key,
+		Logger:    fmt.Sprintf("%T", l),
+		Time:      time.Now().UTC(),
+	})
+}
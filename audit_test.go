@@ -0,0 +1,60 @@
+package laozi
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterAuditsRoutingDecisions(t *testing.T) {
+	assert := assert.New(t)
+
+	var decisions []RoutingDecision
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockSyncLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+		SamplingFunc:     SampleKeys(regexp.MustCompile("^b$"), 0),
+		SyncMode:         true,
+		Envelope:         true,
+		AuditFunc:        func(d RoutingDecision) { decisions = append(decisions, d) },
+	})
+	assert.NoError(r.LogSync(context.Background(), []byte("a")))
+	assert.NoError(r.LogSync(context.Background(), []byte("b")))
+	r.Close()
+
+	// sampled out events aren't archived
+	if assert.Len(decisions, 1) {
+		assert.Equal(EventHash([]byte("a")), decisions[0].Hash)
+		assert.Equal("a", decisions[0].Partition)
+		assert.Equal("*laozi.MockSyncLogger", decisions[0].Logger)
+		assert.WithinDuration(time.Now(), decisions[0].Time, time.Minute)
+	}
+}
+
+func TestRouterAuditsDeliveredEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	decisions := make(chan RoutingDecision, 2)
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+		SplitBytes:       1,
+		SplitShards:      1,
+		AuditFunc:        func(d RoutingDecision) { decisions <- d },
+	})
+	r.Log([]byte("a"))
+	r.Log([]byte("a"))
+	r.Close()
+
+	d := <-decisions
+	assert.Equal("a", d.Partition)
+	assert.Equal("*laozi.MockLogger", d.Logger)
+	d = <-decisions
+	assert.Equal("a/shard-0", d.Partition)
+	assert.Equal("ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", d.Hash)
+}
@@ -0,0 +1,243 @@
+package laozi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Batch is a set of consecutive events of a partition handed to a sink at once, see
+// NewBatchLogger.
+type Batch struct {
+	Events [][]byte
+	// Start is when the first event of the batch was logged, and First its sequence number.
+	Start time.Time
+	First int64
+}
+
+// Last returns the sequence number of the last event of the batch.
+func (b *Batch) Last() int64 {
+	return b.First + int64(len(b.Events)) - 1
+}
+
+// Bytes returns the events of the batch concatenated, the way file based sinks store them.
+func (b *Batch) Bytes() []byte {
+	return bytes.Join(b.Events, nil)
+}
+
+// BatchLogger is a Logger buffering the events of a partition in memory and handing them to a
+// sink in batches: every flush interval, whenever maxBatchSize events are buffered and on
+// Close. A batch that can't be written is kept, and retried with the next flush, except for
+// the events the sink drops, see ErrDropped.
+type BatchLogger struct {
+	key           string
+	write         func(*Batch) error
+	pending       *Batch
+	sequence      int64
+	maxBatchSize  int
+	flushInterval time.Duration
+	active        time.Time
+	logChan       chan []byte
+	batchChan     chan [][]byte
+	flushRequests chan chan error
+	// bufferedRequests receives the calls to Buffered while running, stopped is closed once not
+	bufferedRequests chan chan []byte
+	quitChan         chan struct{}
+	stopped          chan struct{}
+	Reporter
+	// size of the pending batch and whether it is being written, for State
+	bufferedBytes int64
+	uploading     int32
+	// received counts the events logged, and persisted those written by the last flush
+	received  int64
+	persisted int64
+	// MaxPending optionally caps the events kept in the pending batch while writes fail, the
+	// oldest ones being dropped and reported with an *ErrDropped. Set it before logging.
+	MaxPending int
+}
+
+// NewBatchLogger starts a BatchLogger handing the batches of a partition key to write, whose
+// first event gets sequence number sequence+1, e.g. for sinks other than S3. A batch that
+// write fails to write is retried with the next flush; write may trim the events it wrote from
+// it, incrementing First. Events write can never write are trimmed too and returned in an
+// *ErrDropped, which fails the flush only if events are left to retry.
+func NewBatchLogger(key string, write func(*Batch) error, flushInterval time.Duration, maxBatchSize int, sequence int64) *BatchLogger {
+	l := &BatchLogger{
+		key:              key,
+		write:            write,
+		sequence:         sequence,
+		maxBatchSize:     maxBatchSize,
+		flushInterval:    flushInterval,
+		active:           time.Now(),
+		logChan:          make(chan []byte),
+		batchChan:        make(chan [][]byte),
+		flushRequests:    make(chan chan error),
+		quitChan:         make(chan struct{}),
+		bufferedRequests: make(chan chan []byte),
+		stopped:          make(chan struct{}),
+	}
+	go l.loop()
+	return l
+}
+
+// Log causes the event to be added to the pending batch.
+func (l *BatchLogger) Log(e []byte) {
+	l.logChan <- e
+	l.active = time.Now()
+}
+
+// LogBatch causes the events to be added to the pending batch at once.
+func (l *BatchLogger) LogBatch(events [][]byte) {
+	l.batchChan <- events
+	l.active = time.Now()
+}
+
+// Flush writes the pending batch now, returning once done.
+func (l *BatchLogger) Flush() error {
+	done := make(chan error, 1)
+	l.flushRequests <- done
+	return <-done
+}
+
+func (l *BatchLogger) loop() {
+	defer close(l.stopped)
+	var flushChan <-chan time.Time
+	if l.flushInterval > 0 {
+		flushChan = time.After(l.flushInterval)
+	}
+
+	for {
+		select {
+		case <-flushChan:
+			l.flushLogged()
+			flushChan = time.After(l.flushInterval)
+		case e := <-l.logChan:
+			l.add(e)
+			l.flushFull()
+		case events := <-l.batchChan:
+			for _, e := range events {
+				l.add(e)
+				l.flushFull()
+			}
+		case done := <-l.flushRequests:
+			done <- l.flush()
+		case done := <-l.bufferedRequests:
+			done <- l.pendingBytes()
+		case <-l.quitChan:
+			return
+		}
+	}
+}
+
+func (l *BatchLogger) add(e []byte) {
+	l.received++
+	l.sequence++
+	if l.pending == nil {
+		l.pending = &Batch{Start: time.Now(), First: l.sequence}
+	}
+	l.pending.Events = append(l.pending.Events, e)
+	atomic.AddInt64(&l.bufferedBytes, int64(len(e)))
+}
+
+// flushFull flushes the pending batch once it holds maxBatchSize events.
+func (l *BatchLogger) flushFull() {
+	if l.maxBatchSize > 0 && len(l.pending.Events) >= l.maxBatchSize {
+		l.flushLogged()
+	}
+}
+
+func (l *BatchLogger) flushLogged() {
+	err := l.flush()
+	if l.pending == nil && err != nil {
+		fmt.Printf(" [laozi] Error! Could not flush all events of logger: %s: %s\n", l.key, err)
+	} else if err != nil {
+		fmt.Printf(" [laozi] Error! Could not flush logger, will retry: %s: %s\n", l.key, err)
+	}
+}
+
+func (l *BatchLogger) flush() error {
+	if l.pending == nil {
+		return nil
+	}
+	start := time.Now()
+	records, size := len(l.pending.Events), len(l.pending.Bytes())
+	atomic.StoreInt32(&l.uploading, 1)
+	err := l.write(l.pending)
+	atomic.StoreInt32(&l.uploading, 0)
+	l.Report(DeliveryReport{
+		Partition: l.key,
+		Records:   records,
+		Bytes:     size,
+		Duration:  time.Since(start),
+		Err:       err,
+	})
+	var dropped *ErrDropped
+	if err != nil && !(errors.As(err, &dropped) && len(l.pending.Events) == 0) {
+		// the sink may have trimmed the events it wrote
+		l.dropOverflow()
+		atomic.StoreInt64(&l.bufferedBytes, int64(len(l.pending.Bytes())))
+		return err
+	}
+	l.pending = nil
+	atomic.StoreInt64(&l.bufferedBytes, 0)
+	atomic.StoreInt64(&l.persisted, l.received)
+	return err
+}
+
+// dropOverflow drops the oldest events of the pending batch beyond MaxPending.
+func (l *BatchLogger) dropOverflow() {
+	overflow := len(l.pending.Events) - l.MaxPending
+	if l.MaxPending <= 0 || overflow <= 0 {
+		return
+	}
+	err := &ErrDropped{Key: l.key, Events: l.pending.Events[:overflow:overflow], Cause: ErrPendingFull}
+	l.pending.Events = l.pending.Events[overflow:]
+	l.pending.First += int64(overflow)
+	fmt.Printf(" [laozi] Error! %s\n", err)
+	l.Report(DeliveryReport{Partition: l.key, Records: overflow, Bytes: len(bytes.Join(err.Events, nil)), Err: err})
+}
+
+// Persisted returns how many of the events logged are persisted.
+func (l *BatchLogger) Persisted() int64 {
+	return atomic.LoadInt64(&l.persisted)
+}
+
+// Close stops the logger and writes the pending batch.
+func (l *BatchLogger) Close() error {
+	l.quitChan <- struct{}{}
+	return l.flush()
+}
+
+// Buffered returns the events of the pending batch.
+func (l *BatchLogger) Buffered() []byte {
+	done := make(chan []byte, 1)
+	select {
+	case l.bufferedRequests <- done:
+		return <-done
+	case <-l.stopped:
+		return l.pendingBytes()
+	}
+}
+
+func (l *BatchLogger) pendingBytes() []byte {
+	if l.pending == nil {
+		return nil
+	}
+	return l.pending.Bytes()
+}
+
+// Detach stops the logger without writing the pending batch, returning its events.
+func (l *BatchLogger) Detach() [][]byte {
+	l.quitChan <- struct{}{}
+	if l.pending == nil {
+		return nil
+	}
+	return l.pending.Events
+}
+
+// LastActive is used to know when the logger last logged.
+func (l *BatchLogger) LastActive() time.Time {
+	return l.active
+}
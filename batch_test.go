@@ -0,0 +1,150 @@
+package laozi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSink struct {
+	sync.Mutex
+	batches []Batch
+	err     error
+}
+
+func (m *mockSink) write(b *Batch) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.batches = append(m.batches, *b)
+	return nil
+}
+
+func TestBatchLoggerFlushesFullBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	l := NewBatchLogger("test", sink.write, time.Hour, 2, 10)
+
+	l.Log([]byte("a"))
+	l.Log([]byte("b"))
+	l.Log([]byte("c"))
+	assert.NoError(l.Close())
+
+	assert.Equal(2, len(sink.batches))
+	assert.Equal([][]byte{[]byte("a"), []byte("b")}, sink.batches[0].Events)
+	assert.Equal(int64(11), sink.batches[0].First)
+	assert.Equal(int64(12), sink.batches[0].Last())
+	assert.Equal([]byte("c"), sink.batches[1].Bytes())
+	assert.Equal(int64(13), sink.batches[1].First)
+}
+
+func TestBatchLoggerLogsBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	l := NewBatchLogger("test", sink.write, time.Hour, 2, 0)
+
+	l.LogBatch([][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	assert.NoError(l.Close())
+
+	assert.Equal(2, len(sink.batches))
+	assert.Equal([]byte("ab"), sink.batches[0].Bytes())
+	assert.Equal([]byte("c"), sink.batches[1].Bytes())
+}
+
+func TestBatchLoggerDetaches(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	l := NewBatchLogger("test", sink.write, time.Hour, 0, 0)
+
+	l.Log([]byte("a"))
+	assert.Equal([][]byte{[]byte("a")}, l.Detach())
+	assert.Equal(0, len(sink.batches))
+}
+
+func TestBatchLoggerFlushesOnInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	l := NewBatchLogger("test", sink.write, time.Millisecond, 0, 0)
+
+	l.Log([]byte("a"))
+
+	assert.Eventually(func() bool {
+		sink.Lock()
+		defer sink.Unlock()
+		return len(sink.batches) == 1
+	}, time.Second, time.Millisecond)
+	assert.WithinDuration(time.Now(), l.LastActive(), 20*time.Millisecond)
+}
+
+func TestBatchLoggerRetriesFailedBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{err: errors.New("sink is down")}
+	l := NewBatchLogger("test", sink.write, time.Hour, 1, 0)
+
+	l.Log([]byte("a"))
+	l.Log([]byte("b"))
+
+	sink.Lock()
+	sink.err = nil
+	sink.Unlock()
+	assert.NoError(l.Close())
+
+	assert.Equal(1, len(sink.batches))
+	assert.Equal([]byte("ab"), sink.batches[0].Bytes())
+}
+
+func TestBatchLoggerDropsEventsBeyondMaxPending(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{err: errors.New("sink is down")}
+	l := NewBatchLogger("test", sink.write, time.Hour, 1, 0)
+	l.MaxPending = 2
+	reports := make(chan DeliveryReport, 10)
+	l.ReportTo(reports)
+
+	l.Log([]byte("a"))
+	l.Log([]byte("b"))
+	l.Log([]byte("c"))
+	assert.Equal([]byte("bc"), l.Buffered())
+
+	var dropped *ErrDropped
+	for r := range reports {
+		if errors.As(r.Err, &dropped) {
+			break
+		}
+	}
+	assert.Equal([][]byte{[]byte("a")}, dropped.Events)
+	assert.Equal(ErrPendingFull, dropped.Cause)
+
+	sink.Lock()
+	sink.err = nil
+	sink.Unlock()
+	assert.NoError(l.Close())
+	assert.Equal(int64(2), sink.batches[0].First)
+}
+
+func TestBatchLoggerDropsRejectedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	rejected := &ErrDropped{Key: "test", Events: [][]byte{[]byte("a")}, Cause: errors.New("rejected")}
+	l := NewBatchLogger("test", func(b *Batch) error {
+		b.Events = nil
+		return rejected
+	}, time.Hour, 0, 0)
+
+	l.Log([]byte("a"))
+	assert.Equal(rejected, l.Flush())
+	assert.Empty(l.Buffered())
+	assert.Equal(int64(1), l.Persisted())
+	assert.NoError(l.Close())
+}
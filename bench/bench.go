@@ -0,0 +1,190 @@
+// Package bench runs realistic workloads through a laozi router, reporting its throughput,
+// allocation rate and Log latency, so that performance related changes, e.g. to locking or
+// batching, can be validated against a baseline. The benchmarks of the package run the
+// Workloads:
+//
+//	go test -run none -bench . ./bench
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// Workload is events spread over partitions logged to a router.
+type Workload struct {
+	Name string
+	// Events are logged round robin to Partitions, at EventsPerSecond if set or as fast as
+	// possible, their sizes cycling through EventSizes (defaults to 100 bytes).
+	Events          int
+	Partitions      int
+	EventsPerSecond int
+	EventSizes      []int
+}
+
+// Workloads are the workloads of the benchmarks.
+var Workloads = []Workload{
+	{Name: "hot-partition", Events: 100000, Partitions: 1, EventSizes: []int{100}},
+	{Name: "many-partitions", Events: 100000, Partitions: 1000, EventSizes: []int{100}},
+	{Name: "mixed-sizes", Events: 50000, Partitions: 100, EventSizes: []int{50, 200, 1000, 16000}},
+	{Name: "paced", Events: 20000, Partitions: 100, EventsPerSecond: 100000, EventSizes: []int{200}},
+}
+
+// Result is the performance of a router running a workload.
+type Result struct {
+	Workload Workload
+	// Elapsed is the time from the first Log call until the router was closed, with all events
+	// delivered.
+	Elapsed time.Duration
+	// Throughput is the number of events delivered per second, and BytesPerSecond their size.
+	Throughput     float64
+	BytesPerSecond float64
+	// AllocsPerEvent and AllocBytesPerEvent are the allocations of the process per event.
+	AllocsPerEvent     float64
+	AllocBytesPerEvent float64
+	// LogP50 and LogP99 are percentiles of the duration of the Log calls.
+	LogP50 time.Duration
+	LogP99 time.Duration
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s: %d events in %s, %.0f events/s, %.1f MB/s, %.1f allocs/event, %.0f B/event, Log p50 %s p99 %s",
+		r.Workload.Name, r.Workload.Events, r.Elapsed, r.Throughput, r.BytesPerSecond/1e6,
+		r.AllocsPerEvent, r.AllocBytesPerEvent, r.LogP50, r.LogP99)
+}
+
+// Run runs a workload through a router of the config. The config defaults to loggers
+// discarding the events, a LoggerTimeout of a minute and an EventChannelSize of 1000, and its
+// PartitionKeyFunc is replaced by the one of the workload.
+func Run(c laozi.Config, w Workload) Result {
+	discard := &DiscardFactory{}
+	if c.LoggerFactory == nil {
+		c.LoggerFactory = discard
+	}
+	if c.LoggerTimeout == 0 {
+		c.LoggerTimeout = time.Minute
+	}
+	if c.EventChannelSize == 0 {
+		c.EventChannelSize = 1000
+	}
+	c.PartitionKeyFunc = PartitionKey
+
+	events, size := w.events()
+	latencies := make([]time.Duration, len(events))
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	r := laozi.NewLaozi(&c)
+	start := time.Now()
+	for i, e := range events {
+		if w.EventsPerSecond > 0 {
+			if wait := time.Until(start.Add(time.Duration(i) * time.Second / time.Duration(w.EventsPerSecond))); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		t := time.Now()
+		r.Log(e)
+		latencies[i] = time.Since(t)
+	}
+	r.Close()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if c.LoggerFactory == discard && discard.Events() != int64(len(events)) {
+		panic(fmt.Sprintf("%d events were delivered out of %d", discard.Events(), len(events)))
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	n := float64(len(events))
+	return Result{
+		Workload:           w,
+		Elapsed:            elapsed,
+		Throughput:         n / elapsed.Seconds(),
+		BytesPerSecond:     float64(size) / elapsed.Seconds(),
+		AllocsPerEvent:     float64(after.Mallocs-before.Mallocs) / n,
+		AllocBytesPerEvent: float64(after.TotalAlloc-before.TotalAlloc) / n,
+		LogP50:             percentile(latencies, 0.5),
+		LogP99:             percentile(latencies, 0.99),
+	}
+}
+
+// events makes the events of the workload, returning their total size.
+func (w Workload) events() ([][]byte, int) {
+	sizes := w.EventSizes
+	if len(sizes) == 0 {
+		sizes = []int{100}
+	}
+	partitions := w.Partitions
+	if partitions <= 0 {
+		partitions = 1
+	}
+
+	events := make([][]byte, w.Events)
+	total := 0
+	for i := range events {
+		e := strconv.AppendInt([]byte("p"), int64(i%partitions), 10)
+		e = append(e, ':')
+		if pad := sizes[i%len(sizes)] - len(e) - 1; pad > 0 {
+			e = append(e, bytes.Repeat([]byte("x"), pad)...)
+		}
+		events[i] = append(e, '\n')
+		total += len(events[i])
+	}
+	return events, total
+}
+
+// PartitionKey returns the partition of an event of a workload, the part before ':'.
+func PartitionKey(e []byte) (string, error) {
+	i := bytes.IndexByte(e, ':')
+	if i < 0 {
+		return "", fmt.Errorf("no partition in event %q", e)
+	}
+	return string(e[:i]), nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// DiscardFactory makes loggers counting the events logged to them and discarding them, to
+// benchmark the router alone.
+type DiscardFactory struct {
+	events int64
+}
+
+// NewLogger returns a logger discarding events.
+func (f *DiscardFactory) NewLogger(key string) laozi.Logger {
+	return &discardLogger{f: f, active: time.Now()}
+}
+
+// Events returns the number of events logged to the loggers of the factory.
+func (f *DiscardFactory) Events() int64 {
+	return atomic.LoadInt64(&f.events)
+}
+
+type discardLogger struct {
+	f      *DiscardFactory
+	active time.Time
+}
+
+func (l *discardLogger) Log(e []byte) {
+	atomic.AddInt64(&l.f.events, 1)
+}
+
+func (l *discardLogger) Close() error {
+	return nil
+}
+
+func (l *discardLogger) LastActive() time.Time {
+	return l.active
+}
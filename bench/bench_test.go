@@ -0,0 +1,60 @@
+package bench
+
+import (
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func BenchmarkWorkloads(b *testing.B) {
+	for _, w := range Workloads {
+		b.Run(w.Name, func(b *testing.B) {
+			var r Result
+			for i := 0; i < b.N; i++ {
+				r = Run(laozi.Config{}, w)
+			}
+			b.ReportMetric(r.Throughput, "events/s")
+			b.ReportMetric(r.AllocsPerEvent, "allocs/event")
+			b.ReportMetric(float64(r.LogP99.Nanoseconds()), "p99-ns/log")
+			b.Log(r)
+		})
+	}
+}
+
+func BenchmarkWorkloadsWithBatching(b *testing.B) {
+	for _, w := range Workloads {
+		b.Run(w.Name, func(b *testing.B) {
+			var r Result
+			for i := 0; i < b.N; i++ {
+				r = Run(laozi.Config{RouteBatchSize: 100}, w)
+			}
+			b.ReportMetric(r.Throughput, "events/s")
+			b.ReportMetric(float64(r.LogP99.Nanoseconds()), "p99-ns/log")
+		})
+	}
+}
+
+func TestRunReportsWorkloads(t *testing.T) {
+	assert := assert.New(t)
+
+	w := Workload{Name: "test", Events: 1000, Partitions: 10, EventSizes: []int{10, 100}}
+	events, size := w.events()
+	assert.Len(events, 1000)
+	assert.Equal(500*10+500*100, size)
+	key, err := PartitionKey(events[11])
+	assert.NoError(err)
+	assert.Equal("p1", key)
+
+	lf := &DiscardFactory{}
+	r := Run(laozi.Config{LoggerFactory: lf}, w)
+	assert.Equal(int64(1000), lf.Events())
+	assert.True(r.Throughput > 0)
+	assert.True(r.LogP99 >= r.LogP50)
+	assert.Contains(r.String(), "test: 1000 events")
+
+	w.EventsPerSecond = 10000
+	r = Run(laozi.Config{}, w)
+	assert.True(r.Elapsed >= 90*time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package laozi
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	defaultCardinalityWindow = time.Minute
+	// cardinalitySample is how many keys are passed to OnHighCardinality
+	cardinalitySample = 10
+)
+
+// countKey records that events were routed to a partition key, calling OnHighCardinality
+// once the distinct keys routed within the CardinalityWindow exceed the CardinalityThreshold.
+func (r *laozi) countKey(key string) {
+	if r.CardinalityThreshold <= 0 {
+		return
+	}
+
+	now := time.Now()
+	r.keysLock.Lock()
+	if r.keysSeen == nil {
+		r.keysSeen = map[string]time.Time{}
+	}
+	r.keysSeen[key] = now
+	n := len(r.keysSeen)
+	// prune expired keys only once over the threshold, and at most every tenth of the window
+	if n > r.CardinalityThreshold && now.Sub(r.keysPruned) >= r.cardinalityWindow()/10 {
+		n = r.pruneKeys(now)
+	}
+	var sample []string
+	if n > r.CardinalityThreshold && !r.highCardinality {
+		r.highCardinality = true
+		for k := range r.keysSeen {
+			if sample = append(sample, k); len(sample) == cardinalitySample {
+				break
+			}
+		}
+	} else if n <= r.CardinalityThreshold {
+		r.highCardinality = false
+	}
+	r.keysLock.Unlock()
+
+	if sample == nil {
+		return
+	}
+	sort.Strings(sample)
+	if r.OnHighCardinality != nil {
+		r.OnHighCardinality(n, sample)
+	} else {
+		fmt.Printf(" [laozi] Warning! %d partition keys in %s, e.g. %v\n", n, r.cardinalityWindow(), sample)
+	}
+}
+
+// pruneKeys forgets the keys last routed before the window, returning how many are left. It
+// must be called with the keysLock held.
+func (r *laozi) pruneKeys(now time.Time) int {
+	for k, seen := range r.keysSeen {
+		if now.Sub(seen) >= r.cardinalityWindow() {
+			delete(r.keysSeen, k)
+		}
+	}
+	r.keysPruned = now
+	return len(r.keysSeen)
+}
+
+// cardinality returns the number of distinct partition keys routed within the window.
+func (r *laozi) cardinality() int {
+	if r.Config == nil || r.CardinalityThreshold <= 0 {
+		return 0
+	}
+	r.keysLock.Lock()
+	defer r.keysLock.Unlock()
+	return r.pruneKeys(time.Now())
+}
+
+func (r *laozi) cardinalityWindow() time.Duration {
+	if r.CardinalityWindow <= 0 {
+		return defaultCardinalityWindow
+	}
+	return r.CardinalityWindow
+}
@@ -0,0 +1,72 @@
+package laozi
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterAlertsOnHighCardinality(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	var alerts []int
+	var samples [][]string
+	l := &laozi{
+		EventChan:  make(chan []byte, 10),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:        &MockLoggerFactory{},
+			PartitionKeyFunc:     MockPartitionFunc,
+			LoggerTimeout:        time.Minute,
+			CardinalityThreshold: 2,
+			OnHighCardinality: func(keys int, sample []string) {
+				lock.Lock()
+				defer lock.Unlock()
+				alerts = append(alerts, keys)
+				samples = append(samples, sample)
+			},
+		},
+	}
+	go l.route()
+
+	for _, e := range []string{"a", "b", "a", "c", "d"} {
+		l.EventChan <- []byte(e)
+	}
+	l.awaitRouted(5)
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal([]int{3}, alerts)
+	assert.Equal([][]string{{"a", "b", "c"}}, samples)
+	assert.Equal(4, l.cardinality())
+}
+
+func TestCardinalityWindowSlides(t *testing.T) {
+	assert := assert.New(t)
+
+	alerts := 0
+	l := &laozi{Config: &Config{
+		CardinalityThreshold: 1,
+		CardinalityWindow:    20 * time.Millisecond,
+		OnHighCardinality:    func(int, []string) { alerts++ },
+	}}
+
+	l.countKey("a")
+	time.Sleep(30 * time.Millisecond)
+	l.countKey("b")
+	assert.Equal(0, alerts)
+	assert.Equal(1, l.cardinality())
+
+	l.countKey("c")
+	l.countKey("d")
+	assert.Equal(1, alerts)
+
+	// the count falls to the threshold once the keys expire
+	time.Sleep(30 * time.Millisecond)
+	l.countKey("e")
+	l.countKey("f")
+	assert.Equal(2, alerts)
+}
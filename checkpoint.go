@@ -0,0 +1,31 @@
+package laozi
+
+import "time"
+
+// Checkpoint is the high-water mark of a partition, recorded after every successful flush.
+type Checkpoint struct {
+	// Partition is the partition key returned by the PartitionKeyFunc.
+	Partition string
+	// Key is the object key the partition was flushed to.
+	Key string
+	// Sequence is the total number of events flushed for the partition.
+	Sequence int64
+	// Offset is the size in bytes of the (uncompressed) flushed object.
+	Offset int64
+	// SampledOut is the number of events of the flushed object that were sampled out.
+	SampledOut int64
+	// Time is when the flush completed.
+	Time time.Time
+	// VersionID is the version of the flushed object, in buckets with versioning enabled, see
+	// s3.VersionedReader.
+	VersionID string
+}
+
+// Checkpointer defines how checkpoints are stored so a restarted archiver can resume numbering
+// where it left off, or a downstream consumer can verify it has read everything.
+type Checkpointer interface {
+	// SaveCheckpoint records a checkpoint, replacing any previous one for the same partition.
+	SaveCheckpoint(Checkpoint) error
+	// LoadCheckpoint returns the last checkpoint for a partition. If none exists, found is false.
+	LoadCheckpoint(partition string) (c Checkpoint, found bool, err error)
+}
@@ -0,0 +1,95 @@
+// Package clickhouse inserts the events of a laozi router in ClickHouse tables.
+package clickhouse
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const (
+	defaultClickHouseBatchSize = 10000
+	defaultClickHouseFormat    = "JSONEachRow"
+)
+
+// ClickHouseLoggerFactory is a logger factory for creating loggers that insert received events
+// in ClickHouse tables through its HTTP interface. Every event is a row in the input format.
+type ClickHouseLoggerFactory struct {
+	// Addr is the address of the HTTP interface, e.g. "http://localhost:8123".
+	Addr     string
+	Database string
+	Username string
+	Password string
+	// Table is the table events are inserted in, unless TableFunc maps partition keys to tables.
+	Table     string
+	TableFunc func(key string) string
+	// Format is the input format of the events, defaults to JSONEachRow.
+	Format        string
+	FlushInterval time.Duration
+	// BatchSize is the max number of events per insert, defaults to 10000.
+	BatchSize int
+	// Client is the HTTP client used, defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// NewLogger returns a new instance of a ClickHouse logger for a corresponding partition key.
+func (lf ClickHouseLoggerFactory) NewLogger(key string) laozi.Logger {
+	w := &clickHouseWriter{ClickHouseLoggerFactory: lf, table: lf.Table}
+	if lf.TableFunc != nil {
+		w.table = lf.TableFunc(key)
+	}
+	if w.Format == "" {
+		w.Format = defaultClickHouseFormat
+	}
+	if w.BatchSize <= 0 {
+		w.BatchSize = defaultClickHouseBatchSize
+	}
+	if w.Client == nil {
+		w.Client = http.DefaultClient
+	}
+
+	return laozi.NewBatchLogger(key, w.write, lf.FlushInterval, w.BatchSize, 0)
+}
+
+type clickHouseWriter struct {
+	ClickHouseLoggerFactory
+	table string
+}
+
+func (w *clickHouseWriter) write(b *laozi.Batch) error {
+	var body bytes.Buffer
+	for _, e := range b.Events {
+		body.Write(bytes.TrimRight(e, "\r\n"))
+		body.WriteByte('\n')
+	}
+
+	params := url.Values{"query": {fmt.Sprintf("INSERT INTO %s FORMAT %s", w.table, w.Format)}}
+	if w.Database != "" {
+		params.Set("database", w.Database)
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(w.Addr, "/")+"/?"+params.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	if w.Username != "" {
+		req.Header.Set("X-ClickHouse-User", w.Username)
+		req.Header.Set("X-ClickHouse-Key", w.Password)
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("clickhouse insert into %s failed: %s: %s", w.table, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package clickhouse
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClickHouseLoggerInsertsEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	var query, database, user, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		database = r.URL.Query().Get("database")
+		user = r.Header.Get("X-ClickHouse-User")
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	lf := ClickHouseLoggerFactory{
+		Addr:      server.URL,
+		Database:  "analytics",
+		Username:  "laozi",
+		TableFunc: func(key string) string { return "events_" + key },
+	}
+	l := lf.NewLogger("a")
+	assert.Implements((*laozi.Logger)(nil), l)
+	l.Log([]byte(`{"n":1}` + "\n"))
+	l.Log([]byte(`{"n":2}`))
+	assert.NoError(l.Close())
+
+	assert.Equal("INSERT INTO events_a FORMAT JSONEachRow", query)
+	assert.Equal("analytics", database)
+	assert.Equal("laozi", user)
+	assert.Equal("{\"n\":1}\n{\"n\":2}\n", body)
+}
+
+func TestClickHouseWriterReportsErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "Code: 60. DB::Exception: Table default.events doesn't exist.")
+	}))
+	defer server.Close()
+
+	w := &clickHouseWriter{
+		ClickHouseLoggerFactory: ClickHouseLoggerFactory{Addr: server.URL, Format: "JSONEachRow", Client: http.DefaultClient},
+		table:                   "events",
+	}
+	err := w.write(&laozi.Batch{Events: [][]byte{[]byte(`{}`)}})
+	assert.Error(err)
+	assert.Contains(err.Error(), "doesn't exist")
+}
@@ -0,0 +1,110 @@
+package laozi
+
+import (
+	"math/rand"
+	"time"
+)
+
+// defaultCloseConcurrency is the CloseConcurrency if not configured.
+const defaultCloseConcurrency = 8
+
+// closingLogger is a timed out logger waiting for its turn to be closed.
+type closingLogger struct {
+	Logger
+	started bool
+	done    chan struct{}
+}
+
+// closeLater closes a timed out logger after a random jitter, with at most CloseConcurrency
+// loggers closing at once, so loggers timing out in the same tick don't all flush together.
+// It must be called with the lock held.
+func (r *laozi) closeLater(key string, l Logger, sem chan struct{}) {
+	if r.closing == nil {
+		r.closing = map[string]*closingLogger{}
+	}
+	c := &closingLogger{Logger: l, done: make(chan struct{})}
+	r.closing[key] = c
+
+	go func() {
+		if r.CloseJitter > 0 {
+			time.Sleep(time.Duration(rand.Int63n(int64(r.CloseJitter))))
+		}
+		sem <- struct{}{}
+		defer func() { <-sem }()
+
+		if r.startClosing(key, c) {
+			r.closeLogger(key, c)
+		}
+	}()
+}
+
+// startClosing reports whether the logger still has to be closed, i.e. it was neither revived
+// nor closed by Close in the meantime.
+func (r *laozi) startClosing(key string, c *closingLogger) bool {
+	r.Lock()
+	defer r.Unlock()
+	if r.closing[key] != c || c.started {
+		return false
+	}
+	c.started = true
+	return true
+}
+
+func (r *laozi) closeLogger(key string, c *closingLogger) error {
+	err := r.closeFailed(key, c.Logger, c.Close())
+	r.unlock(key)
+
+	r.Lock()
+	delete(r.closing, key)
+	r.Unlock()
+	close(c.done)
+	return err
+}
+
+// closePending closes the timed out loggers still waiting for their turn and waits for the
+// ones already closing.
+func (r *laozi) closePending() {
+	r.Lock()
+	start := map[string]*closingLogger{}
+	var wait []*closingLogger
+	for key, c := range r.closing {
+		if c.started {
+			wait = append(wait, c)
+			continue
+		}
+		c.started = true
+		start[key] = c
+	}
+	r.Unlock()
+
+	for key, c := range start {
+		r.closeLogger(key, c)
+	}
+	for _, c := range wait {
+		<-c.done
+	}
+}
+
+// logger returns the logger of a partition key. A timed out logger that isn't closing yet is
+// put back in use. It must be called with the lock held, which is released while waiting for a
+// logger that is closing, so its final flush happens before a new logger reads previous data.
+func (r *laozi) logger(key string) (Logger, bool) {
+	for {
+		if l, found := r.routingMap[key]; found {
+			return l, true
+		}
+		c, closing := r.closing[key]
+		if !closing {
+			return nil, false
+		}
+		if !c.started {
+			delete(r.closing, key)
+			r.routingMap[key] = c.Logger
+			return c.Logger, true
+		}
+
+		r.Unlock()
+		<-c.done
+		r.Lock()
+	}
+}
@@ -0,0 +1,132 @@
+package laozi
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SlowMockLogger struct {
+	MockLogger
+	running *int32
+	max     *int32
+}
+
+func (m *SlowMockLogger) Close() error {
+	n := atomic.AddInt32(m.running, 1)
+	for {
+		max := atomic.LoadInt32(m.max)
+		if n <= max || atomic.CompareAndSwapInt32(m.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	atomic.AddInt32(m.running, -1)
+	return m.MockLogger.Close()
+}
+
+func TestRouterCapsClosingConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	var running, max int32
+	l := &laozi{
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerTimeout:    2 * time.Millisecond,
+			CloseJitter:      time.Millisecond,
+			CloseConcurrency: 2,
+		},
+	}
+	var loggers []*SlowMockLogger
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		ml := &SlowMockLogger{running: &running, max: &max}
+		loggers = append(loggers, ml)
+		l.routingMap[key] = ml
+	}
+
+	go l.monitorLoggers()
+
+	assert.Eventually(func() bool {
+		l.Lock()
+		defer l.Unlock()
+		return len(l.routingMap) == 0 && len(l.closing) == 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(int32(2), atomic.LoadInt32(&max))
+	for _, ml := range loggers {
+		assert.True(ml.closed)
+	}
+}
+
+func TestRouterClosesLoggersConcurrentlyByDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	var running, max int32
+	l := &laozi{
+		routingMap: map[string]Logger{},
+		Config:     &Config{LoggerTimeout: 2 * time.Millisecond},
+	}
+	for i := 0; i < 2*defaultCloseConcurrency; i++ {
+		l.routingMap[string(rune('a'+i))] = &SlowMockLogger{running: &running, max: &max}
+	}
+
+	go l.monitorLoggers()
+
+	assert.Eventually(func() bool {
+		l.Lock()
+		defer l.Unlock()
+		return len(l.routingMap) == 0 && len(l.closing) == 0
+	}, time.Second, time.Millisecond)
+	assert.True(atomic.LoadInt32(&max) > 1)
+	assert.True(atomic.LoadInt32(&max) <= defaultCloseConcurrency)
+}
+
+func TestRouterRevivesLoggersWaitingToClose(t *testing.T) {
+	assert := assert.New(t)
+
+	log1 := &MockLogger{}
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+		},
+	}
+	l.Lock()
+	l.closeLater("1", log1, make(chan struct{}))
+	l.Unlock()
+
+	go l.route()
+	l.EventChan <- []byte("1")
+
+	l.awaitRouted(1)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(log1, l.routingMap["1"])
+	assert.Equal(0, len(l.closing))
+	assert.Equal([]byte("1"), log1.bytes)
+	assert.False(log1.closed)
+}
+
+func TestRouterClosesPendingLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	log1 := &MockLogger{}
+	l := &laozi{
+		routingMap: map[string]Logger{},
+		Config:     &Config{},
+	}
+	// never gets a turn, so Close must take care of it
+	l.Lock()
+	l.closeLater("1", log1, make(chan struct{}))
+	l.Unlock()
+
+	l.Close()
+
+	assert.True(log1.closed)
+	assert.Equal(0, len(l.closing))
+}
@@ -0,0 +1,12 @@
+package laozi
+
+// PartitionLocker coordinates which instance owns which partition key when several laozi
+// instances run side by side. Only the owner of a partition creates a logger for it, so two
+// instances never write the same object. Ownership is a lease that expires unless renewed,
+// so the TTL of an implementation must comfortably exceed the LoggerTimeout.
+type PartitionLocker interface {
+	// Lock takes or renews ownership of a partition, returning false if another instance owns it.
+	Lock(partition string) (bool, error)
+	// Unlock gives up ownership of a partition.
+	Unlock(partition string) error
+}
@@ -0,0 +1,224 @@
+package laozi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockLocker struct {
+	mu       sync.Mutex
+	owned    map[string]bool
+	unlocked []string
+	// err fails every Lock
+	err error
+}
+
+func (m *MockLocker) Lock(partition string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.owned[partition], m.err
+}
+
+func (m *MockLocker) Unlock(partition string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unlocked = append(m.unlocked, partition)
+	return nil
+}
+
+type ActiveMockLogger struct {
+	MockLogger
+	// done is closed once the logger is, if set
+	done chan struct{}
+}
+
+func (m *ActiveMockLogger) LastActive() time.Time {
+	return time.Now()
+}
+
+func (m *ActiveMockLogger) Close() error {
+	err := m.MockLogger.Close()
+	if m.done != nil {
+		close(m.done)
+	}
+	return err
+}
+
+func TestRouterSkipsNotOwnedPartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	var forwarded []string
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		notOwned:   map[string]bool{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			PartitionLocker:  &MockLocker{owned: map[string]bool{"1": true}},
+			NotOwnedFunc:     func(key string, e []byte) { forwarded = append(forwarded, key) },
+		},
+	}
+	go l.route()
+
+	l.EventChan <- []byte("1")
+	l.EventChan <- []byte("2")
+	l.EventChan <- []byte("2")
+	l.EventChan <- []byte("1")
+
+	l.awaitRouted(4)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(1, len(l.routingMap))
+	assert.Equal([]string{"2", "2"}, forwarded)
+	assert.True(l.notOwned["2"])
+}
+
+func TestRouterUnlocksTimedOutPartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	locker := &MockLocker{owned: map[string]bool{"testkey1": true}}
+	l := &laozi{
+		routingMap: map[string]Logger{},
+		notOwned:   map[string]bool{},
+		Config: &Config{
+			LoggerTimeout:   2 * time.Millisecond,
+			PartitionLocker: locker,
+		},
+	}
+
+	log1 := &MockLogger{}
+	l.routingMap["testkey1"] = log1
+
+	go l.monitorLoggers()
+
+	assert.Eventually(func() bool {
+		locker.mu.Lock()
+		defer locker.mu.Unlock()
+		return len(locker.unlocked) > 0
+	}, time.Second, time.Millisecond)
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	assert.True(log1.closed)
+	assert.Equal([]string{"testkey1"}, locker.unlocked)
+}
+
+func TestRouterClosesLostPartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	active := &ActiveMockLogger{done: make(chan struct{})}
+	l := &laozi{
+		routingMap: map[string]Logger{"testkey1": active},
+		notOwned:   map[string]bool{},
+		Config: &Config{
+			LoggerTimeout:   4 * time.Millisecond,
+			PartitionLocker: &MockLocker{owned: map[string]bool{}},
+		},
+	}
+
+	go l.monitorLoggers()
+
+	select {
+	case <-active.done:
+	case <-time.After(time.Second):
+		t.Fatal("lost partition not closed")
+	}
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(0, len(l.routingMap))
+}
+
+func TestRouterHandsOverLostPartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	var forwarded []string
+	var errs []error
+	lost := &MockSnapshotLogger{events: [][]byte{[]byte("1"), []byte("2")}}
+	active := &ActiveMockLogger{}
+	l := &laozi{
+		routingMap: map[string]Logger{"a": lost, "b": active, "c": &MockSnapshotLogger{}},
+		notOwned:   map[string]bool{},
+		Config: &Config{
+			PartitionLocker: &MockLocker{owned: map[string]bool{"c": true}},
+			NotOwnedFunc:    func(key string, e []byte) { forwarded = append(forwarded, key+":"+string(e)) },
+			ErrorHandler:    func(err error) { errs = append(errs, err) },
+		},
+	}
+
+	l.renewOwnership(map[string]Logger{"a": lost, "b": active, "c": l.routingMap["c"]})
+	assert.Equal([]string{"a:1", "a:2"}, forwarded)
+	assert.False(lost.closed)
+	assert.True(active.closed)
+	assert.Len(l.routingMap, 1)
+	assert.Empty(errs)
+
+	// without a NotOwnedFunc the events are reported
+	lost = &MockSnapshotLogger{events: [][]byte{[]byte("3")}}
+	l.routingMap["a"] = lost
+	l.NotOwnedFunc = nil
+	l.renewOwnership(map[string]Logger{"a": lost})
+	var notOwned *ErrNotOwned
+	if assert.Len(errs, 1) && assert.True(errors.As(errs[0], &notOwned)) {
+		assert.Equal("a", notOwned.Key)
+		assert.Equal([][]byte{[]byte("3")}, notOwned.Events)
+	}
+}
+
+func TestRouterKeepsPartitionsOnLockErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var errs []error
+	logger := &MockLogger{}
+	l := &laozi{
+		EventChan:  make(chan []byte, 1),
+		routingMap: map[string]Logger{"a": logger},
+		notOwned:   map[string]bool{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			PartitionLocker:  &MockLocker{err: errors.New("locker is down")},
+			NotOwnedFunc:     func(key string, e []byte) { t.Errorf("event of %s forwarded", key) },
+			ErrorHandler:     func(err error) { errs = append(errs, err) },
+		},
+	}
+
+	// the lease of a logger failing to be renewed is kept
+	l.renewOwnership(map[string]Logger{"a": logger})
+	assert.Equal(logger, l.routingMap["a"])
+	assert.False(logger.closed)
+	if assert.Len(errs, 1) {
+		assert.Contains(errs[0].Error(), "locker is down")
+	}
+
+	// the events of a partition failing to be locked are reported
+	l.EventChan <- []byte("b")
+	close(l.EventChan)
+	l.route()
+	var newLogger *ErrNewLogger
+	if assert.Len(errs, 2) && assert.True(errors.As(errs[1], &newLogger)) {
+		assert.Equal("b", newLogger.Key)
+		assert.Equal([][]byte{[]byte("b")}, newLogger.Events)
+		assert.Contains(newLogger.Error(), "locker is down")
+	}
+	assert.False(l.notOwned["b"])
+}
+
+func TestRouterClosesUnlocks(t *testing.T) {
+	assert := assert.New(t)
+
+	locker := &MockLocker{}
+	l := &laozi{
+		routingMap: map[string]Logger{"testkey1": &MockLogger{}},
+		Config:     &Config{PartitionLocker: locker},
+	}
+
+	l.Close()
+	assert.Equal([]string{"testkey1"}, locker.unlocked)
+}
@@ -0,0 +1,210 @@
+package laozi
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCommitBarriers bounds the barriers waiting to be persisted, the last one being replaced
+// by newer ones once reached.
+const maxCommitBarriers = 16
+
+// Sequence is the position of an event in a source partition, e.g. the offset of a Kafka
+// message in its topic partition, or a counter of the records read from a Kinesis shard.
+type Sequence int64
+
+// PersistingLogger is implemented by loggers telling how many of the events logged to them
+// are persisted, see CommittableWatermark. The events of other loggers are persisted once they
+// are closed.
+type PersistingLogger interface {
+	Logger
+	// Persisted returns how many of the events logged so far are persisted, the first ones
+	// logged, LogBatch included.
+	Persisted() int64
+}
+
+// commitTracker tracks the events logged with LogSequenced until they are persisted. Routed
+// events are numbered in routing order, which StrictOrdering without workers makes the order
+// they were queued in, and a barrier is the number of events routed at some point along with
+// the events delivered to every logger then. Once each logger persisted the events of a
+// barrier, the events routed before it are.
+type commitTracker struct {
+	sync.Mutex
+	// delivered counts the events delivered to the open loggers
+	delivered map[Logger]int64
+	barriers  []commitBarrier
+	// durable is the number of the first events routed known to be persisted, unless a logger
+	// failed to persist its events when closed
+	durable int64
+	failed  bool
+	// partitions are the source partitions of LogSequenced
+	partitions map[string]*sourcePartition
+}
+
+type commitBarrier struct {
+	routed int64
+	need   map[Logger]int64
+}
+
+// sourcePartition holds the events of a source partition logged with LogSequenced, with the
+// number of the last one in routing order, until persisted.
+type sourcePartition struct {
+	pending     []sequencedEvent
+	committable Sequence
+}
+
+type sequencedEvent struct {
+	seq    Sequence
+	number int64
+}
+
+func newCommitTracker() *commitTracker {
+	return &commitTracker{
+		delivered:  make(map[Logger]int64),
+		partitions: make(map[string]*sourcePartition),
+	}
+}
+
+// LogSequenced logs an event of a source partition, e.g. a Kafka topic partition, at its
+// sequence there, for CommittableWatermark to tell once it is persisted. Events of a source
+// partition must be logged in sequence order. It requires StrictOrdering, without
+// RouterConcurrency nor PinnedKeys, and holds up concurrent Log calls while queueing the event.
+func (r *laozi) LogSequenced(partition string, seq Sequence, e []byte) error {
+	if r.commits == nil {
+		return errors.New("LogSequenced requires StrictOrdering, without RouterConcurrency")
+	}
+	// no other event is queued meanwhile, so the number of events queued is the number of
+	// the last one in routing order
+	r.orderLock.Lock()
+	defer r.orderLock.Unlock()
+	if r.isClosed() {
+		return ErrClosed
+	}
+	for _, e := range r.split(e) {
+		if !r.enqueue(e, true) {
+			return ErrClosed
+		}
+		atomic.AddInt64(&r.sequenced, 1)
+	}
+	r.checkWatermarks()
+	r.commits.sequenced(partition, seq, atomic.LoadInt64(&r.sequenced))
+	return nil
+}
+
+// CommittableWatermark returns the sequence of the last event of a source partition logged
+// with LogSequenced such that it and every event logged before it are persisted, for sources
+// to commit it as their offset, or -1 if there is none yet. It only advances as loggers
+// persist events, so it stops advancing once a logger failed to persist its events when
+// closed, as they are lost, for the source to replay them from the last offset committed
+// after a restart. Events dropped by the router, e.g. filtered, sampled out or failing their
+// partition key, count as persisted, as do events held with NewLoggerFailureHold.
+func (r *laozi) CommittableWatermark(partition string) Sequence {
+	if r.commits == nil {
+		return -1
+	}
+	return r.commits.watermark(partition, atomic.LoadInt64(&r.routedEvents))
+}
+
+// sequenced records that the event of a source partition at seq is the number-th routed.
+func (t *commitTracker) sequenced(partition string, seq Sequence, number int64) {
+	t.Lock()
+	defer t.Unlock()
+	p, ok := t.partitions[partition]
+	if !ok {
+		p = &sourcePartition{committable: -1}
+		t.partitions[partition] = p
+	}
+	p.pending = append(p.pending, sequencedEvent{seq: seq, number: number})
+}
+
+// deliver counts the events delivered to a logger. It must be called before they are counted
+// as routed.
+func (t *commitTracker) deliver(l Logger, n int) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	t.delivered[l] += int64(n)
+	t.Unlock()
+}
+
+// closed forgets a closed logger, whose events are persisted unless it failed.
+func (t *commitTracker) closed(l Logger, err error) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.delivered[l]; !ok {
+		return
+	}
+	delete(t.delivered, l)
+	if err != nil {
+		t.failed = true
+		return
+	}
+	for _, b := range t.barriers {
+		delete(b.need, l)
+	}
+}
+
+// watermark returns the committable sequence of a source partition, once routed events were
+// routed.
+func (t *commitTracker) watermark(partition string, routed int64) Sequence {
+	t.Lock()
+	defer t.Unlock()
+	if !t.failed {
+		last := t.durable
+		if n := len(t.barriers); n > 0 {
+			last = t.barriers[n-1].routed
+		}
+		if routed > last {
+			b := commitBarrier{routed: routed, need: make(map[Logger]int64)}
+			for l, n := range t.delivered {
+				if persisted, ok := loggerPersisted(l); !ok || persisted < n {
+					b.need[l] = n
+				}
+			}
+			if len(t.barriers) == maxCommitBarriers {
+				t.barriers[len(t.barriers)-1] = b
+			} else {
+				t.barriers = append(t.barriers, b)
+			}
+		}
+		// later barriers need more events of the same loggers, so are persisted after
+		for len(t.barriers) > 0 && persistedBarrier(t.barriers[0]) {
+			t.durable = t.barriers[0].routed
+			t.barriers = t.barriers[1:]
+		}
+	}
+
+	p, ok := t.partitions[partition]
+	if !ok {
+		return -1
+	}
+	for len(p.pending) > 0 && p.pending[0].number <= t.durable {
+		p.committable = p.pending[0].seq
+		p.pending = p.pending[1:]
+	}
+	return p.committable
+}
+
+// persistedBarrier reports whether the loggers persisted the events of a barrier.
+func persistedBarrier(b commitBarrier) bool {
+	for l, n := range b.need {
+		if persisted, ok := loggerPersisted(l); !ok || persisted < n {
+			return false
+		}
+	}
+	return true
+}
+
+// loggerPersisted returns how many events a logger persisted, if it is a PersistingLogger.
+func loggerPersisted(l Logger) (int64, bool) {
+	pl, ok := l.(PersistingLogger)
+	if !ok {
+		return 0, false
+	}
+	return pl.Persisted(), true
+}
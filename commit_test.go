@@ -0,0 +1,100 @@
+package laozi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCommitRouter(sink *mockSink) Laozi {
+	return NewLaozi(&Config{
+		LoggerFactory:  MockReportingLoggerFactory{sink},
+		LoggerTimeout:  time.Hour,
+		StrictOrdering: true,
+		ErrorHandler:   func(error) {},
+		PartitionKeyFunc: func(e []byte) (string, error) {
+			return strings.SplitN(string(e), ":", 2)[0], nil
+		},
+	})
+}
+
+// awaitRouted waits for the router to be done with n events.
+func awaitRouted(t *testing.T, r Laozi, n int64) {
+	done := make(chan struct{})
+	go func() {
+		r.(*laozi).awaitRouted(n)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("events not routed")
+	}
+}
+
+func TestCommittableWatermarkAdvancesOnFlush(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	r := newCommitRouter(sink)
+	defer r.Close()
+
+	assert.NoError(r.LogSequenced("p0", 10, []byte("a:1")))
+	assert.NoError(r.LogSequenced("p0", 11, []byte("b:2")))
+	assert.NoError(r.LogSequenced("p1", 5, []byte("a:3")))
+	awaitRouted(t, r, 3)
+	assert.Equal(Sequence(-1), r.CommittableWatermark("p0"))
+	assert.Equal(Sequence(-1), r.CommittableWatermark("unknown"))
+
+	// until every logger persisted the events routed before
+	assert.NoError(r.Flush("a"))
+	assert.Equal(Sequence(-1), r.CommittableWatermark("p0"))
+
+	assert.NoError(r.Evict("b"))
+	assert.Equal(Sequence(11), r.CommittableWatermark("p0"))
+	assert.Equal(Sequence(5), r.CommittableWatermark("p1"))
+}
+
+func TestCommittableWatermarkStopsOnLostEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	r := newCommitRouter(sink)
+	defer r.Close()
+
+	assert.NoError(r.LogSequenced("p0", 1, []byte("a:1")))
+	awaitRouted(t, r, 1)
+	assert.NoError(r.Flush("a"))
+	assert.Equal(Sequence(1), r.CommittableWatermark("p0"))
+
+	sink.Lock()
+	sink.err = errors.New("sink is down")
+	sink.Unlock()
+	assert.NoError(r.LogSequenced("p0", 2, []byte("a:2")))
+	awaitRouted(t, r, 2)
+	assert.Error(r.Evict("a"))
+
+	sink.Lock()
+	sink.err = nil
+	sink.Unlock()
+	assert.NoError(r.LogSequenced("p0", 3, []byte("b:3")))
+	awaitRouted(t, r, 3)
+	assert.NoError(r.Flush("b"))
+	assert.Equal(Sequence(1), r.CommittableWatermark("p0"))
+}
+
+func TestLogSequencedRequiresStrictOrdering(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewLaozi(&Config{
+		LoggerFactory:    MockReportingLoggerFactory{&mockSink{}},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "a", nil },
+	})
+	defer r.Close()
+	assert.Error(r.LogSequenced("p0", 1, []byte("a")))
+	assert.Equal(Sequence(-1), r.CommittableWatermark("p0"))
+}
@@ -0,0 +1,82 @@
+// Package compress compresses the objects written by laozi sinks, with gzip or zstd, and
+// recognizes them when read.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"hash/crc32"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMagic starts zstd frames.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Compress returns data compressed with the given method, "gzip", "zstd" or "" for none.
+func Compress(compression string, data []byte) (bs []byte) {
+
+	switch compression {
+	case "gzip":
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+		bs = b.Bytes()
+	case "zstd":
+		bs = Zstd(data, nil)
+	case "":
+		bs = data
+	}
+	return
+}
+
+// IsGzip reports whether data starts with the gzip magic number.
+func IsGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// IsZstd reports whether data starts with the zstd magic number.
+func IsZstd(data []byte) bool {
+	return bytes.HasPrefix(data, zstdMagic)
+}
+
+// DictionaryID returns the id of a raw zstd dictionary, written in the frames compressed with
+// it.
+func DictionaryID(dict []byte) uint32 {
+	if id := crc32.ChecksumIEEE(dict); id != 0 {
+		return id
+	}
+	return 1
+}
+
+// Zstd returns data compressed with zstd, and the raw dictionary if any.
+func Zstd(data, dict []byte) []byte {
+	opts := []zstd.EOption{}
+	if dict != nil {
+		opts = append(opts, zstd.WithEncoderDictRaw(DictionaryID(dict), dict))
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		// only invalid options fail
+		panic(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+// DecompressZstd returns the data of zstd frames compressed with the raw dictionary, if any,
+// e.g. the one named by the Zstd-Dictionary metadata of objects written by S3 loggers
+// training dictionaries.
+func DecompressZstd(data, dict []byte) ([]byte, error) {
+	opts := []zstd.DOption{}
+	if dict != nil {
+		opts = append(opts, zstd.WithDecoderDictRaw(DictionaryID(dict), dict))
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	return dec.DecodeAll(data, nil)
+}
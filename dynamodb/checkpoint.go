@@ -0,0 +1,114 @@
+package dynamodb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// DynamoDBCheckpointer stores checkpoints in a DynamoDB table. The table must have a string
+// hash key named "Partition".
+type DynamoDBCheckpointer struct {
+	Table    string
+	DynamoDB dynamodbiface.DynamoDBAPI
+}
+
+// NewDynamoDBCheckpointer returns a checkpointer writing to the given table.
+func NewDynamoDBCheckpointer(table, region string) *DynamoDBCheckpointer {
+	return &DynamoDBCheckpointer{
+		Table:    table,
+		DynamoDB: dynamodb.New(session.New(), &aws.Config{Region: aws.String(region)}),
+	}
+}
+
+type checkpointItem struct {
+	Partition  string `dynamodbav:"Partition"`
+	ObjectKey  string `dynamodbav:"ObjectKey"`
+	Sequence   int64  `dynamodbav:"Sequence"`
+	Offset     int64  `dynamodbav:"Offset"`
+	SampledOut int64  `dynamodbav:"SampledOut"`
+	UpdatedAt  string `dynamodbav:"UpdatedAt"`
+	VersionID  string `dynamodbav:"VersionID,omitempty"`
+}
+
+func marshalCheckpoint(c laozi.Checkpoint) (map[string]*dynamodb.AttributeValue, error) {
+	return dynamodbattribute.MarshalMap(checkpointItem{
+		Partition:  c.Partition,
+		ObjectKey:  c.Key,
+		Sequence:   c.Sequence,
+		Offset:     c.Offset,
+		SampledOut: c.SampledOut,
+		UpdatedAt:  c.Time.UTC().Format(time.RFC3339Nano),
+		VersionID:  c.VersionID,
+	})
+}
+
+func unmarshalCheckpoint(item map[string]*dynamodb.AttributeValue) (laozi.Checkpoint, error) {
+	var i checkpointItem
+	if err := dynamodbattribute.UnmarshalMap(item, &i); err != nil {
+		return laozi.Checkpoint{}, err
+	}
+	t, _ := time.Parse(time.RFC3339Nano, i.UpdatedAt)
+	return laozi.Checkpoint{
+		Partition:  i.Partition,
+		Key:        i.ObjectKey,
+		Sequence:   i.Sequence,
+		Offset:     i.Offset,
+		SampledOut: i.SampledOut,
+		Time:       t,
+		VersionID:  i.VersionID,
+	}, nil
+}
+
+// SaveCheckpoint writes the checkpoint to DynamoDB. The write is conditional so a checkpoint
+// can never move backwards, e.g. when two archivers write the same partition.
+func (d *DynamoDBCheckpointer) SaveCheckpoint(c laozi.Checkpoint) error {
+	item, err := marshalCheckpoint(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.DynamoDB.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(d.Table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(#p) OR #s <= :s"),
+		ExpressionAttributeNames: map[string]*string{
+			"#p": aws.String("Partition"),
+			"#s": aws.String("Sequence"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":s": item["Sequence"],
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return fmt.Errorf("checkpoint for %s is ahead of sequence %d", c.Partition, c.Sequence)
+	}
+	return err
+}
+
+// LoadCheckpoint reads the last checkpoint of a partition from DynamoDB.
+func (d *DynamoDBCheckpointer) LoadCheckpoint(partition string) (laozi.Checkpoint, bool, error) {
+	resp, err := d.DynamoDB.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(d.Table),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Partition": {S: aws.String(partition)},
+		},
+	})
+	if err != nil {
+		return laozi.Checkpoint{}, false, err
+	}
+	if len(resp.Item) == 0 {
+		return laozi.Checkpoint{}, false, nil
+	}
+
+	c, err := unmarshalCheckpoint(resp.Item)
+	return c, err == nil, err
+}
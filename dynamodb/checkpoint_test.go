@@ -0,0 +1,30 @@
+package dynamodb
+
+import (
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointMarshalRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	c := laozi.Checkpoint{
+		Partition: "a",
+		Key:       "prefix/a",
+		Sequence:  42,
+		Offset:    1024,
+		Time:      time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC),
+	}
+
+	item, err := marshalCheckpoint(c)
+	assert.NoError(err)
+	assert.Equal("a", *item["Partition"].S)
+	assert.Equal("42", *item["Sequence"].N)
+
+	out, err := unmarshalCheckpoint(item)
+	assert.NoError(err)
+	assert.Equal(c, out)
+}
@@ -0,0 +1,83 @@
+// Package dynamodb leases the partitions of laozi routers and stores their checkpoints in
+// DynamoDB tables.
+package dynamodb
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+func defaultOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// DynamoDBLocker is a PartitionLocker using conditional writes to a DynamoDB table as leases.
+// The table must have a string hash key named "Partition".
+type DynamoDBLocker struct {
+	Table    string
+	DynamoDB dynamodbiface.DynamoDBAPI
+	// Owner identifies this instance, defaults to hostname and pid.
+	Owner string
+	TTL   time.Duration
+}
+
+func (dl *DynamoDBLocker) owner() string {
+	if dl.Owner == "" {
+		dl.Owner = defaultOwner()
+	}
+	return dl.Owner
+}
+
+// Lock takes the lease of a partition if it's free, expired or already ours.
+func (dl *DynamoDBLocker) Lock(partition string) (bool, error) {
+	now := time.Now()
+	_, err := dl.DynamoDB.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(dl.Table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"Partition": {S: aws.String(partition)},
+			"Owner":     {S: aws.String(dl.owner())},
+			"Expires":   {N: aws.String(strconv.FormatInt(now.Add(dl.TTL).UnixNano(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(#p) OR #o = :o OR #e < :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#p": aws.String("Partition"),
+			"#o": aws.String("Owner"),
+			"#e": aws.String("Expires"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":o":   {S: aws.String(dl.owner())},
+			":now": {N: aws.String(strconv.FormatInt(now.UnixNano(), 10))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Unlock releases the lease of a partition if this instance still holds it.
+func (dl *DynamoDBLocker) Unlock(partition string) error {
+	_, err := dl.DynamoDB.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(dl.Table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"Partition": {S: aws.String(partition)},
+		},
+		ConditionExpression:      aws.String("#o = :o"),
+		ExpressionAttributeNames: map[string]*string{"#o": aws.String("Owner")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":o": {S: aws.String(dl.owner())},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
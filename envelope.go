@@ -0,0 +1,102 @@
+package laozi
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const modulePath = "github.com/seedboxtech/laozi"
+
+// EventEnvelope is the record of an event wrapped in its ingestion metadata, see Config.Envelope.
+// Records are JSON objects, followed by a newline if the event was.
+type EventEnvelope struct {
+	// Ingested is when the event was routed, by laozi Version on Host, to Key.
+	Ingested time.Time `json:"ingested"`
+	Host     string    `json:"host"`
+	Version  string    `json:"laozi"`
+	Key      string    `json:"key"`
+	// Event is the event if it is JSON, otherwise Data is.
+	Event json.RawMessage `json:"event,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+}
+
+// OpenEnvelope returns the envelope of a record written with Config.Envelope.
+func OpenEnvelope(record []byte) (EventEnvelope, error) {
+	var env EventEnvelope
+	err := json.Unmarshal(record, &env)
+	return env, err
+}
+
+// Payload returns the event of the envelope, without its trailing newline if it had one.
+func (env EventEnvelope) Payload() []byte {
+	if env.Event != nil {
+		return env.Event
+	}
+	return env.Data
+}
+
+// envelope wraps an event in its ingestion metadata, if configured.
+func (r *laozi) envelope(key string, e []byte) []byte {
+	if !r.Envelope {
+		return e
+	}
+
+	newline := bytes.HasSuffix(e, []byte("\n"))
+	payload := bytes.TrimSuffix(e, []byte("\n"))
+	env := EventEnvelope{
+		Ingested: time.Now().UTC(),
+		Host:     r.host,
+		Version:  version(),
+		Key:      key,
+	}
+	if json.Valid(payload) {
+		env.Event = payload
+	} else {
+		env.Data = payload
+	}
+
+	record, err := json.Marshal(env)
+	if err != nil {
+		// can't happen with valid JSON events
+		return e
+	}
+	if newline {
+		record = append(record, '\n')
+	}
+	return record
+}
+
+var (
+	versionOnce   sync.Once
+	moduleVersion string
+)
+
+// version returns the version of laozi the binary was built with, "(devel)" if unknown.
+func version() string {
+	versionOnce.Do(func() {
+		moduleVersion = "(devel)"
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		if info.Main.Path == modulePath {
+			moduleVersion = info.Main.Version
+			return
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				moduleVersion = dep.Version
+			}
+		}
+	})
+	return moduleVersion
+}
+
+func hostname() string {
+	host, _ := os.Hostname()
+	return host
+}
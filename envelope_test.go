@@ -0,0 +1,92 @@
+package laozi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterWrapsEventsInEnvelopes(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		host:       "host",
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: func(e []byte) (string, error) { return "key", nil },
+			Envelope:         true,
+		},
+	}
+	go l.route()
+
+	l.EventChan <- []byte("{\"a\":1}\n")
+	l.EventChan <- []byte("text")
+
+	l.awaitRouted(2)
+
+	l.Lock()
+	defer l.Unlock()
+	records := bytes.SplitAfter(l.routingMap["key"].(*MockLogger).bytes, []byte("\n"))
+	assert.Equal(2, len(records))
+
+	env, err := OpenEnvelope(records[0])
+	assert.NoError(err)
+	assert.Equal("key", env.Key)
+	assert.Equal("host", env.Host)
+	assert.NotEmpty(env.Version)
+	assert.WithinDuration(time.Now(), env.Ingested, time.Second)
+	assert.Equal(`{"a":1}`, string(env.Event))
+	assert.Equal(`{"a":1}`, string(env.Payload()))
+
+	env, err = OpenEnvelope(records[1])
+	assert.NoError(err)
+	assert.Nil(env.Event)
+	assert.Equal("text", string(env.Payload()))
+}
+
+func FuzzEnvelope(f *testing.F) {
+	f.Add([]byte("{\"a\":1}\n"))
+	f.Add([]byte("text"))
+	f.Add([]byte("{\n\"a\": \"<\"\n}"))
+	f.Add([]byte("a\x00b\nc\xff\n"))
+	f.Fuzz(func(t *testing.T, e []byte) {
+		r := &laozi{host: "host", Config: &Config{Envelope: true}}
+		record := r.envelope("key", e)
+
+		// records are single lines, whatever the event embeds
+		if i := bytes.IndexByte(record, '\n'); i >= 0 && i != len(record)-1 {
+			t.Fatalf("record %q spans lines", record)
+		}
+		if bytes.HasSuffix(record, []byte("\n")) != bytes.HasSuffix(e, []byte("\n")) {
+			t.Fatalf("event %q enveloped as %q", e, record)
+		}
+
+		env, err := OpenEnvelope(record)
+		if err != nil {
+			t.Fatalf("record %q: %s", record, err)
+		}
+		if env.Key != "key" {
+			t.Fatalf("key %q", env.Key)
+		}
+		payload := bytes.TrimSuffix(e, []byte("\n"))
+		if env.Event == nil {
+			if !bytes.Equal(payload, env.Payload()) {
+				t.Fatalf("event %q opened as %q", payload, env.Payload())
+			}
+			return
+		}
+		// JSON events are compacted
+		var want, got interface{}
+		if json.Unmarshal(payload, &want) != nil || json.Unmarshal(env.Payload(), &got) != nil ||
+			!reflect.DeepEqual(want, got) {
+			t.Fatalf("event %q opened as %q", payload, env.Payload())
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package laozi
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+var (
+	// ErrClosed is the error of events logged after the router was closed.
+	ErrClosed = errors.New("laozi is closed")
+	// ErrChannelFull is returned by TryLog when the event channel is full.
+	ErrChannelFull = errors.New("event channel is full")
+	// ErrPartitionKey is wrapped by the errors of events whose partition key could not be
+	// determined.
+	ErrPartitionKey = errors.New("invalid partition key")
+	// ErrUnknownPartition is returned by Flush and Evict when the partition key has no logger.
+	ErrUnknownPartition = errors.New("partition key has no logger")
+	// ErrPendingFull is the cause of the events a BatchLogger drops beyond its MaxPending.
+	ErrPendingFull = errors.New("pending batch is full")
+)
+
+// ErrFlushFailed is the error of a logger that could not persist its events when closed.
+type ErrFlushFailed struct {
+	Key   string
+	Cause error
+}
+
+func (e *ErrFlushFailed) Error() string {
+	return fmt.Sprintf("could not close logger (possible data loss): %s: %s", e.Key, e.Cause)
+}
+
+func (e *ErrFlushFailed) Unwrap() error {
+	return e.Cause
+}
+
+// ErrPreviousData is the error of flushes refused because the object of the key already held
+// data, with the PreviousDataError strategy, or held data that could not be read, as appending
+// to it would lose it, or because the previous state of the key could not be loaded.
+type ErrPreviousData struct {
+	Key string
+	// Cause is why the previous data could not be read, if it couldn't.
+	Cause error
+}
+
+func (e *ErrPreviousData) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("could not read previous data at %s: %s", e.Key, e.Cause)
+	}
+	return fmt.Sprintf("previous data exists at %s", e.Key)
+}
+
+func (e *ErrPreviousData) Unwrap() error {
+	return e.Cause
+}
+
+// ErrConcurrentWrite is the error of flushes refused because another process wrote to the
+// object of the key, with s3.S3LoggerFactory.DetectConcurrentWriters, or of rotated objects
+// found holding other events than those uploaded to their key.
+type ErrConcurrentWrite struct {
+	Key string
+}
+
+func (e *ErrConcurrentWrite) Error() string {
+	return fmt.Sprintf("object %s was written by another process", e.Key)
+}
+
+// ErrS3 is the error of a failed S3 request of a logger, with the ids S3 gave the last attempt
+// to quote when contacting AWS support. Attempts is how many times the request was tried,
+// retries of the SDK included. Flush errors wrap it, find it with errors.As.
+type ErrS3 struct {
+	Op         string
+	Bucket     string
+	Key        string
+	StatusCode int
+	Code       string
+	RequestID  string
+	HostID     string
+	Attempts   int
+	Cause      error
+}
+
+func (e *ErrS3) Error() string {
+	return fmt.Sprintf("s3 %s of s3://%s/%s failed after %d attempts (status %d, request id %q, host id %q): %s",
+		e.Op, e.Bucket, e.Key, e.Attempts, e.StatusCode, e.RequestID, e.HostID, e.Cause)
+}
+
+func (e *ErrS3) Unwrap() error {
+	return e.Cause
+}
+
+// ErrNewLogger is the error of events that could not be logged as the ContextLoggerFactory
+// failed to make the logger of their partition, e.g. for the ErrorHandler to log them again
+// later.
+type ErrNewLogger struct {
+	Key    string
+	Events [][]byte
+	Cause  error
+}
+
+func (e *ErrNewLogger) Error() string {
+	return fmt.Sprintf("could not make logger: %s: %s", e.Key, e.Cause)
+}
+
+func (e *ErrNewLogger) Unwrap() error {
+	return e.Cause
+}
+
+// ErrNotOwned is the error of the events detached from the logger of a partition another
+// instance took ownership of, without a NotOwnedFunc to forward them, e.g. for the
+// ErrorHandler to send them to the new owner.
+type ErrNotOwned struct {
+	Key    string
+	Events [][]byte
+}
+
+func (e *ErrNotOwned) Error() string {
+	return fmt.Sprintf("partition is owned by another instance: %s", e.Key)
+}
+
+// ErrDropped is the error of events a logger dropped without persisting them, e.g. rejected
+// for good by its sink or held beyond BatchLogger.MaxPending while the sink is failing.
+type ErrDropped struct {
+	Key    string
+	Events [][]byte
+	Cause  error
+}
+
+func (e *ErrDropped) Error() string {
+	return fmt.Sprintf("dropped %d events of %s: %s", len(e.Events), e.Key, e.Cause)
+}
+
+func (e *ErrDropped) Unwrap() error {
+	return e.Cause
+}
+
+// ErrPanic is the error of events whose routing panicked, e.g. in the PartitionKeyFunc or the
+// LoggerFactory, with the stack of the panic. The router goes on with the next events.
+type ErrPanic struct {
+	Value  interface{}
+	Stack  []byte
+	Events [][]byte
+}
+
+func (e *ErrPanic) Error() string {
+	return fmt.Sprintf("panic while routing events: %v\n%s", e.Value, e.Stack)
+}
+
+// safely calls f, handling a panic as the *ErrPanic of the events it routes.
+func (r *laozi) safely(events [][]byte, f func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.handleError(&ErrPanic{Value: p, Stack: debug.Stack(), Events: events})
+		}
+	}()
+	f()
+}
+
+// safeNewLogger calls newLogger, returning a panic as an *ErrPanic.
+func safeNewLogger(newLogger func() (Logger, error)) (l Logger, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &ErrPanic{Value: p, Stack: debug.Stack()}
+		}
+	}()
+	return newLogger()
+}
+
+// handleError passes a routing error to the ErrorHandler. Without one, errors are printed,
+// except partition key errors as the events are simply skipped.
+func (r *laozi) handleError(err error) {
+	if r.Config != nil && r.ErrorHandler != nil {
+		r.ErrorHandler(err)
+		return
+	}
+	if !errors.Is(err, ErrPartitionKey) {
+		fmt.Printf(" [laozi] Error! %s\n", err)
+	}
+}
+
+// closeFailed handles the error of a logger that could not be closed, if any.
+func (r *laozi) closeFailed(key string, l Logger, err error) error {
+	r.commits.closed(l, err)
+	if err == nil {
+		return nil
+	}
+	err = &ErrFlushFailed{Key: key, Cause: err}
+	r.handleError(err)
+	return err
+}
@@ -0,0 +1,129 @@
+package laozi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrFlushFailedUnwraps(t *testing.T) {
+	assert := assert.New(t)
+
+	cause := errors.New("s3 is down")
+	var err error = &ErrFlushFailed{Key: "a", Cause: cause}
+	assert.True(errors.Is(err, cause))
+
+	var flushErr *ErrFlushFailed
+	assert.True(errors.As(err, &flushErr))
+	assert.Equal("a", flushErr.Key)
+}
+
+func TestRouterHandlesErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var errs []error
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{"b": &MockLoggerCloseError{}},
+		Config: &Config{
+			LoggerFactory: &MockLoggerFactory{},
+			LoggerTimeout: time.Minute,
+			PartitionKeyFunc: func(e []byte) (string, error) {
+				return "", errors.New("no key in event")
+			},
+			ErrorHandler: func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			},
+		},
+	}
+	go l.route()
+
+	l.Log([]byte("1"))
+	l.awaitRouted(1)
+	l.Close()
+	l.Log([]byte("2"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(3, len(errs))
+	assert.True(errors.Is(errs[0], ErrPartitionKey))
+	var flushErr *ErrFlushFailed
+	assert.True(errors.As(errs[1], &flushErr))
+	assert.Equal("b", flushErr.Key)
+	assert.Equal(ErrClosed, errs[2])
+}
+
+func TestTryLog(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{EventChan: make(chan []byte, 1)}
+	assert.NoError(l.TryLog([]byte("1")))
+	assert.Equal(ErrChannelFull, l.TryLog([]byte("2")))
+
+	l.Close()
+	assert.Equal(ErrClosed, l.TryLog([]byte("3")))
+}
+
+type MockPanickingLoggerFactory struct{}
+
+func (mf *MockPanickingLoggerFactory) NewLogger(key string) Logger {
+	if key == "broken" {
+		panic("no logger")
+	}
+	return &MockLogger{fileName: key}
+}
+
+func TestRouterRecoversPanics(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var errs []error
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory: &MockPanickingLoggerFactory{},
+			LoggerTimeout: time.Minute,
+			PartitionKeyFunc: func(e []byte) (string, error) {
+				if string(e) == "bad" {
+					panic("bad event")
+				}
+				return string(e), nil
+			},
+			ErrorHandler: func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			},
+		},
+	}
+	go l.route()
+
+	l.EventChan <- []byte("bad")
+	l.EventChan <- []byte("broken")
+	l.EventChan <- []byte("good")
+
+	l.awaitRouted(3)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(2, len(errs))
+	var panicErr *ErrPanic
+	assert.True(errors.As(errs[0], &panicErr))
+	assert.Equal("bad event", panicErr.Value)
+	assert.Equal([][]byte{[]byte("bad")}, panicErr.Events)
+	assert.Contains(string(panicErr.Stack), "TestRouterRecoversPanics")
+	var newErr *ErrNewLogger
+	assert.True(errors.As(errs[1], &newErr))
+	assert.True(errors.As(newErr.Cause, &panicErr))
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal([]byte("good"), l.routingMap["good"].(*MockLogger).bytes)
+}
@@ -0,0 +1,123 @@
+// Package eventhubs sends the events of a laozi router to an Azure Event Hub.
+package eventhubs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const (
+	defaultEventHubsBatchSize   = 1000
+	defaultEventHubsSendTimeout = 60 * time.Second
+)
+
+// EventHubsLoggerFactory is a logger factory for creating loggers that send received events to
+// an Azure Event Hub. Events are sent with their partition key as Event Hubs partition key, so
+// the events of a partition land in the same Event Hubs partition, in order.
+type EventHubsLoggerFactory struct {
+	Producer      *azeventhubs.ProducerClient
+	FlushInterval time.Duration
+	// BatchSize is the max number of events buffered before sending them, defaults to 1000.
+	// Events that don't fit the size limit of a single Event Hubs batch are sent in several.
+	BatchSize int
+	// SendTimeout is how long sending the events of a flush may take, defaults to 60 seconds.
+	SendTimeout time.Duration
+}
+
+// eventDataBatch is the part of *azeventhubs.EventDataBatch used by the logger.
+type eventDataBatch interface {
+	AddEventData(*azeventhubs.EventData, *azeventhubs.AddEventDataOptions) error
+	NumEvents() int32
+}
+
+// NewLogger returns a new instance of an Event Hubs logger for a corresponding partition key.
+func (lf EventHubsLoggerFactory) NewLogger(key string) laozi.Logger {
+	w := &eventHubsWriter{
+		EventHubsLoggerFactory: lf,
+		key:                    key,
+		newBatch: func(ctx context.Context) (eventDataBatch, error) {
+			return lf.Producer.NewEventDataBatch(ctx, &azeventhubs.EventDataBatchOptions{PartitionKey: &key})
+		},
+		send: func(ctx context.Context, b eventDataBatch) error {
+			return lf.Producer.SendEventDataBatch(ctx, b.(*azeventhubs.EventDataBatch), nil)
+		},
+	}
+	if w.BatchSize <= 0 {
+		w.BatchSize = defaultEventHubsBatchSize
+	}
+	if w.SendTimeout <= 0 {
+		w.SendTimeout = defaultEventHubsSendTimeout
+	}
+
+	return laozi.NewBatchLogger(key, w.write, lf.FlushInterval, w.BatchSize, 0)
+}
+
+type eventHubsWriter struct {
+	EventHubsLoggerFactory
+	key      string
+	newBatch func(context.Context) (eventDataBatch, error)
+	send     func(context.Context, eventDataBatch) error
+}
+
+// write sends the events of the batch in as many Event Hubs batches as needed. If sending fails,
+// the events already sent are removed from the batch so they aren't sent again on retry.
+func (w *eventHubsWriter) write(b *laozi.Batch) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.SendTimeout)
+	defer cancel()
+
+	eb, err := w.newBatch(ctx)
+	if err != nil {
+		return err
+	}
+	// events of b before sent were sent, the ones from sent on are in eb
+	sent := 0
+	for i := 0; i < len(b.Events); i++ {
+		ed := &azeventhubs.EventData{Body: bytes.TrimRight(b.Events[i], "\r\n")}
+		err := eb.AddEventData(ed, nil)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, azeventhubs.ErrEventDataTooLarge) {
+			return err
+		}
+		if eb.NumEvents() == 0 {
+			log.Printf("- [laozi] Dropping event too large for Event Hubs: %s\n", w.key)
+			b.Events = append(b.Events[:i:i], b.Events[i+1:]...)
+			i--
+			continue
+		}
+
+		if err := w.send(ctx, eb); err != nil {
+			w.sent(b, sent)
+			return fmt.Errorf("could not send events of %s: %s", w.key, err)
+		}
+		sent = i
+		if eb, err = w.newBatch(ctx); err != nil {
+			w.sent(b, sent)
+			return err
+		}
+		i--
+	}
+
+	if eb.NumEvents() == 0 {
+		return nil
+	}
+	if err := w.send(ctx, eb); err != nil {
+		w.sent(b, sent)
+		return fmt.Errorf("could not send events of %s: %s", w.key, err)
+	}
+	return nil
+}
+
+// sent removes the first n events from the batch.
+func (w *eventHubsWriter) sent(b *laozi.Batch, n int) {
+	b.Events = b.Events[n:]
+	b.First += int64(n)
+}
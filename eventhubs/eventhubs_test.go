@@ -0,0 +1,88 @@
+package eventhubs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockEventDataBatch holds up to max events.
+type mockEventDataBatch struct {
+	max    int
+	events []string
+}
+
+func (b *mockEventDataBatch) AddEventData(ed *azeventhubs.EventData, _ *azeventhubs.AddEventDataOptions) error {
+	if len(b.events) >= b.max || len(ed.Body) > 10 {
+		return azeventhubs.ErrEventDataTooLarge
+	}
+	b.events = append(b.events, string(ed.Body))
+	return nil
+}
+
+func (b *mockEventDataBatch) NumEvents() int32 {
+	return int32(len(b.events))
+}
+
+// makeTestEventHubsWriter returns a writer sending batches of up to max events, failing the
+// sends once fail is set.
+func makeTestEventHubsWriter(max int, fail *bool) (*eventHubsWriter, *[][]string) {
+	var sent [][]string
+	w := &eventHubsWriter{
+		EventHubsLoggerFactory: EventHubsLoggerFactory{SendTimeout: defaultEventHubsSendTimeout},
+		key:                    "a",
+		newBatch: func(context.Context) (eventDataBatch, error) {
+			return &mockEventDataBatch{max: max}, nil
+		},
+		send: func(_ context.Context, b eventDataBatch) error {
+			if *fail {
+				return errors.New("amqp: link detached")
+			}
+			sent = append(sent, b.(*mockEventDataBatch).events)
+			return nil
+		},
+	}
+	return w, &sent
+}
+
+func TestEventHubsWriterSplitsBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	fail := false
+	w, sent := makeTestEventHubsWriter(2, &fail)
+	b := &laozi.Batch{Events: [][]byte{[]byte("1\n"), []byte("2\n"), []byte("3\n")}, First: 1}
+
+	assert.NoError(w.write(b))
+	assert.Equal([][]string{{"1", "2"}, {"3"}}, *sent)
+}
+
+func TestEventHubsWriterDropsEventsTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	fail := false
+	w, sent := makeTestEventHubsWriter(2, &fail)
+	b := &laozi.Batch{Events: [][]byte{[]byte("1"), []byte("way too large"), []byte("3")}, First: 1}
+
+	assert.NoError(w.write(b))
+	assert.Equal([][]string{{"1"}, {"3"}}, *sent)
+	assert.Equal(2, len(b.Events))
+}
+
+func TestEventHubsWriterKeepsUnsentEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	fail := true
+	w, sent := makeTestEventHubsWriter(2, &fail)
+	b := &laozi.Batch{Events: [][]byte{[]byte("1"), []byte("2"), []byte("3")}, First: 1}
+
+	assert.Error(w.write(b))
+	assert.Equal(3, len(b.Events))
+
+	fail = false
+	assert.NoError(w.write(b))
+	assert.Equal([][]string{{"1", "2"}, {"3"}}, *sent)
+}
@@ -5,11 +5,12 @@ import (
 	"time"
 
 	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/s3"
 )
 
 func main() {
 	l := laozi.NewLaozi(&laozi.Config{
-		LoggerFactory: laozi.S3LoggerFactory{
+		LoggerFactory: s3.S3LoggerFactory{
 			Bucket: "laozi-test",
 			Region: "us-east-1",
 			Prefix: "events/", // optional
@@ -1,14 +1,6 @@
 package laozi
 
-import (
-	"bytes"
-	"fmt"
-	"time"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-)
+import "context"
 
 // LoggerFactory is an interface that defines how to make a new logger.
 // This Logger will be responsible for logging all events to it that match the same
@@ -17,40 +9,10 @@ type LoggerFactory interface {
 	NewLogger(key string) Logger
 }
 
-// S3LoggerFactory is a logger factory for creating loggers that log received events to S3.
-type S3LoggerFactory struct {
-	Prefix        string
-	Bucket        string
-	Region        string
-	FlushInterval time.Duration
-	Compression   string
-	IsDupeFunc    func(event []byte, line []byte) bool
-}
-
-// NewLogger return a new instance of an S3 Logger for a corresponding partition key.
-func (lf S3LoggerFactory) NewLogger(key string) Logger {
-	l := &s3logger{
-		bucket:        lf.Bucket,
-		key:           fmt.Sprintf("%s%s", lf.Prefix, key),
-		S3:            s3.New(session.New(), &aws.Config{Region: aws.String(lf.Region)}),
-		buffer:        bytes.NewBuffer([]byte{}),
-		active:        time.Now(),
-		logChan:       make(chan []byte),
-		quitChan:      make(chan struct{}),
-		compression:   lf.Compression,
-		flushInterval: lf.FlushInterval,
-	}
-
-	l.fetchPreviousData()
-
-	// added deduplication wrapper if function is specified
-	if lf.IsDupeFunc == nil {
-		go l.loop()
-		return l
-	} else {
-		dl := &dedupeS3Logger{l, lf.IsDupeFunc}
-		go dl.loop()
-		return dl
-	}
-
+// ContextLoggerFactory is implemented by logger factories able to fail making a logger, e.g.
+// when the previous state of its partition can't be loaded in time, see
+// Config.LoggerInitTimeout. The router then handles the events of the partition as set by
+// Config.NewLoggerFailure, instead of logging them to a logger missing data.
+type ContextLoggerFactory interface {
+	NewLoggerContext(ctx context.Context, key string) (Logger, error)
 }
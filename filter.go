@@ -0,0 +1,53 @@
+package laozi
+
+import (
+	"regexp"
+	"strings"
+)
+
+// KeyGlob compiles a glob pattern matching partition keys: "*" matches any characters but
+// slashes, "**" any characters, and "?" any single character but a slash.
+func KeyGlob(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// allowed reports whether events of the partition key are let through by the AllowKeys and
+// DenyKeys patterns.
+func (r *laozi) allowed(key string) bool {
+	if len(r.AllowKeys) > 0 && !matchAny(r.AllowKeys, key) {
+		return false
+	}
+	return !matchAny(r.DenyKeys, key)
+}
+
+// deny handles an event whose partition key is not allowed.
+func (r *laozi) deny(key string, e []byte) {
+	if r.DeniedFunc != nil {
+		r.DeniedFunc(key, e)
+	}
+}
+
+func matchAny(patterns []*regexp.Regexp, key string) bool {
+	for _, p := range patterns {
+		if p.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package laozi
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyGlob(t *testing.T) {
+	assert := assert.New(t)
+
+	g := KeyGlob("app/*/events")
+	assert.True(g.MatchString("app/a/events"))
+	assert.False(g.MatchString("app/a/b/events"))
+	assert.False(g.MatchString("app/a/events2"))
+
+	g = KeyGlob("app/**")
+	assert.True(g.MatchString("app/a/b"))
+	assert.False(g.MatchString("other/app/a"))
+
+	g = KeyGlob("v?.log")
+	assert.True(g.MatchString("v1.log"))
+	assert.False(g.MatchString("v1xlog"))
+}
+
+func TestRouterFiltersKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	var denied []string
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			AllowKeys:        []*regexp.Regexp{KeyGlob("app/**")},
+			DenyKeys:         []*regexp.Regexp{regexp.MustCompile("null")},
+			DeniedFunc: func(key string, e []byte) {
+				denied = append(denied, key)
+			},
+		},
+	}
+	go l.route()
+
+	l.EventChan <- []byte("app/a")
+	l.EventChan <- []byte("app/null")
+	l.EventChan <- []byte("other")
+	l.EventChan <- []byte("app/b")
+
+	l.awaitRouted(4)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(2, len(l.routingMap))
+	assert.Equal([]string{"app/null", "other"}, denied)
+}
@@ -0,0 +1,124 @@
+package laozi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Handoff describes the partitions of a router when it was closed, for a successor instance,
+// or the restarted process, to resume and reconcile them, e.g. during rolling deploys, see
+// Config.Handoff.
+type Handoff struct {
+	Host       string             `json:"host"`
+	Time       time.Time          `json:"time"`
+	Partitions []HandoffPartition `json:"partitions"`
+}
+
+// HandoffPartition is a partition closed by the router.
+type HandoffPartition struct {
+	Key string `json:"key"`
+	// Flushed is the sequence number of the last event persisted, and Logged of the last event
+	// logged, if the logger is a SequenceLogger.
+	Flushed int64 `json:"flushed"`
+	Logged  int64 `json:"logged"`
+	// Error is the error of the logger failing to flush on Close.
+	Error string `json:"error,omitempty"`
+}
+
+// Unflushed reports whether events of the partition may not have been persisted.
+func (p HandoffPartition) Unflushed() bool {
+	return p.Error != "" || p.Logged > p.Flushed
+}
+
+// Unflushed returns the partitions whose events may not have been persisted.
+func (h Handoff) Unflushed() []HandoffPartition {
+	var unflushed []HandoffPartition
+	for _, p := range h.Partitions {
+		if p.Unflushed() {
+			unflushed = append(unflushed, p)
+		}
+	}
+	return unflushed
+}
+
+// SequenceLogger is implemented by loggers numbering the events of their partition, for the
+// Handoff to tell how far they got.
+type SequenceLogger interface {
+	Logger
+	// Sequences returns the sequence numbers of the last events persisted and logged. It is
+	// only called once Close returned.
+	Sequences() (flushed, logged int64)
+}
+
+// HandoffStore defines where the Handoff of a router is kept for its successor.
+type HandoffStore interface {
+	// WriteHandoff records a handoff, replacing the previous one.
+	WriteHandoff(Handoff) error
+	// ReadHandoff returns the handoff written last. If none exists, found is false.
+	ReadHandoff() (h Handoff, found bool, err error)
+}
+
+// handoffPartition describes a partition whose logger was closed with err.
+func handoffPartition(key string, l Logger, err error) HandoffPartition {
+	p := HandoffPartition{Key: key}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	unwrap(l, func(l Logger) bool {
+		sl, ok := l.(SequenceLogger)
+		if ok {
+			p.Flushed, p.Logged = sl.Sequences()
+		}
+		return ok
+	})
+	return p
+}
+
+// writeHandoff writes the handoff of the partitions closed, if the router has a HandoffStore.
+func (r *laozi) writeHandoff(partitions []HandoffPartition) {
+	if r.Config == nil || r.Handoff == nil {
+		return
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Key < partitions[j].Key })
+	h := Handoff{Host: hostname(), Time: time.Now().UTC(), Partitions: partitions}
+	if err := r.Handoff.WriteHandoff(h); err != nil {
+		r.handleError(fmt.Errorf("could not write handoff: %s", err))
+	}
+}
+
+// HandoffFile is a HandoffStore writing the handoff to a JSON file of this path on local disk.
+// It is written under a temporary name and renamed once complete.
+type HandoffFile string
+
+// WriteHandoff writes the handoff to the file, creating its directory if need be.
+func (f HandoffFile) WriteHandoff(h Handoff) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(string(f)), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(string(f)+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(string(f)+".tmp", string(f))
+}
+
+// ReadHandoff reads the handoff of the file, if it exists.
+func (f HandoffFile) ReadHandoff() (Handoff, bool, error) {
+	var h Handoff
+	data, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return h, false, nil
+	}
+	if err != nil {
+		return h, false, err
+	}
+	return h, true, json.Unmarshal(data, &h)
+}
@@ -0,0 +1,19 @@
+package laozi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandoffPartitionsOfFlushedLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	bl := NewBatchLogger("b", func(*Batch) error { return nil }, 0, 0, 4)
+	bl.add([]byte("c"))
+	assert.Equal(HandoffPartition{Key: "b", Flushed: 4, Logged: 5}, handoffPartition("b", bl, nil))
+	assert.True(handoffPartition("b", bl, nil).Unflushed())
+	assert.NoError(bl.flush())
+	assert.False(handoffPartition("b", bl, nil).Unflushed())
+	assert.False(handoffPartition("c", &MockLogger{}, nil).Unflushed())
+}
@@ -0,0 +1,53 @@
+package laozi
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// IDGenerator generates unique components of object keys, see
+// s3.S3LoggerFactory.KeyIDGenerator. IDs sorting like their times make listing order match time
+// order, like NewULID and NewUUIDv7.
+type IDGenerator interface {
+	NewID(t time.Time) string
+}
+
+// IDGeneratorFunc is an IDGenerator function.
+type IDGeneratorFunc func(t time.Time) string
+
+// NewID calls f.
+func (f IDGeneratorFunc) NewID(t time.Time) string {
+	return f(t)
+}
+
+// crockford is the base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID of time t: 26 characters sorting by time, to the millisecond.
+func NewULID(t time.Time) string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(t.UnixNano()/int64(time.Millisecond))<<16)
+	rand.Read(id[6:])
+
+	// 128 bits as 26 characters of 5 bits, the first holding only 3
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
+
+// NewUUIDv7 returns a version 7 UUID of time t, sorting by time to the millisecond.
+func NewUUIDv7(t time.Time) string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(t.UnixNano()/int64(time.Millisecond))<<16)
+	rand.Read(id[6:])
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
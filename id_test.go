@@ -0,0 +1,25 @@
+package laozi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDsSortByTime(t *testing.T) {
+	assert := assert.New(t)
+
+	t1 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Millisecond)
+
+	u1, u2 := NewULID(t1), NewULID(t2)
+	assert.Len(u1, 26)
+	assert.True(u1 < u2)
+	assert.NotEqual(u1, NewULID(t1))
+
+	v1, v2 := NewUUIDv7(t1), NewUUIDv7(t2)
+	assert.Len(v1, 36)
+	assert.Equal(byte('7'), v1[14])
+	assert.True(v1 < v2)
+}
@@ -0,0 +1,51 @@
+// Package laozitest provides a router recording the events logged to it, for the tests of the
+// sources feeding laozi routers.
+package laozitest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// Router is a laozi.Laozi recording the events logged to it. The zero value is ready to use.
+type Router struct {
+	laozi.MockLaozi
+
+	lock   sync.Mutex
+	events []string
+	next   int
+}
+
+func (r *Router) Log(e []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, string(e))
+}
+
+// Logged returns the events logged so far.
+func (r *Router) Logged() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// Next returns the event logged after the one Next last returned, failing the test if none is
+// logged within a second.
+func (r *Router) Next(t *testing.T) []byte {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		r.lock.Lock()
+		if r.next < len(r.events) {
+			e := r.events[r.next]
+			r.next++
+			r.lock.Unlock()
+			return []byte(e)
+		}
+		r.lock.Unlock()
+	}
+	t.Fatal("no event logged")
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package rotating names the objects of rotating sinks, one per batch of events of a
+// partition, and writes them to remote file systems.
+package rotating
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+)
+
+// WindowFormat formats the rotation windows in object names.
+const WindowFormat = "20060102T150405Z"
+
+// IDSeparator separates the generated id of a rotated object name from its sequence range.
+const IDSeparator = "_"
+
+// Name names the object of a range of events of a partition, for any rotating sink.
+func Name(base string, start time.Time, rotation time.Duration, first, last int64) string {
+	return fmt.Sprintf("%s/%s", Window(base, start, rotation), SequenceRange(first, last))
+}
+
+// Window names the rotation window of the objects of a partition started at t.
+func Window(base string, t time.Time, rotation time.Duration) string {
+	return fmt.Sprintf("%s/%s", base, t.UTC().Truncate(rotation).Format(WindowFormat))
+}
+
+// SequenceRange names a range of sequence numbers.
+func SequenceRange(first, last int64) string {
+	return fmt.Sprintf("%020d-%020d", first, last)
+}
+
+// ParseSequenceRange returns the last sequence of a rotated object name.
+func ParseSequenceRange(key string) (int64, bool) {
+	var first, last int64
+	name := key[strings.LastIndex(key, "/")+1:]
+	name = name[strings.LastIndex(name, IDSeparator)+1:]
+	if _, err := fmt.Sscanf(name, "%020d-%020d", &first, &last); err != nil {
+		return 0, false
+	}
+	return last, true
+}
+
+// FS is a file system rotating file sinks upload to.
+type FS interface {
+	Exists(name string) (bool, error)
+	// WriteFile creates a file, and its parent directories if need be.
+	WriteFile(name string, data []byte) error
+	Rename(from, to string) error
+	ReadFile(name string) ([]byte, error)
+	// List returns the names of the files in a directory, or none if it doesn't exist.
+	List(dir string) ([]string, error)
+}
+
+// Writer uploads every batch of a partition as a new file, named like rotated S3 objects.
+// Files are written under a temporary name and renamed once complete, so readers never see
+// partial files.
+type Writer struct {
+	FS          FS
+	Name        string
+	Rotation    time.Duration
+	Compression string
+}
+
+// Write uploads a batch, unless a previous attempt did. It fails with *ErrConcurrentWrite if
+// the file of the batch exists but holds other events.
+func (w *Writer) Write(b *laozi.Batch) error {
+	name := Name(w.Name, b.Start, w.Rotation, b.First, b.Last())
+	exists, err := w.FS.Exists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		// a previous attempt got as far as renaming the file, if it holds the same events
+		return w.checkWritten(name, b.Bytes())
+	}
+
+	tmp := name + ".tmp"
+	if err = w.FS.WriteFile(tmp, compress.Compress(w.Compression, b.Bytes())); err != nil {
+		return err
+	}
+	return w.FS.Rename(tmp, name)
+}
+
+// checkWritten returns nil if the file name holds events, or *ErrConcurrentWrite if it holds
+// other events.
+func (w *Writer) checkWritten(name string, events []byte) error {
+	data, err := w.FS.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	switch w.Compression {
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return err
+		}
+	case "zstd":
+		if data, err = compress.DecompressZstd(data, nil); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(data, events) {
+		return &laozi.ErrConcurrentWrite{Key: name}
+	}
+	return nil
+}
+
+// ResumeSequence continues the sequence of the files already uploaded in the current window,
+// so a restarted logger doesn't reuse their names.
+func (w *Writer) ResumeSequence() (int64, error) {
+	names, err := w.FS.List(Window(w.Name, time.Now(), w.Rotation))
+	if err != nil {
+		return 0, err
+	}
+
+	var sequence int64
+	for _, n := range names {
+		if seq, ok := ParseSequenceRange(n); ok && seq > sequence {
+			sequence = seq
+		}
+	}
+	return sequence, nil
+}
+
+// Start starts a BatchLogger writing the batches of a partition, continuing the sequence of
+// the files already uploaded. It fails if they can't be listed.
+func (w *Writer) Start(key string, flushInterval time.Duration) (*laozi.BatchLogger, error) {
+	sequence, err := w.ResumeSequence()
+	if err != nil {
+		return nil, err
+	}
+	return laozi.NewBatchLogger(key, w.Write, flushInterval, 0, sequence), nil
+}
+
+// NewLogger is Start for factories that can't fail making a logger: if the files already
+// uploaded can't be listed, the writes of the logger fail with the error rather than reuse
+// their names.
+func (w *Writer) NewLogger(key string, flushInterval time.Duration) *laozi.BatchLogger {
+	l, err := w.Start(key, flushInterval)
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not resume sequence, flushes will fail: %s: %s\n", key, err)
+		return laozi.NewBatchLogger(key, func(*laozi.Batch) error { return err }, flushInterval, 0, 0)
+	}
+	return l
+}
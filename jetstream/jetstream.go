@@ -0,0 +1,89 @@
+// Package jetstream publishes the events of a laozi router to NATS JetStream.
+package jetstream
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const (
+	defaultJetStreamBatchSize  = 1000
+	defaultJetStreamAckTimeout = 30 * time.Second
+)
+
+// JetStreamLoggerFactory is a logger factory for creating loggers that publish received events
+// to NATS JetStream, bridging in-process events into a NATS based pipeline. A flush succeeds
+// once every event of the batch is acknowledged by the stream. Events carry a message id so
+// the stream discards the duplicates of a retried batch within its duplicate window.
+type JetStreamLoggerFactory struct {
+	JetStream nats.JetStream
+	// SubjectPrefix prefixes the default subjects, <SubjectPrefix><key> with slashes turned
+	// into dots.
+	SubjectPrefix string
+	// SubjectFunc optionally maps partition keys to subjects.
+	SubjectFunc   func(key string) string
+	FlushInterval time.Duration
+	// BatchSize is the max number of events published before waiting for acks, defaults to 1000.
+	BatchSize int
+	// AckTimeout is how long to wait for the acks of a batch, defaults to 30 seconds.
+	AckTimeout time.Duration
+}
+
+// NewLogger returns a new instance of a JetStream logger for a corresponding partition key.
+func (lf JetStreamLoggerFactory) NewLogger(key string) laozi.Logger {
+	w := &jetStreamWriter{
+		JetStreamLoggerFactory: lf,
+		subject:                lf.SubjectPrefix + strings.Replace(key, "/", ".", -1),
+		// tells the events of this logger apart from the ones of earlier loggers of the key
+		idPrefix: fmt.Sprintf("%s-%d", key, time.Now().UnixNano()),
+	}
+	if lf.SubjectFunc != nil {
+		w.subject = lf.SubjectFunc(key)
+	}
+	if w.BatchSize <= 0 {
+		w.BatchSize = defaultJetStreamBatchSize
+	}
+	if w.AckTimeout <= 0 {
+		w.AckTimeout = defaultJetStreamAckTimeout
+	}
+
+	return laozi.NewBatchLogger(key, w.write, lf.FlushInterval, w.BatchSize, 0)
+}
+
+type jetStreamWriter struct {
+	JetStreamLoggerFactory
+	subject  string
+	idPrefix string
+}
+
+func (w *jetStreamWriter) write(b *laozi.Batch) error {
+	futures := make([]nats.PubAckFuture, 0, len(b.Events))
+	for i, e := range b.Events {
+		msg := nats.NewMsg(w.subject)
+		msg.Data = bytes.TrimRight(e, "\r\n")
+		msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s-%d", w.idPrefix, b.First+int64(i)))
+
+		f, err := w.JetStream.PublishMsgAsync(msg)
+		if err != nil {
+			return err
+		}
+		futures = append(futures, f)
+	}
+
+	timeout := time.After(w.AckTimeout)
+	for _, f := range futures {
+		select {
+		case <-f.Ok():
+		case err := <-f.Err():
+			return fmt.Errorf("could not publish to %s: %s", w.subject, err)
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for acks from %s", w.subject)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package jetstream
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPubAckFuture struct {
+	msg *nats.Msg
+	ok  chan *nats.PubAck
+	err chan error
+}
+
+func (f *mockPubAckFuture) Ok() <-chan *nats.PubAck { return f.ok }
+func (f *mockPubAckFuture) Err() <-chan error       { return f.err }
+func (f *mockPubAckFuture) Msg() *nats.Msg          { return f.msg }
+
+// mockJetStream acks every message unless it has an error to fail them with.
+type mockJetStream struct {
+	nats.JetStream
+	sync.Mutex
+	msgs []*nats.Msg
+	err  error
+}
+
+func (m *mockJetStream) PublishMsgAsync(msg *nats.Msg, opts ...nats.PubOpt) (nats.PubAckFuture, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	f := &mockPubAckFuture{msg: msg, ok: make(chan *nats.PubAck, 1), err: make(chan error, 1)}
+	if m.err != nil {
+		f.err <- m.err
+		return f, nil
+	}
+	m.msgs = append(m.msgs, msg)
+	f.ok <- &nats.PubAck{Stream: "EVENTS"}
+	return f, nil
+}
+
+func TestJetStreamLoggerPublishesEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	js := &mockJetStream{}
+	lf := JetStreamLoggerFactory{JetStream: js, SubjectPrefix: "events."}
+	l := lf.NewLogger("app/a")
+	assert.Implements((*laozi.Logger)(nil), l)
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal(2, len(js.msgs))
+	assert.Equal("events.app.a", js.msgs[0].Subject)
+	assert.Equal([]byte("1"), js.msgs[0].Data)
+	assert.NotEqual(js.msgs[0].Header.Get(nats.MsgIdHdr), js.msgs[1].Header.Get(nats.MsgIdHdr))
+}
+
+func TestJetStreamWriterKeepsMessageIDsOnRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	js := &mockJetStream{err: errors.New("nats: no response from stream")}
+	w := &jetStreamWriter{
+		JetStreamLoggerFactory: JetStreamLoggerFactory{JetStream: js, AckTimeout: defaultJetStreamAckTimeout},
+		subject:                "events.a",
+		idPrefix:               "a-1",
+	}
+	b := &laozi.Batch{Events: [][]byte{[]byte("1")}, First: 7}
+
+	assert.Error(w.write(b))
+
+	js.err = nil
+	assert.NoError(w.write(b))
+	assert.Equal("a-1-7", js.msgs[0].Header.Get(nats.MsgIdHdr))
+}
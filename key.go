@@ -0,0 +1,58 @@
+package laozi
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// maxPartitionKeyLength leaves room for the factory prefix and rotated object names within
+// the 1024 byte limit of S3 keys.
+const maxPartitionKeyLength = 900
+
+// SanitizeKey is the default KeySanitizer. It lowercases the key and replaces every character
+// that isn't safe in S3 keys by an underscore, keeping "=" and ":", so Hive style partitions
+// like "dt=2024-01-01/" and timestamps are kept as is. Keys whose characters were replaced are
+// suffixed by a hash of the key, so keys only differing by those stay distinct, e.g. "a?b" and
+// "a b". Slashes are kept as path separators, but empty, "." and ".." path segments are
+// removed. Keys that are too long are truncated and suffixed by a hash of the key too.
+func SanitizeKey(key string) string {
+	return sanitizeKey(strings.ToLower(key))
+}
+
+// SanitizeKeyPreservingCase is a KeySanitizer like SanitizeKey, but keeping the case of
+// letters.
+func SanitizeKeyPreservingCase(key string) string {
+	return sanitizeKey(key)
+}
+
+func sanitizeKey(key string) string {
+	replaced := false
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("/!-_.*'()=:", r):
+			return r
+		}
+		replaced = true
+		return '_'
+	}, key)
+
+	var segments []string
+	for _, s := range strings.Split(safe, "/") {
+		if s != "" && s != "." && s != ".." {
+			segments = append(segments, s)
+		}
+	}
+	safe = strings.Join(segments, "/")
+
+	if replaced || len(safe) > maxPartitionKeyLength {
+		hash := fmt.Sprintf("-%x", sha1.Sum([]byte(key)))[:9]
+		if len(safe) > maxPartitionKeyLength-len(hash) {
+			safe = safe[:maxPartitionKeyLength-len(hash)]
+		}
+		safe += hash
+	}
+	return safe
+}
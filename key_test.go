@@ -0,0 +1,137 @@
+package laozi
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeKey(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("event-file.csv.gz", SanitizeKey("event-file.csv.gz"))
+	assert.Equal("2016/01/02/events", SanitizeKey("2016/01/02/events"))
+	assert.Equal("my_events/caf_-d0fc69af", SanitizeKey("My Events/Café"))
+	assert.Equal("events/dt=2024-01-01/hour=10:00", SanitizeKey("events/dt=2024-01-01/hour=10:00"))
+	assert.Equal("events/a", SanitizeKey("Events/A"))
+	assert.Equal("a/b/c", SanitizeKey("/a//b/./../c/"))
+	assert.Equal("", SanitizeKey("//"))
+
+	// keys only differing by the characters replaced stay distinct
+	assert.Equal("a_b_c-f2a42846", SanitizeKey("a?b#c"))
+	assert.Equal("a_b_c-6b3f339c", SanitizeKey("a b c"))
+	assert.Equal("a_b_c", SanitizeKey("a_b_c"))
+}
+
+func TestSanitizeKeyPreservingCase(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("Events/A", SanitizeKeyPreservingCase("Events/A"))
+	assert.Equal("My_Events/Caf_-22c32ef2", SanitizeKeyPreservingCase("My Events/Café"))
+}
+
+func TestSanitizeKeyLimitsLength(t *testing.T) {
+	assert := assert.New(t)
+
+	long1 := SanitizeKey(strings.Repeat("a", 2000) + "1")
+	long2 := SanitizeKey(strings.Repeat("a", 2000) + "2")
+
+	assert.Equal(maxPartitionKeyLength, len(long1))
+	assert.Equal(maxPartitionKeyLength, len(long2))
+	assert.NotEqual(long1, long2)
+}
+
+func TestRouterSanitizesKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			KeySanitizer:     SanitizeKey,
+		},
+	}
+	go l.route()
+
+	l.EventChan <- []byte("/a/")
+	l.EventChan <- []byte("a")
+	l.EventChan <- []byte("//")
+	l.EventChan <- []byte("b")
+
+	l.awaitRouted(4)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(2, len(l.routingMap))
+	assert.NotNil(l.routingMap["a"])
+}
+
+func FuzzSanitizeKey(f *testing.F) {
+	f.Add("2016/01/02/events")
+	f.Add("My Events/Café")
+	f.Add("/a//b/./../c/")
+	f.Add("a\x00b\xffc")
+	f.Add(strings.Repeat("é", 1000))
+	f.Fuzz(func(t *testing.T, key string) {
+		safe := SanitizeKey(key)
+		if len(safe) > maxPartitionKeyLength {
+			t.Fatalf("key of %d bytes", len(safe))
+		}
+		for i := 0; i < len(safe); i++ {
+			if c := safe[i]; !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("/!-_.*'()=:", c) >= 0) {
+				t.Fatalf("unsafe byte %q in %q", c, safe)
+			}
+		}
+		if safe != "" {
+			for _, segment := range strings.Split(safe, "/") {
+				if segment == "" || segment == "." || segment == ".." {
+					t.Fatalf("segment %q in %q", segment, safe)
+				}
+			}
+		}
+		if again := SanitizeKey(safe); again != safe {
+			t.Fatalf("%q sanitized again to %q", safe, again)
+		}
+	})
+}
+
+func FuzzRouterKeys(f *testing.F) {
+	f.Add([]byte("a/b\n"))
+	f.Add([]byte("//"))
+	f.Add([]byte("\x00\xff/\xc3\x28"))
+	f.Add([]byte(strings.Repeat("../", 500)))
+	f.Fuzz(func(t *testing.T, e []byte) {
+		l := &laozi{
+			routingMap: map[string]Logger{},
+			Config: &Config{
+				LoggerFactory:    &MockLoggerFactory{},
+				PartitionKeyFunc: MockPartitionFunc,
+				KeySanitizer:     SanitizeKey,
+			},
+		}
+		key := SanitizeKey(string(e))
+		err := l.routeOne(e)
+		if key == "" {
+			if !errors.Is(err, ErrPartitionKey) {
+				t.Fatalf("event %q routed: %v", e, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("event %q: %s", e, err)
+		}
+		if len(l.routingMap) != 1 || l.routingMap[key] == nil {
+			t.Fatalf("event %q routed to %v", e, l.routingMap)
+		}
+		if got := l.routingMap[key].(*MockLogger).bytes; !bytes.Equal(e, got) {
+			t.Fatalf("event %q logged as %q", e, got)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package laozi
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyCache is an LRU cache of the partition keys of events, so an expensive PartitionKeyFunc,
+// e.g. parsing JSON, isn't evaluated again for events it already saw, see Config.KeyCache.
+// Events are cached by their fingerprint, or by what CacheKeyFunc returns. Errors aren't
+// cached. It is safe for concurrent use.
+type KeyCache struct {
+	// Size is the max number of keys cached.
+	Size int
+	// CacheKeyFunc optionally returns what identifies the partition key of an event, e.g. the
+	// prefix holding its key, so events differing elsewhere share an entry.
+	CacheKeyFunc func([]byte) string
+	// Hits and Misses count lookups, read them with HitRate or atomically.
+	Hits   int64
+	Misses int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type keyCacheEntry struct {
+	id, key string
+}
+
+// NewKeyCache returns a cache of up to size partition keys.
+func NewKeyCache(size int) *KeyCache {
+	return &KeyCache{Size: size}
+}
+
+// HitRate returns the share of lookups that were found in the cache.
+func (c *KeyCache) HitRate() float64 {
+	hits, misses := atomic.LoadInt64(&c.Hits), atomic.LoadInt64(&c.Misses)
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// partitionKey returns the cached partition key of an event, calling keyFunc if need be.
+func (c *KeyCache) partitionKey(e []byte, keyFunc func([]byte) (string, error)) (string, error) {
+	id := c.id(e)
+
+	c.mu.Lock()
+	if el, ok := c.entries[id]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		atomic.AddInt64(&c.Hits, 1)
+		return el.Value.(*keyCacheEntry).key, nil
+	}
+	c.mu.Unlock()
+	atomic.AddInt64(&c.Misses, 1)
+
+	key, err := keyFunc(e)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+		c.order = list.New()
+	}
+	if _, ok := c.entries[id]; !ok {
+		c.entries[id] = c.order.PushFront(&keyCacheEntry{id, key})
+	}
+	for c.order.Len() > c.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*keyCacheEntry).id)
+	}
+	return key, nil
+}
+
+func (c *KeyCache) id(e []byte) string {
+	if c.CacheKeyFunc != nil {
+		return c.CacheKeyFunc(e)
+	}
+	sum := sha256.Sum256(e)
+	return string(sum[:])
+}
@@ -0,0 +1,59 @@
+package laozi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyCacheCachesKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	keyFunc := func(e []byte) (string, error) {
+		calls++
+		return string(e[:1]), nil
+	}
+	c := NewKeyCache(2)
+
+	for _, e := range []string{"a1", "b1", "a1", "c1", "a1", "b1"} {
+		key, err := c.partitionKey([]byte(e), keyFunc)
+		assert.NoError(err)
+		assert.Equal(e[:1], key)
+	}
+
+	// b1 was evicted by c1, being the least recently used
+	assert.Equal(4, calls)
+	assert.Equal(int64(2), c.Hits)
+	assert.Equal(int64(4), c.Misses)
+	assert.Equal(1.0/3, c.HitRate())
+}
+
+func TestKeyCacheUsesCacheKeyFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	keyFunc := func(e []byte) (string, error) {
+		calls++
+		return string(e[:1]), nil
+	}
+	c := &KeyCache{Size: 10, CacheKeyFunc: func(e []byte) string { return string(e[:1]) }}
+
+	c.partitionKey([]byte("a1"), keyFunc)
+	c.partitionKey([]byte("a2"), keyFunc)
+	assert.Equal(1, calls)
+}
+
+func TestKeyCacheDoesNotCacheErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewKeyCache(10)
+	keyFunc := func(e []byte) (string, error) { return "", errors.New("bad event") }
+
+	_, err := c.partitionKey([]byte("a"), keyFunc)
+	assert.Error(err)
+	_, err = c.partitionKey([]byte("a"), keyFunc)
+	assert.Error(err)
+	assert.Equal(int64(0), c.Hits)
+}
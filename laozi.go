@@ -4,9 +4,15 @@
 package laozi
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"regexp"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,13 +21,99 @@ import (
 // It is named after one of the most famous archivists in the world, https://en.wikipedia.org/wiki/Laozi
 type Laozi interface {
 	Log([]byte)
+	// TryLog is like Log but returns ErrChannelFull instead of blocking when the event
+	// channel is full, and ErrClosed once closed.
+	TryLog([]byte) error
 	Close()
+	Pause()
+	Resume()
+	LogSync(ctx context.Context, e []byte) error
+	CloseWithTimeout(d time.Duration) []UnpersistedPartition
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader) error
+	Reports() <-chan DeliveryReport
+	LogWithPriority(e []byte, p Priority)
+	DumpState(w io.Writer) error
+	// Flush flushes the logger of a partition key now, if it is a FlushingLogger, and Evict
+	// closes it, e.g. from the AdminServer. They return ErrUnknownPartition if the key has no
+	// logger.
+	Flush(key string) error
+	Evict(key string) error
+	LogReader(key string, r io.Reader) error
+	ProcessOne(e []byte) error
+	WorkerFor(key string) int
+	// LogSequenced logs an event of a source partition at its sequence there, and
+	// CommittableWatermark returns the sequence of the source partition up to which events
+	// are persisted, for sources to commit their offsets, e.g. of Kafka or Kinesis.
+	LogSequenced(partition string, seq Sequence, e []byte) error
+	CommittableWatermark(partition string) Sequence
 }
 
 type laozi struct {
 	sync.RWMutex
 	EventChan  chan []byte
 	routingMap map[string]Logger
+	// partitions recently found to be owned by another instance
+	notOwned map[string]bool
+	// timed out loggers being closed
+	closing map[string]*closingLogger
+	// resumeChan is closed on Resume, it is nil when not paused
+	pauseLock  sync.Mutex
+	resumeChan chan struct{}
+	// last time timed out loggers were closed in SyncMode
+	expired time.Time
+	// closed is set to 1 by Close, CloseWithTimeout or Snapshot
+	closed int32
+	// stop is closed by Snapshot to stop routing, and routeDone once route returned, leaving
+	// the events it was holding in unrouted
+	stop      chan struct{}
+	routeDone chan struct{}
+	unrouted  [][]byte
+	reports   chan DeliveryReport
+	// closeDone is closed once Close, CloseWithTimeout or Snapshot returns
+	closeDone   chan struct{}
+	closeReport closeReport
+	// priorityChan queues the events logged with PriorityHigh
+	priorityChan chan []byte
+	// queue holds the events before the EventChan if EventQueueBytes is set, pumpDone is
+	// closed once pump returned, leaving the event it was holding in pumped
+	queue    *elasticQueue
+	pumpDone chan struct{}
+	pumped   []byte
+	// aboveWatermark is set to 1 once the HighWatermark was reached, until the LowWatermark is
+	aboveWatermark int32
+	// host is the hostname recorded in event envelopes
+	host string
+	// volumes of the partition keys since volumeStart, to split them
+	splitLock   sync.Mutex
+	volumes     map[string]*partitionVolume
+	volumeStart time.Time
+	// lastProgress is the routeProgress of the router, for the watchdog
+	lastProgress atomic.Value
+	// last time the partition keys were routed, to count them, and whether they exceeded the
+	// CardinalityThreshold
+	keysLock        sync.Mutex
+	keysSeen        map[string]time.Time
+	keysPruned      time.Time
+	highCardinality bool
+	// workers deliver the events of the keys they are assigned, pinned ones at the index of
+	// their worker, see Config.RouterConcurrency
+	workers     []chan routedEvents
+	workersDone sync.WaitGroup
+	pinned      map[string]int
+	// held are the events of the partitions whose logger failed to be made, with
+	// NewLoggerFailureHold
+	held map[string]*heldEvents
+	// sequenced is the number of events queued with StrictOrdering, while holding orderLock
+	// for reading, and routedEvents the number route is done with
+	orderLock    sync.RWMutex
+	sequenced    int64
+	routedEvents int64
+	// commits tracks the events logged with LogSequenced, with StrictOrdering
+	commits *commitTracker
+	// partitioner and delivery are the partition and delivery stages, if wrapped
+	partitioner Partitioner
+	delivery    Delivery
 	*Config
 }
 
@@ -30,7 +122,160 @@ type Config struct {
 	LoggerFactory    LoggerFactory
 	LoggerTimeout    time.Duration
 	PartitionKeyFunc func([]byte) (string, error)
+	// KeySanitizer cleans up the keys returned by the PartitionKeyFunc, defaults to SanitizeKey.
+	// Events with an empty sanitized key are skipped.
+	KeySanitizer func(string) string
+	// KeyRewriter optionally rewrites the keys returned by the PartitionKeyFunc, and those of
+	// LogReader, before they are sanitized, by rules that can be reloaded from a file while
+	// the router runs, see LoadKeyRewriter.
+	KeyRewriter *KeyRewriter
+	// SamplingFunc optionally decides which events are archived, see SampleKeys. Loggers
+	// implementing SamplingRecorder are told how many events of their partition were dropped.
+	SamplingFunc     func(key string, e []byte) bool
 	EventChannelSize int
+	// PartitionLocker optionally coordinates partition ownership between laozi instances.
+	// Events of partitions that could not be locked are handled like those whose logger could
+	// not be made, see NewLoggerFailure.
+	PartitionLocker PartitionLocker
+	// NotOwnedFunc is called with events of partitions owned by another instance, e.g. to
+	// forward them. If not set, these events are dropped, except those detached from the
+	// logger of a partition lost to another instance, which are reported in an *ErrNotOwned.
+	NotOwnedFunc func(key string, e []byte)
+	// CloseJitter is the max random delay before a timed out logger is closed, and
+	// CloseConcurrency the max number of loggers closing at once (defaults to 8, 1 closes them
+	// one at a time). They spread the flushes of loggers timing out together, e.g. after a
+	// traffic burst ends.
+	CloseJitter      time.Duration
+	CloseConcurrency int
+	// SyncMode routes and flushes events within the goroutine calling LogSync, and runs no
+	// background goroutines, e.g. for AWS Lambda where they are frozen between invocations.
+	// The LoggerFactory must implement SyncLoggerFactory. Log calls LogSync, handling errors with the
+	// ErrorHandler.
+	SyncMode bool
+	// AllowKeys, if set, restricts archiving to events whose partition key matches one of the
+	// patterns, and events whose key matches one of DenyKeys are never archived, e.g. to keep
+	// garbage keys from flooding the routing map. Patterns can be made with KeyGlob. Denied
+	// events are passed to DeniedFunc if set, e.g. to send them to a dead letter queue, or
+	// dropped.
+	AllowKeys  []*regexp.Regexp
+	DenyKeys   []*regexp.Regexp
+	DeniedFunc func(key string, e []byte)
+	// RouteBatchSize, if more than 1, makes the router coalesce up to this many consecutive
+	// events of a partition into a single LogBatch call, for loggers implementing LogBatcher.
+	// RouteBatchDelay is how long to wait for more events of the partition; by default only
+	// the events already waiting in the event channel are coalesced.
+	RouteBatchSize  int
+	RouteBatchDelay time.Duration
+	// ErrorHandler is called with the errors of events that could not be routed, and of
+	// loggers that could not be closed, see ErrPartitionKey, ErrClosed and ErrFlushFailed. If
+	// not set, errors are printed.
+	ErrorHandler func(error)
+	// ReportChannelSize is the capacity of the Reports channel, defaults to 100.
+	ReportChannelSize int
+	// KeyCache optionally caches the keys returned by the PartitionKeyFunc.
+	KeyCache *KeyCache
+	// PriorityChannelSize is the size of the channel of events logged with PriorityHigh,
+	// defaults to EventChannelSize.
+	PriorityChannelSize int
+	// EventQueueBytes, if set, queues events in an elastic queue bounded by their total size
+	// instead of their number, so bursts of tiny events and the odd huge event both fit without
+	// tuning EventChannelSize, which then only sizes the channel between the queue and the
+	// router.
+	EventQueueBytes int64
+	// HighWatermark and LowWatermark are fractions of the capacity of the event channel, or of
+	// EventQueueBytes. OnHighWatermark is called with the utilization once it rises to the
+	// HighWatermark, and OnLowWatermark once it then falls to the LowWatermark, e.g. for
+	// producers to shed load or alert before Log blocks.
+	HighWatermark   float64
+	LowWatermark    float64
+	OnHighWatermark func(utilization float64)
+	OnLowWatermark  func(utilization float64)
+	// KeyAliasFunc optionally maps sanitized partition keys to the key of the logger their events
+	// are logged to, so several keys share a logger and its objects, e.g. ShardKeys collapsing
+	// per-user keys into a fixed number of shards. Filtering and sampling apply to aliases.
+	KeyAliasFunc func(key string) string
+	// Envelope wraps every event in a JSON record of when it was routed, by which host and
+	// version of laozi, and its partition key, so archives are self-describing, see
+	// EventEnvelope. Filtering, sampling and NotOwnedFunc see the events as logged.
+	Envelope bool
+	// SplitBytes, if set, splits a partition key once the events routed to it within a
+	// SplitInterval (defaults to a minute) exceed that many bytes, so one pathological key
+	// doesn't dominate a logger: its next events go to SplitShards (defaults to 4) sub-partitions
+	// key/shard-0, key/shard-1... by a hash of the events. Keys stay split until the router is
+	// closed, and are passed to OnSplit and listed by DumpState. Events logged with LogReader
+	// aren't split.
+	SplitBytes    int64
+	SplitInterval time.Duration
+	SplitShards   int
+	OnSplit       func(key string, shards int)
+	// LoggerInitTimeout bounds the making of loggers by a ContextLoggerFactory, e.g. the
+	// fetching of the previous data of S3 loggers. It is unbounded by default.
+	LoggerInitTimeout time.Duration
+	// StallTimeout, if set, makes a watchdog report an *ErrStalled to the ErrorHandler when the
+	// router routed no event for that long while events are waiting, e.g. because a logger
+	// blocks, so stalls are observable.
+	StallTimeout time.Duration
+	// CardinalityThreshold, if set, makes the router count the distinct partition keys routed
+	// within the last CardinalityWindow (defaults to a minute), approximately, and call
+	// OnHighCardinality with their count and some of them once it exceeds the threshold, e.g.
+	// when a request id is used as partition key by mistake, before the loggers exhaust memory.
+	// It is called again once the count fell to the threshold and exceeds it again. If not set,
+	// a warning is printed. The count is listed by DumpState.
+	CardinalityThreshold int
+	CardinalityWindow    time.Duration
+	OnHighCardinality    func(keys int, sample []string)
+	// Embedded makes the router run no goroutines of its own, for frameworks with their own
+	// event loops or deterministic simulations to drive it: events are routed within the
+	// goroutine calling ProcessOne, which also closes timed out loggers, and Log calls it,
+	// handling errors with the ErrorHandler. Loggers may still run their own goroutines.
+	Embedded bool
+	// RouterConcurrency, if more than 1, makes the router hand the events to that many workers
+	// delivering them to the loggers, by a hash of their partition key, so a logger that is
+	// slow to log to only holds up the keys of its worker, until EventChannelSize events wait
+	// for it. The events of a key are still delivered in order. PinnedKeys are delivered by
+	// dedicated workers of their own, e.g. for known heavy partitions not to starve the others.
+	// WorkerFor tells the worker of a key. Callbacks may be called concurrently by workers.
+	// Ignored in SyncMode and Embedded.
+	RouterConcurrency int
+	PinnedKeys        []string
+	// Handoff, if set, is written the partitions of the loggers closed by Close, with the
+	// sequence numbers of their last events persisted and logged, and the errors of those that
+	// failed to flush, for a successor instance or the restarted process to read and reconcile
+	// them, e.g. for rolling deploys without gaps. See HandoffFile and s3.S3Handoff. Errors
+	// writing it are passed to the ErrorHandler.
+	Handoff HandoffStore
+	// AuditFunc, if set, is called with the routing decision of every event handed to a
+	// logger, after filtering and sampling, e.g. for security teams to prove where a record was
+	// archived without reading every object. It is called while routing, so it must not
+	// block. Events logged with LogReader aren't audited.
+	AuditFunc func(RoutingDecision)
+	// NewLoggerFailure is what the router does with the events of a partition whose logger
+	// can't be made, as the ContextLoggerFactory failed, the LoggerFactory panicked or returned
+	// no logger, one of the NewLoggerFailure constants. It defaults to NewLoggerFailureReport.
+	// NewLoggerRetries defaults to 3, NewLoggerBackoff to 100ms and NewLoggerHoldEvents to 1000.
+	NewLoggerFailure    string
+	NewLoggerRetries    int
+	NewLoggerBackoff    time.Duration
+	NewLoggerHoldEvents int
+	// StrictOrdering guarantees that the events of a partition logged before Close are
+	// delivered, and so flushed, in the order they were logged: events are sequenced as they
+	// are queued, and Close waits for the router to be done with all of them, resuming it if
+	// paused, rather than draining the channels. Events logged once Close started fail with
+	// ErrClosed, PriorityHigh events aren't routed ahead, and LogReader waits for the events
+	// logged before it. Without RouterConcurrency, it enables LogSequenced. Ignored in SyncMode
+	// and Embedded, which route events as they are logged.
+	StrictOrdering bool
+	// SplitterFunc, if set, splits the payloads logged into the events partitioned and archived,
+	// e.g. SplitLines for NDJSON blobs, or SplitJSONArray for SQS bodies of many records, so one
+	// Log call can carry a batch. Events logged with LogReader aren't split.
+	SplitterFunc func([]byte) [][]byte
+	// PartitionStage and DeliveryStage optionally wrap the partition and delivery stages of the
+	// router, given its own, e.g. with TeeDelivery to also deliver the events to a second sink.
+	// The partition stage returns the keys as routed, the router's own applying the KeyRewriter,
+	// KeySanitizer and KeyAliasFunc, and is used by LogSync too. They are called while
+	// routing, by the workers with RouterConcurrency, and their panics are handled as *ErrPanic.
+	PartitionStage func(Partitioner) Partitioner
+	DeliveryStage  func(Delivery) Delivery
 }
 
 func (c Config) valid() {
@@ -40,6 +285,17 @@ func (c Config) valid() {
 	if c.PartitionKeyFunc == nil {
 		panic("PartitionKeyFunc must be implemented")
 	}
+	if _, ok := c.LoggerFactory.(SyncLoggerFactory); c.SyncMode && !ok {
+		panic("LoggerFactory must implement SyncLoggerFactory in SyncMode")
+	}
+	if c.SyncMode && c.Embedded {
+		panic("SyncMode and Embedded are exclusive")
+	}
+	switch c.NewLoggerFailure {
+	case "", NewLoggerFailureReport, NewLoggerFailureRetry, NewLoggerFailureHold:
+	default:
+		panic(fmt.Sprintf("unknown NewLoggerFailure %q", c.NewLoggerFailure))
+	}
 }
 
 // NewLaozi creates a new router and start the logger monitoring
@@ -47,13 +303,51 @@ func NewLaozi(c *Config) Laozi {
 	r := &laozi{
 		EventChan:  make(chan []byte, c.EventChannelSize),
 		routingMap: map[string]Logger{},
+		notOwned:   map[string]bool{},
+		closing:    map[string]*closingLogger{},
+		stop:       make(chan struct{}),
+		routeDone:  make(chan struct{}),
+		closeDone:  make(chan struct{}),
 		Config:     c,
 	}
+	if c.PriorityChannelSize > 0 {
+		r.priorityChan = make(chan []byte, c.PriorityChannelSize)
+	} else {
+		r.priorityChan = make(chan []byte, c.EventChannelSize)
+	}
 
 	r.Config.valid()
+	if c.ReportChannelSize <= 0 {
+		r.reports = make(chan DeliveryReport, defaultReportChannelSize)
+	} else {
+		r.reports = make(chan DeliveryReport, c.ReportChannelSize)
+	}
+	if r.KeySanitizer == nil {
+		r.KeySanitizer = SanitizeKey
+	}
+	if r.Envelope {
+		r.host = hostname()
+	}
+	if c.StrictOrdering && !c.SyncMode && !c.Embedded && c.RouterConcurrency <= 1 && len(c.PinnedKeys) == 0 {
+		r.commits = newCommitTracker()
+	}
+	r.wrapStages()
 
+	if r.SyncMode || r.Embedded {
+		return r
+	}
+	if c.EventQueueBytes > 0 {
+		r.queue = newElasticQueue(c.EventQueueBytes)
+		r.pumpDone = make(chan struct{})
+		go r.pump()
+	}
 	go r.monitorLoggers()
+	r.startWorkers()
 	go r.route()
+	if c.StallTimeout > 0 {
+		r.progress("", true)
+		go r.watchdog()
+	}
 
 	return r
 }
@@ -61,54 +355,635 @@ func NewLaozi(c *Config) Laozi {
 // Log is designed as a non-blocking function for
 // clients to use in a "fire and forget" manner
 func (r *laozi) Log(e []byte) {
-	r.EventChan <- e
+	for _, e := range r.split(e) {
+		r.logOne(e)
+	}
+}
+
+// logOne logs an event split by the SplitterFunc.
+func (r *laozi) logOne(e []byte) {
+	if r.Config != nil && r.SyncMode {
+		if err := r.logSync(context.Background(), e); err != nil {
+			r.handleError(err)
+		}
+		return
+	}
+	if r.Config != nil && r.Embedded {
+		if err := r.processOne(e); err != nil {
+			r.handleError(err)
+		}
+		return
+	}
+	if r.Config != nil && r.StrictOrdering {
+		if err := r.ordered(e, true); err != nil {
+			r.handleError(err)
+		}
+		return
+	}
+	if err := r.queueEvent(e, true); err != nil {
+		r.handleError(err)
+	}
+}
+
+// TryLog is a non-blocking Log reporting events that could not be queued. Events split by the
+// SplitterFunc are queued until one can't be, whose error is returned.
+func (r *laozi) TryLog(e []byte) error {
+	for _, e := range r.split(e) {
+		if err := r.tryLogOne(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tryLogOne tries to log an event split by the SplitterFunc.
+func (r *laozi) tryLogOne(e []byte) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+	if r.Config != nil && r.SyncMode {
+		return r.logSync(context.Background(), e)
+	}
+	if r.Config != nil && r.Embedded {
+		return r.processOne(e)
+	}
+	if r.Config != nil && r.StrictOrdering {
+		return r.ordered(e, false)
+	}
+	return r.queueEvent(e, false)
+}
+
+// queueEvent queues an event for the route goroutine, blocking until it is queued or the router
+// is closed if block is set. Like with StrictOrdering, the orderLock is held for reading while
+// queueing, so Close waits for the events being queued and routes them rather than losing
+// them in the channels.
+func (r *laozi) queueEvent(e []byte, block bool) error {
+	r.orderLock.RLock()
+	defer r.orderLock.RUnlock()
+	if r.isClosed() {
+		return ErrClosed
+	}
+	if r.queue != nil {
+		var pushed bool
+		if block {
+			pushed = r.queue.push(e)
+		} else {
+			pushed = r.queue.tryPush(e)
+		}
+		if !pushed {
+			if block || r.isClosed() {
+				return ErrClosed
+			}
+			return ErrChannelFull
+		}
+		r.checkWatermarks()
+		return nil
+	}
+	if !block {
+		select {
+		case r.EventChan <- e:
+			r.checkWatermarks()
+			return nil
+		default:
+			return ErrChannelFull
+		}
+	}
+	select {
+	case r.EventChan <- e:
+		r.checkWatermarks()
+		return nil
+	case <-r.stop:
+		return ErrClosed
+	}
+}
+
+func (r *laozi) isClosed() bool {
+	return atomic.LoadInt32(&r.closed) == 1
 }
 
 // Close must be called whenever process terminates.
-// This ensure all loggers have flushed their state.
+// This ensure all loggers have flushed their state. Events still waiting in the event channel
+// are routed first, and events logged afterwards fail with ErrClosed. Close can be called more
+// than once and concurrently, returning once the router is closed.
 func (r *laozi) Close() {
-	for key, l := range r.routingMap {
-		err := l.Close()
-		if err != nil {
-			fmt.Printf(" [laozi] Error! Could not close logger (possible data loss): %s\n", key)
+	if !r.startClose() {
+		if r.closeDone != nil {
+			<-r.closeDone
 		}
+		return
+	}
+	defer r.closeReturned()
+	r.stopRouting()
+	r.routeRemaining()
+
+	r.Lock()
+	loggers := r.routingMap
+	r.routingMap = map[string]Logger{}
+	r.Unlock()
+	var handoff []HandoffPartition
+	for key, l := range loggers {
+		r.closeReport.start(key, l)
+	}
+	for key, l := range loggers {
+		err := r.closeFailed(key, l, l.Close())
+		r.unlock(key)
+		r.closeReport.done(key, l, err)
+		handoff = append(handoff, handoffPartition(key, l, err))
 	}
+	r.closePending()
+	r.reportHeld()
+	r.writeHandoff(handoff)
 }
 
-// route listens to the EventChan for events and routes them to their according logger
-// using the implemented partition key function.
+// startClose marks the router closed, reporting false if it already was. Whoever started
+// closing it must call closeReturned once done, for Close calls to return.
+func (r *laozi) startClose() bool {
+	return atomic.CompareAndSwapInt32(&r.closed, 0, 1)
+}
+
+// closeReturned releases the Close calls waiting for the router to be closed.
+func (r *laozi) closeReturned() {
+	if r.closeDone != nil {
+		close(r.closeDone)
+	}
+}
+
+// stopRouting stops the route goroutine, if any, and waits for it to return.
+func (r *laozi) stopRouting() {
+	if r.stop == nil {
+		return
+	}
+	r.awaitSequenced()
+	close(r.stop)
+	if r.queue != nil {
+		r.queue.close()
+	}
+	// wait for the events being queued, left in the channels for routeRemaining
+	r.orderLock.Lock()
+	r.orderLock.Unlock()
+	if r.queue != nil {
+		<-r.pumpDone
+	}
+	if !r.SyncMode && !r.Embedded {
+		<-r.routeDone
+	}
+}
+
+// routeRemaining routes the events left by the route goroutine once stopped.
+func (r *laozi) routeRemaining() {
+	if r.stop == nil {
+		return
+	}
+	for _, e := range r.remaining() {
+		if err := r.routeOne(e); err != nil {
+			r.handleError(err)
+		}
+	}
+}
+
+// remaining returns the events left by the route goroutine once stopped, in routing order.
+func (r *laozi) remaining() [][]byte {
+	events := r.unrouted
+	r.unrouted = nil
+	for {
+		select {
+		case e := <-r.priorityChan:
+			events = append(events, e)
+			continue
+		default:
+		}
+		select {
+		case e := <-r.EventChan:
+			events = append(events, e)
+			continue
+		default:
+		}
+		break
+	}
+	if r.queue != nil {
+		if r.pumped != nil {
+			events = append(events, r.pumped)
+			r.pumped = nil
+		}
+		events = append(events, r.queue.drain()...)
+	}
+	return events
+}
+
+// routeOne routes an event, returning the error of its partition key if any.
+func (r *laozi) routeOne(e []byte) error {
+	key, err := r.partitionKey(e)
+	if err != nil {
+		return err
+	}
+	events := [][]byte{e}
+	if !r.allowed(key) {
+		r.safely(events, func() { r.deny(key, e) })
+		return nil
+	}
+	r.safely(events, func() { r.deliveryStage().Deliver(key, events) })
+	return nil
+}
+
+// ProcessOne routes an event within the calling goroutine and closes timed out loggers. It
+// requires Embedded, and returns the error of the partition key of the event, or ErrClosed.
+// Errors of loggers are passed to the ErrorHandler.
+func (r *laozi) ProcessOne(e []byte) error {
+	if !r.Embedded {
+		return errors.New("ProcessOne requires Embedded")
+	}
+	for _, e := range r.split(e) {
+		if err := r.processOne(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processOne routes an event split by the SplitterFunc.
+func (r *laozi) processOne(e []byte) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+	r.expireSyncLoggers()
+	return r.routeOne(e)
+}
+
+// Pause stops routing events to loggers until Resume is called, e.g. to halt writes during a
+// destination migration. Events logged meanwhile wait in the event channel, so Log blocks once
+// it is full. Loggers don't time out while paused.
+func (r *laozi) Pause() {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	if r.resumeChan == nil {
+		r.resumeChan = make(chan struct{})
+	}
+}
+
+// Resume starts routing events again after a Pause.
+func (r *laozi) Resume() {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	if r.resumeChan != nil {
+		close(r.resumeChan)
+		r.resumeChan = nil
+	}
+}
+
+func (r *laozi) paused() chan struct{} {
+	r.pauseLock.Lock()
+	defer r.pauseLock.Unlock()
+	return r.resumeChan
+}
+
+// route moves the events of the ingest stage through the partition and buffer stages, and
+// dispatches them to the delivery stage.
 func (r *laozi) route() {
-	for e := range r.EventChan {
+	if r.routeDone != nil {
+		defer close(r.routeDone)
+	}
+	defer r.stopWorkers()
+
+	in := r.ingestStage()
+	buf := r.bufferStage(in)
+	// next is an event received while gathering the events of another partition
+	var next []byte
+	var hasNext bool
+	for {
+		e := next
+		if !hasNext {
+			r.progress("", true)
+			if resume := r.paused(); resume != nil {
+				select {
+				case <-resume:
+				case <-r.stop:
+					return
+				}
+			}
+			var ok bool
+			if e, ok = in.receive(r.stop); !ok {
+				return
+			}
+		} else {
+			select {
+			case <-r.stop:
+				// left for Snapshot
+				r.unrouted = append(r.unrouted, next)
+				return
+			default:
+			}
+		}
+		hasNext = false
+		r.checkWatermarks()
+		r.progress("", false)
 
-		key, err := r.PartitionKeyFunc(e)
+		key, err := r.partitionKey(e)
 		if err != nil {
+			r.handleError(err)
+			r.routed(1)
+			continue
+		}
+		if !r.allowed(key) {
+			r.safely([][]byte{e}, func() { r.deny(key, e) })
+			r.routed(1)
 			continue
 		}
 
-		// TODO: We need a way to test this
-		r.Lock()
-		l, found := r.routingMap[key]
-		if !found {
-			l = r.LoggerFactory.NewLogger(key)
-			r.routingMap[key] = l
+		var events [][]byte
+		var open bool
+		events, next, hasNext, open = buf.gather(key, e)
+		r.progress(key, false)
+		r.dispatch(key, events)
+		if !open {
+			return
+		}
+	}
+}
 
+// deliver is the delivery stage of the router, logging consecutive events of a partition key,
+// at once if the logger is a LogBatcher.
+func (r *laozi) deliver(key string, events [][]byte) {
+	r.countKey(key)
+	if r.SplitBytes <= 0 {
+		r.deliverTo(key, events)
+		return
+	}
+
+	var keys []string
+	shards := map[string][][]byte{}
+	for _, e := range events {
+		k := r.shardKey(key, e)
+		if _, ok := shards[k]; !ok {
+			keys = append(keys, k)
 		}
-		r.Unlock()
+		shards[k] = append(shards[k], e)
+	}
+	for _, k := range keys {
+		r.deliverTo(k, shards[k])
+	}
+}
+
+// deliverTo logs the events to the logger of a key.
+func (r *laozi) deliverTo(key string, events [][]byte) {
+	l, ok := r.loggerFor(key, events, func() (Logger, error) { return r.newLogger(key) })
+	if !ok {
+		return
+	}
+	if held := r.releaseHeld(key); held != nil {
+		events = append(held, events...)
+	}
+
+	kept := events[:0]
+	for _, e := range events {
+		if !r.sampledOut(key, l, e) {
+			r.audit(key, l, e)
+			kept = append(kept, r.envelope(key, e))
+		}
+	}
+
+	r.commits.deliver(l, len(kept))
+	if lb, ok := l.(LogBatcher); ok && len(kept) > 1 {
+		lb.LogBatch(kept)
+		return
+	}
+	for _, e := range kept {
 		l.Log(e)
 	}
 }
 
+// loggerFor returns the logger of a partition key, making it with newLogger if need be. It
+// returns false if the events must not be logged as the partition is owned by another instance.
+func (r *laozi) loggerFor(key string, events [][]byte, newLogger func() (Logger, error)) (Logger, bool) {
+	r.Lock()
+	l, found := r.logger(key)
+	if !found {
+		if held, err := r.holding(key, events); held {
+			r.Unlock()
+			if err != nil {
+				r.handleError(err)
+			}
+			return nil, false
+		}
+		owned, err := r.own(key)
+		if err != nil {
+			// handled like a logger failing to be made, so the events are held or reported
+			err = r.newLoggerFailed(key, events, err)
+			r.Unlock()
+			if err != nil {
+				r.handleError(err)
+			}
+			return nil, false
+		}
+		if !owned {
+			r.Unlock()
+			if r.NotOwnedFunc != nil {
+				for _, e := range events {
+					r.NotOwnedFunc(key, e)
+				}
+			}
+			return nil, false
+		}
+		if l, err = r.makeLogger(newLogger); err != nil {
+			r.unlock(key)
+			err = r.newLoggerFailed(key, events, err)
+			r.Unlock()
+			if err != nil {
+				r.handleError(err)
+			}
+			return nil, false
+		}
+		r.reportTo(l)
+		r.routingMap[key] = l
+
+	}
+	r.Unlock()
+	return l, true
+}
+
+// newLogger makes the logger of a partition key, within the LoggerInitTimeout if the
+// LoggerFactory is a ContextLoggerFactory.
+func (r *laozi) newLogger(key string) (Logger, error) {
+	lf, ok := r.LoggerFactory.(ContextLoggerFactory)
+	if !ok {
+		return r.LoggerFactory.NewLogger(key), nil
+	}
+	ctx := context.Background()
+	if r.LoggerInitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.LoggerInitTimeout)
+		defer cancel()
+	}
+	return lf.NewLoggerContext(ctx, key)
+}
+
+// sampledOut reports whether the event is dropped by the SamplingFunc.
+func (r *laozi) sampledOut(key string, l Logger, e []byte) bool {
+	if r.SamplingFunc == nil || r.SamplingFunc(key, e) {
+		return false
+	}
+	unwrap(l, func(l Logger) bool {
+		sr, ok := l.(SamplingRecorder)
+		if ok {
+			sr.RecordSampledOut(1)
+		}
+		return ok
+	})
+	return true
+}
+
+// partitionKey returns the partition key of an event from the partition stage, handling its
+// panics as an *ErrPanic.
+func (r *laozi) partitionKey(e []byte) (key string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			key, err = "", &ErrPanic{Value: p, Stack: debug.Stack(), Events: [][]byte{e}}
+		}
+	}()
+	return r.partitionStage().PartitionKey(e)
+}
+
+// routerKey is the partition stage of the router, returning the sanitized key of the
+// PartitionKeyFunc.
+func (r *laozi) routerKey(e []byte) (key string, err error) {
+	if r.KeyCache != nil {
+		key, err = r.KeyCache.partitionKey(e, r.PartitionKeyFunc)
+	} else {
+		key, err = r.PartitionKeyFunc(e)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrPartitionKey, err)
+	}
+	return r.routingKey(key)
+}
+
+// routingKey returns the key of the logger of a partition key, rewritten, sanitized and aliased.
+func (r *laozi) routingKey(key string) (string, error) {
+	if r.KeyRewriter != nil {
+		key = r.KeyRewriter.Rewrite(key)
+	}
+	if r.KeySanitizer != nil {
+		if key = r.KeySanitizer(key); key == "" {
+			return "", fmt.Errorf("%w: empty key", ErrPartitionKey)
+		}
+	}
+	if r.KeyAliasFunc != nil {
+		if key = r.KeyAliasFunc(key); key == "" {
+			return "", fmt.Errorf("%w: empty alias", ErrPartitionKey)
+		}
+	}
+	return key, nil
+}
+
+// own takes ownership of a partition key, if partition ownership is coordinated. Errors of the
+// PartitionLocker are returned, the key being neither owned nor known to be owned elsewhere.
+func (r *laozi) own(key string) (bool, error) {
+	if r.PartitionLocker == nil {
+		return true, nil
+	}
+	if r.notOwned[key] {
+		return false, nil
+	}
+
+	owned, err := r.PartitionLocker.Lock(key)
+	if err != nil {
+		return false, fmt.Errorf("could not lock partition: %w", err)
+	}
+	if !owned {
+		r.notOwned[key] = true
+	}
+	return owned, nil
+}
+
+// unlock gives up ownership of a partition key, if partition ownership is coordinated.
+func (r *laozi) unlock(key string) {
+	if r.Config == nil || r.PartitionLocker == nil {
+		return
+	}
+	if err := r.PartitionLocker.Unlock(key); err != nil {
+		log.Printf("- [laozi] Could not unlock partition: %s: %s\n", key, err)
+	}
+}
+
 // monitorLoggers will periodically check the internal map and delete stale loggers.
 func (r *laozi) monitorLoggers() {
+	concurrency := r.CloseConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultCloseConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+
 	for _ = range time.Tick(r.LoggerTimeout / 2) {
+		if r.paused() != nil {
+			continue
+		}
+		active := map[string]Logger{}
 		r.Lock()
 		for key, l := range r.routingMap {
 			if time.Since(l.LastActive()) >= r.LoggerTimeout {
 				log.Printf("- [laozi] Logger timeout: %s\n", key)
-				l.Close()
 				delete(r.routingMap, key)
+				r.closeLater(key, l, sem)
+				continue
 			}
+			active[key] = l
 		}
+		// check again whether partitions owned elsewhere have been given up
+		r.notOwned = map[string]bool{}
 		r.Unlock()
+
+		if r.PartitionLocker != nil {
+			r.renewOwnership(active)
+		}
+	}
+}
+
+// renewOwnership renews the leases of the partitions of active loggers, without holding the
+// lock so routing goes on meanwhile. The loggers of partitions lost to another instance are
+// detached rather than flushed over the objects of the new owner.
+func (r *laozi) renewOwnership(loggers map[string]Logger) {
+	for key, l := range loggers {
+		owned, err := r.PartitionLocker.Lock(key)
+		if err != nil {
+			// the lease may still be ours, so the logger is kept until it is known to be lost
+			r.handleError(fmt.Errorf("could not renew lock of partition %s: %w", key, err))
+			continue
+		}
+		if owned {
+			continue
+		}
+
+		r.Lock()
+		current, found := r.routingMap[key]
+		if found && current == l {
+			delete(r.routingMap, key)
+		}
+		r.Unlock()
+		if !found || current != l {
+			continue
+		}
+		log.Printf("- [laozi] Lost ownership of partition: %s\n", key)
+		r.handOver(key, l)
+	}
+}
+
+// handOver stops the logger of a partition owned by another instance. SnapshotLoggers are
+// detached, their events passed to the NotOwnedFunc, or else reported in an *ErrNotOwned, and
+// other loggers are closed.
+func (r *laozi) handOver(key string, l Logger) {
+	sl, ok := l.(SnapshotLogger)
+	if !ok {
+		r.closeFailed(key, l, l.Close())
+		return
+	}
+	events := sl.Detach()
+	if len(events) == 0 {
+		return
+	}
+	if r.NotOwnedFunc == nil {
+		r.handleError(&ErrNotOwned{Key: key, Events: events})
+		return
+	}
+	for _, e := range events {
+		r.NotOwnedFunc(key, e)
 	}
 }
@@ -1,8 +1,14 @@
 package laozi
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"go/build"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -130,6 +136,78 @@ func TestRouterCallsLog(t *testing.T) {
 	assert.Equal(logger.bytes, []byte("11"))
 }
 
+type MockBatchLoggerFactory struct{}
+
+func (mf *MockBatchLoggerFactory) NewLogger(file string) Logger {
+	return &MockBatchLogger{MockLogger: MockLogger{fileName: file}}
+}
+
+// MockBatchLogger records how events were logged.
+type MockBatchLogger struct {
+	MockLogger
+	calls [][]string
+}
+
+func (m *MockBatchLogger) Log(b []byte) {
+	m.calls = append(m.calls, []string{string(b)})
+}
+
+func (m *MockBatchLogger) LogBatch(events [][]byte) {
+	var call []string
+	for _, e := range events {
+		call = append(call, string(e))
+	}
+	m.calls = append(m.calls, call)
+}
+
+func TestRouterCoalescesEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte, 10),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockBatchLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			RouteBatchSize:   3,
+		},
+	}
+	for _, e := range []string{"a", "a", "b", "a", "a", "a", "a"} {
+		l.EventChan <- []byte(e)
+	}
+	close(l.EventChan)
+	l.route()
+
+	assert.Equal([][]string{{"a", "a"}, {"a", "a", "a"}, {"a"}}, l.routingMap["a"].(*MockBatchLogger).calls)
+	assert.Equal([][]string{{"b"}}, l.routingMap["b"].(*MockBatchLogger).calls)
+}
+
+func TestRouterWaitsForEventsToCoalesce(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockBatchLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			RouteBatchSize:   10,
+			RouteBatchDelay:  time.Second,
+		},
+	}
+	go func() {
+		l.EventChan <- []byte("a")
+		time.Sleep(time.Millisecond)
+		l.EventChan <- []byte("a")
+		close(l.EventChan)
+	}()
+	l.route()
+
+	assert.Equal([][]string{{"a", "a"}}, l.routingMap["a"].(*MockBatchLogger).calls)
+}
+
 func TestRouterDeletesLoggersAfterTimeout(t *testing.T) {
 	assert := assert.New(t)
 	l := &laozi{
@@ -183,16 +261,189 @@ func TestRouterClosesError(t *testing.T) {
 	l.Close()
 }
 
+func TestRouterClosesOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	var errs []error
+	l := NewLaozi(&Config{
+		LoggerFactory:    &MockLoggerFactory{},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: MockPartitionFunc,
+		EventChannelSize: 10,
+		ErrorHandler:     func(err error) { errs = append(errs, err) },
+	}).(*laozi)
+
+	// events still waiting are routed before loggers are closed
+	l.Pause()
+	l.Log([]byte("testkey1"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Close()
+		}()
+	}
+	wg.Wait()
+
+	l.Log([]byte("testkey2"))
+	assert.Equal([]error{ErrClosed}, errs)
+	assert.Equal(ErrClosed, l.TryLog([]byte("testkey2")))
+	assert.Empty(l.routingMap)
+	assert.Equal(ErrClosed, l.Snapshot(ioutil.Discard))
+}
+
+func TestRouterClosesAfterCloseWithTimeoutOrSnapshot(t *testing.T) {
+	for _, closeFirst := range []func(Laozi){
+		func(l Laozi) { l.CloseWithTimeout(time.Second) },
+		func(l Laozi) { l.Snapshot(ioutil.Discard) },
+	} {
+		l := NewLaozi(&Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Hour,
+			PartitionKeyFunc: MockPartitionFunc,
+		})
+		closeFirst(l)
+
+		done := make(chan struct{})
+		go func() {
+			l.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Close blocks")
+		}
+	}
+}
+
+func TestRouterRoutesEventsLoggedWhileClosing(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	var rejected int64
+	l := NewLaozi(&Config{
+		LoggerFactory:    MockReportingLoggerFactory{sink},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "a", nil },
+		EventChannelSize: 1,
+		ErrorHandler: func(err error) {
+			if err == ErrClosed {
+				atomic.AddInt64(&rejected, 1)
+			}
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				l.Log([]byte("e"))
+			}
+		}()
+	}
+	l.Close()
+	wg.Wait()
+
+	// every event is either archived or rejected with ErrClosed
+	var archived int
+	for _, b := range sink.batches {
+		archived += len(b.Events)
+	}
+	assert.Equal(int64(800), int64(archived)+atomic.LoadInt64(&rejected))
+}
+
+func TestRouterPauses(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte, 10),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+		},
+	}
+	l.Pause()
+	go l.route()
+
+	l.Log([]byte("1"))
+	l.Log([]byte("2"))
+
+	time.Sleep(5 * time.Millisecond)
+
+	l.Lock()
+	assert.Equal(0, len(l.routingMap))
+	assert.Equal(2, len(l.EventChan))
+	l.Unlock()
+
+	l.Resume()
+	l.awaitRouted(2)
+
+	l.Lock()
+	assert.Equal(2, len(l.routingMap))
+	l.Unlock()
+}
+
+func TestRouterLogReaderReturnsWhenClosedWhilePaused(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewLaozi(&Config{
+		LoggerTimeout:    time.Minute,
+		LoggerFactory:    &MockLoggerFactory{},
+		PartitionKeyFunc: MockPartitionFunc,
+	})
+	l.Pause()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.LogReader("a", strings.NewReader("1"))
+	}()
+	time.Sleep(5 * time.Millisecond)
+	l.Close()
+
+	select {
+	case err := <-done:
+		assert.Equal(ErrClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("LogReader still waiting for the closed router to be resumed")
+	}
+}
+
+func TestRouterDoesNotTimeoutLoggersWhilePaused(t *testing.T) {
+	assert := assert.New(t)
+	l := &laozi{
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerTimeout: 2 * time.Millisecond,
+		},
+	}
+
+	log1 := &MockLogger{}
+	l.routingMap["testkey1"] = log1
+
+	l.Pause()
+	go l.monitorLoggers()
+
+	time.Sleep(10 * time.Millisecond)
+
+	l.Lock()
+	assert.Equal(1, len(l.routingMap))
+	l.Unlock()
+	assert.False(log1.closed)
+}
+
 func TestNewLoazi(t *testing.T) {
 	assert := assert.New(t)
 
 	l := NewLaozi(&Config{
 		LoggerTimeout: time.Minute,
-		LoggerFactory: S3LoggerFactory{
-			Bucket: "bucket",
-			Prefix: "prefix/",
-			Region: "us-east-1",
-		},
+		LoggerFactory: &MockLoggerFactory{},
 		PartitionKeyFunc: func([]byte) (string, error) {
 			return "a", nil
 		},
@@ -200,3 +451,48 @@ func TestNewLoazi(t *testing.T) {
 
 	assert.Implements((*Laozi)(nil), l)
 }
+
+type MockFailingLoggerFactory struct{}
+
+func (mf *MockFailingLoggerFactory) NewLogger(key string) Logger {
+	return &MockLogger{fileName: key}
+}
+
+func (mf *MockFailingLoggerFactory) NewLoggerContext(ctx context.Context, key string) (Logger, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestRouterHandlesNewLoggerErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var handled error
+	l := &laozi{
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockFailingLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			ErrorHandler:     func(err error) { handled = err },
+		},
+	}
+	l.deliver("key", [][]byte{[]byte("event")})
+
+	var newErr *ErrNewLogger
+	assert.True(errors.As(handled, &newErr))
+	assert.Equal("key", newErr.Key)
+	assert.Equal([][]byte{[]byte("event")}, newErr.Events)
+	assert.Equal(0, len(l.routingMap))
+}
+
+func TestRouterImportsOnlyStandardLibrary(t *testing.T) {
+	assert := assert.New(t)
+
+	// the backends with dependencies of their own live in subpackages
+	pkg, err := build.ImportDir(".", 0)
+	if !assert.NoError(err) {
+		return
+	}
+	for _, path := range pkg.Imports {
+		assert.NotContains(strings.SplitN(path, "/", 2)[0], ".", "the router imports %s", path)
+	}
+}
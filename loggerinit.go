@@ -0,0 +1,149 @@
+package laozi
+
+import (
+	"errors"
+	"time"
+)
+
+// What the router does with the events of a partition whose logger could not be made, see
+// Config.NewLoggerFailure.
+const (
+	// NewLoggerFailureReport passes the events to the ErrorHandler in an *ErrNewLogger, e.g.
+	// for it to send them to a dead letter queue.
+	NewLoggerFailureReport = "report"
+	// NewLoggerFailureRetry tries making the logger again, NewLoggerRetries times with
+	// exponential backoff from NewLoggerBackoff, before reporting the events. Routing waits
+	// meanwhile.
+	NewLoggerFailureRetry = "retry"
+	// NewLoggerFailureHold holds up to NewLoggerHoldEvents events of the partition in memory,
+	// reporting the others, and tries making the logger again with the next events of the
+	// partition routed once NewLoggerBackoff has passed. The events held are logged first once
+	// it is made, reported on Close, or snapshotted as unrouted by Snapshot. Events logged
+	// with LogSync are reported instead.
+	NewLoggerFailureHold = "hold"
+)
+
+const (
+	defaultNewLoggerRetries    = 3
+	defaultNewLoggerBackoff    = 100 * time.Millisecond
+	defaultNewLoggerHoldEvents = 1000
+)
+
+// errNilLogger is the error of LoggerFactories returning no logger.
+var errNilLogger = errors.New("LoggerFactory returned no logger")
+
+// heldEvents are the events of a partition held until its logger is made, retried after retry
+// as it last failed with err.
+type heldEvents struct {
+	events [][]byte
+	retry  time.Time
+	err    error
+}
+
+// makeLogger makes a logger with newLogger, retrying with NewLoggerFailureRetry.
+func (r *laozi) makeLogger(newLogger func() (Logger, error)) (Logger, error) {
+	retries := 0
+	if r.NewLoggerFailure == NewLoggerFailureRetry {
+		retries = r.NewLoggerRetries
+		if retries <= 0 {
+			retries = defaultNewLoggerRetries
+		}
+	}
+	backoff := r.newLoggerBackoff()
+	for attempt := 0; ; attempt++ {
+		l, err := safeNewLogger(newLogger)
+		if err == nil && l == nil {
+			err = errNilLogger
+		}
+		if err == nil || attempt >= retries {
+			return l, err
+		}
+		time.Sleep(backoff << uint(attempt))
+	}
+}
+
+func (r *laozi) newLoggerBackoff() time.Duration {
+	if r.NewLoggerBackoff <= 0 {
+		return defaultNewLoggerBackoff
+	}
+	return r.NewLoggerBackoff
+}
+
+// holding holds the events of a partition whose logger failed to be made until its next retry,
+// reporting true if they were, with the error to report if some could not be held. It must be
+// called with the lock held.
+func (r *laozi) holding(key string, events [][]byte) (bool, error) {
+	h, ok := r.held[key]
+	if !ok || !time.Now().Before(h.retry) {
+		return false, nil
+	}
+	if dropped := r.hold(key, events); len(dropped) > 0 {
+		return true, &ErrNewLogger{Key: key, Events: dropped, Cause: h.err}
+	}
+	return true, nil
+}
+
+// newLoggerFailed handles the events of a partition whose logger could not be made. It must be
+// called with the lock held, and returns the error to report, if any.
+func (r *laozi) newLoggerFailed(key string, events [][]byte, err error) error {
+	if r.NewLoggerFailure != NewLoggerFailureHold || r.SyncMode {
+		return &ErrNewLogger{Key: key, Events: events, Cause: err}
+	}
+	if r.held == nil {
+		r.held = map[string]*heldEvents{}
+	}
+	if _, ok := r.held[key]; !ok {
+		r.held[key] = &heldEvents{}
+	}
+	r.held[key].retry = time.Now().Add(r.newLoggerBackoff())
+	r.held[key].err = err
+	if dropped := r.hold(key, events); len(dropped) > 0 {
+		return &ErrNewLogger{Key: key, Events: dropped, Cause: err}
+	}
+	return nil
+}
+
+// hold adds events to those held for a partition, returning those beyond NewLoggerHoldEvents.
+func (r *laozi) hold(key string, events [][]byte) (dropped [][]byte) {
+	max := r.NewLoggerHoldEvents
+	if max <= 0 {
+		max = defaultNewLoggerHoldEvents
+	}
+	h := r.held[key]
+	for _, e := range events {
+		if len(h.events) >= max {
+			dropped = append(dropped, e)
+			continue
+		}
+		h.events = append(h.events, e)
+	}
+	return dropped
+}
+
+// releaseHeld returns the events held for a partition whose logger is now made.
+func (r *laozi) releaseHeld(key string) [][]byte {
+	r.Lock()
+	defer r.Unlock()
+	h, ok := r.held[key]
+	if !ok {
+		return nil
+	}
+	delete(r.held, key)
+	return h.events
+}
+
+// takeHeld returns the events still held, by partition.
+func (r *laozi) takeHeld() map[string]*heldEvents {
+	r.Lock()
+	defer r.Unlock()
+	held := r.held
+	r.held = nil
+	return held
+}
+
+// reportHeld reports the events still held on Close.
+func (r *laozi) reportHeld() {
+	for key, h := range r.takeHeld() {
+		r.handleError(&ErrNewLogger{Key: key, Events: h.events, Cause: ErrClosed})
+	}
+}
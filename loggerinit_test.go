@@ -0,0 +1,116 @@
+package laozi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingLoggerFactory fails making loggers until failures is down to 0, or always returns no
+// logger with nilLogger.
+type failingLoggerFactory struct {
+	failures  int
+	nilLogger bool
+	made      map[string]*MockLogger
+}
+
+func (f *failingLoggerFactory) NewLogger(key string) Logger {
+	if f.nilLogger {
+		return nil
+	}
+	if f.failures > 0 {
+		f.failures--
+		panic("sink is down")
+	}
+	if f.made == nil {
+		f.made = map[string]*MockLogger{}
+	}
+	f.made[key] = &MockLogger{fileName: key}
+	return f.made[key]
+}
+
+func makeTestInitRouter(lf LoggerFactory, failure string, errs *[]error) *laozi {
+	return NewLaozi(&Config{
+		LoggerFactory:       lf,
+		LoggerTimeout:       time.Minute,
+		PartitionKeyFunc:    func(e []byte) (string, error) { return string(e[:1]), nil },
+		Embedded:            true,
+		ErrorHandler:        func(err error) { *errs = append(*errs, err) },
+		NewLoggerFailure:    failure,
+		NewLoggerBackoff:    time.Millisecond,
+		NewLoggerHoldEvents: 2,
+	}).(*laozi)
+}
+
+func TestRouterReportsNilLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	var errs []error
+	r := makeTestInitRouter(&failingLoggerFactory{nilLogger: true}, "", &errs)
+	assert.NoError(r.ProcessOne([]byte("a1")))
+	assert.Empty(r.routingMap)
+	if assert.Len(errs, 1) {
+		var nerr *ErrNewLogger
+		assert.True(errors.As(errs[0], &nerr))
+		assert.Equal(errNilLogger, nerr.Cause)
+		assert.Equal([][]byte{[]byte("a1")}, nerr.Events)
+	}
+	r.Close()
+}
+
+func TestRouterRetriesMakingLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	var errs []error
+	lf := &failingLoggerFactory{failures: 3}
+	r := makeTestInitRouter(lf, NewLoggerFailureRetry, &errs)
+	assert.NoError(r.ProcessOne([]byte("a1")))
+	assert.Empty(errs)
+	assert.Equal([]byte("a1"), lf.made["a"].bytes)
+
+	lf.failures = 4
+	assert.NoError(r.ProcessOne([]byte("b1")))
+	assert.Len(errs, 1)
+	r.Close()
+
+	assert.Panics(func() { makeTestInitRouter(lf, "later", &errs) })
+}
+
+func TestRouterHoldsEventsUntilLoggersAreMade(t *testing.T) {
+	assert := assert.New(t)
+
+	var errs []error
+	lf := &failingLoggerFactory{failures: 2}
+	r := makeTestInitRouter(lf, NewLoggerFailureHold, &errs)
+	assert.NoError(r.ProcessOne([]byte("a1")))
+	// held until the backoff passed, beyond NewLoggerHoldEvents
+	assert.NoError(r.ProcessOne([]byte("a2")))
+	assert.NoError(r.ProcessOne([]byte("a3")))
+	assert.Equal(1, lf.failures)
+	assert.Len(r.held["a"].events, 2)
+	if assert.Len(errs, 1) {
+		assert.Equal([][]byte{[]byte("a3")}, errs[0].(*ErrNewLogger).Events)
+		assert.Contains(errs[0].Error(), "sink is down")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(r.ProcessOne([]byte("a4")))
+	if assert.Len(errs, 2) {
+		assert.Equal([][]byte{[]byte("a4")}, errs[1].(*ErrNewLogger).Events)
+	}
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(r.ProcessOne([]byte("a5")))
+	assert.Equal([]byte("a1a2a5"), lf.made["a"].bytes)
+	assert.Empty(r.held)
+
+	// events still held are reported on Close
+	lf.failures = 1
+	assert.NoError(r.ProcessOne([]byte("b1")))
+	r.Close()
+	if assert.Len(errs, 3) {
+		assert.Equal(ErrClosed, errs[2].(*ErrNewLogger).Cause)
+		assert.Equal([][]byte{[]byte("b1")}, errs[2].(*ErrNewLogger).Events)
+	}
+}
@@ -0,0 +1,66 @@
+package laozi
+
+import "context"
+
+// Middleware wraps a logger in one adding a cross-cutting behaviour, e.g. measuring or
+// retrying what it does, see WithMiddleware. Loggers made by middlewares should implement
+// WrappingLogger.
+type Middleware func(Logger) Logger
+
+// WrappingLogger is a Logger wrapping another one, e.g. made by a Middleware. The router looks
+// for the ReportingLogger, SamplingRecorder, StateLogger, BufferedLogger and FlushingLogger
+// interfaces in the loggers they wrap. The others, e.g. LogBatcher, must be implemented by the
+// wrapping logger itself, for events to go through it, or the router falls back to Log and
+// Close.
+type WrappingLogger interface {
+	Logger
+	Unwrap() Logger
+}
+
+// WithMiddleware returns a factory making the loggers of lf wrapped in the middlewares, the
+// first one being the outermost.
+func WithMiddleware(lf LoggerFactory, middlewares ...Middleware) LoggerFactory {
+	return middlewareFactory{lf, middlewares}
+}
+
+type middlewareFactory struct {
+	LoggerFactory
+	middlewares []Middleware
+}
+
+func (lf middlewareFactory) NewLogger(key string) Logger {
+	return lf.wrap(lf.LoggerFactory.NewLogger(key))
+}
+
+func (lf middlewareFactory) NewLoggerContext(ctx context.Context, key string) (Logger, error) {
+	clf, ok := lf.LoggerFactory.(ContextLoggerFactory)
+	if !ok {
+		return lf.NewLogger(key), nil
+	}
+	l, err := clf.NewLoggerContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return lf.wrap(l), nil
+}
+
+func (lf middlewareFactory) wrap(l Logger) Logger {
+	for i := len(lf.middlewares) - 1; i >= 0; i-- {
+		l = lf.middlewares[i](l)
+	}
+	return l
+}
+
+// unwrap calls found with l and then the loggers it wraps, until found returns true.
+func unwrap(l Logger, found func(Logger) bool) bool {
+	for {
+		if found(l) {
+			return true
+		}
+		w, ok := l.(WrappingLogger)
+		if !ok {
+			return false
+		}
+		l = w.Unwrap()
+	}
+}
@@ -0,0 +1,55 @@
+package laozi
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type prefixingLogger struct {
+	Logger
+	prefix string
+}
+
+func (l prefixingLogger) Log(e []byte) {
+	l.Logger.Log(append([]byte(l.prefix), e...))
+}
+
+func (l prefixingLogger) Unwrap() Logger {
+	return l.Logger
+}
+
+func prefixing(prefix string) Middleware {
+	return func(l Logger) Logger { return prefixingLogger{l, prefix} }
+}
+
+func TestMiddlewareWrapsLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	r := NewLaozi(&Config{
+		LoggerFactory:    WithMiddleware(MockReportingLoggerFactory{sink}, prefixing("a"), prefixing("b")),
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "key", nil },
+	})
+	// a, the outermost, prefixes the event first
+	r.Log([]byte("c"))
+	r.(*laozi).awaitRouted(1)
+
+	// the optional interfaces of the wrapped logger are found
+	var b bytes.Buffer
+	assert.NoError(r.DumpState(&b))
+	var state routerState
+	assert.NoError(json.Unmarshal(b.Bytes(), &state))
+	assert.NotNil(state.Partitions[0].LoggerState)
+	r.Close()
+
+	report := <-r.Reports()
+	assert.Equal(1, report.Records)
+	sink.Lock()
+	defer sink.Unlock()
+	assert.Equal([][]byte{[]byte("bac")}, sink.batches[0].Events)
+}
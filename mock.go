@@ -1,6 +1,11 @@
 package laozi
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
 
 type MockLaozi struct{}
 
@@ -8,6 +13,85 @@ func (d MockLaozi) Log(b []byte) {
 	fmt.Printf("[laozi] event logged: %s\n", b)
 }
 
+func (d MockLaozi) TryLog(b []byte) error {
+	d.Log(b)
+	return nil
+}
+
 func (d MockLaozi) Close() {
 	fmt.Println("[laozi] closing!")
 }
+
+func (d MockLaozi) Pause() {
+	fmt.Println("[laozi] pausing!")
+}
+
+func (d MockLaozi) Resume() {
+	fmt.Println("[laozi] resuming!")
+}
+
+func (d MockLaozi) LogSync(ctx context.Context, b []byte) error {
+	fmt.Printf("[laozi] event logged synchronously: %s\n", b)
+	return nil
+}
+
+func (d MockLaozi) ProcessOne(b []byte) error {
+	d.Log(b)
+	return nil
+}
+
+func (d MockLaozi) WorkerFor(key string) int {
+	return 0
+}
+
+func (d MockLaozi) LogSequenced(partition string, seq Sequence, b []byte) error {
+	d.Log(b)
+	return nil
+}
+
+func (d MockLaozi) CommittableWatermark(partition string) Sequence {
+	return -1
+}
+
+func (d MockLaozi) CloseWithTimeout(timeout time.Duration) []UnpersistedPartition {
+	fmt.Println("[laozi] closing!")
+	return nil
+}
+
+func (d MockLaozi) LogWithPriority(b []byte, p Priority) {
+	d.Log(b)
+}
+
+func (d MockLaozi) Flush(key string) error {
+	fmt.Printf("[laozi] flushing %s!\n", key)
+	return nil
+}
+
+func (d MockLaozi) Evict(key string) error {
+	fmt.Printf("[laozi] evicting %s!\n", key)
+	return nil
+}
+
+func (d MockLaozi) DumpState(w io.Writer) error {
+	fmt.Println("[laozi] dumping state!")
+	return nil
+}
+
+func (d MockLaozi) LogReader(key string, r io.Reader) error {
+	fmt.Printf("[laozi] event streamed: %s\n", key)
+	return nil
+}
+
+func (d MockLaozi) Reports() <-chan DeliveryReport {
+	return nil
+}
+
+func (d MockLaozi) Snapshot(w io.Writer) error {
+	fmt.Println("[laozi] snapshotting!")
+	return nil
+}
+
+func (d MockLaozi) Restore(r io.Reader) error {
+	fmt.Println("[laozi] restoring!")
+	return nil
+}
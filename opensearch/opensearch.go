@@ -0,0 +1,157 @@
+// Package opensearch indexes the events of a laozi router in OpenSearch or Elasticsearch.
+package opensearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const defaultOpenSearchBatchSize = 1000
+
+// defaultOpenSearchMaxPending is the default MaxPending, in batches.
+const defaultOpenSearchMaxPending = 10
+
+// OpenSearchLoggerFactory is a logger factory for creating loggers that index received events
+// in OpenSearch or Elasticsearch with the bulk API. Events must be JSON documents.
+type OpenSearchLoggerFactory struct {
+	// Addr is the address of the cluster, e.g. "https://localhost:9200".
+	Addr     string
+	Username string
+	Password string
+	// IndexPrefix prefixes the default index names, <IndexPrefix><key>-<yyyy.mm.dd>.
+	IndexPrefix string
+	// IndexFunc optionally names the index of the events of a partition logged at a given time.
+	IndexFunc     func(key string, t time.Time) string
+	FlushInterval time.Duration
+	// BatchSize is the max number of events per bulk request, defaults to 1000.
+	BatchSize int
+	// MaxPending is the max number of events kept to be retried while the cluster fails to
+	// index them, defaults to 10 times BatchSize, see laozi.BatchLogger.MaxPending. Events
+	// rejected for good, e.g. failing the mapping of their index, are dropped rather than
+	// retried.
+	MaxPending int
+	// Client is the HTTP client used, defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// NewLogger returns a new instance of an OpenSearch logger for a corresponding partition key.
+func (lf OpenSearchLoggerFactory) NewLogger(key string) laozi.Logger {
+	w := &openSearchWriter{
+		OpenSearchLoggerFactory: lf,
+		key:                     key,
+	}
+	if w.Client == nil {
+		w.Client = http.DefaultClient
+	}
+	if w.BatchSize <= 0 {
+		w.BatchSize = defaultOpenSearchBatchSize
+	}
+	if w.MaxPending <= 0 {
+		w.MaxPending = defaultOpenSearchMaxPending * w.BatchSize
+	}
+
+	l := laozi.NewBatchLogger(key, w.write, lf.FlushInterval, w.BatchSize, 0)
+	l.MaxPending = w.MaxPending
+	return l
+}
+
+type openSearchWriter struct {
+	OpenSearchLoggerFactory
+	key string
+}
+
+func (w *openSearchWriter) index(t time.Time) string {
+	if w.IndexFunc != nil {
+		return w.IndexFunc(w.key, t)
+	}
+	return fmt.Sprintf("%s%s-%s", w.IndexPrefix, strings.Replace(w.key, "/", "-", -1), t.UTC().Format("2006.01.02"))
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// write indexes a batch. If only some events fail, the batch is left with just those that can
+// be retried, so retrying it doesn't index the others twice. Those rejected for good are
+// returned in a *laozi.ErrDropped.
+func (w *openSearchWriter) write(b *laozi.Batch) error {
+	action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": w.index(b.Start)}})
+
+	var body bytes.Buffer
+	for _, e := range b.Events {
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(bytes.TrimRight(e, "\r\n"))
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(w.Addr, "/")+"/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.Username != "" {
+		req.SetBasicAuth(w.Username, w.Password)
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("bulk request failed: %s: %s", resp.Status, msg)
+	}
+
+	var result bulkResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	var failed, rejected [][]byte
+	var reason, rejectReason json.RawMessage
+	for i, item := range result.Items {
+		for _, r := range item {
+			if r.Status < 300 || i >= len(b.Events) {
+				continue
+			}
+			if retryableStatus(r.Status) {
+				failed = append(failed, b.Events[i])
+				reason = r.Error
+			} else {
+				rejected = append(rejected, b.Events[i])
+				rejectReason = r.Error
+			}
+		}
+	}
+	b.Events = failed
+	if len(rejected) == 0 {
+		return fmt.Errorf("%d events could not be indexed: %s", len(failed), reason)
+	}
+	cause := fmt.Errorf("rejected by the cluster: %s", rejectReason)
+	if len(failed) > 0 {
+		cause = fmt.Errorf("%s, and %d events could not be indexed: %s", cause, len(failed), reason)
+	}
+	return &laozi.ErrDropped{Key: w.key, Events: rejected, Cause: cause}
+}
+
+// retryableStatus reports whether documents failing with status may be indexed by a retry, i.e.
+// the cluster was overloaded or failing rather than rejecting them, e.g. for their mapping.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
@@ -0,0 +1,122 @@
+package opensearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockOpenSearch records indexed documents, failing documents containing "fail" once and
+// rejecting those containing "bad".
+type mockOpenSearch struct {
+	sync.Mutex
+	docs   map[string][]string
+	failed map[string]bool
+}
+
+func (m *mockOpenSearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	var items []string
+	errors := false
+	s := bufio.NewScanner(r.Body)
+	for s.Scan() {
+		var action map[string]map[string]string
+		json.Unmarshal(s.Bytes(), &action)
+		s.Scan()
+		doc := s.Text()
+
+		if strings.Contains(doc, "bad") {
+			errors = true
+			items = append(items, `{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}`)
+			continue
+		}
+		if strings.Contains(doc, "fail") && !m.failed[doc] {
+			m.failed[doc] = true
+			errors = true
+			items = append(items, `{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}`)
+			continue
+		}
+		index := action["index"]["_index"]
+		m.docs[index] = append(m.docs[index], doc)
+		items = append(items, `{"index":{"status":201}}`)
+	}
+	fmt.Fprintf(w, `{"errors":%t,"items":[%s]}`, errors, strings.Join(items, ","))
+}
+
+func TestOpenSearchLoggerIndexesEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	es := &mockOpenSearch{docs: map[string][]string{}, failed: map[string]bool{}}
+	server := httptest.NewServer(es)
+	defer server.Close()
+
+	lf := OpenSearchLoggerFactory{Addr: server.URL, IndexPrefix: "events-"}
+	l := lf.NewLogger("app/a")
+	assert.Implements((*laozi.Logger)(nil), l)
+	l.Log([]byte(`{"n":1}` + "\n"))
+	l.Log([]byte(`{"n":2}` + "\n"))
+	assert.NoError(l.Close())
+
+	index := "events-app-a-" + time.Now().UTC().Format("2006.01.02")
+	assert.Equal([]string{`{"n":1}`, `{"n":2}`}, es.docs[index])
+}
+
+func TestOpenSearchWriterKeepsFailedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	es := &mockOpenSearch{docs: map[string][]string{}, failed: map[string]bool{}}
+	server := httptest.NewServer(es)
+	defer server.Close()
+
+	w := &openSearchWriter{
+		OpenSearchLoggerFactory: OpenSearchLoggerFactory{
+			Addr:      server.URL,
+			IndexFunc: func(key string, t time.Time) string { return key },
+			Client:    http.DefaultClient,
+		},
+		key: "a",
+	}
+	b := &laozi.Batch{Events: [][]byte{[]byte(`{"n":1}`), []byte(`{"fail":2}`), []byte(`{"n":3}`)}}
+
+	assert.Error(w.write(b))
+	assert.Equal([][]byte{[]byte(`{"fail":2}`)}, b.Events)
+
+	assert.NoError(w.write(b))
+	assert.Equal([]string{`{"n":1}`, `{"n":3}`, `{"fail":2}`}, es.docs["a"])
+}
+
+func TestOpenSearchWriterDropsRejectedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	es := &mockOpenSearch{docs: map[string][]string{}, failed: map[string]bool{}}
+	server := httptest.NewServer(es)
+	defer server.Close()
+
+	lf := OpenSearchLoggerFactory{
+		Addr:      server.URL,
+		IndexFunc: func(key string, t time.Time) string { return key },
+	}
+	l := lf.NewLogger("a").(*laozi.BatchLogger)
+	l.LogBatch([][]byte{[]byte(`{"n":1}`), []byte(`{"bad":2}`), []byte(`{"fail":3}`)})
+
+	var dropped *laozi.ErrDropped
+	assert.True(errors.As(l.Flush(), &dropped))
+	assert.Equal([][]byte{[]byte(`{"bad":2}`)}, dropped.Events)
+	assert.Equal([]byte(`{"fail":3}`), l.Buffered())
+
+	assert.NoError(l.Close())
+	assert.Equal([]string{`{"n":1}`, `{"fail":3}`}, es.docs["a"])
+	assert.Equal(10000, l.MaxPending)
+}
@@ -0,0 +1,76 @@
+package laozi
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ordered queues an event with StrictOrdering, blocking until it is queued if block is set.
+// Events are sequenced while holding the orderLock, which Close takes before stopping the
+// route goroutine, so none is queued once the router stopped watching the channels.
+func (r *laozi) ordered(e []byte, block bool) error {
+	r.orderLock.RLock()
+	defer r.orderLock.RUnlock()
+	if r.isClosed() {
+		return ErrClosed
+	}
+	if !r.enqueue(e, block) {
+		if block || r.isClosed() {
+			return ErrClosed
+		}
+		return ErrChannelFull
+	}
+	atomic.AddInt64(&r.sequenced, 1)
+	r.checkWatermarks()
+	return nil
+}
+
+// enqueue queues an event for the route goroutine, reporting false if it would block and
+// block isn't set, or if the queue was closed. Events are queued in the EventChan even with PriorityHigh.
+func (r *laozi) enqueue(e []byte, block bool) bool {
+	if r.queue != nil {
+		if block {
+			return r.queue.push(e)
+		}
+		return r.queue.tryPush(e)
+	}
+	if block {
+		r.EventChan <- e
+		return true
+	}
+	select {
+	case r.EventChan <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// routed counts the events the route goroutine is done with, delivered or not.
+func (r *laozi) routed(n int) {
+	atomic.AddInt64(&r.routedEvents, int64(n))
+}
+
+// awaitSequenced waits, with StrictOrdering, for the route goroutine to be done with every
+// event sequenced before the router was closed, resuming it if it was paused.
+func (r *laozi) awaitSequenced() {
+	if r.Config == nil || !r.StrictOrdering || r.SyncMode || r.Embedded {
+		return
+	}
+	r.Resume()
+	r.orderLock.Lock()
+	sequenced := atomic.LoadInt64(&r.sequenced)
+	r.orderLock.Unlock()
+	r.awaitRouted(sequenced)
+}
+
+// awaitRouted waits for the route goroutine to be done with n events, or to return.
+func (r *laozi) awaitRouted(n int64) {
+	for atomic.LoadInt64(&r.routedEvents) < n {
+		select {
+		case <-r.routeDone:
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package laozi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type orderedLoggerFactory struct {
+	sync.Mutex
+	loggers map[string][]*MockLogger
+}
+
+func (mf *orderedLoggerFactory) NewLogger(key string) Logger {
+	mf.Lock()
+	defer mf.Unlock()
+	l := &MockLogger{fileName: key}
+	mf.loggers[key] = append(mf.loggers[key], l)
+	return l
+}
+
+// logged returns the events logged to the loggers of a key, in the order they were made.
+func (mf *orderedLoggerFactory) logged(key string) string {
+	mf.Lock()
+	defer mf.Unlock()
+	var b bytes.Buffer
+	for _, l := range mf.loggers[key] {
+		b.Write(l.bytes)
+	}
+	return b.String()
+}
+
+func strictRouter(lf LoggerFactory, c Config) Laozi {
+	c.LoggerFactory = lf
+	c.LoggerTimeout = time.Minute
+	c.PartitionKeyFunc = func(e []byte) (string, error) {
+		return strings.SplitN(string(e), ":", 2)[0], nil
+	}
+	c.StrictOrdering = true
+	return NewLaozi(&c)
+}
+
+func TestRouterStrictOrderingAcrossClose(t *testing.T) {
+	for name, c := range map[string]Config{
+		"channel": {EventChannelSize: 4},
+		"workers": {EventChannelSize: 4, RouterConcurrency: 3},
+		"queue":   {EventQueueBytes: 64},
+		"batches": {EventChannelSize: 4, RouteBatchSize: 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			lf := &orderedLoggerFactory{loggers: map[string][]*MockLogger{}}
+			r := strictRouter(lf, c)
+
+			// every event whose TryLog succeeded must be delivered, in order per key
+			accepted := make([]string, 8)
+			var started int32
+			var wg sync.WaitGroup
+			for i := range accepted {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					var b strings.Builder
+					for n := 0; ; n++ {
+						e := fmt.Sprintf("k%d:%d\n", i, n)
+						err := r.TryLog([]byte(e))
+						for err == ErrChannelFull {
+							time.Sleep(time.Microsecond)
+							err = r.TryLog([]byte(e))
+						}
+						if err == ErrClosed {
+							accepted[i] = b.String()
+							return
+						}
+						if n == 0 {
+							atomic.AddInt32(&started, 1)
+						}
+						b.WriteString(e)
+					}
+				}(i)
+			}
+			assert.Eventually(func() bool {
+				return atomic.LoadInt32(&started) == int32(len(accepted))
+			}, time.Second, time.Millisecond)
+			r.Close()
+			wg.Wait()
+
+			for i, events := range accepted {
+				assert.NotEmpty(events)
+				assert.Equal(events, lf.logged(fmt.Sprintf("k%d", i)))
+			}
+		})
+	}
+}
+
+func TestRouterStrictOrderingIgnoresPriorities(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := &orderedLoggerFactory{loggers: map[string][]*MockLogger{}}
+	r := strictRouter(lf, Config{EventChannelSize: 10})
+	r.Pause()
+	r.Log([]byte("a:0\n"))
+	r.LogWithPriority([]byte("a:1\n"), PriorityHigh)
+	r.Close()
+
+	assert.Equal("a:0\na:1\n", lf.logged("a"))
+}
+
+func TestRouterStrictOrderingCloseResumes(t *testing.T) {
+	assert := assert.New(t)
+
+	var closed int32
+	lf := &orderedLoggerFactory{loggers: map[string][]*MockLogger{}}
+	r := strictRouter(lf, Config{
+		EventChannelSize: 2,
+		ErrorHandler: func(err error) {
+			assert.Equal(ErrClosed, err)
+			atomic.AddInt32(&closed, 1)
+		},
+	})
+	r.Pause()
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		for n := 0; n < 5; n++ {
+			r.Log([]byte(fmt.Sprintf("a:%d\n", n)))
+		}
+	}()
+	time.Sleep(5 * time.Millisecond)
+	r.Close()
+	<-logged
+
+	// the event blocked in Log when Close started is routed, the following ones fail
+	var events string
+	for n := 0; n < 5-int(atomic.LoadInt32(&closed)); n++ {
+		events += fmt.Sprintf("a:%d\n", n)
+	}
+	assert.True(strings.HasPrefix(events, "a:0\na:1\na:2\n"))
+	assert.Equal(events, lf.logged("a"))
+	assert.Equal(ErrClosed, r.TryLog([]byte("a:5\n")))
+}
+
+func TestRouterStrictOrderingBlockingLogFailsClosed(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozi{Config: &Config{StrictOrdering: true}, queue: newElasticQueue(64)}
+	r.queue.close()
+
+	// a blocking enqueue can only fail because the queue was closed
+	assert.Equal(ErrClosed, r.ordered([]byte("a:0\n"), true))
+}
+
+func TestRouterStrictOrderingLogReader(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := &orderedLoggerFactory{loggers: map[string][]*MockLogger{}}
+	r := strictRouter(lf, Config{EventChannelSize: 10})
+	r.Pause()
+	r.Log([]byte("a:0\n"))
+	r.Log([]byte("a:1\n"))
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		r.Resume()
+	}()
+
+	assert.NoError(r.LogReader("a", strings.NewReader("a:2\n")))
+	r.Close()
+	assert.Equal("a:0\na:1\na:2\n", lf.logged("a"))
+}
@@ -0,0 +1,85 @@
+// Package postgres inserts the events of a laozi router in a PostgreSQL table.
+package postgres
+
+import (
+	"bytes"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const (
+	defaultPostgresBatchSize   = 10000
+	defaultPostgresKeyColumn   = "partition_key"
+	defaultPostgresEventColumn = "event"
+)
+
+// PostgresLoggerFactory is a logger factory for creating loggers that insert received events in
+// a PostgreSQL (or TimescaleDB) table, one row per event with the partition key as a column.
+// Batches are bulk loaded with COPY in a transaction, so a flush is either fully stored or not
+// at all. DB must be opened with the lib/pq driver, and the event column be of type text or jsonb.
+type PostgresLoggerFactory struct {
+	DB    *sql.DB
+	Table string
+	// KeyColumn and EventColumn name the columns of the partition key and the event, they
+	// default to "partition_key" and "event".
+	KeyColumn     string
+	EventColumn   string
+	FlushInterval time.Duration
+	// BatchSize is the max number of events per transaction, defaults to 10000.
+	BatchSize int
+}
+
+// NewLogger returns a new instance of a PostgreSQL logger for a corresponding partition key.
+func (lf PostgresLoggerFactory) NewLogger(key string) laozi.Logger {
+	w := &postgresWriter{PostgresLoggerFactory: lf, key: key}
+	if w.KeyColumn == "" {
+		w.KeyColumn = defaultPostgresKeyColumn
+	}
+	if w.EventColumn == "" {
+		w.EventColumn = defaultPostgresEventColumn
+	}
+	if w.BatchSize <= 0 {
+		w.BatchSize = defaultPostgresBatchSize
+	}
+
+	return laozi.NewBatchLogger(key, w.write, lf.FlushInterval, w.BatchSize, 0)
+}
+
+type postgresWriter struct {
+	PostgresLoggerFactory
+	key string
+}
+
+func (w *postgresWriter) write(b *laozi.Batch) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = w.copy(tx, b)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (w *postgresWriter) copy(tx *sql.Tx, b *laozi.Batch) error {
+	stmt, err := tx.Prepare(pq.CopyIn(w.Table, w.KeyColumn, w.EventColumn))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range b.Events {
+		if _, err = stmt.Exec(w.key, string(bytes.TrimRight(e, "\r\n"))); err != nil {
+			return err
+		}
+	}
+	// flushes the buffered rows
+	_, err = stmt.Exec()
+	return err
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresLoggerCopiesEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare(pq.CopyIn("events", "partition_key", "event"))
+	prep.ExpectExec().WithArgs("a", `{"n":1}`).WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WithArgs("a", `{"n":2}`).WillReturnResult(sqlmock.NewResult(0, 1))
+	prep.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	lf := PostgresLoggerFactory{DB: db, Table: "events"}
+	l := lf.NewLogger("a")
+	assert.Implements((*laozi.Logger)(nil), l)
+	l.Log([]byte(`{"n":1}` + "\n"))
+	l.Log([]byte(`{"n":2}` + "\n"))
+	assert.NoError(l.Close())
+
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestPostgresWriterRollsBack(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare(pq.CopyIn("events", "key", "data"))
+	prep.ExpectExec().WithArgs("a", "x").WillReturnError(errors.New("invalid input syntax for type json"))
+	mock.ExpectRollback()
+
+	w := &postgresWriter{
+		PostgresLoggerFactory: PostgresLoggerFactory{DB: db, Table: "events", KeyColumn: "key", EventColumn: "data"},
+		key:                   "a",
+	}
+	assert.Error(w.write(&laozi.Batch{Events: [][]byte{[]byte("x")}}))
+	assert.NoError(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,43 @@
+package laozi
+
+// Priority is the priority of an event, see LogWithPriority.
+type Priority int
+
+const (
+	// PriorityNormal events are queued in the event channel, like with Log.
+	PriorityNormal Priority = iota
+	// PriorityHigh events are queued separately and routed ahead of normal ones, e.g. for
+	// audit events not to wait behind bulk telemetry when the router is saturated.
+	PriorityHigh
+)
+
+// LogWithPriority is Log with a priority. Events of a partition logged with different
+// priorities may be archived out of order, unless with StrictOrdering, which ignores them.
+func (r *laozi) LogWithPriority(e []byte, p Priority) {
+	if p == PriorityNormal || (r.Config != nil && (r.SyncMode || r.Embedded || r.StrictOrdering)) {
+		r.Log(e)
+		return
+	}
+	for _, e := range r.split(e) {
+		if err := r.prioritized(e); err != nil {
+			r.handleError(err)
+			return
+		}
+	}
+}
+
+// prioritized queues an event with PriorityHigh, holding the orderLock for reading like
+// queueEvent.
+func (r *laozi) prioritized(e []byte) error {
+	r.orderLock.RLock()
+	defer r.orderLock.RUnlock()
+	if r.isClosed() {
+		return ErrClosed
+	}
+	select {
+	case r.priorityChan <- e:
+		return nil
+	case <-r.stop:
+		return ErrClosed
+	}
+}
@@ -0,0 +1,31 @@
+package laozi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterRoutesHighPriorityFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	l := NewLaozi(&Config{
+		LoggerFactory:    MockReportingLoggerFactory{sink},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "key", nil },
+		EventChannelSize: 10,
+	})
+
+	l.Pause()
+	l.Log([]byte("bulk1"))
+	l.Log([]byte("bulk2"))
+	l.LogWithPriority([]byte("audit"), PriorityHigh)
+	l.Resume()
+	l.(*laozi).awaitRouted(3)
+	l.Close()
+
+	assert.Equal(1, len(sink.batches))
+	assert.Equal([]byte("auditbulk1bulk2"), sink.batches[0].Bytes())
+}
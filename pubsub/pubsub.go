@@ -0,0 +1,81 @@
+// Package pubsub publishes the events of a laozi router to a Google Cloud Pub/Sub topic.
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const (
+	defaultPubSubBatchSize      = 1000
+	defaultPubSubPublishTimeout = 60 * time.Second
+)
+
+// PubSubLoggerFactory is a logger factory for creating loggers that publish received events
+// to a Google Cloud Pub/Sub topic. Events are published with their partition key as ordering
+// key, so subscribers receive the events of a partition in order. The topic must have message
+// ordering enabled, see NewPubSubTopic.
+type PubSubLoggerFactory struct {
+	Topic         *pubsub.Topic
+	FlushInterval time.Duration
+	// BatchSize is the max number of events published before waiting for their results,
+	// defaults to 1000.
+	BatchSize int
+	// PublishTimeout is how long to wait for the results of a batch, defaults to 60 seconds.
+	PublishTimeout time.Duration
+}
+
+// NewPubSubTopic returns a topic of the client configured to be used by a PubSubLoggerFactory,
+// with message ordering enabled and the given settings controlling how the client bundles
+// published messages.
+func NewPubSubTopic(client *pubsub.Client, id string, settings pubsub.PublishSettings) *pubsub.Topic {
+	t := client.Topic(id)
+	t.EnableMessageOrdering = true
+	t.PublishSettings = settings
+	return t
+}
+
+// NewLogger returns a new instance of a Pub/Sub logger for a corresponding partition key.
+func (lf PubSubLoggerFactory) NewLogger(key string) laozi.Logger {
+	w := &pubSubWriter{PubSubLoggerFactory: lf, key: key}
+	if w.BatchSize <= 0 {
+		w.BatchSize = defaultPubSubBatchSize
+	}
+	if w.PublishTimeout <= 0 {
+		w.PublishTimeout = defaultPubSubPublishTimeout
+	}
+
+	return laozi.NewBatchLogger(key, w.write, lf.FlushInterval, w.BatchSize, 0)
+}
+
+type pubSubWriter struct {
+	PubSubLoggerFactory
+	key string
+}
+
+func (w *pubSubWriter) write(b *laozi.Batch) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.PublishTimeout)
+	defer cancel()
+
+	results := make([]*pubsub.PublishResult, len(b.Events))
+	for i, e := range b.Events {
+		results[i] = w.Topic.Publish(ctx, &pubsub.Message{
+			Data:        bytes.TrimRight(e, "\r\n"),
+			OrderingKey: w.key,
+		})
+	}
+
+	for _, r := range results {
+		if _, err := r.Get(ctx); err != nil {
+			// publishing of an ordering key is paused after a failure, until it is resumed
+			w.Topic.ResumePublish(w.key)
+			return fmt.Errorf("could not publish to %s: %s", w.Topic, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// makeTestPubSub returns a client of an in-process fake Pub/Sub server.
+func makeTestPubSub(t *testing.T) (*pubsub.Client, *pstest.Server) {
+	srv := pstest.NewServer()
+	conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := pubsub.NewClient(context.Background(), "laozi", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		srv.Close()
+	})
+	return client, srv
+}
+
+func TestPubSubLoggerPublishesOrderedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	client, srv := makeTestPubSub(t)
+	_, err := client.CreateTopic(context.Background(), "events")
+	assert.NoError(err)
+
+	topic := NewPubSubTopic(client, "events", pubsub.DefaultPublishSettings)
+	defer topic.Stop()
+	lf := PubSubLoggerFactory{Topic: topic}
+	l := lf.NewLogger("app/a")
+	assert.Implements((*laozi.Logger)(nil), l)
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+	assert.NoError(l.Close())
+
+	msgs := srv.Messages()
+	assert.Equal(2, len(msgs))
+	assert.Equal([]byte("1"), msgs[0].Data)
+	assert.Equal([]byte("2"), msgs[1].Data)
+	assert.Equal("app/a", msgs[0].OrderingKey)
+}
+
+func TestPubSubWriterResumesPublishingAfterFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	client, srv := makeTestPubSub(t)
+	topic := NewPubSubTopic(client, "events", pubsub.DefaultPublishSettings)
+	defer topic.Stop()
+	w := &pubSubWriter{
+		PubSubLoggerFactory: PubSubLoggerFactory{Topic: topic, PublishTimeout: defaultPubSubPublishTimeout},
+		key:                 "a",
+	}
+	b := &laozi.Batch{Events: [][]byte{[]byte("1")}}
+
+	// the topic does not exist yet
+	assert.Error(w.write(b))
+
+	_, err := client.CreateTopic(context.Background(), "events")
+	assert.NoError(err)
+	assert.NoError(w.write(b))
+	assert.Equal(1, len(srv.Messages()))
+}
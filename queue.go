@@ -0,0 +1,155 @@
+package laozi
+
+import "sync"
+
+// queueSegmentSize is the number of events of each ring buffer of an elasticQueue.
+const queueSegmentSize = 256
+
+// elasticQueue is an unbounded FIFO of events made of linked ring buffers, bounded by the total
+// size of the events instead of their number, see Config.EventQueueBytes.
+type elasticQueue struct {
+	sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	maxBytes int64
+	bytes    int64
+	length   int
+	head     *queueSegment
+	tail     *queueSegment
+	closed   bool
+}
+
+// queueSegment is a ring buffer of events, linked to the segment queued after it.
+type queueSegment struct {
+	events [queueSegmentSize][]byte
+	start  int
+	length int
+	next   *queueSegment
+}
+
+func newElasticQueue(maxBytes int64) *elasticQueue {
+	q := &elasticQueue{maxBytes: maxBytes}
+	q.notEmpty = sync.NewCond(q)
+	q.notFull = sync.NewCond(q)
+	return q
+}
+
+// push queues an event, waiting while the queue is full. A single event larger than maxBytes
+// is queued once the queue is empty. It returns false once the queue is closed.
+func (q *elasticQueue) push(e []byte) bool {
+	q.Lock()
+	defer q.Unlock()
+	for !q.closed && q.length > 0 && q.bytes+int64(len(e)) > q.maxBytes {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return false
+	}
+	q.add(e)
+	return true
+}
+
+// tryPush queues an event unless the queue is full or closed.
+func (q *elasticQueue) tryPush(e []byte) bool {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed || (q.length > 0 && q.bytes+int64(len(e)) > q.maxBytes) {
+		return false
+	}
+	q.add(e)
+	return true
+}
+
+func (q *elasticQueue) add(e []byte) {
+	if q.tail == nil || q.tail.length == queueSegmentSize {
+		s := &queueSegment{}
+		if q.tail == nil {
+			q.head = s
+		} else {
+			q.tail.next = s
+		}
+		q.tail = s
+	}
+	q.tail.events[(q.tail.start+q.tail.length)%queueSegmentSize] = e
+	q.tail.length++
+	q.length++
+	q.bytes += int64(len(e))
+	q.notEmpty.Signal()
+}
+
+// pop waits for an event and dequeues it. It returns false once the queue is closed, leaving
+// the events still queued to drain.
+func (q *elasticQueue) pop() ([]byte, bool) {
+	q.Lock()
+	defer q.Unlock()
+	for !q.closed && q.length == 0 {
+		q.notEmpty.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	return q.remove(), true
+}
+
+func (q *elasticQueue) remove() []byte {
+	s := q.head
+	e := s.events[s.start]
+	s.events[s.start] = nil
+	s.start = (s.start + 1) % queueSegmentSize
+	s.length--
+	if s.length == 0 {
+		// drop the segment, or reuse it if it is the only one
+		if s.next != nil {
+			q.head = s.next
+		} else {
+			s.start = 0
+		}
+	}
+	q.length--
+	q.bytes -= int64(len(e))
+	q.notFull.Broadcast()
+	return e
+}
+
+// drain dequeues all the events left.
+func (q *elasticQueue) drain() [][]byte {
+	q.Lock()
+	defer q.Unlock()
+	var events [][]byte
+	for q.length > 0 {
+		events = append(events, q.remove())
+	}
+	return events
+}
+
+// close wakes up and fails the pending and future pushes and pops.
+func (q *elasticQueue) close() {
+	q.Lock()
+	defer q.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *elasticQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return q.length
+}
+
+// pump moves the events of the queue to the EventChan until routing stops.
+func (r *laozi) pump() {
+	defer close(r.pumpDone)
+	for {
+		e, ok := r.queue.pop()
+		if !ok {
+			return
+		}
+		select {
+		case r.EventChan <- e:
+		case <-r.stop:
+			r.pumped = e
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package laozi
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElasticQueueIsFIFO(t *testing.T) {
+	assert := assert.New(t)
+
+	q := newElasticQueue(1 << 20)
+	for i := 0; i < 3*queueSegmentSize; i++ {
+		assert.True(q.push([]byte(fmt.Sprint(i))))
+	}
+	for i := 0; i < queueSegmentSize+1; i++ {
+		e, ok := q.pop()
+		assert.True(ok)
+		assert.Equal(fmt.Sprint(i), string(e))
+	}
+	left := q.drain()
+	assert.Equal(2*queueSegmentSize-1, len(left))
+	assert.Equal(fmt.Sprint(3*queueSegmentSize-1), string(left[len(left)-1]))
+	assert.Equal(int64(0), q.bytes)
+}
+
+func TestElasticQueueIsBoundedByBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	q := newElasticQueue(10)
+	// a huge event fits an empty queue
+	assert.True(q.tryPush(make([]byte, 100)))
+	assert.False(q.tryPush([]byte("a")))
+	q.pop()
+	assert.True(q.tryPush(make([]byte, 6)))
+	assert.True(q.tryPush(make([]byte, 4)))
+	assert.False(q.tryPush([]byte("a")))
+
+	pushed := make(chan bool)
+	go func() { pushed <- q.push([]byte("a")) }()
+	select {
+	case <-pushed:
+		t.Fatal("push did not wait for room")
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.pop()
+	assert.True(<-pushed)
+
+	q.close()
+	assert.False(q.push([]byte("a")))
+	_, ok := q.pop()
+	assert.False(ok)
+}
+
+func TestRouterQueuesEventsByBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	l := NewLaozi(&Config{
+		LoggerFactory:    MockReportingLoggerFactory{sink},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "key", nil },
+		EventQueueBytes:  1024,
+	})
+
+	l.Pause()
+	for i := 0; i < 100; i++ {
+		assert.NoError(l.TryLog([]byte("e")))
+	}
+	l.Close()
+
+	assert.Equal(1, len(sink.batches))
+	assert.Equal(100, len(sink.batches[0].Events))
+}
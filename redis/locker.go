@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func defaultOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// lockRedisPartition sets the lock if free or already held by the owner.
+var lockRedisPartition = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false or owner == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// unlockRedisPartition deletes the lock only if held by the owner.
+var unlockRedisPartition = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker is a PartitionLocker using Redis keys with an expiry as leases.
+type RedisLocker struct {
+	Redis redis.UniversalClient
+	// Namespace prefixes every Redis key used, defaults to "laozi".
+	Namespace string
+	// Owner identifies this instance, defaults to hostname and pid.
+	Owner string
+	TTL   time.Duration
+}
+
+func (rl *RedisLocker) key(partition string) string {
+	return fmt.Sprintf("%s:owner:%s", redisNamespace(rl.Namespace), partition)
+}
+
+func (rl *RedisLocker) owner() string {
+	if rl.Owner == "" {
+		rl.Owner = defaultOwner()
+	}
+	return rl.Owner
+}
+
+// Lock takes or renews the lease of a partition.
+func (rl *RedisLocker) Lock(partition string) (bool, error) {
+	n, err := lockRedisPartition.Run(context.Background(), rl.Redis, []string{rl.key(partition)},
+		rl.owner(), int64(rl.TTL/time.Millisecond)).Int()
+	return n == 1, err
+}
+
+// Unlock releases the lease of a partition if this instance still holds it.
+func (rl *RedisLocker) Unlock(partition string) error {
+	return unlockRedisPartition.Run(context.Background(), rl.Redis, []string{rl.key(partition)}, rl.owner()).Err()
+}
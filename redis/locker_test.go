@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisLocker(t *testing.T) {
+	assert := assert.New(t)
+
+	r := makeTestRedis()
+	a := &RedisLocker{Redis: r, Namespace: testRedisNamespace, Owner: "a", TTL: time.Minute}
+	b := &RedisLocker{Redis: r, Namespace: testRedisNamespace, Owner: "b", TTL: time.Minute}
+	defer a.Unlock("p")
+
+	owned, err := a.Lock("p")
+	assert.NoError(err)
+	assert.True(owned)
+
+	owned, err = a.Lock("p")
+	assert.NoError(err)
+	assert.True(owned)
+
+	owned, err = b.Lock("p")
+	assert.NoError(err)
+	assert.False(owned)
+
+	assert.NoError(b.Unlock("p"))
+	owned, _ = b.Lock("p")
+	assert.False(owned)
+
+	assert.NoError(a.Unlock("p"))
+	owned, _ = b.Lock("p")
+	assert.True(owned)
+	b.Unlock("p")
+}
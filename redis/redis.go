@@ -0,0 +1,82 @@
+// Package redis buffers the events of a laozi router in Redis lists, for many producers to
+// share one archiver, and leases partitions with Redis keys.
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const defaultRedisNamespace = "laozi"
+
+func redisNamespace(ns string) string {
+	if ns == "" {
+		return defaultRedisNamespace
+	}
+	return ns
+}
+
+// ListKey returns the key of the Redis list holding the events of a partition of a namespace.
+func ListKey(ns, partition string) string {
+	return fmt.Sprintf("%s:events:%s", redisNamespace(ns), partition)
+}
+
+// PartitionsKey returns the key of the Redis set of the partitions of a namespace with events.
+func PartitionsKey(ns string) string {
+	return fmt.Sprintf("%s:partitions", redisNamespace(ns))
+}
+
+// RedisLoggerFactory is a logger factory for sharing one logical archiver between many
+// producer processes. Instead of buffering events in process memory, its loggers push them
+// onto a Redis list per partition, which survives producer restarts. A single s3.RedisFlusher
+// drains the lists to S3.
+type RedisLoggerFactory struct {
+	Redis redis.UniversalClient
+	// Namespace prefixes every Redis key used, defaults to "laozi".
+	Namespace string
+}
+
+// NewLogger returns a logger pushing the events of a partition key to Redis.
+func (lf RedisLoggerFactory) NewLogger(key string) laozi.Logger {
+	return &redisLogger{
+		redis:     lf.Redis,
+		namespace: lf.Namespace,
+		partition: key,
+		active:    time.Now(),
+	}
+}
+
+type redisLogger struct {
+	redis     redis.UniversalClient
+	namespace string
+	partition string
+	active    time.Time
+}
+
+// Log pushes the event to the partition list in Redis.
+func (l *redisLogger) Log(e []byte) {
+	ctx := context.Background()
+	_, err := l.redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.RPush(ctx, ListKey(l.namespace, l.partition), e)
+		p.SAdd(ctx, PartitionsKey(l.namespace), l.partition)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not push event to redis (possible data loss): %s\n", l.partition)
+	}
+	l.active = time.Now()
+}
+
+// Close does nothing as events are never held in memory.
+func (l *redisLogger) Close() error {
+	return nil
+}
+
+// LastActive is used to know when the logger last logged.
+func (l *redisLogger) LastActive() time.Time {
+	return l.active
+}
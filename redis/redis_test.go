@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRedisNamespace = "laozi-test"
+
+func makeTestRedis() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+}
+
+func cleanTestRedis(r *redis.Client, partitions ...string) {
+	ctx := context.Background()
+	r.Del(ctx, PartitionsKey(testRedisNamespace))
+	for _, p := range partitions {
+		r.Del(ctx, ListKey(testRedisNamespace, p))
+	}
+}
+
+func TestRedisKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("laozi:events:a", ListKey("", "a"))
+	assert.Equal("laozi:partitions", PartitionsKey(""))
+	assert.Equal("ns:events:a", ListKey("ns", "a"))
+}
+
+func TestRedisLoggerFactoryNew(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := RedisLoggerFactory{Redis: makeTestRedis()}
+	l := lf.NewLogger("test.file")
+
+	assert.Implements((*laozi.Logger)(nil), l)
+	assert.NoError(l.Close())
+}
+
+func TestRedisLoggerLog(t *testing.T) {
+	assert := assert.New(t)
+
+	r := makeTestRedis()
+	defer cleanTestRedis(r, "a")
+
+	l := RedisLoggerFactory{Redis: r, Namespace: testRedisNamespace}.NewLogger("a")
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+
+	ctx := context.Background()
+	events, err := r.LRange(ctx, ListKey(testRedisNamespace, "a"), 0, -1).Result()
+	assert.NoError(err)
+	assert.Equal([]string{"1\n", "2\n"}, events)
+
+	partitions, err := r.SMembers(ctx, PartitionsKey(testRedisNamespace)).Result()
+	assert.NoError(err)
+	assert.Equal([]string{"a"}, partitions)
+}
@@ -0,0 +1,132 @@
+package laozi
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultReportChannelSize is the capacity of the Reports channel if not configured.
+const defaultReportChannelSize = 100
+
+// DeliveryReport describes a flush of a logger, see Reports.
+type DeliveryReport struct {
+	Partition string
+	// Key is the object written, for sinks storing objects.
+	Key string
+	// Records is the number of events flushed and Bytes the size of the payload written.
+	Records  int
+	Bytes    int
+	Duration time.Duration
+	// Err is why the flush failed, if it did.
+	Err error
+	// URL is a pre-signed GET URL of the object written, for sinks making them, see
+	// s3.S3LoggerFactory.PresignTTL.
+	URL string
+}
+
+// ReportingLogger is implemented by loggers emitting a DeliveryReport per flush.
+type ReportingLogger interface {
+	Logger
+	// ReportTo sets the channel reports are sent to. Reports are dropped when it is full.
+	ReportTo(reports chan<- DeliveryReport)
+}
+
+// Reporter implements ReportTo for loggers, e.g. by being embedded in them, which can set it
+// while their loop is running. It keeps the last HistorySize flushes reported.
+type Reporter struct {
+	HistorySize int
+	reports     atomic.Value
+	history     flushHistory
+}
+
+// ReportTo sets the channel the reports are sent to.
+func (r *Reporter) ReportTo(reports chan<- DeliveryReport) {
+	r.reports.Store(reports)
+}
+
+// Report sends the report of a flush, unless the channel is full, and adds it to the history.
+func (r *Reporter) Report(d DeliveryReport) {
+	r.history.add(d, r.HistorySize)
+	reports, _ := r.reports.Load().(chan<- DeliveryReport)
+	if reports == nil {
+		return
+	}
+	select {
+	case reports <- d:
+	default:
+	}
+}
+
+// FlushRecord is a flush in the history of a logger, see LoggerState.Flushes.
+type FlushRecord struct {
+	Time     time.Time     `json:"time"`
+	Key      string        `json:"key,omitempty"`
+	Records  int           `json:"records"`
+	Bytes    int           `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	// Error is why the flush failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// Flushes returns the last flushes reported, the oldest first.
+func (r *Reporter) Flushes() []FlushRecord {
+	return r.history.last()
+}
+
+// flushHistory keeps the last flushes of a logger.
+type flushHistory struct {
+	sync.Mutex
+	flushes []FlushRecord
+}
+
+// add adds a flush to the history, keeping the last size.
+func (h *flushHistory) add(d DeliveryReport, size int) {
+	if size <= 0 {
+		return
+	}
+	f := FlushRecord{
+		Time:     time.Now(),
+		Key:      d.Key,
+		Records:  d.Records,
+		Bytes:    d.Bytes,
+		Duration: d.Duration,
+	}
+	if d.Err != nil {
+		f.Error = d.Err.Error()
+	}
+	h.Lock()
+	defer h.Unlock()
+	if len(h.flushes) == size {
+		h.flushes = append(h.flushes[:0], h.flushes[1:]...)
+	}
+	h.flushes = append(h.flushes, f)
+}
+
+// last returns the flushes of the history, the oldest first.
+func (h *flushHistory) last() []FlushRecord {
+	h.Lock()
+	defer h.Unlock()
+	return append([]FlushRecord(nil), h.flushes...)
+}
+
+// Reports returns the channel receiving a DeliveryReport per flush of the loggers that are
+// ReportingLoggers, e.g. for applications to do their own bookkeeping. Reports are dropped
+// while it is full, and it is never closed.
+func (r *laozi) Reports() <-chan DeliveryReport {
+	return r.reports
+}
+
+// reportTo makes a new logger send its reports to the Reports channel.
+func (r *laozi) reportTo(l Logger) {
+	if r.reports == nil {
+		return
+	}
+	unwrap(l, func(l Logger) bool {
+		rl, ok := l.(ReportingLogger)
+		if ok {
+			rl.ReportTo(r.reports)
+		}
+		return ok
+	})
+}
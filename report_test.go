@@ -0,0 +1,58 @@
+package laozi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockReportingLoggerFactory struct {
+	sink *mockSink
+}
+
+func (lf MockReportingLoggerFactory) NewLogger(key string) Logger {
+	return NewBatchLogger(key, lf.sink.write, time.Hour, 0, 0)
+}
+
+func TestBatchLoggerReportsFlushes(t *testing.T) {
+	assert := assert.New(t)
+
+	reports := make(chan DeliveryReport, 2)
+	sink := &mockSink{err: errors.New("down")}
+	l := NewBatchLogger("test", sink.write, time.Hour, 0, 0)
+	l.ReportTo(reports)
+
+	l.LogBatch([][]byte{[]byte("a"), []byte("bc")})
+	assert.Error(l.Close())
+	sink.err = nil
+	assert.NoError(l.flush())
+
+	failed, flushed := <-reports, <-reports
+	assert.Equal("test", failed.Partition)
+	assert.EqualError(failed.Err, "down")
+	assert.NoError(flushed.Err)
+	assert.Equal(2, flushed.Records)
+	assert.Equal(3, flushed.Bytes)
+}
+
+func TestRouterReportsFlushes(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewLaozi(&Config{
+		LoggerFactory:    MockReportingLoggerFactory{&mockSink{}},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return string(e), nil },
+	})
+	r.Log([]byte("a"))
+	r.Close()
+
+	select {
+	case report := <-r.Reports():
+		assert.Equal("a", report.Partition)
+		assert.Equal(1, report.Records)
+	default:
+		t.Fatal("no report")
+	}
+}
@@ -0,0 +1,112 @@
+package laozi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"regexp"
+	"sync"
+	"syscall"
+)
+
+// RewriteRule rewrites the partition keys matching Pattern, a regular expression, to
+// Replacement, which may refer to its submatches, e.g. $1 or ${name}.
+type RewriteRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+type compiledRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// KeyRewriter rewrites the partition keys returned by the PartitionKeyFunc by the first of its
+// rules matching them, see Config.KeyRewriter. Its rules can be replaced while the router runs,
+// e.g. reloaded from a file, so routing can be adjusted without redeploying producers. It is
+// safe for concurrent use.
+type KeyRewriter struct {
+	sync.RWMutex
+	rules []compiledRule
+	// path is the file the rules are loaded from, if any
+	path string
+}
+
+// NewKeyRewriter returns a KeyRewriter with the rules, or the error of the first rule whose
+// pattern doesn't compile.
+func NewKeyRewriter(rules []RewriteRule) (*KeyRewriter, error) {
+	k := &KeyRewriter{}
+	return k, k.SetRules(rules)
+}
+
+// LoadKeyRewriter returns a KeyRewriter with the rules of a JSON file holding an array of
+// RewriteRules, which Reload loads again.
+func LoadKeyRewriter(path string) (*KeyRewriter, error) {
+	k := &KeyRewriter{path: path}
+	return k, k.Reload()
+}
+
+// SetRules replaces the rules, unless one of them doesn't compile.
+func (k *KeyRewriter) SetRules(rules []RewriteRule) error {
+	compiled := make([]compiledRule, len(rules))
+	for i, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid rewrite rule %d: %s", i, err)
+		}
+		compiled[i] = compiledRule{pattern, rule.Replacement}
+	}
+
+	k.Lock()
+	defer k.Unlock()
+	k.rules = compiled
+	return nil
+}
+
+// Reload loads the rules of the file of a KeyRewriter made by LoadKeyRewriter again, keeping
+// the current ones if the file can't be read or holds invalid rules.
+func (k *KeyRewriter) Reload() error {
+	if k.path == "" {
+		return fmt.Errorf("rewrite rules weren't loaded from a file")
+	}
+	data, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	var rules []RewriteRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("invalid rewrite rules in %s: %s", k.path, err)
+	}
+	return k.SetRules(rules)
+}
+
+// ReloadOnSignal reloads the rules whenever the process receives one of the signals, by default
+// SIGHUP, printing the errors.
+func (k *KeyRewriter) ReloadOnSignal(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	go func() {
+		for range c {
+			if err := k.Reload(); err != nil {
+				fmt.Printf(" [laozi] Error! Could not reload rewrite rules: %s\n", err)
+			}
+		}
+	}()
+}
+
+// Rewrite returns the key rewritten by the first rule matching it, or the key itself.
+func (k *KeyRewriter) Rewrite(key string) string {
+	k.RLock()
+	defer k.RUnlock()
+	for _, rule := range k.rules {
+		if rule.pattern.MatchString(key) {
+			return rule.pattern.ReplaceAllString(key, rule.replacement)
+		}
+	}
+	return key
+}
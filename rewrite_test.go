@@ -0,0 +1,57 @@
+package laozi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRewriterRewritesByFirstMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	k, err := NewKeyRewriter([]RewriteRule{
+		{Pattern: `^tenant-(\d+)/debug/.*`, Replacement: "tenant-$1/debug"},
+		{Pattern: `^tenant-(?P<id>\d+)/`, Replacement: "tenants/${id}/"},
+	})
+	assert.NoError(err)
+	assert.Equal("tenant-1/debug", k.Rewrite("tenant-1/debug/2016/01/02"))
+	assert.Equal("tenants/1/2016/01/02", k.Rewrite("tenant-1/2016/01/02"))
+	assert.Equal("other", k.Rewrite("other"))
+
+	assert.Error(k.SetRules([]RewriteRule{{Pattern: "("}}))
+	assert.Equal("tenants/1/a", k.Rewrite("tenant-1/a"))
+}
+
+func TestKeyRewriterReloads(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	assert.NoError(ioutil.WriteFile(path, []byte(`[{"pattern": "^a$", "replacement": "b"}]`), 0600))
+	k, err := LoadKeyRewriter(path)
+	assert.NoError(err)
+
+	ml := &MockLoggerFactory{}
+	r := NewLaozi(&Config{
+		LoggerFactory:    ml,
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+		KeyRewriter:      k,
+		Embedded:         true,
+	})
+	assert.NoError(r.ProcessOne([]byte("a")))
+	assert.Contains(r.(*laozi).routingMap, "b")
+
+	assert.NoError(ioutil.WriteFile(path, []byte(`[{"pattern": "^a$", "replacement": "c"}]`), 0600))
+	assert.NoError(k.Reload())
+	assert.NoError(r.ProcessOne([]byte("a")))
+	assert.Contains(r.(*laozi).routingMap, "c")
+
+	// invalid files keep the rules
+	assert.NoError(ioutil.WriteFile(path, []byte(`[{"pattern": "("}]`), 0600))
+	assert.Error(k.Reload())
+	assert.Equal("c", k.Rewrite("a"))
+	r.Close()
+}
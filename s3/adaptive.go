@@ -0,0 +1,49 @@
+package s3
+
+import (
+	"math"
+	"time"
+)
+
+// adaptiveSmoothing is the weight of the last FlushInterval in the smoothed event rate of
+// loggers with AdaptiveFlush.
+const adaptiveSmoothing = 0.3
+
+// learnRate folds the events logged since it was last called into the smoothed event rate, once
+// per FlushInterval.
+func (l *s3logger) learnRate() {
+	if !l.adaptive {
+		return
+	}
+	now := time.Now()
+	if elapsed := now.Sub(l.rateTime).Seconds(); elapsed > 0 {
+		sample := float64(l.sequence-l.rateSequence) / elapsed
+		if l.rateKnown {
+			l.rate = adaptiveSmoothing*sample + (1-adaptiveSmoothing)*l.rate
+		} else {
+			l.rate, l.rateKnown = sample, true
+		}
+	}
+	l.rateTime, l.rateSequence = now, l.sequence
+}
+
+// recordsThreshold returns how many events logged since the last flush make the logger flush:
+// those of a FlushInterval at the smoothed rate with AdaptiveFlush, within its bounds, else
+// FlushEveryNRecords, unless overridden by the FlushThresholds.
+func (l *s3logger) recordsThreshold() int {
+	interval, records, _ := l.flushThresholds()
+	if !l.adaptive || !l.rateKnown {
+		return records
+	}
+	n := int(math.Ceil(l.rate * interval.Seconds()))
+	if n < l.adaptiveMin {
+		n = l.adaptiveMin
+	}
+	if n < 1 {
+		n = 1
+	}
+	if l.adaptiveMax > 0 && n > l.adaptiveMax {
+		n = l.adaptiveMax
+	}
+	return n
+}
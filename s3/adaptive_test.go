@@ -0,0 +1,56 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerLearnsEventRate(t *testing.T) {
+	assert := assert.New(t)
+
+	l := makeTestLogger()
+	l.adaptive = true
+	l.flushInterval = 10 * time.Second
+	l.maxRecords = 1000
+	assert.Equal(1000, l.recordsThreshold())
+
+	l.sequence = 20
+	l.rateTime = time.Now().Add(-2 * time.Second)
+	l.learnRate()
+	assert.InDelta(10, l.rate, 0.1)
+	assert.Equal(100, l.recordsThreshold())
+
+	// a quiet interval lowers the rate smoothly
+	l.rateTime = time.Now().Add(-2 * time.Second)
+	l.learnRate()
+	assert.InDelta(7, l.rate, 0.1)
+	assert.Equal(70, l.recordsThreshold())
+
+	l.adaptiveMax = 50
+	assert.Equal(50, l.recordsThreshold())
+	l.rate, l.adaptiveMin = 0, 5
+	assert.Equal(5, l.recordsThreshold())
+}
+
+func TestS3LoggerFlushesAdaptively(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+	lf.FlushInterval = time.Hour
+	lf.AdaptiveFlush = true
+
+	l := lf.newS3Logger("a")
+	l.rate, l.rateKnown = 1/time.Hour.Seconds(), true
+	l.add([]byte("a\n"))
+	l.flushFull()
+	assert.Equal([]byte("a\n"), m.objects["/bucket/a"])
+
+	assert.Panics(func() {
+		lf.FlushInterval = 0
+		lf.NewLogger("a")
+	})
+}
@@ -0,0 +1,130 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+)
+
+// Backfiller re-partitions archived events, e.g. after changing the partitioning scheme, by
+// reading the objects under a prefix and logging their events to a router configured with the
+// new PartitionKeyFunc and a LoggerFactory writing under the new prefix. Objects are read
+// decompressed and decrypted as loggers wrote them, and split in lines.
+type Backfiller struct {
+	S3     *s3.S3
+	Bucket string
+	Prefix string
+	// KeyRing decrypts the objects written with client-side encryption, if any.
+	KeyRing *KeyRing
+	// Router receives the events. It is not closed by Run.
+	Router laozi.Laozi
+}
+
+// Run logs the events of every object under the Prefix to the Router, returning the number
+// of objects and events read.
+func (b *Backfiller) Run() (objects int, events int, err error) {
+	var keys []string
+	err = b.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(b.Bucket),
+		Prefix: aws.String(b.Prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			keys = append(keys, aws.StringValue(o.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, key := range keys {
+		data, err := readArchive(b.S3, b.Bucket, key, b.KeyRing)
+		if err != nil {
+			return objects, events, fmt.Errorf("could not read %s: %s", key, err)
+		}
+		for _, e := range splitRecords(data) {
+			b.Router.Log(e)
+			events++
+		}
+		objects++
+	}
+	return objects, events, nil
+}
+
+// splitRecords splits the lines of an archived object, keeping their newlines.
+func splitRecords(data []byte) [][]byte {
+	var records [][]byte
+	for len(data) > 0 {
+		record := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			record = data[:i+1]
+		}
+		data = data[len(record):]
+		records = append(records, record)
+	}
+	return records
+}
+
+// readArchive returns the events of an archived object, decrypted and decompressed.
+func readArchive(svc *s3.S3, bucket, key string, keyRing *KeyRing) ([]byte, error) {
+	return readArchiveVersion(svc, bucket, key, "", keyRing)
+}
+
+// readArchiveVersion is readArchive for a version of the object, or the current one if empty.
+func readArchiveVersion(svc *s3.S3, bucket, key, versionID string, keyRing *KeyRing) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	resp, err := svc.GetObject(input)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeArchive(svc, bucket, data, resp.Metadata, keyRing)
+}
+
+// decodeArchive decrypts and decompresses the data of an archived object of a bucket with its
+// metadata.
+func decodeArchive(svc *s3.S3, bucket string, data []byte, metadata map[string]*string, keyRing *KeyRing) ([]byte, error) {
+	if id := metadata[keyIDMetadata]; id != nil {
+		if keyRing == nil {
+			return nil, fmt.Errorf("encrypted but no KeyRing is configured")
+		}
+		var err error
+		if data, err = keyRing.Decrypt(aws.StringValue(id), data); err != nil {
+			return nil, err
+		}
+	}
+	if compress.IsGzip(data) {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(gr)
+	}
+	if compress.IsZstd(data) {
+		var dict []byte
+		if key := metadata[dictionaryMetadata]; key != nil {
+			var err error
+			if dict, err = readDictionary(svc, bucket, aws.StringValue(key)); err != nil {
+				return nil, err
+			}
+		}
+		return compress.DecompressZstd(data, dict)
+	}
+	return data, nil
+}
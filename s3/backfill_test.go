@@ -0,0 +1,44 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillerRepartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{
+		"/bucket/old/a":    []byte("x1\ny1\n"),
+		"/bucket/old/b.gz": compress.Compress("gzip", []byte("x2\ny2")),
+		"/bucket/other/c":  []byte("x3\n"),
+	}}
+	lf := makeTestS3Factory(t, m)
+	lf.Prefix = "new/"
+	r := laozi.NewLaozi(&laozi.Config{
+		LoggerFactory:    lf,
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return string(e[:1]), nil },
+	})
+
+	b := &Backfiller{
+		S3:     s3.New(session.New(), lf.s3Config()),
+		Bucket: "bucket",
+		Prefix: "old/",
+		Router: r,
+	}
+	objects, events, err := b.Run()
+	assert.NoError(err)
+	r.Close()
+
+	assert.Equal(2, objects)
+	assert.Equal(4, events)
+	assert.Equal("x1\nx2\n", string(m.objects["/bucket/new/x"]))
+	assert.Equal("y1\ny2", string(m.objects["/bucket/new/y"]))
+}
@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// Buffer holds the events of a logger of an S3LoggerFactory until they are flushed, e.g. in a
+// memory-mapped or encrypted file instead of memory, see S3LoggerFactory.NewBuffer. It is only
+// used by the goroutine of its logger.
+type Buffer interface {
+	io.Writer
+	// Len returns the size of the content, and Bytes the content itself, valid until the
+	// buffer is next modified.
+	Len() int
+	Bytes() []byte
+	// Truncate discards all but the first n bytes of the content, and Reset all of it.
+	Truncate(n int)
+	Reset()
+	// Reader returns a reader of the content for StreamUploads, closed once uploaded. The
+	// buffer isn't modified until then.
+	Reader() io.ReadCloser
+}
+
+// memoryBuffer is the default Buffer, in memory.
+type memoryBuffer struct {
+	*bytes.Buffer
+}
+
+func newMemoryBuffer(data []byte) Buffer {
+	return memoryBuffer{bytes.NewBuffer(data)}
+}
+
+func (b memoryBuffer) Reader() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(b.Bytes()))
+}
+
+// newBuffer makes the buffer of the logger of a partition.
+func (lf S3LoggerFactory) newBuffer(key string) Buffer {
+	if lf.NewBuffer == nil {
+		return newMemoryBuffer([]byte{})
+	}
+	return lf.NewBuffer(key)
+}
@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fileBuffer is a Buffer in a temporary file, as users may supply.
+type fileBuffer struct {
+	t       *testing.T
+	name    string
+	readers int
+}
+
+func (b *fileBuffer) Write(p []byte) (int, error) {
+	data, _ := ioutil.ReadFile(b.name)
+	return len(p), ioutil.WriteFile(b.name, append(data, p...), 0600)
+}
+
+func (b *fileBuffer) Bytes() []byte {
+	data, err := ioutil.ReadFile(b.name)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return data
+}
+
+func (b *fileBuffer) Len() int {
+	return len(b.Bytes())
+}
+
+func (b *fileBuffer) Truncate(n int) {
+	ioutil.WriteFile(b.name, b.Bytes()[:n], 0600)
+}
+
+func (b *fileBuffer) Reset() {
+	b.Truncate(0)
+}
+
+func (b *fileBuffer) Reader() io.ReadCloser {
+	b.readers++
+	return ioutil.NopCloser(bytes.NewReader(b.Bytes()))
+}
+
+func TestS3LoggerUsesCustomBuffers(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}}
+	lf := makeTestS3Factory(t, m)
+	lf.AsyncPreviousData = true
+	lf.IsDupeFunc = func(e, line []byte) bool { return bytes.Equal(e, line) }
+	buffers := map[string]*fileBuffer{}
+	lf.NewBuffer = func(key string) Buffer {
+		b := &fileBuffer{t: t, name: t.TempDir() + "/" + key}
+		ioutil.WriteFile(b.name, nil, 0600)
+		buffers[key] = b
+		return b
+	}
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+	assert.Equal([]byte("old\nnew\n"), m.objects["/bucket/a"])
+	assert.Equal([]byte("old\nnew\n"), buffers["a"].Bytes())
+
+	// streamed uploads read the buffer
+	lf.IsDupeFunc = nil
+	lf.AsyncPreviousData = false
+	lf.SkipPreviousData = true
+	lf.StreamUploads = true
+	lf.Compression = "gzip"
+	sl := lf.newS3Logger("b")
+	sl.add([]byte("event\n"))
+	assert.NoError(sl.flush())
+	assert.Equal(1, buffers["b"].readers)
+	gr, err := gzip.NewReader(bytes.NewReader(m.objects["/bucket/b"]))
+	assert.NoError(err)
+	uploaded, _ := ioutil.ReadAll(gr)
+	assert.Equal([]byte("event\n"), uploaded)
+}
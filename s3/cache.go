@@ -0,0 +1,147 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// LocalCache keeps the last objects flushed by the loggers of every partition on local disk,
+// see S3LoggerFactory.LocalCache. Recent data can then be read without S3 GETs, and a
+// restarted logger only downloads the previous data of its key if it changed meanwhile.
+type LocalCache struct {
+	Dir string
+	// MaxObjects is the number of objects kept per partition, defaults to 1. Partitions not
+	// rotating objects only need one.
+	MaxObjects int
+}
+
+// CachedObject is an object of a LocalCache.
+type CachedObject struct {
+	Key  string            `json:"key"`
+	ETag string            `json:"etag"`
+	Time time.Time         `json:"time"`
+	Meta map[string]string `json:"metadata"`
+	// Data is the object as uploaded, i.e. compressed or encrypted if configured.
+	Data []byte `json:"-"`
+}
+
+// Objects returns the cached objects of a partition, the most recent first.
+func (c *LocalCache) Objects(partition string) ([]CachedObject, error) {
+	dir := c.partitionDir(partition)
+	names, err := filepath.Glob(filepath.Join(dir, "*.meta"))
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []CachedObject
+	for _, name := range names {
+		o, err := c.read(strings.TrimSuffix(name, ".meta"))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Time.After(objects[j].Time) })
+	return objects, nil
+}
+
+// get returns the cached object of a key, if any.
+func (c *LocalCache) get(partition, key string) (CachedObject, bool) {
+	if c == nil {
+		return CachedObject{}, false
+	}
+	o, err := c.read(c.path(partition, key))
+	return o, err == nil
+}
+
+// put caches an uploaded object, dropping the oldest ones of the partition beyond MaxObjects.
+func (c *LocalCache) put(partition string, o CachedObject) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.partitionDir(partition), 0700); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	path := c.path(partition, o.Key)
+	if err := ioutil.WriteFile(path, o.Data, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".meta", meta, 0600); err != nil {
+		return err
+	}
+
+	objects, err := c.Objects(partition)
+	if err != nil {
+		return err
+	}
+	max := c.MaxObjects
+	if max <= 0 {
+		max = 1
+	}
+	for i := max; i < len(objects); i++ {
+		old := c.path(partition, objects[i].Key)
+		os.Remove(old + ".meta")
+		os.Remove(old)
+	}
+	return nil
+}
+
+func (c *LocalCache) read(path string) (CachedObject, error) {
+	var o CachedObject
+	meta, err := ioutil.ReadFile(path + ".meta")
+	if err != nil {
+		return o, err
+	}
+	if err := json.Unmarshal(meta, &o); err != nil {
+		return o, err
+	}
+	o.Data, err = ioutil.ReadFile(path)
+	return o, err
+}
+
+func (c *LocalCache) partitionDir(partition string) string {
+	return filepath.Join(c.Dir, url.PathEscape(partition))
+}
+
+func (c *LocalCache) path(partition, key string) string {
+	return filepath.Join(c.partitionDir(partition), url.PathEscape(key))
+}
+
+// cacheUpload caches an object the logger uploaded.
+func (l *s3logger) cacheUpload(key, etag string, body []byte, metadata map[string]*string) {
+	if l.cache == nil || etag == "" {
+		return
+	}
+	err := l.cache.put(l.partition, CachedObject{
+		Key:  key,
+		ETag: etag,
+		Time: time.Now(),
+		Meta: aws.StringValueMap(metadata),
+		Data: body,
+	})
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not cache object: %s: %s\n", key, err)
+	}
+}
+
+func isNotModified(err error) bool {
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		return rerr.StatusCode() == http.StatusNotModified
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalCacheKeepsRecentObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.LocalCache = &LocalCache{Dir: t.TempDir(), MaxObjects: 2}
+
+	l := lf.NewLogger("a").(*s3logger)
+	for _, e := range []string{"1\n", "2\n", "3\n"} {
+		l.add([]byte(e))
+		assert.NoError(l.flush())
+	}
+
+	objects, err := lf.LocalCache.Objects("a")
+	assert.NoError(err)
+	assert.Equal(2, len(objects))
+	assert.Equal("3\n", string(objects[0].Data))
+	assert.Equal("2\n", string(objects[1].Data))
+	assert.Equal(etag([]byte("3\n")), objects[0].ETag)
+}
+
+func TestLocalCacheServesUnchangedPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.LocalCache = &LocalCache{Dir: t.TempDir()}
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("old\n"))
+	assert.NoError(l.Close())
+
+	// the object is unchanged, so it is read from the cache
+	objects, _ := lf.LocalCache.Objects("a")
+	objects[0].Data = []byte("cached\n")
+	assert.NoError(lf.LocalCache.put("a", objects[0]))
+	l = lf.NewLogger("a")
+	assert.Equal("cached\n", string(l.(*s3logger).Buffered()))
+	l.Close()
+
+	// another process wrote to it meanwhile
+	m.objects["/bucket/a"] = []byte("other\n")
+	l = lf.NewLogger("a")
+	assert.Equal("other\n", string(l.(*s3logger).Buffered()))
+	l.Close()
+}
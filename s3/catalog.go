@@ -0,0 +1,151 @@
+package s3
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const defaultCatalogTable = "laozi_objects"
+
+// CatalogEntry describes an object flushed by a logger, see Catalog.
+type CatalogEntry struct {
+	Partition string
+	Key       string
+	// Window is the start of the rotation window of rotated objects, zero otherwise.
+	Window time.Time
+	// Records is the number of events of rotated objects, or the sequence of the partition for
+	// others, and Bytes the size uploaded. Checksum is the hex SHA-256 of the upload, empty
+	// with StreamUploads.
+	Records  int64
+	Bytes    int
+	Checksum string
+	// Flushed is when the object was flushed.
+	Flushed time.Time
+}
+
+// Catalog records every object flushed by the loggers of an S3LoggerFactory, e.g. to find the
+// objects of a partition without listing the bucket. Failing to record an object doesn't
+// fail its flush.
+type Catalog interface {
+	// RecordObject records an object, replacing any previous entry for the same key.
+	RecordObject(CatalogEntry) error
+}
+
+// SQLiteCatalog is a Catalog kept in a table of a SQLite database, a lightweight alternative to
+// a Glue catalog or manifests for small deployments. DB must be opened with a SQLite driver,
+// e.g. modernc.org/sqlite or github.com/mattn/go-sqlite3.
+type SQLiteCatalog struct {
+	DB *sql.DB
+	// Table defaults to "laozi_objects".
+	Table string
+}
+
+// NewSQLiteCatalog returns a catalog in the table of a SQLite database, creating the table if
+// need be.
+func NewSQLiteCatalog(db *sql.DB, table string) (*SQLiteCatalog, error) {
+	c := &SQLiteCatalog{DB: db, Table: table}
+	if c.Table == "" {
+		c.Table = defaultCatalogTable
+	}
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]q (
+		key TEXT PRIMARY KEY,
+		partition TEXT NOT NULL,
+		window_start INTEGER NOT NULL,
+		records INTEGER NOT NULL,
+		bytes INTEGER NOT NULL,
+		checksum TEXT NOT NULL,
+		flushed INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS %[2]q ON %[1]q (partition, window_start)`, c.Table, c.Table+"_partition"))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RecordObject records an object, replacing any previous entry for the same key.
+func (c *SQLiteCatalog) RecordObject(e CatalogEntry) error {
+	var window int64
+	if !e.Window.IsZero() {
+		window = e.Window.UnixNano()
+	}
+	_, err := c.DB.Exec(fmt.Sprintf(`INSERT OR REPLACE INTO %q
+		(key, partition, window_start, records, bytes, checksum, flushed)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, c.Table),
+		e.Key, e.Partition, window, e.Records, e.Bytes, e.Checksum, e.Flushed.UnixNano())
+	return err
+}
+
+// Objects returns the objects of a partition, in window and key order.
+func (c *SQLiteCatalog) Objects(partition string) ([]CatalogEntry, error) {
+	rows, err := c.DB.Query(fmt.Sprintf(`SELECT key, partition, window_start, records, bytes, checksum, flushed
+		FROM %q WHERE partition = ? ORDER BY window_start, key`, c.Table), partition)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []CatalogEntry
+	for rows.Next() {
+		var e CatalogEntry
+		var window, flushed int64
+		if err := rows.Scan(&e.Key, &e.Partition, &window, &e.Records, &e.Bytes, &e.Checksum, &flushed); err != nil {
+			return nil, err
+		}
+		if window != 0 {
+			e.Window = time.Unix(0, window).UTC()
+		}
+		e.Flushed = time.Unix(0, flushed).UTC()
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// MayExist reports whether the catalog recorded an object of the key, as a KeyIndex.
+func (c *SQLiteCatalog) MayExist(key string) (bool, error) {
+	var n int
+	err := c.DB.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %q WHERE key = ?`, c.Table), key).Scan(&n)
+	return n > 0, err
+}
+
+// Partitions returns the partitions of the catalog, sorted.
+func (c *SQLiteCatalog) Partitions() ([]string, error) {
+	rows, err := c.DB.Query(fmt.Sprintf(`SELECT DISTINCT partition FROM %q ORDER BY partition`, c.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, rows.Err()
+}
+
+// catalogObject records a flushed object in the Catalog, if any.
+func (l *s3logger) catalogObject(key string) {
+	if l.catalog == nil {
+		return
+	}
+	e := CatalogEntry{
+		Partition: l.partition,
+		Key:       key,
+		Records:   l.sequence,
+		Bytes:     l.uploadedBytes,
+		Checksum:  l.uploadedChecksum,
+		Flushed:   time.Now(),
+	}
+	if l.rotation > 0 {
+		e.Window = l.batchStart.UTC().Truncate(l.rotation)
+		e.Records = l.sequence - l.flushedSequence
+	}
+	if err := l.catalog.RecordObject(e); err != nil {
+		fmt.Printf(" [laozi] Error! Could not catalog object: %s: %s\n", key, err)
+	}
+}
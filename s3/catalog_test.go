@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func makeTestCatalog(t *testing.T) *SQLiteCatalog {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c, err := NewSQLiteCatalog(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSQLiteCatalogRecordsObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	c := makeTestCatalog(t)
+	window := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(c.RecordObject(CatalogEntry{Partition: "a", Key: "a/2", Window: window.Add(time.Hour), Records: 2}))
+	assert.NoError(c.RecordObject(CatalogEntry{Partition: "a", Key: "a/1", Window: window, Records: 1}))
+	assert.NoError(c.RecordObject(CatalogEntry{Partition: "a", Key: "a/1", Window: window, Records: 3}))
+	assert.NoError(c.RecordObject(CatalogEntry{Partition: "b", Key: "b", Records: 1}))
+
+	entries, err := c.Objects("a")
+	if assert.NoError(err) && assert.Len(entries, 2) {
+		assert.Equal("a/1", entries[0].Key)
+		assert.Equal(window, entries[0].Window)
+		assert.Equal(int64(3), entries[0].Records)
+		assert.Equal("a/2", entries[1].Key)
+	}
+	entries, err = c.Objects("b")
+	if assert.NoError(err) && assert.Len(entries, 1) {
+		assert.True(entries[0].Window.IsZero())
+	}
+
+	partitions, err := c.Partitions()
+	assert.NoError(err)
+	assert.Equal([]string{"a", "b"}, partitions)
+}
+
+func TestS3LoggerCatalogsObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.Catalog = makeTestCatalog(t)
+
+	l := lf.newS3Logger("a")
+	l.add([]byte("a\n"))
+	l.add([]byte("b\n"))
+	key := l.rotatedKey()
+	assert.NoError(l.flush())
+
+	entries, err := lf.Catalog.(*SQLiteCatalog).Objects("a")
+	if assert.NoError(err) && assert.Len(entries, 1) {
+		assert.Equal(key, entries[0].Key)
+		assert.Equal(int64(2), entries[0].Records)
+		assert.Equal(len("a\nb\n"), entries[0].Bytes)
+		assert.Equal(time.Now().UTC().Truncate(time.Hour), entries[0].Window)
+		assert.Len(entries[0].Checksum, 64)
+	}
+}
@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockCheckpointer struct {
+	checkpoints map[string]laozi.Checkpoint
+	// loadErr fails loading checkpoints
+	loadErr error
+}
+
+func (m *MockCheckpointer) SaveCheckpoint(c laozi.Checkpoint) error {
+	m.checkpoints[c.Partition] = c
+	return nil
+}
+
+func (m *MockCheckpointer) LoadCheckpoint(partition string) (laozi.Checkpoint, bool, error) {
+	if m.loadErr != nil {
+		return laozi.Checkpoint{}, false, m.loadErr
+	}
+	c, found := m.checkpoints[partition]
+	return c, found, nil
+}
+
+func TestS3LoggerCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	cp := &MockCheckpointer{checkpoints: map[string]laozi.Checkpoint{}}
+	l := makeTestLogger()
+	l.partition = "testkey"
+	l.checkpointer = cp
+	l.buffer.Write([]byte("some data"))
+	l.sequence = 3
+
+	assert.NoError(l.checkpoint(testFile))
+
+	c := cp.checkpoints["testkey"]
+	assert.Equal(testFile, c.Key)
+	assert.Equal(int64(3), c.Sequence)
+	assert.Equal(int64(9), c.Offset)
+}
+
+func TestS3LoggerLoadsCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	cp := &MockCheckpointer{checkpoints: map[string]laozi.Checkpoint{
+		"testkey": {Partition: "testkey", Sequence: 7},
+	}}
+	l := makeTestLogger()
+	l.partition = "testkey"
+	l.checkpointer = cp
+
+	found, err := l.loadCheckpoint()
+	assert.NoError(err)
+	assert.True(found)
+	go l.loop()
+
+	l.logChan <- []byte("a\n")
+	l.logChan <- []byte("b\n")
+
+	// the loop is done with the events once it returns the buffer
+	l.Buffered()
+
+	assert.Equal(int64(9), l.sequence)
+}
+
+func TestS3LoggerFailsWithoutCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.Checkpointer = &MockCheckpointer{loadErr: errors.New("table is down")}
+
+	_, err := lf.NewLoggerContext(context.Background(), "a")
+	assert.EqualError(err, "table is down")
+
+	// without a context, flushes fail rather than restart the sequence
+	l := lf.NewLogger("a")
+	l.Log([]byte("a\n"))
+	var prev *laozi.ErrPreviousData
+	assert.True(errors.As(l.Close(), &prev))
+	assert.Empty(m.objects)
+}
@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+type dedupeS3Logger struct {
+	*s3logger
+	isDupeFunc func(event []byte, line []byte) bool
+}
+
+func (l *dedupeS3Logger) loop() {
+	defer close(l.stopped)
+	flushChan := l.nextFlush()
+
+	var event []byte
+	for {
+		select {
+		case <-flushChan:
+			l.learnRate()
+			if l.previous == nil {
+				l.flush()
+				l.markEmptyWindows()
+			}
+			flushChan = l.nextFlush()
+		case event = <-l.logChan:
+			l.add(event)
+			l.flushFull()
+		case events := <-l.batchChan:
+			for _, e := range events {
+				l.add(e)
+				l.flushFull()
+			}
+		case prev := <-l.previous:
+			l.mergePrevious(prev)
+		case done := <-l.flushRequests:
+			l.waitPrevious()
+			done <- l.flush()
+		case done := <-l.bufferedRequests:
+			done <- l.bufferedCopy()
+		case <-l.quitChan:
+			return
+		default:
+			if flushChan == nil {
+				// a flush interval may have been set meanwhile
+				flushChan = l.nextFlush()
+			}
+			// chill out for a moment...
+			time.Sleep(time.Millisecond)
+		}
+		l.storeBuffered()
+	}
+}
+
+// add writes an event to the buffer, unless it is a dupe of an event already in it.
+func (l *dedupeS3Logger) add(event []byte) {
+	l.received++
+	l.sliceWindow()
+	var tmp []byte
+	buffer := bytes.NewBuffer(l.buffer.Bytes())
+	for {
+		// the last line is kept even if an event didn't end it with a newline
+		line, err := buffer.ReadBytes('\n')
+		if len(line) > 0 && l.isDupeFunc(event, l.unstamp(line)) {
+			tmp = append(append(tmp, line...), buffer.Bytes()...)
+			break
+		}
+		tmp = append(tmp, line...)
+		if err == io.EOF {
+			// didn't find dupe in buffer so write
+			l.buffered()
+			tmp = append(append(tmp, l.stamp()...), l.terminate(event)...)
+			break
+		}
+	}
+	l.buffer.Reset()
+	l.buffer.Write(tmp)
+}
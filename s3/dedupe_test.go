@@ -1,4 +1,4 @@
-package laozi
+package s3
 
 import (
 	"testing"
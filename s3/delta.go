@@ -0,0 +1,365 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/parquet-go/parquet-go"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+)
+
+const defaultDeltaBatchSize = 10000
+
+// deltaSchema is the Delta schema of the deltaRow parquet files.
+const deltaSchema = `{"type":"struct","fields":[` +
+	`{"name":"partition","type":"string","nullable":false,"metadata":{}},` +
+	`{"name":"sequence","type":"long","nullable":false,"metadata":{}},` +
+	`{"name":"event","type":"string","nullable":false,"metadata":{}}]}`
+
+// DeltaLoggerFactory is a logger factory for creating loggers that store the events of every
+// partition as a Delta Lake table on S3, rooted at <Prefix><key>. Every flush writes a parquet
+// data file and commits it to the table log, so the events are queryable with Delta readers
+// (Spark, Trino, DuckDB...) as soon as they are flushed. Each table must only be written by
+// one logger at a time, e.g. with a PartitionLocker.
+//
+// This is experimental: tables have a fixed schema of partition, sequence and raw event
+// string columns, and are never checkpointed or compacted.
+type DeltaLoggerFactory struct {
+	Prefix        string
+	Bucket        string
+	Region        string
+	FlushInterval time.Duration
+	// BatchSize is the max number of events of a data file, defaults to 10000.
+	BatchSize int
+}
+
+// NewLogger returns a new instance of a Delta logger for a corresponding partition key. If the
+// log of its table can't be read to resume its sequence, its flushes fail.
+func (lf DeltaLoggerFactory) NewLogger(key string) laozi.Logger {
+	w := lf.writer(key)
+	write := w.write
+	if err := w.resume(); err != nil {
+		fmt.Printf(" [laozi] Error! Could not read table log, flushes will fail: %s: %s\n", w.table, err)
+		write = func(*laozi.Batch) error { return err }
+	}
+	return laozi.NewBatchLogger(key, write, lf.FlushInterval, lf.batchSize(), w.sequence)
+}
+
+// NewLoggerContext is NewLogger failing if the log of the table can't be read. The reads
+// aren't cancelled with ctx.
+func (lf DeltaLoggerFactory) NewLoggerContext(ctx context.Context, key string) (laozi.Logger, error) {
+	w := lf.writer(key)
+	if err := w.resume(); err != nil {
+		return nil, err
+	}
+	return laozi.NewBatchLogger(key, w.write, lf.FlushInterval, lf.batchSize(), w.sequence), nil
+}
+
+// writer returns the writer of the table of a partition key.
+func (lf DeltaLoggerFactory) writer(key string) *deltaWriter {
+	return &deltaWriter{
+		fs: &s3TableFS{
+			S3:     s3.New(session.New(), &aws.Config{Region: aws.String(lf.Region)}),
+			bucket: lf.Bucket,
+		},
+		table:     lf.Prefix + key,
+		partition: key,
+		version:   -1,
+	}
+}
+
+func (lf DeltaLoggerFactory) batchSize() int {
+	if lf.BatchSize <= 0 {
+		return defaultDeltaBatchSize
+	}
+	return lf.BatchSize
+}
+
+// tableFS is the storage tables are written to.
+type tableFS interface {
+	writeFile(name string, data []byte) error
+	// createFile writes a file unless it exists, returning false if it does.
+	createFile(name string, data []byte) (bool, error)
+	readFile(name string) ([]byte, error)
+	// list returns the names of the files in a directory.
+	list(dir string) ([]string, error)
+}
+
+type deltaRow struct {
+	Partition string `parquet:"partition"`
+	Sequence  int64  `parquet:"sequence"`
+	Event     string `parquet:"event"`
+}
+
+// deltaAction is a line of a Delta commit file.
+type deltaAction struct {
+	Protocol   *deltaProtocol   `json:"protocol,omitempty"`
+	MetaData   *deltaMetaData   `json:"metaData,omitempty"`
+	Txn        *deltaTxn        `json:"txn,omitempty"`
+	Add        *deltaAdd        `json:"add,omitempty"`
+	CommitInfo *deltaCommitInfo `json:"commitInfo,omitempty"`
+}
+
+type deltaProtocol struct {
+	MinReaderVersion int `json:"minReaderVersion"`
+	MinWriterVersion int `json:"minWriterVersion"`
+}
+
+type deltaMetaData struct {
+	ID               string            `json:"id"`
+	Format           deltaFormat       `json:"format"`
+	SchemaString     string            `json:"schemaString"`
+	PartitionColumns []string          `json:"partitionColumns"`
+	Configuration    map[string]string `json:"configuration"`
+	CreatedTime      int64             `json:"createdTime"`
+}
+
+type deltaFormat struct {
+	Provider string            `json:"provider"`
+	Options  map[string]string `json:"options"`
+}
+
+// deltaTxn records the last sequence committed by the logger of a table, so a commit is not
+// repeated after a retry or a restart.
+type deltaTxn struct {
+	AppID       string `json:"appId"`
+	Version     int64  `json:"version"`
+	LastUpdated int64  `json:"lastUpdated"`
+}
+
+type deltaAdd struct {
+	Path             string            `json:"path"`
+	PartitionValues  map[string]string `json:"partitionValues"`
+	Size             int64             `json:"size"`
+	ModificationTime int64             `json:"modificationTime"`
+	DataChange       bool              `json:"dataChange"`
+}
+
+type deltaCommitInfo struct {
+	Timestamp int64  `json:"timestamp"`
+	Operation string `json:"operation"`
+}
+
+// deltaWriter writes the batches of a partition to its Delta table.
+type deltaWriter struct {
+	fs        tableFS
+	table     string
+	partition string
+	// version of the last commit of the table, -1 if it has none
+	version  int64
+	sequence int64
+}
+
+func (w *deltaWriter) logName(version int64) string {
+	return fmt.Sprintf("%s/_delta_log/%020d.json", w.table, version)
+}
+
+func (w *deltaWriter) appID() string {
+	return "laozi-" + w.partition
+}
+
+// resume finds the last commit of the table and the sequence it was committed at.
+func (w *deltaWriter) resume() error {
+	names, err := w.fs.list(w.table + "/_delta_log")
+	if err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		if !strings.HasSuffix(n, ".json") {
+			continue
+		}
+		if v, err := strconv.ParseInt(strings.TrimSuffix(n, ".json"), 10, 64); err == nil && v > w.version {
+			w.version = v
+		}
+	}
+	if w.version < 0 {
+		return nil
+	}
+
+	seq, found, err := w.committedSequence(w.version)
+	if found {
+		w.sequence = seq
+	}
+	return err
+}
+
+// committedSequence returns the sequence recorded by the commit of the given version, if it
+// was made by a laozi logger of the partition.
+func (w *deltaWriter) committedSequence(version int64) (int64, bool, error) {
+	data, err := w.fs.readFile(w.logName(version))
+	if err != nil {
+		return 0, false, err
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		var a deltaAction
+		if err := json.Unmarshal(s.Bytes(), &a); err != nil {
+			return 0, false, err
+		}
+		if a.Txn != nil && a.Txn.AppID == w.appID() {
+			return a.Txn.Version, true, nil
+		}
+	}
+	return 0, false, s.Err()
+}
+
+func (w *deltaWriter) write(b *laozi.Batch) error {
+	if b.Last() <= w.sequence {
+		// committed before the logger restarted
+		return nil
+	}
+
+	var buf bytes.Buffer
+	pw := parquet.NewWriter(&buf, parquet.SchemaOf(deltaRow{}))
+	for i, e := range b.Events {
+		row := deltaRow{
+			Partition: w.partition,
+			Sequence:  b.First + int64(i),
+			Event:     string(bytes.TrimRight(e, "\r\n")),
+		}
+		if err := pw.Write(&row); err != nil {
+			return err
+		}
+	}
+	if err := pw.Close(); err != nil {
+		return err
+	}
+
+	// data files are named after their events, so a retry overwrites the file of the failed attempt
+	name := fmt.Sprintf("part-%s.parquet", rotating.SequenceRange(b.First, b.Last()))
+	if err := w.fs.writeFile(w.table+"/"+name, buf.Bytes()); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	var actions []deltaAction
+	if w.version < 0 {
+		actions = append(actions,
+			deltaAction{Protocol: &deltaProtocol{MinReaderVersion: 1, MinWriterVersion: 2}},
+			deltaAction{MetaData: &deltaMetaData{
+				ID:               newTableID(),
+				Format:           deltaFormat{Provider: "parquet", Options: map[string]string{}},
+				SchemaString:     deltaSchema,
+				PartitionColumns: []string{},
+				Configuration:    map[string]string{},
+				CreatedTime:      now,
+			}},
+		)
+	}
+	actions = append(actions,
+		deltaAction{Txn: &deltaTxn{AppID: w.appID(), Version: b.Last(), LastUpdated: now}},
+		deltaAction{Add: &deltaAdd{
+			Path:             name,
+			PartitionValues:  map[string]string{},
+			Size:             int64(buf.Len()),
+			ModificationTime: now,
+			DataChange:       true,
+		}},
+		deltaAction{CommitInfo: &deltaCommitInfo{Timestamp: now, Operation: "WRITE"}},
+	)
+
+	var commit bytes.Buffer
+	enc := json.NewEncoder(&commit)
+	for _, a := range actions {
+		enc.Encode(a)
+	}
+
+	version := w.version + 1
+	created, err := w.fs.createFile(w.logName(version), commit.Bytes())
+	if err != nil {
+		return err
+	}
+	if !created {
+		// an attempt whose response was lost may have committed the batch
+		seq, found, err := w.committedSequence(version)
+		if err != nil {
+			return err
+		}
+		if !found || seq != b.Last() {
+			w.version = version
+			return fmt.Errorf("version %d of table %s was committed by another writer", version, w.table)
+		}
+	}
+
+	w.version = version
+	w.sequence = b.Last()
+	return nil
+}
+
+// newTableID returns a random UUID identifying a new table.
+func newTableID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// s3TableFS stores tables in an S3 bucket.
+type s3TableFS struct {
+	S3     *s3.S3
+	bucket string
+}
+
+func (fs *s3TableFS) put(name string, data []byte, opts ...request.Option) error {
+	_, err := fs.S3.PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+		Bucket: aws.String(fs.bucket),
+		Key:    aws.String(name),
+		Body:   bytes.NewReader(data),
+	}, opts...)
+	return err
+}
+
+func (fs *s3TableFS) writeFile(name string, data []byte) error {
+	return fs.put(name, data)
+}
+
+func (fs *s3TableFS) createFile(name string, data []byte) (bool, error) {
+	err := fs.put(name, data, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}))
+	if isAlreadyUploaded(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (fs *s3TableFS) readFile(name string) ([]byte, error) {
+	resp, err := fs.S3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(fs.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (fs *s3TableFS) list(dir string) ([]string, error) {
+	var names []string
+	err := fs.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(fs.bucket),
+		Prefix: aws.String(dir + "/"),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			names = append(names, path.Base(aws.StringValue(o.Key)))
+		}
+		return true
+	})
+	return names, err
+}
@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockTableFS keeps files in memory.
+type mockTableFS struct {
+	sync.Mutex
+	files map[string][]byte
+}
+
+func (fs *mockTableFS) writeFile(name string, data []byte) error {
+	fs.Lock()
+	defer fs.Unlock()
+	fs.files[name] = data
+	return nil
+}
+
+func (fs *mockTableFS) createFile(name string, data []byte) (bool, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	if _, ok := fs.files[name]; ok {
+		return false, nil
+	}
+	fs.files[name] = data
+	return true, nil
+}
+
+func (fs *mockTableFS) readFile(name string) ([]byte, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	data, ok := fs.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (fs *mockTableFS) list(dir string) ([]string, error) {
+	fs.Lock()
+	defer fs.Unlock()
+	var names []string
+	for name := range fs.files {
+		if path.Dir(name) == dir {
+			names = append(names, path.Base(name))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func makeTestDeltaWriter(t *testing.T, fs *mockTableFS) *deltaWriter {
+	w := &deltaWriter{fs: fs, table: "tables/a", partition: "a", version: -1}
+	assert.NoError(t, w.resume())
+	return w
+}
+
+func TestDeltaWriterCommitsBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := &mockTableFS{files: map[string][]byte{}}
+	w := makeTestDeltaWriter(t, fs)
+	assert.NoError(w.write(&laozi.Batch{Events: [][]byte{[]byte("1\n"), []byte("2\n")}, First: 1}))
+	assert.NoError(w.write(&laozi.Batch{Events: [][]byte{[]byte("3\n")}, First: 3}))
+
+	logs, _ := fs.list("tables/a/_delta_log")
+	assert.Equal([]string{"00000000000000000000.json", "00000000000000000001.json"}, logs)
+
+	first := string(fs.files["tables/a/_delta_log/00000000000000000000.json"])
+	assert.Contains(first, `"protocol"`)
+	assert.Contains(first, `"metaData"`)
+	second := string(fs.files["tables/a/_delta_log/00000000000000000001.json"])
+	assert.NotContains(second, `"metaData"`)
+
+	var add deltaAction
+	assert.NoError(json.Unmarshal([]byte(strings.Split(second, "\n")[1]), &add))
+	data := fs.files["tables/a/"+add.Add.Path]
+	assert.Equal(int64(len(data)), add.Add.Size)
+
+	var row deltaRow
+	r := parquet.NewReader(bytes.NewReader(data))
+	assert.NoError(r.Read(&row))
+	assert.Equal(deltaRow{Partition: "a", Sequence: 3, Event: "3"}, row)
+}
+
+func TestDeltaWriterResumes(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := &mockTableFS{files: map[string][]byte{}}
+	w := makeTestDeltaWriter(t, fs)
+	assert.NoError(w.write(&laozi.Batch{Events: [][]byte{[]byte("1\n"), []byte("2\n")}, First: 1}))
+
+	w = makeTestDeltaWriter(t, fs)
+	assert.Equal(int64(0), w.version)
+	assert.Equal(int64(2), w.sequence)
+	assert.NoError(w.write(&laozi.Batch{Events: [][]byte{[]byte("3\n")}, First: 3}))
+	assert.Equal(int64(1), w.version)
+
+	// rather than restart the sequence
+	fs.files["tables/a/_delta_log/00000000000000000002.json"] = []byte("{")
+	w = &deltaWriter{fs: fs, table: "tables/a", partition: "a", version: -1}
+	assert.Error(w.resume())
+}
+
+func TestDeltaWriterDetectsCommittedRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := &mockTableFS{files: map[string][]byte{}}
+	w := makeTestDeltaWriter(t, fs)
+	b := &laozi.Batch{Events: [][]byte{[]byte("1\n")}, First: 1}
+	assert.NoError(w.write(b))
+
+	// as if the response of the commit was lost
+	w.version, w.sequence = -1, 0
+	assert.NoError(w.write(b))
+	assert.Equal(int64(0), w.version)
+
+	other := &deltaWriter{fs: fs, table: "tables/a", partition: "b", version: -1}
+	assert.Error(other.write(&laozi.Batch{Events: [][]byte{[]byte("2\n")}, First: 2}))
+}
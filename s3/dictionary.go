@@ -0,0 +1,109 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/seedboxtech/laozi/compress"
+)
+
+const (
+	// dictionaryMetadata is the object metadata holding the key of its zstd dictionary.
+	dictionaryMetadata       = "Zstd-Dictionary"
+	defaultDictionarySize    = 16 << 10
+	defaultDictionarySamples = 10000
+)
+
+// TrainDictionary returns a raw zstd dictionary of at most size bytes made of samples, e.g.
+// events of a partition. Samples are picked by how often they occur, the most frequent ones
+// last, where their matches are the cheapest to reference.
+func TrainDictionary(samples [][]byte, size int) []byte {
+	counts := make(map[string]int)
+	var distinct []string
+	for _, s := range samples {
+		if counts[string(s)] == 0 {
+			distinct = append(distinct, string(s))
+		}
+		counts[string(s)]++
+	}
+	sort.SliceStable(distinct, func(i, j int) bool { return counts[distinct[i]] > counts[distinct[j]] })
+
+	var picked []string
+	total := 0
+	for _, s := range distinct {
+		if total+len(s) > size {
+			continue
+		}
+		picked = append(picked, s)
+		total += len(s)
+	}
+	dict := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		dict = append(dict, picked[i]...)
+	}
+	return dict
+}
+
+// dictionaries caches the dictionaries read, immutable once uploaded, by bucket and key.
+var dictionaries sync.Map
+
+// readDictionary returns the dictionary stored in an object.
+func readDictionary(svc *s3.S3, bucket, key string) ([]byte, error) {
+	if dict, ok := dictionaries.Load(bucket + "/" + key); ok {
+		return dict.([]byte), nil
+	}
+	resp, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read dictionary %s: %s", key, err)
+	}
+	defer resp.Body.Close()
+	dict, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	dictionaries.Store(bucket+"/"+key, dict)
+	return dict, nil
+}
+
+// trainDictionary trains the dictionary of the partition on the events of the buffer, unless it
+// has one, and uploads it next to the objects of the key.
+func (l *s3logger) trainDictionary(ctx aws.Context) error {
+	if !l.trainDictionaries || l.dictionary != nil || l.buffer.Len() == 0 {
+		return nil
+	}
+	samples := splitRecords(l.buffer.Bytes())
+	if len(samples) > l.dictionarySamples {
+		samples = samples[:l.dictionarySamples]
+	}
+	dict := TrainDictionary(samples, l.dictionarySize)
+	key := fmt.Sprintf("%s.%08x.zdict", l.key, compress.DictionaryID(dict))
+	_, err := l.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(dict),
+	}, l.kms.option())
+	if err != nil {
+		return s3Error("PutObject", l.bucket, key, 1, err)
+	}
+	l.dictionary, l.dictionaryKey = dict, key
+	return nil
+}
+
+// loadDictionary reads the dictionary the previous data of the key was compressed with, to
+// decompress it and keep compressing the key with it.
+func (l *s3logger) loadDictionary(key string) error {
+	dict, err := readDictionary(l.S3, l.bucket, key)
+	if err != nil {
+		return err
+	}
+	l.dictionary, l.dictionaryKey = dict, key
+	return nil
+}
@@ -0,0 +1,101 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrainDictionaryPicksFrequentSamples(t *testing.T) {
+	assert := assert.New(t)
+
+	samples := [][]byte{[]byte("rare\n"), []byte("common\n"), []byte("common\n"), []byte("big event\n")}
+	// the most frequent last
+	assert.Equal("big event\nrare\ncommon\n", string(TrainDictionary(samples, 100)))
+	// samples not fitting are skipped
+	assert.Equal("rare\ncommon\n", string(TrainDictionary(samples, 12)))
+}
+
+func TestDecompressZstdWithDictionary(t *testing.T) {
+	assert := assert.New(t)
+
+	var events []string
+	for i := 0; i < 50; i++ {
+		events = append(events, fmt.Sprintf(`{"type":"page_view","user":"u%d"}`+"\n", i))
+	}
+	var samples [][]byte
+	for _, e := range events {
+		samples = append(samples, []byte(e))
+	}
+	dict := TrainDictionary(samples, 1024)
+	data := []byte(events[0])
+
+	compressed := compress.Zstd(data, dict)
+	assert.True(compress.IsZstd(compressed))
+	assert.True(len(compressed) < len(compress.Zstd(data, nil)))
+
+	decompressed, err := compress.DecompressZstd(compressed, dict)
+	assert.NoError(err)
+	assert.Equal(data, decompressed)
+	_, err = compress.DecompressZstd(compressed, nil)
+	assert.Error(err)
+}
+
+func TestLoggerTrainsDictionary(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	lf := makeTestS3Factory(t, m)
+	lf.Compression = "zstd"
+	lf.TrainDictionary = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte(`{"type":"click"}` + "\n"))
+	assert.NoError(l.Close())
+
+	dictKey := m.headers["/bucket/a"].Get("X-Amz-Meta-Zstd-Dictionary")
+	if !assert.True(strings.HasPrefix(dictKey, "a.") && strings.HasSuffix(dictKey, ".zdict"), dictKey) {
+		return
+	}
+	assert.Equal(`{"type":"click"}`+"\n", string(m.objects["/bucket/"+dictKey]))
+
+	// later loggers of the key append with the dictionary
+	l = lf.NewLogger("a")
+	l.Log([]byte(`{"type":"view"}` + "\n"))
+	assert.NoError(l.Close())
+	assert.Equal(dictKey, m.headers["/bucket/a"].Get("X-Amz-Meta-Zstd-Dictionary"))
+
+	data, err := readArchive(s3.New(session.New(), lf.s3Config()), "bucket", "a", nil)
+	assert.NoError(err)
+	assert.Equal(`{"type":"click"}`+"\n"+`{"type":"view"}`+"\n", string(data))
+}
+
+func TestLoggerRefusesUnreadablePreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{
+		objects: map[string][]byte{"/bucket/a": []byte("not zstd"), "/bucket/b": compress.Zstd([]byte("old\n"), nil)},
+		headers: map[string]http.Header{"/bucket/b": {"X-Amz-Meta-Zstd-Dictionary": {"b.1.zdict"}}},
+	}
+	lf := makeTestS3Factory(t, m)
+	lf.Compression = "zstd"
+	lf.AsyncPreviousData = true
+
+	// neither the corrupt object nor the one whose dictionary is missing is overwritten
+	for _, key := range []string{"a", "b"} {
+		old := m.objects["/bucket/"+key]
+		l := lf.NewLogger(key)
+		l.Log([]byte("new\n"))
+		var prevErr *laozi.ErrPreviousData
+		assert.True(errors.As(l.Close(), &prevErr), key)
+		assert.Equal(old, m.objects["/bucket/"+key])
+	}
+}
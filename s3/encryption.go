@@ -0,0 +1,108 @@
+package s3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// keyIDMetadata is the object metadata holding the id of the key an object is encrypted with.
+const keyIDMetadata = "Encryption-Key-Id"
+
+// KeyRing holds the keys used for client-side encryption of archived objects with AES-GCM.
+// New objects are encrypted with the current key, whose id is stored along the object. Older
+// keys stay in the ring after a rotation so objects written before it remain decryptable.
+type KeyRing struct {
+	sync.RWMutex
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// NewKeyRing returns a key ring whose current key is the given 16, 24 or 32 byte AES key.
+func NewKeyRing(id string, key []byte) (*KeyRing, error) {
+	k := &KeyRing{keys: map[string]cipher.AEAD{}}
+	return k, k.Rotate(id, key)
+}
+
+// Add makes a key available for decryption only.
+func (k *KeyRing) Add(id string, key []byte) error {
+	if id == "" {
+		return errors.New("key id must not be empty")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	k.Lock()
+	defer k.Unlock()
+	if _, found := k.keys[id]; found {
+		return fmt.Errorf("key %s already exists", id)
+	}
+	k.keys[id] = aead
+	return nil
+}
+
+// Rotate adds a key and makes it the one new objects are encrypted with.
+func (k *KeyRing) Rotate(id string, key []byte) error {
+	if err := k.Add(id, key); err != nil {
+		return err
+	}
+
+	k.Lock()
+	defer k.Unlock()
+	k.current = id
+	return nil
+}
+
+// Current returns the id of the key new objects are encrypted with.
+func (k *KeyRing) Current() string {
+	k.RLock()
+	defer k.RUnlock()
+	return k.current
+}
+
+// Encrypt seals data with the current key, returning the id of the key used.
+func (k *KeyRing) Encrypt(data []byte) (string, []byte, error) {
+	k.RLock()
+	id, aead := k.current, k.keys[k.current]
+	k.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return id, aead.Seal(nonce, nonce, data, []byte(id)), nil
+}
+
+// Decrypt opens data sealed with the key of the given id.
+func (k *KeyRing) Decrypt(id string, data []byte) ([]byte, error) {
+	k.RLock()
+	aead, found := k.keys[id]
+	k.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("unknown encryption key %s", id)
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(id))
+}
+
+// keyRing returns the KeyRing of the objects of a partition, if any.
+func (lf S3LoggerFactory) keyRing(partition string) *KeyRing {
+	if lf.PartitionKeyRing != nil {
+		return lf.PartitionKeyRing(partition)
+	}
+	return lf.KeyRing
+}
@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte("1"), 32)
+	testKey2 = bytes.Repeat([]byte("2"), 32)
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	assert := assert.New(t)
+
+	k, err := NewKeyRing("v1", testKey1)
+	assert.NoError(err)
+
+	id1, sealed1, err := k.Encrypt([]byte("old data"))
+	assert.NoError(err)
+	assert.Equal("v1", id1)
+
+	assert.NoError(k.Rotate("v2", testKey2))
+	assert.Equal("v2", k.Current())
+	assert.Error(k.Rotate("v2", testKey2))
+
+	id2, sealed2, err := k.Encrypt([]byte("new data"))
+	assert.NoError(err)
+	assert.Equal("v2", id2)
+
+	data, err := k.Decrypt(id1, sealed1)
+	assert.NoError(err)
+	assert.Equal([]byte("old data"), data)
+
+	data, err = k.Decrypt(id2, sealed2)
+	assert.NoError(err)
+	assert.Equal([]byte("new data"), data)
+
+	_, err = k.Decrypt(id1, sealed2)
+	assert.Error(err)
+	_, err = k.Decrypt("v3", sealed2)
+	assert.Error(err)
+}
+
+func TestKeyRingRejectsBadKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewKeyRing("v1", []byte("short"))
+	assert.Error(err)
+	_, err = NewKeyRing("", testKey1)
+	assert.Error(err)
+}
+
+func TestS3LoggerDecryptsPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := NewKeyRing("v1", testKey1)
+	l := makeTestLogger()
+	l.keyRing = k
+	l.buffer.Write([]byte("some data"))
+
+	id, sealed, err := k.Encrypt(l.compressBuffer())
+	assert.NoError(err)
+	l.buffer.Reset()
+
+	assert.NoError(k.Rotate("v2", testKey2))
+	assert.NoError(l.decryptToBuffer(id, ioutil.NopCloser(bytes.NewReader(sealed))))
+
+	assert.Equal([]byte("some data"), l.buffer.Bytes())
+}
+
+func TestS3LoggerRefusesUndecryptablePreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{
+		objects: map[string][]byte{"/bucket/a": []byte("sealed")},
+		headers: map[string]http.Header{"/bucket/a": {"X-Amz-Meta-Encryption-Key-Id": {"v1"}}},
+	}
+	lf := makeTestS3Factory(t, m)
+	lf.AsyncPreviousData = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	var prevErr *laozi.ErrPreviousData
+	assert.True(errors.As(l.Close(), &prevErr))
+	assert.Equal([]byte("sealed"), m.objects["/bucket/a"])
+
+	lf.AsyncPreviousData = false
+	lf.KeyRing, _ = NewKeyRing("v2", testKey2)
+	_, err := lf.NewLoggerContext(context.Background(), "a")
+	assert.True(errors.As(err, &prevErr))
+}
@@ -0,0 +1,34 @@
+package s3
+
+import (
+	"errors"
+	"testing"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushErrorsHoldS3RequestIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("event\n"))
+	err := l.Close()
+
+	var s3Err *laozi.ErrS3
+	if assert.True(errors.As(err, &s3Err)) {
+		assert.Equal("PutObject", s3Err.Op)
+		assert.Equal("bucket", s3Err.Bucket)
+		assert.Equal("a", s3Err.Key)
+		assert.Equal(403, s3Err.StatusCode)
+		assert.Equal("AccessDenied", s3Err.Code)
+		assert.Equal("request-id", s3Err.RequestID)
+		assert.Equal("host-id", s3Err.HostID)
+		assert.Equal(maxRetries, s3Err.Attempts)
+		assert.Contains(err.Error(), "request-id")
+	}
+}
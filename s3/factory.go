@@ -0,0 +1,433 @@
+// Package s3 archives the partitions of a laozi router to S3 with aws-sdk-go, as objects
+// rewritten on every flush or rotated, along with the readers, catalogs and tools of archives.
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// S3LoggerFactory is a logger factory for creating loggers that log received events to S3.
+type S3LoggerFactory struct {
+	Prefix        string
+	Bucket        string
+	Region        string
+	FlushInterval time.Duration
+	Compression   string
+	IsDupeFunc    func(event []byte, line []byte) bool
+	// Checkpointer optionally records the high-water mark of every partition after each flush.
+	Checkpointer laozi.Checkpointer
+	// RotationInterval, if set, makes every flush upload a new immutable object holding only
+	// the events logged since the previous flush, instead of rewriting one object per partition.
+	// Object keys are derived from the partition, the rotation window and the event sequence,
+	// so retried flushes don't duplicate objects. They depend on when the events were logged
+	// though, so events replayed after a crash get other keys and are archived twice. Objects
+	// hold the digest of their events, and a flush finding its key holding other events fails
+	// with *ErrConcurrentWrite rather than count as uploaded.
+	RotationInterval time.Duration
+	// KeyRing optionally enables client-side encryption of objects, see KeyRing.
+	// PartitionKeyRing, if set, returns the KeyRing of the objects of every partition instead,
+	// e.g. one per tenant, so the data of tenants is encrypted with keys of their own and can be
+	// revoked by dropping them.
+	KeyRing          *KeyRing
+	PartitionKeyRing func(partition string) *KeyRing
+	// SSEKMSKeyID, if set, makes S3 encrypt objects with this KMS key, and SSEKMSContext
+	// optionally returns the encryption context of the objects of every partition, e.g.
+	// PartitionEncryptionContext, which KMS requires to decrypt them again, so the data of
+	// tenants is cryptographically separated and their access individually revocable by key
+	// policies and grants on the context.
+	SSEKMSKeyID   string
+	SSEKMSContext func(partition string) map[string]string
+	// SkipUnchangedUploads skips flushes when nothing changed since the last upload of a
+	// partition, e.g. with a short FlushInterval on a quiet partition.
+	SkipUnchangedUploads bool
+	// Stats optionally counts what the loggers of the factory do.
+	Stats *S3Stats
+	// Endpoint and S3ForcePathStyle optionally point the factory at an S3-compatible service,
+	// and Credentials replace the default AWS credential chain. See the presets, e.g.
+	// NewB2LoggerFactory, for services needing them.
+	Endpoint         string
+	S3ForcePathStyle bool
+	Credentials      *credentials.Credentials
+	// SkipPreviousData starts new loggers with an empty buffer instead of fetching the object
+	// of their key, so a restarted archiver overwrites the objects it finds. AsyncPreviousData
+	// fetches it in the background instead, so new partitions don't delay routing: events are
+	// buffered meanwhile and flushes wait for the fetch.
+	SkipPreviousData  bool
+	AsyncPreviousData bool
+	// PreviousData is what loggers do when the object of their key already holds data, one of
+	// the PreviousData constants. It defaults to PreviousDataAppend.
+	PreviousData string
+	// ObjectLockMode, one of s3.ObjectLockMode*, makes objects immutable until
+	// ObjectLockRetention has passed, and ObjectLockLegalHold until the hold is removed, in
+	// buckets with Object Lock enabled. Objects can't be appended to then, so either requires a
+	// RotationInterval.
+	ObjectLockMode      string
+	ObjectLockRetention time.Duration
+	ObjectLockLegalHold bool
+	// SequenceStamp prepends to every record the sequence number of the event in its partition
+	// and a tab, so consumers can detect gaps and reorderings, see ParseSequenceStamp. Numbers
+	// continue those of the previous data, so AsyncPreviousData is ignored, or of the rotated
+	// objects of the current window. Events not ending with a newline are ended with one, so
+	// records don't run together.
+	SequenceStamp bool
+	// RequestPayer makes the requests of loggers accept the charges of requester-pays buckets,
+	// and ExpectedBucketOwner, the account ID of the owner of the bucket, makes them fail if the
+	// bucket is owned by another account, for organizations enforcing either.
+	RequestPayer        bool
+	ExpectedBucketOwner string
+	// GzipMembers appends every flush to the object of the partition as an independent gzip
+	// member, making a valid multi-member gzip, instead of fetching the previous data and
+	// uploading it again recompressed. It requires gzip Compression and no RotationInterval,
+	// and the previous data is left alone, so PreviousData doesn't apply. Events sampled out
+	// are counted per flush. Appends are conditional on the object not being written to
+	// meanwhile, and retried otherwise.
+	GzipMembers bool
+	// FlushEveryNRecords and FlushEveryNBytes flush loggers as soon as the events logged since
+	// their last flush reach that many records or bytes, besides every FlushInterval, e.g. to
+	// bound the number of records of rotated objects for downstream batch loads.
+	FlushEveryNRecords int
+	FlushEveryNBytes   int
+	// TrainDictionary, with "zstd" Compression, compresses the objects of every partition with
+	// a zstd dictionary trained on the first DictionarySamples events flushed, 10000 by
+	// default, of at most DictionarySize bytes, 16 KiB by default, for far better ratios of
+	// small repetitive events than compressing every flush alone. The dictionary is uploaded
+	// next to the objects, as <key>.<id>.zdict, and named by their Zstd-Dictionary metadata
+	// for ArchiveReaders to decompress them, and reused by loggers appending to the objects.
+	TrainDictionary   bool
+	DictionarySize    int
+	DictionarySamples int
+	// TrackSchemas versions the schemas of the JSON events of every partition, the JSON types
+	// of their top level fields: new schemas are added to the versions of the key, uploaded
+	// next to the objects as <key>.schemas.json, see ReadSchemaVersions, and uploads carry the
+	// Schema-Version of the last event buffered, see ParseSchemaVersion. SchemaRotation, which
+	// requires a RotationInterval, flushes the buffer before an event of another schema, so
+	// every object holds events of exactly one schema, unless that flush fails.
+	TrackSchemas   bool
+	SchemaRotation bool
+	// FlushThresholds optionally override the FlushInterval, FlushEveryNRecords and
+	// FlushEveryNBytes at runtime, see laozi.FlushThresholds.
+	FlushThresholds *laozi.FlushThresholds
+	// KeyIDGenerator optionally prefixes the names of rotated objects with a generated id and
+	// an underscore, e.g. IDGeneratorFunc(NewULID), for their listing order to match time order
+	// across processes.
+	KeyIDGenerator laozi.IDGenerator
+	// LocalCache optionally keeps the last objects uploaded on local disk, see LocalCache.
+	LocalCache *LocalCache
+	// DetectConcurrentWriters makes every upload conditional on the object of the key being the
+	// one the logger last fetched or uploaded, so that when another process writes to the same
+	// key, flushes fail with *ErrConcurrentWrite instead of overwriting its data. Rotated
+	// objects are never overwritten anyway, and GzipMembers don't upload whole objects.
+	DetectConcurrentWriters bool
+	// S3 optionally is the client shared by the loggers, e.g. one configured elsewhere, instead
+	// of one per logger made from the settings above. The factory adds its handlers to copies of
+	// it, which share its session and connections.
+	S3 *s3.S3
+	// StreamUploads compresses the buffer of loggers while uploading it with an s3manager.Uploader,
+	// one part of 5 MiB at a time, instead of uploading a compressed copy of it, roughly halving
+	// the peak memory of flushes of large partitions. It only applies to gzip Compression, and
+	// not with a KeyRing, Object Lock, a LocalCache or GzipMembers, which need the whole upload.
+	StreamUploads bool
+	// RetryQueue optionally keeps on local disk the uploads of loggers failing to flush when
+	// closed, retrying them in the background instead of losing their events, see RetryQueue.
+	RetryQueue *RetryQueue
+	// FlushHistory is how many of their last flushes loggers keep, with their time, size,
+	// duration and error, for DumpState to show whether a partition reaches S3.
+	FlushHistory int
+	// AdaptiveFlush makes loggers learn the event rate of their partition, smoothed over their
+	// FlushIntervals, and flush as soon as about a FlushInterval of events is buffered, instead
+	// of at FlushEveryNRecords: quiet partitions flush as their few events arrive, and busy ones
+	// in batches of up to AdaptiveFlushMaxRecords, if set, and of at least
+	// AdaptiveFlushMinRecords. It requires a FlushInterval.
+	AdaptiveFlush           bool
+	AdaptiveFlushMinRecords int
+	AdaptiveFlushMaxRecords int
+	// EmptyWindowMarkers uploads an empty <window>/_EMPTY object to the rotation windows of
+	// partitions without events, so downstream jobs can tell no data from a broken pipeline.
+	// Windows are marked once they end, every FlushInterval and when loggers close, so only
+	// while the logger of the partition is open: set a LoggerTimeout above the
+	// RotationInterval to mark every window. It requires a RotationInterval.
+	EmptyWindowMarkers bool
+	// Catalog optionally records every object flushed, see Catalog and SQLiteCatalog.
+	Catalog Catalog
+	// WebIdentityTokenFile makes the factory assume the WebIdentityRoleARN with the web identity
+	// token of the file, e.g. the one of an EKS service account, which the default credential
+	// chain only uses from AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN. AssumeRoleARNs are then
+	// assumed in order, each with the credentials of the previous role, starting with the web
+	// identity, Credentials or the default chain, e.g. to reach a bucket of another account.
+	// Credentials are refreshed before they expire, so long-lived loggers keep working.
+	// RoleSessionName names the sessions, "laozi" by default, and STSEndpoint optionally is the
+	// endpoint of STS.
+	WebIdentityTokenFile string
+	WebIdentityRoleARN   string
+	AssumeRoleARNs       []string
+	RoleSessionName      string
+	STSEndpoint          string
+	// UploadProgress is optionally called with the bytes of an object uploaded so far by a
+	// flush, and its total size, about every MiB, e.g. for dashboards to show the progress of
+	// flushes of large partitions. The total of StreamUploads is -1 until the upload completes.
+	// Retries start over.
+	UploadProgress func(key string, uploaded, total int64)
+	// WindowBuffers buffers the events of every rotation window apart, so events logged once a
+	// window ended are flushed to an object of their own window on the next flush, instead of
+	// the object of the window of the first event buffered. It requires a RotationInterval.
+	WindowBuffers bool
+	// KeyIndex optionally tells which keys may have an object, for loggers not to fetch the
+	// previous data of the others, saving the latency and cost of the GET requests failing
+	// with 404 of new partitions, e.g. the SQLiteCatalog the factory records its objects in.
+	// Objects the index doesn't know of are overwritten, unless DetectConcurrentWriters is set,
+	// failing their flushes instead.
+	KeyIndex KeyIndex
+	// NewBuffer optionally makes the buffers of the loggers of partitions, e.g. disk backed ones
+	// for partitions too large to buffer in memory. Previous data fetched in the background,
+	// and the rotation windows sealed with WindowBuffers, are held in memory meanwhile.
+	NewBuffer func(key string) Buffer
+	// PresignTTL, if set, makes the DeliveryReports of flushes hold a pre-signed GET URL of the
+	// object flushed, valid for that long, up to 7 days, so downstream consumers without access
+	// to the bucket can fetch it. The URLs of versioned buckets are of the version flushed.
+	PresignTTL time.Duration
+	// ShardPrefixLength, up to 8, prefixes the object keys of every partition, after the
+	// Prefix, by as many hex digits of a hash of its key and a slash, e.g. a3/events, to spread
+	// the requests of partitions with similar keys across S3 partitions. Loggers write a
+	// ShardManifest along the objects so readers can find them.
+	ShardPrefixLength int
+}
+
+// What loggers do with the previous data of their key, see S3LoggerFactory.PreviousData.
+const (
+	// PreviousDataAppend appends new events to the previous data. If the previous process died
+	// while flushing, the events it had retried may be logged again.
+	PreviousDataAppend = "append"
+	// PreviousDataOverwrite discards the previous data.
+	PreviousDataOverwrite = "overwrite"
+	// PreviousDataRename copies the previous data aside to <key>.<time>.previous and starts over.
+	PreviousDataRename = "rename"
+	// PreviousDataError leaves the previous data alone, failing flushes with *ErrPreviousData.
+	PreviousDataError = "error"
+)
+
+// NewLogger return a new instance of an S3 laozi.Logger for a corresponding partition key.
+func (lf S3LoggerFactory) NewLogger(key string) laozi.Logger {
+	return lf.start(lf.newS3Logger(key))
+}
+
+// NewLoggerContext is NewLogger failing if the previous state of the key, i.e. its previous
+// data, its checkpoint or the sequence of its rotated objects, could not be loaded before ctx
+// is done, instead of starting with flushes failing.
+func (lf S3LoggerFactory) NewLoggerContext(ctx context.Context, key string) (laozi.Logger, error) {
+	l, err := lf.newS3LoggerContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return lf.start(l), nil
+}
+
+// start starts the loop of a new logger.
+func (lf S3LoggerFactory) start(l *s3logger) laozi.Logger {
+	l.bufferedRequests = make(chan chan []byte)
+	l.stopped = make(chan struct{})
+	// added deduplication wrapper if function is specified
+	if lf.IsDupeFunc == nil {
+		go l.loop()
+		return l
+	} else {
+		dl := &dedupeS3Logger{l, lf.IsDupeFunc}
+		go dl.loop()
+		return dl
+	}
+}
+
+// newS3Logger makes an s3logger loaded with the previous state of its partition, without
+// starting its loop. If the state can't be loaded, flushes fail with *ErrPreviousData rather
+// than overwrite the previous data or reuse the keys of rotated objects.
+func (lf S3LoggerFactory) newS3Logger(key string) *s3logger {
+	l, err := lf.newS3LoggerContext(aws.BackgroundContext(), key)
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not load previous state, flushes will fail: %s: %s\n", key, err)
+		if l.conflict == nil {
+			l.conflict = &laozi.ErrPreviousData{Key: l.key, Cause: err}
+		}
+	}
+	return l
+}
+
+// newS3LoggerContext is newS3Logger returning the error of loading the previous state, i.e.
+// fetching the previous data, loading the checkpoint or resuming the sequence, along with a
+// logger starting without it.
+func (lf S3LoggerFactory) newS3LoggerContext(ctx context.Context, key string) (*s3logger, error) {
+	if (lf.ObjectLockMode != "" || lf.ObjectLockLegalHold) && lf.RotationInterval == 0 {
+		panic("Object Lock requires a RotationInterval")
+	}
+	if lf.EmptyWindowMarkers && lf.RotationInterval == 0 {
+		panic("EmptyWindowMarkers requires a RotationInterval")
+	}
+	if lf.WindowBuffers && lf.RotationInterval == 0 {
+		panic("WindowBuffers requires a RotationInterval")
+	}
+	if lf.PresignTTL > maxPresignTTL {
+		panic("PresignTTL must be at most 7 days")
+	}
+	if lf.ShardPrefixLength < 0 || lf.ShardPrefixLength > maxShardPrefixLength {
+		panic("ShardPrefixLength must be between 0 and 8")
+	}
+	if lf.AdaptiveFlush && lf.FlushInterval <= 0 {
+		panic("AdaptiveFlush requires a FlushInterval")
+	}
+	if lf.SchemaRotation && (!lf.TrackSchemas || lf.RotationInterval == 0) {
+		panic("SchemaRotation requires TrackSchemas and a RotationInterval")
+	}
+	if lf.TrainDictionary && lf.Compression != "zstd" {
+		panic("TrainDictionary requires zstd Compression")
+	}
+	if lf.GzipMembers && (lf.Compression != "gzip" || lf.RotationInterval > 0 || lf.KeyRing != nil || lf.PartitionKeyRing != nil) {
+		panic("GzipMembers requires gzip Compression, without RotationInterval nor KeyRing")
+	}
+
+	l := &s3logger{
+		bucket:         lf.Bucket,
+		key:            fmt.Sprintf("%s%s%s", lf.Prefix, ShardPrefix(key, lf.ShardPrefixLength), key),
+		S3:             lf.s3Client(),
+		buffer:         lf.newBuffer(key),
+		active:         time.Now(),
+		logChan:        make(chan []byte),
+		batchChan:      make(chan [][]byte),
+		readChan:       make(chan readRequest),
+		quitChan:       make(chan struct{}),
+		compression:    lf.Compression,
+		flushInterval:  lf.FlushInterval,
+		partition:      key,
+		checkpointer:   lf.Checkpointer,
+		rotation:       lf.RotationInterval,
+		keyRing:        lf.keyRing(key),
+		kms:            lf.sseKMS(key),
+		skipUnchanged:  lf.SkipUnchangedUploads,
+		stats:          lf.Stats,
+		previousData:   lf.PreviousData,
+		lockMode:       lf.ObjectLockMode,
+		lockRetention:  lf.ObjectLockRetention,
+		legalHold:      lf.ObjectLockLegalHold,
+		stampSequence:  lf.SequenceStamp,
+		gzipMembers:    lf.GzipMembers,
+		maxRecords:     lf.FlushEveryNRecords,
+		maxBytes:       lf.FlushEveryNBytes,
+		thresholds:     lf.FlushThresholds,
+		flushRequests:  make(chan chan error),
+		idGenerator:    lf.KeyIDGenerator,
+		cache:          lf.LocalCache,
+		detectWriters:  lf.DetectConcurrentWriters,
+		streamUploads:  lf.StreamUploads,
+		retryQueue:     lf.RetryQueue,
+		Reporter:       laozi.Reporter{HistorySize: lf.FlushHistory},
+		adaptive:       lf.AdaptiveFlush,
+		adaptiveMin:    lf.AdaptiveFlushMinRecords,
+		adaptiveMax:    lf.AdaptiveFlushMaxRecords,
+		emptyMarkers:   lf.EmptyWindowMarkers,
+		catalog:        lf.Catalog,
+		uploadProgress: lf.UploadProgress,
+		windowBuffers:  lf.WindowBuffers,
+		presignTTL:     lf.PresignTTL,
+
+		trainDictionaries: lf.TrainDictionary,
+		dictionarySize:    lf.DictionarySize,
+		dictionarySamples: lf.DictionarySamples,
+		trackSchemas:      lf.TrackSchemas,
+		schemaRotation:    lf.SchemaRotation,
+	}
+	if l.dictionarySize <= 0 {
+		l.dictionarySize = defaultDictionarySize
+	}
+	if l.dictionarySamples <= 0 {
+		l.dictionarySamples = defaultDictionarySamples
+	}
+	if l.retryQueue != nil {
+		l.retryQueue.start(l.S3, l.stats)
+	}
+	lf.writeShardManifest(l.S3)
+
+	var err error
+	if l.rotation > 0 {
+		var found bool
+		if found, err = l.loadCheckpoint(); err == nil && !found {
+			err = l.resumeSequence(ctx)
+		}
+	} else {
+		switch {
+		case lf.SkipPreviousData, lf.GzipMembers, l.coldKey(lf.KeyIndex):
+		case lf.AsyncPreviousData && !lf.SequenceStamp:
+			l.fetchPreviousDataAsync()
+		default:
+			err = l.fetchPreviousDataContext(ctx)
+		}
+		if err == nil {
+			_, err = l.loadCheckpoint()
+		}
+		l.resumeStampedSequence()
+	}
+	l.reportedSequence = l.sequence
+	l.rateTime, l.rateSequence = time.Now(), l.sequence
+	if l.rotation > 0 {
+		// the logger is made for an event of the current window
+		l.markedWindow = time.Now().UTC().Truncate(l.rotation)
+	}
+
+	return l, err
+}
+
+// s3Client returns the S3 client of a logger of the factory, a copy of S3 if set, for the
+// handlers of the factory not to be added to it.
+func (lf S3LoggerFactory) s3Client() *s3.S3 {
+	var c *s3.S3
+	if lf.S3 != nil {
+		copied := *lf.S3.Client
+		copied.Handlers = lf.S3.Handlers.Copy()
+		c = &s3.S3{Client: &copied}
+	} else {
+		c = s3.New(session.New(), lf.s3Config())
+	}
+	if lf.RequestPayer || lf.ExpectedBucketOwner != "" {
+		c.Handlers.Build.PushBack(lf.setBucketHeaders)
+	}
+	lf.Stats.instrument(c)
+	return c
+}
+
+// setBucketHeaders sets the requester-pays and bucket owner headers of a request.
+func (lf S3LoggerFactory) setBucketHeaders(r *request.Request) {
+	if lf.RequestPayer {
+		r.HTTPRequest.Header.Set("X-Amz-Request-Payer", s3.RequestPayerRequester)
+	}
+	if lf.ExpectedBucketOwner != "" {
+		r.HTTPRequest.Header.Set("X-Amz-Expected-Bucket-Owner", lf.ExpectedBucketOwner)
+		if r.Operation.Name == "CopyObject" {
+			// loggers only copy objects within their bucket
+			r.HTTPRequest.Header.Set("X-Amz-Source-Expected-Bucket-Owner", lf.ExpectedBucketOwner)
+		}
+	}
+}
+
+// s3Config returns the configuration of the S3 clients of the factory.
+func (lf S3LoggerFactory) s3Config() *aws.Config {
+	c := &aws.Config{}
+	if lf.Region != "" {
+		// otherwise the region of the environment, e.g. AWS_REGION
+		c.Region = aws.String(lf.Region)
+	}
+	if lf.Endpoint != "" {
+		c.Endpoint = aws.String(lf.Endpoint)
+	}
+	if lf.S3ForcePathStyle {
+		c.S3ForcePathStyle = aws.Bool(true)
+	}
+	if creds := lf.credentials(); creds != nil {
+		c.Credentials = creds
+	}
+	return c
+}
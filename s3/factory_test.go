@@ -0,0 +1,417 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerFactoryNew(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := S3LoggerFactory{
+		Bucket:        "bucket",
+		Prefix:        "prefix/",
+		Region:        "us-east-1",
+		FlushInterval: 100,
+	}
+
+	l := lf.NewLogger("test.file")
+	defer l.Close()
+
+	assert.Implements((*laozi.Logger)(nil), l)
+}
+
+func TestLoggerFactoryNewDedupedLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := S3LoggerFactory{
+		Bucket:        "bucket",
+		Prefix:        "prefix/",
+		Region:        "us-east-1",
+		FlushInterval: 100,
+		IsDupeFunc:    func(event []byte, line []byte) bool { return string(event) == string(line) },
+	}
+
+	l := lf.NewLogger("test.file")
+	defer l.Close()
+
+	assert.Implements((*laozi.Logger)(nil), l)
+}
+
+// mockS3 is a minimal S3 API storing objects in memory. GETs wait for getGate if it is set.
+type mockS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+	gets    int
+	getGate chan struct{}
+	// parts of the pending multipart uploads, by object
+	parts map[string]map[string][]byte
+	// failPuts makes uploads fail as forbidden
+	failPuts bool
+	// ranges is the number of ranged GETs
+	ranges int
+}
+
+func (m *mockS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodHead:
+		m.Lock()
+		defer m.Unlock()
+		data, ok := m.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("ETag", etag(data))
+		for name, values := range m.headers[r.URL.Path] {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				w.Header()[name] = values
+			}
+		}
+	case http.MethodPost:
+		m.Lock()
+		defer m.Unlock()
+		if _, ok := r.URL.Query()["uploads"]; ok {
+			if m.parts == nil {
+				m.parts = map[string]map[string][]byte{}
+			}
+			m.parts[r.URL.Path] = map[string][]byte{}
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>1</UploadId></InitiateMultipartUploadResult>`)
+			return
+		}
+		parts := m.parts[r.URL.Path]
+		var data []byte
+		for i := 1; i <= len(parts); i++ {
+			data = append(data, parts[fmt.Sprint(i)]...)
+		}
+		m.objects[r.URL.Path] = data
+		delete(m.parts, r.URL.Path)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><ETag>%s</ETag></CompleteMultipartUploadResult>`, etag(data))
+	case http.MethodGet:
+		if m.getGate != nil {
+			<-m.getGate
+		}
+		m.Lock()
+		defer m.Unlock()
+		if r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Path + "/" + r.URL.Query().Get("prefix")
+			var names []string
+			for name := range m.objects {
+				if strings.HasPrefix(name, prefix) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			fmt.Fprint(w, `<ListBucketResult>`)
+			for _, name := range names {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>%s</LastModified></Contents>`,
+					strings.TrimPrefix(name, r.URL.Path+"/"), time.Now().UTC().Format(time.RFC3339))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		m.gets++
+		data, ok := m.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag(data) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && match != etag(data) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", etag(data))
+		for name, values := range m.headers[r.URL.Path] {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				w.Header()[name] = values
+			}
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			m.ranges++
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[start : end+1])
+			return
+		}
+		w.Write(data)
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		m.Lock()
+		defer m.Unlock()
+		if m.failPuts {
+			w.Header().Set("X-Amz-Request-Id", "request-id")
+			w.Header().Set("X-Amz-Id-2", "host-id")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+			return
+		}
+		if part := r.URL.Query().Get("partNumber"); part != "" {
+			if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+				src, _ = url.PathUnescape(src)
+				data = m.objects["/"+src]
+				fmt.Fprint(w, `<CopyPartResult><ETag>"etag"</ETag></CopyPartResult>`)
+			}
+			m.parts[r.URL.Path][part] = data
+			return
+		}
+		old, exists := m.objects[r.URL.Path]
+		if match := r.Header.Get("If-Match"); (match != "" && (!exists || match != etag(old))) ||
+			(r.Header.Get("If-None-Match") == "*" && exists) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			src, _ = url.PathUnescape(src)
+			data = m.objects["/"+src]
+			fmt.Fprint(w, `<CopyObjectResult></CopyObjectResult>`)
+		}
+		m.objects[r.URL.Path] = data
+		w.Header().Set("ETag", etag(data))
+		w.Header().Set("X-Amz-Version-Id", strings.Trim(etag(data), `"`))
+		if m.headers != nil {
+			m.headers[r.URL.Path] = r.Header
+		}
+	}
+}
+
+func etag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(data))
+}
+
+// makeTestS3Factory returns a factory writing to a mock S3 server.
+func makeTestS3Factory(t *testing.T, m *mockS3) S3LoggerFactory {
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return S3LoggerFactory{
+		Bucket:           "bucket",
+		Region:           "us-east-1",
+		Endpoint:         srv.URL,
+		S3ForcePathStyle: true,
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	}
+}
+
+func TestLoggerFactorySkipsPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal(0, m.gets)
+	assert.Equal([]byte("new\n"), m.objects["/bucket/a"])
+}
+
+func TestLoggerFactoryFetchesPreviousDataAsync(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}, getGate: make(chan struct{})}
+	lf := makeTestS3Factory(t, m)
+	lf.AsyncPreviousData = true
+
+	// the logger is usable before the previous data is fetched
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	close(m.getGate)
+	assert.NoError(l.Close())
+
+	assert.Equal([]byte("old\nnew\n"), m.objects["/bucket/a"])
+}
+
+func TestLoggerFactoryHandlesPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+
+	for strategy, expected := range map[string]string{
+		PreviousDataAppend:    "old\nnew\n",
+		PreviousDataOverwrite: "new\n",
+		PreviousDataRename:    "new\n",
+	} {
+		m.objects["/bucket/a"] = []byte("old\n")
+		lf.PreviousData = strategy
+		l := lf.NewLogger("a")
+		l.Log([]byte("new\n"))
+		assert.NoError(l.Close())
+		assert.Equal(expected, string(m.objects["/bucket/a"]), strategy)
+	}
+
+	var renamed []string
+	for name, data := range m.objects {
+		if strings.HasPrefix(name, "/bucket/a.") && strings.HasSuffix(name, ".previous") {
+			renamed = append(renamed, string(data))
+		}
+	}
+	assert.Equal([]string{"old\n"}, renamed)
+}
+
+func TestLoggerFactoryRefusesPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}}
+	lf := makeTestS3Factory(t, m)
+	lf.PreviousData = PreviousDataError
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	err := l.Close()
+
+	var previousErr *laozi.ErrPreviousData
+	assert.True(errors.As(err, &previousErr))
+	assert.Equal("old\n", string(m.objects["/bucket/a"]))
+}
+
+func TestLoggerFactoryLocksObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.ObjectLockMode = s3.ObjectLockModeCompliance
+	lf.ObjectLockRetention = 24 * time.Hour
+	lf.ObjectLockLegalHold = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal(1, len(m.headers))
+	for _, h := range m.headers {
+		assert.Equal(s3.ObjectLockModeCompliance, h.Get("X-Amz-Object-Lock-Mode"))
+		assert.Equal(s3.ObjectLockLegalHoldStatusOn, h.Get("X-Amz-Object-Lock-Legal-Hold"))
+		until, err := time.Parse(time.RFC3339, h.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+		assert.NoError(err)
+		assert.WithinDuration(time.Now().Add(24*time.Hour), until, time.Minute)
+		assert.NotEmpty(h.Get("Content-Md5"))
+	}
+
+	lf.RotationInterval = 0
+	assert.Panics(func() { lf.NewLogger("b") })
+}
+
+func TestLoggerFactoryKeepsGzippedPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": compress.Compress("gzip", []byte("old\n"))}}
+	lf := makeTestS3Factory(t, m)
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	gr, err := gzip.NewReader(bytes.NewReader(m.objects["/bucket/a"]))
+	assert.NoError(err)
+	data, _ := ioutil.ReadAll(gr)
+	assert.Equal("old\nnew\n", string(data))
+}
+
+func TestLoggerFactorySetsBucketHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RequestPayer = true
+	lf.ExpectedBucketOwner = "111122223333"
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	h := m.headers["/bucket/a"]
+	assert.Equal("requester", h.Get("X-Amz-Request-Payer"))
+	assert.Equal("111122223333", h.Get("X-Amz-Expected-Bucket-Owner"))
+}
+
+func TestLoggerFactoryDetectsConcurrentWriters(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.DetectConcurrentWriters = true
+
+	// both loggers find no object, the second to flush conflicts
+	first := lf.newS3Logger("a")
+	second := lf.newS3Logger("a")
+	first.add([]byte("first\n"))
+	assert.NoError(first.flush())
+	second.add([]byte("second\n"))
+	var conflict *laozi.ErrConcurrentWrite
+	assert.True(errors.As(second.flush(), &conflict))
+	assert.Equal("first\n", string(m.objects["/bucket/a"]))
+
+	// the first logger keeps writing the object it last uploaded, until another one does
+	first.add([]byte("again\n"))
+	assert.NoError(first.flush())
+	third := lf.newS3Logger("a")
+	third.add([]byte("third\n"))
+	assert.NoError(third.flush())
+	first.add([]byte("lost\n"))
+	assert.True(errors.As(first.flush(), &conflict))
+	assert.Equal("first\nagain\nthird\n", string(m.objects["/bucket/a"]))
+}
+
+func TestLoggerFactorySharesClients(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	injected := makeTestS3Factory(t, m).s3Client()
+	lf := S3LoggerFactory{Bucket: "bucket", S3: injected, Stats: &S3Stats{}}
+	a, b := lf.newS3Logger("a"), lf.newS3Logger("b")
+	assert.True(a.S3.Client.Config.HTTPClient == injected.Client.Config.HTTPClient)
+	assert.True(a.S3.Client.Config.HTTPClient == b.S3.Client.Config.HTTPClient)
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+	assert.Equal("new\n", string(m.objects["/bucket/a"]))
+	assert.Equal(int64(1), lf.Stats.PutRequests)
+}
+
+func TestLoggerFactoryFailsWithoutPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}, getGate: make(chan struct{})}
+	lf := makeTestS3Factory(t, m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := lf.NewLoggerContext(ctx, "a")
+	assert.Error(err)
+	close(m.getGate)
+
+	// a missing object is no error
+	l, err := lf.NewLoggerContext(context.Background(), "b")
+	assert.NoError(err)
+	assert.NoError(l.Close())
+}
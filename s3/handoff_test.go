@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterWritesHandoffOnClose(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+	f := laozi.HandoffFile(filepath.Join(t.TempDir(), "handoff", "laozi.json"))
+
+	_, found, err := f.ReadHandoff()
+	assert.NoError(err)
+	assert.False(found)
+
+	var errs []error
+	r := laozi.NewLaozi(&laozi.Config{
+		LoggerFactory:    lf,
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: partitionByEvent,
+		ErrorHandler:     func(err error) { errs = append(errs, err) },
+		Handoff:          f,
+	})
+	r.Log([]byte("b"))
+	r.Log([]byte("a"))
+	r.Log([]byte("a"))
+	assert.Eventually(func() bool {
+		var buf bytes.Buffer
+		r.DumpState(&buf)
+		return strings.Count(buf.String(), `"key"`) == 2
+	}, time.Second, time.Millisecond)
+	m.failPuts = true
+	r.Close()
+	assert.Len(errs, 2)
+
+	h, found, err := f.ReadHandoff()
+	assert.NoError(err)
+	assert.True(found)
+	assert.NotEmpty(h.Host)
+	if assert.Len(h.Partitions, 2) {
+		assert.Equal("a", h.Partitions[0].Key)
+		assert.Equal(int64(0), h.Partitions[0].Flushed)
+		assert.Equal(int64(2), h.Partitions[0].Logged)
+		assert.Contains(h.Partitions[0].Error, "AccessDenied")
+		assert.Equal("b", h.Partitions[1].Key)
+	}
+	assert.Len(h.Unflushed(), 2)
+}
+
+func TestS3LoggerReportsSequencesForHandoff(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+
+	l := lf.newS3Logger("a")
+	l.add([]byte("a\n"))
+	assert.NoError(l.flush())
+	l.add([]byte("b\n"))
+	flushed, logged := l.Sequences()
+	assert.Equal(int64(1), flushed)
+	assert.Equal(int64(2), logged)
+
+	assert.NoError(l.flush())
+	flushed, logged = l.Sequences()
+	assert.Equal(flushed, logged)
+}
+
+func TestS3HandoffStoresHandoff(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	s := &S3Handoff{S3: s3.New(session.New(), lf.s3Config()), Bucket: "bucket", Key: "handoff.json"}
+
+	_, found, err := s.ReadHandoff()
+	assert.NoError(err)
+	assert.False(found)
+
+	h := laozi.Handoff{Host: "host", Time: testTime.UTC(), Partitions: []laozi.HandoffPartition{{Key: "a", Logged: 1}}}
+	assert.NoError(s.WriteHandoff(h))
+	read, found, err := s.ReadHandoff()
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(h, read)
+}
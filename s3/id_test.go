@@ -0,0 +1,34 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatedKeyHasGeneratedID(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	l := makeTestLogger()
+	l.rotation = time.Hour
+	l.batchStart = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	l.sequence = 5
+	l.idGenerator = laozi.IDGeneratorFunc(func(t time.Time) string {
+		calls++
+		return "id"
+	})
+
+	key := l.rotatedKey()
+	assert.True(strings.HasSuffix(key, "/id_"+rotating.SequenceRange(1, 5)), key)
+	assert.Equal(key, l.rotatedKey())
+	assert.Equal(1, calls)
+
+	seq, ok := rotating.ParseSequenceRange(key)
+	assert.True(ok)
+	assert.Equal(int64(5), seq)
+}
@@ -0,0 +1,29 @@
+package s3
+
+import "fmt"
+
+// KeyIndex tells which object keys may exist, for loggers to skip fetching the previous data
+// of new partitions, see S3LoggerFactory.KeyIndex.
+type KeyIndex interface {
+	// MayExist reports whether the object of a key may exist. It must report true for every
+	// key that was flushed.
+	MayExist(key string) (bool, error)
+}
+
+// coldKey reports whether the KeyIndex of the logger knows its key has no object yet, so its
+// previous data needn't be fetched. Errors of the index are printed, and the data fetched.
+func (l *s3logger) coldKey(index KeyIndex) bool {
+	if index == nil {
+		return false
+	}
+	exists, err := index.MayExist(l.key)
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not look up key, fetching its previous data: %s: %s\n", l.key, err)
+		return false
+	}
+	if !exists {
+		// flushes expect the object not to exist with DetectConcurrentWriters
+		l.etag, l.etagKnown = "", true
+	}
+	return !exists
+}
@@ -0,0 +1,41 @@
+package s3
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingKeyIndex struct{}
+
+func (failingKeyIndex) MayExist(key string) (bool, error) {
+	return false, errors.New("index is down")
+}
+
+func TestS3LoggerSkipsPreviousDataOfColdKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}}
+	lf := makeTestS3Factory(t, m)
+	c := makeTestCatalog(t)
+	lf.KeyIndex = c
+	lf.DetectConcurrentWriters = true
+
+	// the index doesn't know of the object, which flushes don't overwrite
+	l := lf.newS3Logger("a")
+	assert.Equal(0, m.gets)
+	assert.Empty(l.Buffered())
+	l.add([]byte("new\n"))
+	assert.Error(l.flush())
+	assert.Equal([]byte("old\n"), m.objects["/bucket/a"])
+
+	assert.NoError(c.RecordObject(CatalogEntry{Partition: "a", Key: "a"}))
+	l = lf.newS3Logger("a")
+	assert.Equal(1, m.gets)
+	assert.Equal([]byte("old\n"), l.Buffered())
+
+	lf.KeyIndex = failingKeyIndex{}
+	lf.newS3Logger("a")
+	assert.Equal(2, m.gets)
+}
@@ -0,0 +1,58 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// sseKMS is the SSE-KMS settings of the objects of a partition, see S3LoggerFactory.SSEKMSKeyID.
+type sseKMS struct {
+	keyID string
+	// context is the encryption context, base64 encoded JSON, if any
+	context string
+}
+
+// sseKMS returns the SSE-KMS settings of the objects of a partition.
+func (lf S3LoggerFactory) sseKMS(partition string) sseKMS {
+	k := sseKMS{keyID: lf.SSEKMSKeyID}
+	if k.keyID == "" || lf.SSEKMSContext == nil {
+		return k
+	}
+	if c := lf.SSEKMSContext(partition); len(c) > 0 {
+		// maps of strings always encode
+		data, _ := json.Marshal(c)
+		k.context = base64.StdEncoding.EncodeToString(data)
+	}
+	return k
+}
+
+// option returns the request option setting the SSE-KMS headers of the requests creating
+// objects, which are the only ones accepting them.
+func (k sseKMS) option() request.Option {
+	return func(r *request.Request) {
+		if k.keyID == "" {
+			return
+		}
+		switch r.Operation.Name {
+		case "PutObject", "CreateMultipartUpload", "CopyObject":
+		default:
+			return
+		}
+		r.HTTPRequest.Header.Set("X-Amz-Server-Side-Encryption", s3.ServerSideEncryptionAwsKms)
+		r.HTTPRequest.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", k.keyID)
+		if k.context != "" {
+			r.HTTPRequest.Header.Set("X-Amz-Server-Side-Encryption-Context", k.context)
+		}
+	}
+}
+
+// PartitionEncryptionContext returns an SSEKMSContext holding the partition key under name, so
+// KMS key policies and grants can allow or revoke the decryption of every partition apart.
+func PartitionEncryptionContext(name string) func(partition string) map[string]string {
+	return func(partition string) map[string]string {
+		return map[string]string{name: partition}
+	}
+}
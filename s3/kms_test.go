@@ -0,0 +1,66 @@
+package s3
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerEncryptsWithPartitionContexts(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	lf := makeTestS3Factory(t, m)
+	lf.SSEKMSKeyID = "key"
+	lf.SSEKMSContext = PartitionEncryptionContext("tenant")
+
+	for _, key := range []string{"a", "b"} {
+		l := lf.NewLogger(key)
+		l.Log([]byte("event\n"))
+		assert.NoError(l.Close())
+	}
+
+	for _, key := range []string{"a", "b"} {
+		h := m.headers["/bucket/"+key]
+		assert.Equal("aws:kms", h.Get("X-Amz-Server-Side-Encryption"))
+		assert.Equal("key", h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+		context, err := base64.StdEncoding.DecodeString(h.Get("X-Amz-Server-Side-Encryption-Context"))
+		assert.NoError(err)
+		assert.JSONEq(`{"tenant":"`+key+`"}`, string(context))
+	}
+}
+
+func TestS3LoggerEncryptsWithPartitionKeyRings(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := NewKeyRing("a", testKey1)
+	b, _ := NewKeyRing("b", testKey2)
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	lf := makeTestS3Factory(t, m)
+	lf.PartitionKeyRing = func(partition string) *KeyRing {
+		return map[string]*KeyRing{"a": a, "b": b}[partition]
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		l := lf.NewLogger(key)
+		l.Log([]byte(key + "\n"))
+		assert.NoError(l.Close())
+	}
+
+	svc := s3.New(session.New(), lf.s3Config())
+	for key, k := range map[string]*KeyRing{"a": a, "b": b, "c": nil} {
+		r := &ArchiveReader{S3: svc, Bucket: "bucket", KeyRing: k}
+		next, err := r.Events(key)
+		if assert.NoError(err, key) {
+			assert.Equal([]string{key}, readEvents(next))
+		}
+	}
+	// tenants can't read each other's data
+	r := &ArchiveReader{S3: svc, Bucket: "bucket", KeyRing: b}
+	_, err := r.Events("a")
+	assert.Error(err)
+}
@@ -0,0 +1,810 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/seedboxtech/laozi/internal/rotating"
+)
+
+const maxRetries = 10
+
+// sampledOutMetadata is the object metadata holding the number of events sampled out of it.
+const sampledOutMetadata = "Sampled-Out"
+
+type s3logger struct {
+	S3            *s3.S3
+	bucket        string
+	key           string
+	buffer        Buffer
+	active        time.Time
+	logChan       chan []byte
+	readChan      chan readRequest
+	batchChan     chan [][]byte
+	flushInterval time.Duration
+	quitChan      chan struct{}
+	compression   string
+	partition     string
+	sequence      int64
+	checkpointer  laozi.Checkpointer
+	rotation      time.Duration
+	// sequence of the last event written to a rotated object and the time
+	// the first event still in the buffer was logged
+	flushedSequence int64
+	batchStart      time.Time
+	// events of the buffer sampled out by the router, and how many of them were last uploaded
+	sampledOut         int64
+	uploadedSampledOut int64
+	keyRing            *KeyRing
+	kms                sseKMS
+	// hash of the last uploaded payload, to skip uploading it again
+	skipUnchanged bool
+	uploadedHash  [sha256.Size]byte
+	stats         *S3Stats
+	// length of the start of the buffer already stored in s3
+	persisted int
+	// previous receives the previous data of the key when fetched in the background
+	previous chan *s3logger
+	// previousData is the PreviousData strategy, and conflict the error failing flushes
+	previousData string
+	conflict     error
+	// Object Lock settings of the uploads
+	lockMode      string
+	lockRetention time.Duration
+	legalHold     bool
+	// streamUploads compresses the buffer while uploading it
+	streamUploads bool
+	// sequence of the last event reported flushed, and size of the last upload
+	reportedSequence int64
+	uploadedBytes    int
+	// version of the last upload, in versioned buckets
+	uploadedVersion string
+	laozi.Reporter
+	// stampSequence prepends the sequence number of every event to its record
+	stampSequence bool
+	// size of the buffer and whether an upload is in progress, for State
+	bufferedBytes int64
+	uploading     int32
+	// gzipMembers appends every flush to the object as a gzip member
+	gzipMembers bool
+	// flush thresholds of the events logged since the last flush, unless overridden by the
+	// thresholds, and flushRequests receives the forced flushes
+	maxRecords    int
+	maxBytes      int
+	thresholds    *laozi.FlushThresholds
+	flushRequests chan chan error
+	// bufferedRequests receives the calls to Buffered while the loop runs, and stopped is
+	// closed once it returned. Both are nil until the loop is started.
+	bufferedRequests chan chan []byte
+	stopped          chan struct{}
+	// idGenerator optionally makes the id of rotated object keys, kept in batchID until flushed
+	idGenerator laozi.IDGenerator
+	batchID     string
+	cache       *LocalCache
+	// detectWriters makes uploads conditional on etag, the ETag of the object of the key when
+	// last fetched or uploaded, or none if it didn't exist. etagKnown is unset until then.
+	detectWriters bool
+	etag          string
+	etagKnown     bool
+	// retryQueue optionally keeps the upload of the last flush when it fails on Close
+	retryQueue *RetryQueue
+	// adaptive derives the records threshold from the rate of events since rateTime, smoothed
+	// in rate once known, between adaptiveMin and adaptiveMax
+	adaptive     bool
+	adaptiveMin  int
+	adaptiveMax  int
+	rate         float64
+	rateKnown    bool
+	rateTime     time.Time
+	rateSequence int64
+	// emptyMarkers marks the rotation windows without events after markedWindow, the last one
+	// events were flushed in or marked, lastEvent being when the last event was buffered
+	emptyMarkers bool
+	markedWindow time.Time
+	lastEvent    time.Time
+	// catalog optionally records the flushed objects, with the checksum of the last upload
+	catalog          Catalog
+	uploadedChecksum string
+	// uploadProgress is optionally called with the progress of uploads
+	uploadProgress func(key string, uploaded, total int64)
+	// windowBuffers seals the buffer when a rotation window ends, in sealed until flushed
+	windowBuffers bool
+	sealed        []windowBuffer
+	// presignTTL is how long the pre-signed URLs of the objects reported flushed are valid
+	presignTTL time.Duration
+	// dictionary optionally compresses the key with zstd, stored in dictionaryKey, trained on
+	// the first dictionarySamples events flushed if trainDictionaries
+	dictionary        []byte
+	dictionaryKey     string
+	trainDictionaries bool
+	dictionarySize    int
+	dictionarySamples int
+	// trackSchemas versions the schema of events, the current one being schema of the known
+	// schemas, and schemaRotation flushes the buffer when it changes
+	trackSchemas   bool
+	schemaRotation bool
+	schema         SchemaVersion
+	schemas        []SchemaVersion
+	// received counts the events logged, and persistedEvents those persisted by the last flush
+	received        int64
+	persistedEvents int64
+}
+
+// Log causes event event to br written to internal memory buffer.
+func (l *s3logger) Log(e []byte) {
+	l.logChan <- e
+	l.active = time.Now()
+}
+
+// LogBatch causes events to be written to the internal memory buffer at once.
+func (l *s3logger) LogBatch(events [][]byte) {
+	l.batchChan <- events
+	l.active = time.Now()
+}
+
+// Flush uploads the buffer now, once the previous data was fetched, returning once done.
+func (l *s3logger) Flush() error {
+	done := make(chan error, 1)
+	l.flushRequests <- done
+	return <-done
+}
+
+func (l *s3logger) loop() {
+	defer close(l.stopped)
+	flushChan := l.nextFlush()
+
+	var event []byte
+	for {
+		select {
+		case <-flushChan:
+			l.learnRate()
+			if l.previous == nil {
+				l.flush()
+				l.markEmptyWindows()
+			}
+			flushChan = l.nextFlush()
+		case event = <-l.logChan:
+			l.add(event)
+			l.flushFull()
+		case events := <-l.batchChan:
+			for _, e := range events {
+				l.add(e)
+				l.flushFull()
+			}
+		case req := <-l.readChan:
+			req.done <- l.addReader(req.r)
+			l.flushFull()
+		case prev := <-l.previous:
+			l.mergePrevious(prev)
+		case done := <-l.flushRequests:
+			l.waitPrevious()
+			done <- l.flush()
+		case done := <-l.bufferedRequests:
+			done <- l.bufferedCopy()
+		case <-l.quitChan:
+			return
+		default:
+			if flushChan == nil {
+				// a flush interval may have been set meanwhile
+				flushChan = l.nextFlush()
+			}
+			// chill out for a moment...
+			time.Sleep(time.Millisecond)
+		}
+		l.storeBuffered()
+	}
+}
+
+// add writes an event to the buffer.
+func (l *s3logger) add(e []byte) {
+	l.trackSchema(e)
+	l.received++
+	l.sliceWindow()
+	l.buffered()
+	l.buffer.Write(l.stamp())
+	l.buffer.Write(l.terminate(e))
+}
+
+// flushFull flushes the buffer once the events logged since the last flush reach the
+// FlushEveryNRecords, or AdaptiveFlush, or FlushEveryNBytes thresholds.
+func (l *s3logger) flushFull() {
+	if l.previous != nil {
+		return
+	}
+	_, _, maxBytes := l.flushThresholds()
+	records, maxRecords := l.sequence-l.reportedSequence, l.recordsThreshold()
+	if (maxRecords > 0 && records >= int64(maxRecords)) || (maxBytes > 0 && l.buffer.Len()-l.persisted >= maxBytes) {
+		if err := l.flush(); err != nil {
+			fmt.Printf(" [laozi] Error! Could not flush logger, will retry: %s: %s\n", l.partition, err)
+		}
+	}
+}
+
+// buffered must be called every time an event is added to the buffer.
+func (l *s3logger) buffered() {
+	l.sequence++
+	if l.batchStart.IsZero() {
+		l.batchStart = time.Now()
+	}
+	if l.emptyMarkers {
+		l.lastEvent = time.Now()
+	}
+}
+
+// Persisted returns how many of the events logged are persisted.
+func (l *s3logger) Persisted() int64 {
+	return atomic.LoadInt64(&l.persistedEvents)
+}
+
+// RecordSampledOut counts events of the partition that were sampled out, so the count can be
+// stored along the flushed object.
+func (l *s3logger) RecordSampledOut(n int64) {
+	atomic.AddInt64(&l.sampledOut, n)
+}
+
+// Close is called when logger timeouts. Will cause internal memory buffer to be written to s3.
+func (l *s3logger) Close() error {
+	l.quitChan <- struct{}{}
+	l.waitPrevious()
+	err := l.flush()
+	l.markEmptyWindows()
+	return l.queueFailed(err)
+}
+
+func (l *s3logger) compressBuffer() []byte {
+	if l.compression == "zstd" && l.dictionary != nil {
+		return compress.Zstd(l.buffer.Bytes(), l.dictionary)
+	}
+	return compress.Compress(l.compression, l.buffer.Bytes())
+}
+
+// decompressToBuffer writes previous data to the buffer, returning an *ErrPreviousData if it
+// can't be decompressed.
+func (l *s3logger) decompressToBuffer(r io.ReadCloser) error {
+
+	switch l.compression {
+	case "gzip":
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return &laozi.ErrPreviousData{Key: l.key, Cause: err}
+		}
+		b, err := ioutil.ReadAll(gr)
+		if err != nil {
+			return &laozi.ErrPreviousData{Key: l.key, Cause: err}
+		}
+		l.buffer.Write(b)
+	case "zstd":
+		b, _ := ioutil.ReadAll(r)
+		b, err := compress.DecompressZstd(b, l.dictionary)
+		if err != nil {
+			// appending to it would lose it
+			return &laozi.ErrPreviousData{Key: l.key, Cause: err}
+		}
+		l.buffer.Write(b)
+	case "":
+		b, _ := ioutil.ReadAll(r)
+		if compress.IsGzip(b) {
+			// keep the object compressed, appending plain data to it would corrupt it
+			l.compression = "gzip"
+			return l.decompressToBuffer(ioutil.NopCloser(bytes.NewReader(b)))
+		}
+		l.buffer.Write(b)
+	}
+	return nil
+}
+
+// decryptToBuffer writes previous data encrypted with the key of the given id to the buffer,
+// returning an *ErrPreviousData if it can't be decrypted.
+func (l *s3logger) decryptToBuffer(id string, r io.ReadCloser) error {
+	if l.keyRing == nil {
+		// appending plain data to it would corrupt the object
+		return &laozi.ErrPreviousData{Key: l.key, Cause: errors.New("object is encrypted but no KeyRing is configured")}
+	}
+
+	b, _ := ioutil.ReadAll(r)
+	data, err := l.keyRing.Decrypt(id, b)
+	if err != nil {
+		return &laozi.ErrPreviousData{Key: l.key, Cause: err}
+	}
+	return l.decompressToBuffer(ioutil.NopCloser(bytes.NewReader(data)))
+}
+
+func (l *s3logger) flush() error {
+	return l.flushContext(aws.BackgroundContext())
+}
+
+func (l *s3logger) flushContext(ctx aws.Context) error {
+	if err := l.flushSealed(ctx); err != nil {
+		l.storeBuffered()
+		return err
+	}
+	return l.flushBuffer(ctx)
+}
+
+// flushBuffer uploads the buffer.
+func (l *s3logger) flushBuffer(ctx aws.Context) error {
+	atomic.StoreInt32(&l.uploading, 1)
+	defer atomic.StoreInt32(&l.uploading, 0)
+	defer l.storeBuffered()
+
+	start := time.Now()
+	key, err := l.upload(ctx)
+	// TODO: add emergency file writing here if s3 is down...
+	if err == nil {
+		err = l.flushed(key)
+	}
+	if key != "" || err != nil {
+		d := laozi.DeliveryReport{
+			Partition: l.partition,
+			Key:       key,
+			Records:   int(l.sequence - l.reportedSequence),
+			Bytes:     l.uploadedBytes,
+			Duration:  time.Since(start),
+			Err:       err,
+		}
+		if err == nil {
+			d.URL = l.presign(key)
+		}
+		l.Report(d)
+	}
+	if err != nil {
+		return err
+	}
+	l.reportedSequence = l.sequence
+	atomic.StoreInt64(&l.persistedEvents, l.received)
+	return nil
+}
+
+// upload writes the buffer to s3, returning the key of the object it was written to.
+func (l *s3logger) upload(ctx aws.Context) (string, error) {
+	if l.conflict != nil {
+		return "", l.conflict
+	}
+	key := l.key
+	var opts []request.Option
+	if l.gzipMembers && l.buffer.Len() == 0 {
+		return "", nil
+	}
+	if l.rotation > 0 {
+		if l.buffer.Len() == 0 {
+			return "", nil
+		}
+		// rotated objects are immutable, so refuse to overwrite one a previous attempt uploaded
+		key = l.rotatedKey()
+		opts = append(opts, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}))
+	}
+
+	metadata := map[string]*string{}
+	if l.rotation > 0 {
+		metadata[contentDigestMetadata] = aws.String(contentDigest(l.buffer.Bytes()))
+	}
+	l.uploadedSampledOut = atomic.LoadInt64(&l.sampledOut)
+	if l.uploadedSampledOut > 0 {
+		metadata[sampledOutMetadata] = aws.String(strconv.FormatInt(l.uploadedSampledOut, 10))
+	}
+
+	var hash [sha256.Size]byte
+	if l.skipUnchanged {
+		if hash = l.payloadHash(); hash == l.uploadedHash {
+			l.stats.skippedUpload()
+			return "", nil
+		}
+	}
+
+	l.schemaMetadata(metadata)
+	if l.compression == "zstd" {
+		if err := l.trainDictionary(ctx); err != nil {
+			return key, err
+		}
+		if l.dictionary != nil {
+			metadata[dictionaryMetadata] = aws.String(l.dictionaryKey)
+		}
+	}
+
+	var body []byte
+	if !l.streaming() {
+		body = l.compressBuffer()
+	}
+	if l.keyRing != nil {
+		id, encrypted, err := l.keyRing.Encrypt(body)
+		if err != nil {
+			return key, err
+		}
+		body = encrypted
+		metadata[keyIDMetadata] = aws.String(id)
+	}
+
+	var err error
+	size := len(body)
+	op, attempts := "PutObject", 0
+	// retry write to s3 for max tries
+	for i := 0; i < maxRetries; i++ {
+		if l.gzipMembers {
+			op, attempts = "multipart upload", attempts+1
+			err = l.appendMember(ctx, key, body, metadata)
+		} else if l.streaming() {
+			op, attempts = "multipart upload", attempts+1
+			size, err = l.streamUpload(ctx, key, metadata, append(opts, l.writeCondition()...))
+		} else {
+			input := &s3.PutObjectInput{
+				Bucket:   aws.String(l.bucket),
+				Key:      aws.String(key),
+				Body:     bytes.NewReader(body),
+				Metadata: metadata,
+			}
+			l.lock(input, body)
+			var out *s3.PutObjectOutput
+			putOpts := append(append(opts, l.writeCondition()...), countAttempts(&attempts),
+				l.newProgress(key, int64(len(body))).option(), l.kms.option())
+			out, err = l.S3.PutObjectWithContext(ctx, input, putOpts...)
+			if err == nil {
+				l.cacheUpload(key, aws.StringValue(out.ETag), body, metadata)
+				l.etag, l.etagKnown = aws.StringValue(out.ETag), true
+				l.uploadedVersion = aws.StringValue(out.VersionId)
+			}
+		}
+
+		if l.writeCondition() != nil && isAlreadyUploaded(err) {
+			l.conflict = &laozi.ErrConcurrentWrite{Key: key}
+			return key, l.conflict
+		}
+
+		if l.rotation > 0 && isAlreadyUploaded(err) {
+			// the object is ours only if it holds the same events
+			op = "HeadObject"
+			if err = checkUploaded(ctx, l.S3, l.bucket, key, aws.StringValue(metadata[contentDigestMetadata])); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			l.uploadedHash = hash
+			l.uploadedBytes = size
+			if l.catalog != nil && body != nil {
+				sum := sha256.Sum256(body)
+				l.uploadedChecksum = hex.EncodeToString(sum[:])
+			}
+			break
+		}
+	}
+
+	return key, s3Error(op, l.bucket, key, attempts, err)
+}
+
+// lock sets the Object Lock settings of an upload, if any.
+func (l *s3logger) lock(input *s3.PutObjectInput, body []byte) {
+	if l.lockMode == "" && !l.legalHold {
+		return
+	}
+	if l.lockMode != "" {
+		input.ObjectLockMode = aws.String(l.lockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(time.Now().Add(l.lockRetention))
+	}
+	if l.legalHold {
+		input.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
+	}
+	// required by s3 for uploads with Object Lock settings
+	sum := md5.Sum(body)
+	input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// payloadHash identifies the content of an upload.
+func (l *s3logger) payloadHash() [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(l.buffer.Bytes())
+	fmt.Fprintf(h, "%d", l.uploadedSampledOut)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// flushed must be called once the buffer was uploaded to key.
+func (l *s3logger) flushed(key string) error {
+	if key == "" {
+		return nil
+	}
+
+	err := l.checkpoint(key)
+	l.catalogObject(key)
+	l.persisted = l.buffer.Len()
+	if l.gzipMembers {
+		l.persisted = 0
+		l.buffer.Reset()
+		atomic.AddInt64(&l.sampledOut, -l.uploadedSampledOut)
+	}
+	if l.rotation > 0 {
+		l.flushedWindow()
+		l.persisted = 0
+		l.buffer.Reset()
+		l.flushedSequence = l.sequence
+		l.batchStart = time.Time{}
+		l.batchID = ""
+		atomic.AddInt64(&l.sampledOut, -l.uploadedSampledOut)
+	}
+	return err
+}
+
+// checkpoint records how far the partition has been flushed, if a checkpointer is configured.
+func (l *s3logger) checkpoint(key string) error {
+	if l.checkpointer == nil {
+		return nil
+	}
+
+	err := l.checkpointer.SaveCheckpoint(laozi.Checkpoint{
+		Partition:  l.partition,
+		Key:        key,
+		Sequence:   l.sequence,
+		Offset:     int64(l.buffer.Len()),
+		SampledOut: l.uploadedSampledOut,
+		Time:       time.Now(),
+		VersionID:  l.uploadedVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("could not checkpoint %s: %s", l.partition, err)
+	}
+	return nil
+}
+
+// Buffered returns the content of the buffer, i.e. the whole object unless rotating objects.
+func (l *s3logger) Buffered() []byte {
+	if l.stopped == nil {
+		return l.bufferedCopy()
+	}
+	done := make(chan []byte, 1)
+	select {
+	case l.bufferedRequests <- done:
+		return <-done
+	case <-l.stopped:
+		return l.bufferedCopy()
+	}
+}
+
+func (l *s3logger) bufferedCopy() []byte {
+	return append(l.sealedBytes(), l.buffer.Bytes()...)
+}
+
+// Detach stops the logger without flushing, returning the events not stored in s3 yet.
+func (l *s3logger) Detach() [][]byte {
+	l.quitChan <- struct{}{}
+	return l.unpersisted()
+}
+
+func (l *s3logger) unpersisted() [][]byte {
+	var events [][]byte
+	for _, w := range l.sealed {
+		events = append(events, w.data)
+	}
+	if l.buffer.Len() <= l.persisted {
+		return events
+	}
+	return append(events, append([]byte(nil), l.buffer.Bytes()[l.persisted:]...))
+}
+
+// LastActive is used to know when the S3Logger last logged.
+func (l *s3logger) LastActive() time.Time {
+	return l.active
+}
+
+// fetchPreviousDataContext fetches the previous data of the key, failing if it exists but could
+// not be read before ctx is done.
+func (l *s3logger) fetchPreviousDataContext(ctx aws.Context) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(l.key),
+	}
+	cached, found := l.cache.get(l.partition, l.key)
+	if found {
+		input.IfNoneMatch = aws.String(cached.ETag)
+	}
+	attempts := 0
+	resp, err := l.S3.GetObjectWithContext(ctx, input, countAttempts(&attempts))
+	if found && isNotModified(err) {
+		resp = &s3.GetObjectOutput{
+			Body:     ioutil.NopCloser(bytes.NewReader(cached.Data)),
+			ETag:     aws.String(cached.ETag),
+			Metadata: aws.StringMap(cached.Meta),
+		}
+		err = nil
+	}
+	if isNotFound(err) {
+		l.etag, l.etagKnown = "", true
+		return nil
+	}
+	if err != nil {
+		return s3Error("GetObject", l.bucket, l.key, attempts, err)
+	}
+	l.etag, l.etagKnown = aws.StringValue(resp.ETag), true
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if key := resp.Metadata[dictionaryMetadata]; key != nil {
+		if err = l.loadDictionary(aws.StringValue(key)); err != nil {
+			err = &laozi.ErrPreviousData{Key: l.key, Cause: fmt.Errorf("could not load dictionary: %w", err)}
+		}
+	}
+	if err == nil {
+		if id := resp.Metadata[keyIDMetadata]; id != nil {
+			err = l.decryptToBuffer(aws.StringValue(id), ioutil.NopCloser(bytes.NewReader(data)))
+		} else {
+			err = l.decompressToBuffer(ioutil.NopCloser(bytes.NewReader(data)))
+		}
+	}
+	if err != nil {
+		// flushes fail rather than overwrite the object
+		l.conflict = err
+		return err
+	}
+	l.persisted = l.buffer.Len()
+	if n, err := strconv.ParseInt(aws.StringValue(resp.Metadata[sampledOutMetadata]), 10, 64); err == nil {
+		l.sampledOut = n
+	}
+	if l.buffer.Len() > 0 {
+		l.handlePreviousData()
+	}
+	if l.skipUnchanged {
+		l.uploadedSampledOut = l.sampledOut
+		l.uploadedHash = l.payloadHash()
+	}
+	return nil
+}
+
+// handlePreviousData applies the PreviousData strategy to the previous data in the buffer.
+func (l *s3logger) handlePreviousData() {
+	switch l.previousData {
+	case PreviousDataOverwrite:
+		l.discardPreviousData()
+	case PreviousDataRename:
+		aside := fmt.Sprintf("%s.%s.previous", l.key, time.Now().UTC().Format(rotating.WindowFormat))
+		_, err := l.S3.CopyObjectWithContext(aws.BackgroundContext(), &s3.CopyObjectInput{
+			Bucket:     aws.String(l.bucket),
+			Key:        aws.String(aside),
+			CopySource: aws.String(l.bucket + "/" + url.PathEscape(l.key)),
+		}, l.kms.option())
+		if err != nil {
+			// appending is better than losing it
+			fmt.Printf(" [laozi] Error! Could not rename previous data, appending to it: %s: %s\n", l.key, err)
+			return
+		}
+		l.discardPreviousData()
+	case PreviousDataError:
+		l.conflict = &laozi.ErrPreviousData{Key: l.key}
+	}
+}
+
+func (l *s3logger) discardPreviousData() {
+	l.buffer.Reset()
+	l.persisted = 0
+	l.sampledOut = 0
+}
+
+// fetchPreviousDataAsync fetches the previous data of the key in the background, for the loop
+// to merge it once received.
+func (l *s3logger) fetchPreviousDataAsync() {
+	l.previous = make(chan *s3logger, 1)
+	prev := &s3logger{
+		S3:            l.S3,
+		bucket:        l.bucket,
+		key:           l.key,
+		buffer:        newMemoryBuffer([]byte{}),
+		compression:   l.compression,
+		keyRing:       l.keyRing,
+		skipUnchanged: l.skipUnchanged,
+		previousData:  l.previousData,
+		partition:     l.partition,
+		cache:         l.cache,
+		detectWriters: l.detectWriters,
+	}
+	go func() {
+		if err := prev.fetchPreviousDataContext(aws.BackgroundContext()); err != nil {
+			fmt.Printf(" [laozi] Error! Could not fetch previous data, flushes will fail: %s: %s\n", prev.key, err)
+			if prev.conflict == nil {
+				prev.conflict = &laozi.ErrPreviousData{Key: prev.key, Cause: err}
+			}
+		}
+		l.previous <- prev
+	}()
+}
+
+// mergePrevious puts the fetched previous data of the key before the events buffered meanwhile.
+func (l *s3logger) mergePrevious(prev *s3logger) {
+	l.previous = nil
+	l.conflict = prev.conflict
+	l.compression = prev.compression
+	l.dictionary, l.dictionaryKey = prev.dictionary, prev.dictionaryKey
+	l.etag, l.etagKnown = prev.etag, prev.etagKnown
+	if prev.buffer.Len() == 0 {
+		return
+	}
+
+	data := append(prev.buffer.Bytes(), l.buffer.Bytes()...)
+	l.buffer.Reset()
+	l.buffer.Write(data)
+	l.persisted = prev.persisted
+	atomic.AddInt64(&l.sampledOut, prev.sampledOut)
+	l.uploadedSampledOut = prev.uploadedSampledOut
+	l.uploadedHash = prev.uploadedHash
+}
+
+// waitPrevious merges the previous data of the key if it is still being fetched. It must not
+// be called while the loop runs.
+func (l *s3logger) waitPrevious() {
+	if l.previous != nil {
+		l.mergePrevious(<-l.previous)
+	}
+}
+
+// loadCheckpoint resumes the sequence of a partition from its last checkpoint, if any.
+func (l *s3logger) loadCheckpoint() (bool, error) {
+	if l.checkpointer == nil {
+		return false, nil
+	}
+
+	c, found, err := l.checkpointer.LoadCheckpoint(l.partition)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		l.sequence = c.Sequence
+		l.flushedSequence = c.Sequence
+	}
+	return found, nil
+}
+
+// writeCondition returns the options making an upload to the key of the logger fail if another
+// process wrote to it, if detecting concurrent writers.
+func (l *s3logger) writeCondition() []request.Option {
+	if !l.detectWriters || !l.etagKnown || l.rotation > 0 || l.gzipMembers {
+		return nil
+	}
+	if l.etag == "" {
+		return []request.Option{request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"})}
+	}
+	return []request.Option{request.WithSetRequestHeaders(map[string]string{"If-Match": l.etag})}
+}
+
+// s3Error wraps the error of an S3 request, if it is one.
+func s3Error(op, bucket, key string, attempts int, err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	e := &laozi.ErrS3{Op: op, Bucket: bucket, Key: key, Code: aerr.Code(), Attempts: attempts, Cause: err}
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		e.StatusCode = rerr.StatusCode()
+		e.RequestID = rerr.RequestID()
+	}
+	if rerr, ok := err.(s3.RequestFailure); ok {
+		e.HostID = rerr.HostID()
+	}
+	return e
+}
+
+// countAttempts adds to n how many times a request was sent.
+func countAttempts(n *int) request.Option {
+	return func(r *request.Request) {
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			*n += r.RetryCount + 1
+		})
+	}
+}
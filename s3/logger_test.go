@@ -1,4 +1,4 @@
-package laozi
+package s3
 
 import (
 	"bytes"
@@ -9,13 +9,19 @@ import (
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/stretchr/testify/assert"
-
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
 )
 
+var testTime = time.Now()
+
+// partitionByEvent uses the events as their partition key.
+func partitionByEvent(e []byte) (string, error) {
+	return string(e), nil
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 	testBucket = fmt.Sprintf("LOAZI_TEST_BUCKET_%d", rand.Intn(123435))
@@ -35,15 +41,18 @@ func makeS3Service() *s3.S3 {
 func makeTestLogger() *s3logger {
 
 	return &s3logger{
-		bucket:        testBucket,
-		key:           testFile,
-		S3:            makeS3Service(),
-		buffer:        bytes.NewBuffer([]byte{}),
-		active:        time.Now(),
-		logChan:       make(chan []byte, 10),
-		quitChan:      make(chan struct{}, 1),
-		flushInterval: time.Hour,
-		compression:   "gzip",
+		bucket:           testBucket,
+		key:              testFile,
+		S3:               makeS3Service(),
+		buffer:           newMemoryBuffer([]byte{}),
+		active:           time.Now(),
+		logChan:          make(chan []byte, 10),
+		batchChan:        make(chan [][]byte, 1),
+		quitChan:         make(chan struct{}, 1),
+		flushInterval:    time.Hour,
+		compression:      "gzip",
+		bufferedRequests: make(chan chan []byte),
+		stopped:          make(chan struct{}),
 	}
 }
 
@@ -154,7 +163,7 @@ func TestS3LoggerFetchesPreviousData(t *testing.T) {
 	})
 	assert.NoError(err)
 
-	l.fetchPreviousData()
+	assert.NoError(l.fetchPreviousDataContext(aws.BackgroundContext()))
 
 	assert.Equal(testData, l.buffer.Bytes())
 
@@ -176,6 +185,20 @@ func TestLoopLogsEvent(t *testing.T) {
 	assert.Equal([]byte("test datatest data"), l.buffer.Bytes())
 }
 
+func TestLoopLogsBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	l := makeTestLogger()
+	go l.loop()
+
+	l.LogBatch([][]byte{[]byte("a\n"), []byte("b\n")})
+
+	time.Sleep(time.Millisecond * 5)
+
+	assert.Equal([]byte("a\nb\n"), l.buffer.Bytes())
+	assert.Equal(int64(2), l.sequence)
+}
+
 func TestLoopFlushes(t *testing.T) {
 	assert := assert.New(t)
 
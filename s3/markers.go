@@ -0,0 +1,50 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/seedboxtech/laozi/internal/rotating"
+)
+
+// emptyWindowMarker names the marker object of a rotation window without events, see
+// S3LoggerFactory.EmptyWindowMarkers.
+const emptyWindowMarker = "_EMPTY"
+
+// markEmptyWindows uploads a marker object to the rotation windows that ended without events
+// since the last window events were flushed in. Windows of events still buffered aren't
+// marked.
+func (l *s3logger) markEmptyWindows() {
+	if !l.emptyMarkers {
+		return
+	}
+	end := time.Now().UTC().Truncate(l.rotation)
+	if !l.batchStart.IsZero() && l.batchStart.UTC().Truncate(l.rotation).Before(end) {
+		end = l.batchStart.UTC().Truncate(l.rotation)
+	}
+
+	for w := l.markedWindow.Add(l.rotation); w.Before(end); w = w.Add(l.rotation) {
+		key := fmt.Sprintf("%s/%s", rotating.Window(l.key, w, l.rotation), emptyWindowMarker)
+		_, err := l.S3.PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+			Bucket: aws.String(l.bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(nil),
+		}, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}), l.kms.option())
+		if err != nil && !isAlreadyUploaded(err) {
+			fmt.Printf(" [laozi] Error! Could not mark empty window, will retry: %s: %s\n", key, err)
+			return
+		}
+		l.markedWindow = w
+	}
+}
+
+// flushedWindow records the window of the last event flushed, for markEmptyWindows.
+func (l *s3logger) flushedWindow() {
+	if w := l.lastEvent.UTC().Truncate(l.rotation); l.emptyMarkers && w.After(l.markedWindow) {
+		l.markedWindow = w
+	}
+}
@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+// markers returns the keys of the empty window markers of the mock.
+func (m *mockS3) markers() []string {
+	m.Lock()
+	defer m.Unlock()
+	var keys []string
+	for key, data := range m.objects {
+		if strings.HasSuffix(key, "/"+emptyWindowMarker) && len(data) == 0 {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestS3LoggerMarksEmptyWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.EmptyWindowMarkers = true
+
+	l := lf.newS3Logger("a")
+	now := time.Now().UTC().Truncate(time.Hour)
+	l.markedWindow = now.Add(-3 * time.Hour)
+	l.markEmptyWindows()
+
+	assert.ElementsMatch([]string{
+		"/bucket/" + rotating.Window("a", now.Add(-2*time.Hour), time.Hour) + "/_EMPTY",
+		"/bucket/" + rotating.Window("a", now.Add(-time.Hour), time.Hour) + "/_EMPTY",
+	}, m.markers())
+	l.markEmptyWindows()
+	assert.Len(m.markers(), 2)
+
+	// windows of buffered events aren't marked
+	m.objects = map[string][]byte{}
+	l.markedWindow = now.Add(-4 * time.Hour)
+	l.add([]byte("a\n"))
+	l.batchStart = now.Add(-2 * time.Hour)
+	l.markEmptyWindows()
+	assert.Equal([]string{"/bucket/" + rotating.Window("a", now.Add(-3*time.Hour), time.Hour) + "/_EMPTY"}, m.markers())
+
+	// nor windows events were flushed in
+	assert.NoError(l.flush())
+	assert.Equal(now, l.markedWindow)
+
+	assert.Panics(func() {
+		lf.RotationInterval = 0
+		lf.NewLogger("a")
+	})
+}
@@ -0,0 +1,129 @@
+package s3
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// minCopyPartSize is the min size of the parts of a multipart upload but the last, under which
+// objects are downloaded to be appended to instead of copied server side.
+var minCopyPartSize int64 = 5 << 20
+
+// appendMember appends a gzip member to the object of key, see S3LoggerFactory.GzipMembers.
+// Objects of at least minCopyPartSize are copied server side in a multipart upload, smaller
+// ones are downloaded as is, neither being decompressed. Downloaded objects are only replaced
+// if they weren't written to meanwhile, failing with a 412 error retried by upload otherwise.
+func (l *s3logger) appendMember(ctx aws.Context, key string, member []byte, metadata map[string]*string) error {
+	head, err := l.S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return l.putObject(ctx, key, member, metadata, ifHeader("If-None-Match", "*"))
+	}
+	if err != nil {
+		return err
+	}
+
+	if aws.Int64Value(head.ContentLength) < minCopyPartSize {
+		resp, err := l.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(l.bucket),
+			Key:     aws.String(key),
+			IfMatch: head.ETag,
+		})
+		if err != nil {
+			return err
+		}
+		prev, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		condition := ifHeader("If-Match", aws.StringValue(head.ETag))
+		return l.putObject(ctx, key, append(prev, member...), metadata, condition)
+	}
+
+	upload, err := l.S3.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:   aws.String(l.bucket),
+		Key:      aws.String(key),
+		Metadata: metadata,
+	}, l.kms.option())
+	if err != nil {
+		return err
+	}
+	err = l.appendParts(ctx, key, upload.UploadId, head.ETag, member)
+	if err != nil {
+		l.S3.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(l.bucket),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		})
+	}
+	return err
+}
+
+// appendParts completes a multipart upload made of the object of key, as of etag, followed by
+// member.
+func (l *s3logger) appendParts(ctx aws.Context, key string, uploadID, etag *string, member []byte) error {
+	copied, err := l.S3.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+		Bucket:            aws.String(l.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(l.bucket + "/" + url.PathEscape(key)),
+		CopySourceIfMatch: etag,
+		PartNumber:        aws.Int64(1),
+		UploadId:          uploadID,
+	})
+	if err != nil {
+		return err
+	}
+	uploaded, err := l.S3.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(l.bucket),
+		Key:        aws.String(key),
+		Body:       bytes.NewReader(member),
+		PartNumber: aws.Int64(2),
+		UploadId:   uploadID,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = l.S3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(l.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{
+			{ETag: copied.CopyPartResult.ETag, PartNumber: aws.Int64(1)},
+			{ETag: uploaded.ETag, PartNumber: aws.Int64(2)},
+		}},
+	})
+	return err
+}
+
+func (l *s3logger) putObject(ctx aws.Context, key string, body []byte, metadata map[string]*string, condition request.Option) error {
+	_, err := l.S3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(l.bucket),
+		Key:      aws.String(key),
+		Body:     bytes.NewReader(body),
+		Metadata: metadata,
+	}, l.kms.option(), condition)
+	return err
+}
+
+// ifHeader returns the option making a request conditional on the header.
+func ifHeader(name, value string) request.Option {
+	return request.WithSetRequestHeaders(map[string]string{name: value})
+}
+
+func isNotFound(err error) bool {
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		return rerr.StatusCode() == http.StatusNotFound
+	}
+	return false
+}
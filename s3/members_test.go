@@ -0,0 +1,97 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+func gunzip(t *testing.T, data []byte) string {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(gr)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestS3LoggerAppendsGzipMembers(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.Compression = "gzip"
+	lf.GzipMembers = true
+
+	l := lf.NewLogger("a").(*s3logger)
+	l.Log([]byte("one\n"))
+	l.Log([]byte("two\n"))
+	l.Close()
+	first := append([]byte(nil), m.objects["/bucket/a"]...)
+	assert.Equal("one\ntwo\n", gunzip(t, first))
+
+	l = lf.NewLogger("a").(*s3logger)
+	l.Log([]byte("three\n"))
+	assert.NoError(l.Close())
+
+	// the first member is left as is
+	assert.Equal(first, m.objects["/bucket/a"][:len(first)])
+	assert.Equal("one\ntwo\nthree\n", gunzip(t, m.objects["/bucket/a"]))
+	assert.Equal(0, l.buffer.Len())
+}
+
+func TestS3LoggerAppendsGzipMembersWrittenMeanwhile(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": compress.Compress("gzip", []byte("one\n"))}}
+	lf := makeTestS3Factory(t, m)
+	lf.Compression = "gzip"
+	lf.GzipMembers = true
+
+	l := lf.NewLogger("a").(*s3logger)
+	// another process appends to the object between the GET and the PUT of the first attempt
+	var appended bool
+	l.S3.Handlers.Send.PushFront(func(r *request.Request) {
+		if r.Operation.Name != "PutObject" || appended {
+			return
+		}
+		appended = true
+		m.Lock()
+		m.objects["/bucket/a"] = append(m.objects["/bucket/a"], compress.Compress("gzip", []byte("two\n"))...)
+		m.Unlock()
+	})
+	l.Log([]byte("three\n"))
+	assert.NoError(l.Close())
+
+	assert.True(appended)
+	assert.Equal("one\ntwo\nthree\n", gunzip(t, m.objects["/bucket/a"]))
+}
+
+func TestS3LoggerAppendsGzipMembersServerSide(t *testing.T) {
+	assert := assert.New(t)
+
+	minCopyPartSize = 1
+	defer func() { minCopyPartSize = 5 << 20 }()
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": compress.Compress("gzip", []byte("old\n"))}}
+	lf := makeTestS3Factory(t, m)
+	lf.Compression = "gzip"
+	lf.GzipMembers = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal(0, m.gets)
+	assert.Equal("old\nnew\n", gunzip(t, m.objects["/bucket/a"]))
+	assert.Empty(m.parts)
+}
+
+func TestGzipMembersRequiresGzip(t *testing.T) {
+	lf := S3LoggerFactory{GzipMembers: true}
+	assert.Panics(t, func() { lf.NewLogger("a") })
+}
@@ -0,0 +1,78 @@
+package s3
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// NewB2LoggerFactory returns an S3LoggerFactory writing to a Backblaze B2 bucket through its
+// S3-compatible API. Region is the region of the bucket, e.g. "us-west-004", and the key is an
+// application key of the account.
+func NewB2LoggerFactory(bucket, region, keyID, applicationKey string) S3LoggerFactory {
+	return S3LoggerFactory{
+		Bucket:      bucket,
+		Region:      region,
+		Endpoint:    fmt.Sprintf("https://s3.%s.backblazeb2.com", region),
+		Credentials: credentials.NewStaticCredentials(keyID, applicationKey, ""),
+	}
+}
+
+// NewWasabiLoggerFactory returns an S3LoggerFactory writing to a Wasabi bucket. Region is the
+// region of the bucket, e.g. "eu-central-1".
+func NewWasabiLoggerFactory(bucket, region, accessKey, secretKey string) S3LoggerFactory {
+	return S3LoggerFactory{
+		Bucket:      bucket,
+		Region:      region,
+		Endpoint:    fmt.Sprintf("https://s3.%s.wasabisys.com", region),
+		Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
+	}
+}
+
+// NewSpacesLoggerFactory returns an S3LoggerFactory writing to a DigitalOcean Spaces bucket.
+// Region is the datacenter of the bucket, e.g. "nyc3". Spaces expects requests to be signed
+// for us-east-1 whatever the datacenter, so it is only used for the endpoint.
+func NewSpacesLoggerFactory(bucket, region, accessKey, secretKey string) S3LoggerFactory {
+	return S3LoggerFactory{
+		Bucket:      bucket,
+		Region:      "us-east-1",
+		Endpoint:    fmt.Sprintf("https://%s.digitaloceanspaces.com", region),
+		Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
+	}
+}
+
+// NewS3CompatibleLoggerFactory returns an S3LoggerFactory writing to any other S3-compatible
+// service, e.g. MinIO or Ceph, reached at endpoint. Buckets are addressed in the path of the
+// requests since these services are often not set up for virtual-hosted buckets.
+func NewS3CompatibleLoggerFactory(bucket, endpoint, region, accessKey, secretKey string) S3LoggerFactory {
+	return S3LoggerFactory{
+		Bucket:           bucket,
+		Region:           region,
+		Endpoint:         endpoint,
+		S3ForcePathStyle: true,
+		Credentials:      credentials.NewStaticCredentials(accessKey, secretKey, ""),
+	}
+}
+
+// FirehosePreset returns a router configuration behaving like an AWS Firehose delivery stream
+// with default settings: events are archived under prefix in gzipped objects rotated hourly,
+// flushed every 5 minutes or 5 MiB. The region is that of the environment, e.g. AWS_REGION.
+// All events go to one partition, set a PartitionKeyFunc to split them.
+func FirehosePreset(bucket, prefix string) *laozi.Config {
+	return &laozi.Config{
+		LoggerFactory: S3LoggerFactory{
+			Bucket:           bucket,
+			Prefix:           prefix,
+			FlushInterval:    5 * time.Minute,
+			FlushEveryNBytes: 5 << 20,
+			Compression:      "gzip",
+			RotationInterval: time.Hour,
+			KeyIDGenerator:   laozi.IDGeneratorFunc(laozi.NewULID),
+		},
+		LoggerTimeout:    10 * time.Minute,
+		EventChannelSize: 10000,
+		PartitionKeyFunc: func([]byte) (string, error) { return "events", nil },
+	}
+}
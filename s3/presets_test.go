@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresetsConfigureEndpoints(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewB2LoggerFactory("logs", "us-west-004", "id", "key").s3Config()
+	assert.Equal("https://s3.us-west-004.backblazeb2.com", aws.StringValue(c.Endpoint))
+	assert.Equal("us-west-004", aws.StringValue(c.Region))
+
+	c = NewWasabiLoggerFactory("logs", "eu-central-1", "id", "key").s3Config()
+	assert.Equal("https://s3.eu-central-1.wasabisys.com", aws.StringValue(c.Endpoint))
+
+	c = NewSpacesLoggerFactory("logs", "nyc3", "id", "key").s3Config()
+	assert.Equal("https://nyc3.digitaloceanspaces.com", aws.StringValue(c.Endpoint))
+	assert.Equal("us-east-1", aws.StringValue(c.Region))
+
+	c = NewS3CompatibleLoggerFactory("logs", "http://localhost:9000", "us-east-1", "id", "key").s3Config()
+	assert.Equal("http://localhost:9000", aws.StringValue(c.Endpoint))
+	assert.True(aws.BoolValue(c.S3ForcePathStyle))
+
+	v, err := c.Credentials.Get()
+	assert.NoError(err)
+	assert.Equal("id", v.AccessKeyID)
+}
+
+func TestS3ConfigDefaultsToAWS(t *testing.T) {
+	assert := assert.New(t)
+
+	c := S3LoggerFactory{Region: "us-east-1"}.s3Config()
+	assert.Nil(c.Endpoint)
+	assert.Nil(c.S3ForcePathStyle)
+	assert.Nil(c.Credentials)
+}
+
+func TestFirehosePreset(t *testing.T) {
+	assert := assert.New(t)
+
+	c := FirehosePreset("bucket", "logs/")
+	lf := c.LoggerFactory.(S3LoggerFactory)
+	assert.Equal("logs/", lf.Prefix)
+	assert.Equal("gzip", lf.Compression)
+	assert.Equal(time.Hour, lf.RotationInterval)
+	assert.Equal(5*time.Minute, lf.FlushInterval)
+	assert.NotPanics(func() { laozi.NewLaozi(c).Close() })
+}
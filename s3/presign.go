@@ -0,0 +1,34 @@
+package s3
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxPresignTTL is the longest S3 accepts pre-signed URLs for.
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// presign returns a pre-signed GET URL of the version of the object last uploaded to key, if the
+// logger makes them.
+func (l *s3logger) presign(key string) string {
+	if l.presignTTL <= 0 || key == "" {
+		return ""
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(key),
+	}
+	if l.uploadedVersion != "" {
+		input.VersionId = aws.String(l.uploadedVersion)
+	}
+	req, _ := l.S3.GetObjectRequest(input)
+	url, err := req.Presign(l.presignTTL)
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not presign object: %s: %s\n", key, err)
+		return ""
+	}
+	return url
+}
@@ -0,0 +1,50 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerReportsPresignedURLs(t *testing.T) {
+	assert := assert.New(t)
+
+	reports := make(chan laozi.DeliveryReport, 2)
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+	lf.PresignTTL = time.Hour
+
+	l := lf.newS3Logger("a")
+	l.ReportTo(reports)
+	l.add([]byte("new\n"))
+	assert.Error(l.flush())
+	assert.Empty((<-reports).URL)
+
+	m.failPuts = false
+	assert.NoError(l.flush())
+	r := <-reports
+	u, err := url.Parse(r.URL)
+	if assert.NoError(err) {
+		assert.Equal("/bucket/a", u.Path)
+		assert.Equal("3600", u.Query().Get("X-Amz-Expires"))
+	}
+
+	// consumers fetch the object without credentials
+	resp, err := http.Get(r.URL)
+	if assert.NoError(err) {
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal([]byte("new\n"), data)
+	}
+
+	assert.Panics(func() {
+		lf.PresignTTL = 8 * 24 * time.Hour
+		lf.NewLogger("a")
+	})
+}
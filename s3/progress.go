@@ -0,0 +1,99 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// progressStep is how many bytes are uploaded between two calls of the UploadProgress callback.
+const progressStep = 1 << 20
+
+// uploadProgress reports the progress of an upload to the UploadProgress callback of the
+// factory: the bytes of its requests that completed, plus those sent by the current one.
+type uploadProgress struct {
+	sync.Mutex
+	key      string
+	total    int64
+	done     int64
+	reported int64
+	f        func(key string, uploaded, total int64)
+}
+
+// newProgress returns the progress of an upload of total bytes, -1 if unknown, or nil without
+// UploadProgress callback.
+func (l *s3logger) newProgress(key string, total int64) *uploadProgress {
+	if l.uploadProgress == nil {
+		return nil
+	}
+	return &uploadProgress{key: key, total: total, reported: -1, f: l.uploadProgress}
+}
+
+// option returns the request option tracking the bytes sent by the requests uploading data.
+func (p *uploadProgress) option() request.Option {
+	return func(r *request.Request) {
+		if p == nil || (r.Operation.Name != "PutObject" && r.Operation.Name != "UploadPart") {
+			return
+		}
+		var sent int64
+		r.Handlers.Send.PushFront(func(r *request.Request) {
+			// the body is sent again by retries
+			atomic.StoreInt64(&sent, 0)
+			if r.HTTPRequest.Body == nil || r.HTTPRequest.Body == http.NoBody {
+				return
+			}
+			r.HTTPRequest.Body = &progressReader{ReadCloser: r.HTTPRequest.Body, read: func(n int) {
+				p.report(atomic.AddInt64(&sent, int64(n)))
+			}}
+		})
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.Error == nil {
+				p.Lock()
+				p.done += atomic.LoadInt64(&sent)
+				p.Unlock()
+			}
+		})
+	}
+}
+
+// report calls the callback once at least a progressStep was uploaded since the last call, or
+// the upload is complete.
+func (p *uploadProgress) report(sent int64) {
+	p.Lock()
+	uploaded := p.done + sent
+	if uploaded-p.reported < progressStep && uploaded != p.total {
+		p.Unlock()
+		return
+	}
+	p.reported = uploaded
+	p.Unlock()
+	p.f(p.key, uploaded, p.total)
+}
+
+// finish reports the end of an upload of unknown size.
+func (p *uploadProgress) finish(size int64) {
+	if p == nil || p.total >= 0 {
+		return
+	}
+	p.Lock()
+	p.total = size
+	p.Unlock()
+	p.f(p.key, size, size)
+}
+
+// progressReader calls read with the size of every read.
+type progressReader struct {
+	io.ReadCloser
+	read func(n int)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.read(n)
+	}
+	return n, err
+}
@@ -0,0 +1,55 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerReportsUploadProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	var uploaded, totals []int64
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+	lf.UploadProgress = func(key string, n, total int64) {
+		lock.Lock()
+		defer lock.Unlock()
+		assert.Equal("a", key)
+		uploaded = append(uploaded, n)
+		totals = append(totals, total)
+	}
+
+	data := bytes.Repeat([]byte("event\n"), 1<<19)
+	l := lf.newS3Logger("a")
+	l.add(data)
+	assert.NoError(l.flush())
+	lock.Lock()
+	if assert.True(len(uploaded) > 1) {
+		assert.Equal(int64(len(data)), uploaded[len(uploaded)-1])
+		assert.Equal(int64(len(data)), totals[0])
+	}
+	uploaded, totals = nil, nil
+	lock.Unlock()
+
+	// the size of streamed uploads is unknown until they complete
+	lf.StreamUploads = true
+	lf.Compression = "gzip"
+	large := make([]byte, 6<<20)
+	rand.Read(large)
+	l = lf.newS3Logger("a")
+	l.add(large)
+	assert.NoError(l.flush())
+	lock.Lock()
+	defer lock.Unlock()
+	if assert.True(len(uploaded) > 1) {
+		assert.Equal(int64(-1), totals[0])
+		assert.Equal(int64(len(m.objects["/bucket/a"])), uploaded[len(uploaded)-1])
+		assert.Equal(uploaded[len(uploaded)-1], totals[len(totals)-1])
+	}
+}
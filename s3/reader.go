@@ -0,0 +1,242 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/parquet-go/parquet-go"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// parquetMagic starts parquet files, e.g. the data files of a DeltaLoggerFactory table.
+var parquetMagic = []byte("PAR1")
+
+const defaultReadPartSize = 8 << 20
+
+// ArchiveReader reads the events of archived objects whatever the loggers wrote them as, so
+// consumers don't detect formats themselves: encrypted objects are decrypted by their key id
+// metadata, gzip objects decompressed, GzipMembers included, zstd ones with their dictionary
+// if any, and parquet data files of DeltaLoggerFactory tables decoded. With SequenceStamp,
+// records are split from their sequence number, and with Envelope, records are opened to their
+// payload, as archived with the options of the same name.
+type ArchiveReader struct {
+	S3     *s3.S3
+	Bucket string
+	// KeyRing decrypts the objects written with client-side encryption, if any.
+	KeyRing       *KeyRing
+	SequenceStamp bool
+	Envelope      bool
+	// Concurrency, if more than 1, fetches objects larger than ReadPartSize with that many
+	// ranged GETs in parallel, merged back in order, and makes EventsUnder read that many
+	// objects ahead, so replays saturate the bandwidth rather than stream one connection.
+	// ReadPartSize defaults to 8 MiB.
+	Concurrency  int
+	ReadPartSize int64
+}
+
+// Events returns an iterator of the events of an archived object, whose next function returns
+// the events without their trailing newline, in order, then false.
+func (a *ArchiveReader) Events(key string) (next func() ([]byte, bool), err error) {
+	events, err := a.objectEvents(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]byte, bool) {
+		if len(events) == 0 {
+			return nil, false
+		}
+		e := events[0]
+		events = events[1:]
+		return e, true
+	}, nil
+}
+
+// EventsUnder returns an iterator of the events of the objects under a prefix, in key order,
+// e.g. of the rotated objects of a partition for a day, with a prefix like logs/a/20260102.
+// Objects are read ahead of next, Concurrency at once. next returns false once all events were
+// returned or an object failed to be read, err then returns the error if any.
+func (a *ArchiveReader) EventsUnder(prefix string) (next func() ([]byte, bool), err func() error) {
+	var keys []string
+	failed := a.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(a.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			if key := aws.StringValue(o.Key); path.Base(key) != shardManifestName {
+				keys = append(keys, key)
+			}
+		}
+		return true
+	})
+
+	type result struct {
+		events [][]byte
+		err    error
+	}
+	var pending []chan result
+	var events [][]byte
+	next = func() ([]byte, bool) {
+		for len(events) == 0 {
+			// keeps Concurrency objects being read, without reading all of them in memory
+			for failed == nil && len(keys) > 0 && len(pending) < a.concurrency() {
+				c := make(chan result, 1)
+				go func(key string) {
+					objectEvents, objectErr := a.objectEvents(key)
+					c <- result{objectEvents, objectErr}
+				}(keys[0])
+				keys = keys[1:]
+				pending = append(pending, c)
+			}
+			if failed != nil || len(pending) == 0 {
+				return nil, false
+			}
+			r := <-pending[0]
+			pending = pending[1:]
+			events, failed = r.events, r.err
+		}
+		e := events[0]
+		events = events[1:]
+		return e, true
+	}
+	return next, func() error { return failed }
+}
+
+func (a *ArchiveReader) concurrency() int {
+	if a.Concurrency < 1 {
+		return 1
+	}
+	return a.Concurrency
+}
+
+// objectEvents returns the events of an archived object.
+func (a *ArchiveReader) objectEvents(key string) ([][]byte, error) {
+	data, err := a.read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var events [][]byte
+	if bytes.HasPrefix(data, parquetMagic) {
+		events, err = parquetEvents(data)
+	} else {
+		events, err = a.records(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %s: %s", key, err)
+	}
+	return events, nil
+}
+
+// read returns the data of an archived object, decrypted and decompressed, fetched with
+// ranged GETs in parallel if it is large enough. Ranges are fetched if they match the ETag of
+// the object, so an object overwritten meanwhile fails to be read instead of being mixed up.
+func (a *ArchiveReader) read(key string) ([]byte, error) {
+	if a.Concurrency <= 1 {
+		return readArchive(a.S3, a.Bucket, key, a.KeyRing)
+	}
+	partSize := a.ReadPartSize
+	if partSize <= 0 {
+		partSize = defaultReadPartSize
+	}
+	head, err := a.S3.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(a.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	size := aws.Int64Value(head.ContentLength)
+	if size <= partSize {
+		return readArchive(a.S3, a.Bucket, key, a.KeyRing)
+	}
+
+	data := make([]byte, size)
+	sem := make(chan struct{}, a.Concurrency)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for start := int64(0); start < size; start += partSize {
+		end := start + partSize
+		if end > size {
+			end = size
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(start, end int64) {
+			defer func() { <-sem; wg.Done() }()
+			if err := a.readRange(key, head.ETag, data[start:end], start); err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+	return decodeArchive(a.S3, a.Bucket, data, head.Metadata, a.KeyRing)
+}
+
+// readRange reads the part of an object starting at start into part.
+func (a *ArchiveReader) readRange(key string, etag *string, part []byte, start int64) error {
+	resp, err := a.S3.GetObject(&s3.GetObjectInput{
+		Bucket:  aws.String(a.Bucket),
+		Key:     aws.String(key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, start+int64(len(part))-1)),
+		IfMatch: etag,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadFull(resp.Body, part)
+	return err
+}
+
+// records returns the events of the records of an object.
+func (a *ArchiveReader) records(data []byte) ([][]byte, error) {
+	var events [][]byte
+	for _, record := range splitRecords(data) {
+		e := bytes.TrimRight(record, "\r\n")
+		if a.SequenceStamp {
+			if _, event, ok := ParseSequenceStamp(e); ok {
+				e = event
+			}
+		}
+		if a.Envelope {
+			env, err := laozi.OpenEnvelope(e)
+			if err != nil {
+				return nil, err
+			}
+			e = env.Payload()
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// parquetEvents returns the events of a parquet data file of a Delta table.
+func parquetEvents(data []byte) ([][]byte, error) {
+	r := parquet.NewReader(bytes.NewReader(data), parquet.SchemaOf(deltaRow{}))
+	defer r.Close()
+
+	var events [][]byte
+	for {
+		var row deltaRow
+		if err := r.Read(&row); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+		events = append(events, []byte(row.Event))
+	}
+}
@@ -0,0 +1,141 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/parquet-go/parquet-go"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+// envelope returns the record of an envelope, as written with Config.Envelope.
+func envelope(env laozi.EventEnvelope) []byte {
+	record, _ := json.Marshal(env)
+	return append(record, '\n')
+}
+
+// readEvents returns all the events of an iterator.
+func readEvents(next func() ([]byte, bool)) []string {
+	var events []string
+	for e, ok := next(); ok; e, ok = next() {
+		events = append(events, string(e))
+	}
+	return events
+}
+
+func TestArchiveReaderDecodesFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	var pq bytes.Buffer
+	pw := parquet.NewWriter(&pq, parquet.SchemaOf(deltaRow{}))
+	pw.Write(&deltaRow{Partition: "a", Sequence: 1, Event: "a"})
+	pw.Write(&deltaRow{Partition: "a", Sequence: 2, Event: "b"})
+	pw.Close()
+
+	m := &mockS3{objects: map[string][]byte{
+		"/bucket/plain":   []byte("a\nb\n"),
+		"/bucket/gzip":    compress.Compress("gzip", []byte("a\nb")),
+		"/bucket/members": append(compress.Compress("gzip", []byte("a\n")), compress.Compress("gzip", []byte("b\n"))...),
+		"/bucket/parquet": pq.Bytes(),
+	}}
+	lf := makeTestS3Factory(t, m)
+	r := &ArchiveReader{S3: s3.New(session.New(), lf.s3Config()), Bucket: "bucket"}
+
+	for _, key := range []string{"plain", "gzip", "members", "parquet"} {
+		next, err := r.Events(key)
+		if assert.NoError(err, key) {
+			assert.Equal([]string{"a", "b"}, readEvents(next), key)
+		}
+	}
+
+	_, err := r.Events("missing")
+	assert.Error(err)
+}
+
+func TestArchiveReaderOpensStampedEnvelopes(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{
+		"/bucket/a": append(append([]byte("1\t"), envelope(laozi.EventEnvelope{Key: "a", Event: []byte(`{"id":1}`)})...),
+			append([]byte("2\t"), envelope(laozi.EventEnvelope{Key: "a", Data: []byte("text")})...)...),
+	}}
+	lf := makeTestS3Factory(t, m)
+	r := &ArchiveReader{
+		S3:            s3.New(session.New(), lf.s3Config()),
+		Bucket:        "bucket",
+		SequenceStamp: true,
+		Envelope:      true,
+	}
+
+	next, err := r.Events("a")
+	if assert.NoError(err) {
+		assert.Equal([]string{`{"id":1}`, "text"}, readEvents(next))
+	}
+
+	r.SequenceStamp = false
+	_, err = r.Events("a")
+	assert.Error(err)
+}
+
+func TestArchiveReaderReadsRanges(t *testing.T) {
+	assert := assert.New(t)
+
+	var events []string
+	var plain bytes.Buffer
+	for i := 0; i < 100; i++ {
+		events = append(events, fmt.Sprintf("event %d", i))
+		fmt.Fprintf(&plain, "event %d\n", i)
+	}
+	m := &mockS3{objects: map[string][]byte{
+		"/bucket/plain": plain.Bytes(),
+		"/bucket/gzip":  compress.Compress("gzip", plain.Bytes()),
+	}}
+	lf := makeTestS3Factory(t, m)
+	r := &ArchiveReader{
+		S3:           s3.New(session.New(), lf.s3Config()),
+		Bucket:       "bucket",
+		Concurrency:  4,
+		ReadPartSize: 64,
+	}
+
+	for _, key := range []string{"plain", "gzip"} {
+		next, err := r.Events(key)
+		if assert.NoError(err, key) {
+			assert.Equal(events, readEvents(next), key)
+		}
+	}
+	assert.True(m.ranges > len(plain.Bytes())/64)
+
+	_, err := r.Events("missing")
+	assert.Error(err)
+}
+
+func TestArchiveReaderReadsEventsUnder(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{
+		"/bucket/a/20260102T000000Z/" + rotating.SequenceRange(1, 2): []byte("1\n2\n"),
+		"/bucket/a/20260102T010000Z/" + rotating.SequenceRange(3, 3): []byte("3\n"),
+		"/bucket/a/20260102T020000Z/" + rotating.SequenceRange(4, 5): []byte("4\n5\n"),
+		"/bucket/a/20260103T000000Z/" + rotating.SequenceRange(6, 6): []byte("6\n"),
+		"/bucket/b/20260102T000000Z/" + rotating.SequenceRange(1, 1): []byte("x\n"),
+	}}
+	lf := makeTestS3Factory(t, m)
+	r := &ArchiveReader{S3: s3.New(session.New(), lf.s3Config()), Bucket: "bucket", Concurrency: 2}
+
+	next, err := r.EventsUnder("a/20260102")
+	assert.Equal([]string{"1", "2", "3", "4", "5"}, readEvents(next))
+	assert.NoError(err())
+
+	r.Envelope = true
+	next, err = r.EventsUnder("a/")
+	assert.Empty(readEvents(next))
+	assert.Error(err())
+}
@@ -0,0 +1,140 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	laoziredis "github.com/seedboxtech/laozi/redis"
+)
+
+const defaultRedisBatchSize = 10000
+
+// removeIdlePartition forgets a partition only if its list is still empty, so an event pushed
+// by a producer in the meantime is never stranded.
+var removeIdlePartition = redis.NewScript(`
+if redis.call("LLEN", KEYS[1]) == 0 then
+	return redis.call("SREM", KEYS[2], ARGV[1])
+end
+return 0
+`)
+
+// RedisFlusher drains the partitions buffered in Redis by redis.RedisLoggerFactory loggers to S3,
+// using the LoggerFactory settings for each partition. Only one flusher must run per namespace.
+type RedisFlusher struct {
+	Redis         redis.UniversalClient
+	Namespace     string
+	LoggerFactory S3LoggerFactory
+	FlushInterval time.Duration
+	// BatchSize is the max number of events taken from a list per upload, defaults to 10000.
+	BatchSize int64
+
+	loggers  map[string]*s3logger
+	quitChan chan struct{}
+	doneChan chan struct{}
+}
+
+// Start drains Redis to S3 every FlushInterval until Close is called.
+func (f *RedisFlusher) Start() {
+	if f.FlushInterval == time.Duration(0) {
+		panic("FlushInterval must not be zero")
+	}
+
+	f.loggers = map[string]*s3logger{}
+	f.quitChan = make(chan struct{})
+	f.doneChan = make(chan struct{})
+
+	go f.loop()
+}
+
+func (f *RedisFlusher) loop() {
+	defer close(f.doneChan)
+	for {
+		select {
+		case <-time.After(f.FlushInterval):
+			f.drain()
+		case <-f.quitChan:
+			return
+		}
+	}
+}
+
+// Close stops the flusher after draining Redis one last time.
+func (f *RedisFlusher) Close() error {
+	close(f.quitChan)
+	<-f.doneChan
+	return f.drain()
+}
+
+// drain flushes every partition buffered in Redis, returning the last error encountered.
+func (f *RedisFlusher) drain() error {
+	ctx := context.Background()
+	partitions, err := f.Redis.SMembers(ctx, laoziredis.PartitionsKey(f.Namespace)).Result()
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not list partitions from redis: %s\n", err)
+		return err
+	}
+
+	for _, p := range partitions {
+		if perr := f.drainPartition(ctx, p); perr != nil {
+			fmt.Printf(" [laozi] Error! Could not flush partition from redis: %s\n", p)
+			err = perr
+		}
+	}
+	return err
+}
+
+// drainPartition uploads the events of a partition list in batches. Events are only removed
+// from the list once they are safely on S3.
+func (f *RedisFlusher) drainPartition(ctx context.Context, partition string) error {
+	batchSize := f.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRedisBatchSize
+	}
+	list := laoziredis.ListKey(f.Namespace, partition)
+
+	for {
+		events, err := f.Redis.LRange(ctx, list, 0, batchSize-1).Result()
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			delete(f.loggers, partition)
+			return removeIdlePartition.Run(ctx, f.Redis, []string{list, laoziredis.PartitionsKey(f.Namespace)}, partition).Err()
+		}
+
+		l, found := f.loggers[partition]
+		if !found {
+			if l, err = f.LoggerFactory.newS3LoggerContext(ctx, partition); err != nil {
+				return err
+			}
+			l.waitPrevious()
+			f.loggers[partition] = l
+		}
+
+		size, sequence := l.buffer.Len(), l.sequence
+		for _, e := range events {
+			l.buffer.Write([]byte(e))
+			l.buffered()
+		}
+
+		key, err := l.upload(ctx)
+		if err != nil {
+			// roll back so the events are uploaded again on the next drain
+			l.buffer.Truncate(size)
+			l.sequence = sequence
+			return err
+		}
+		if err = f.Redis.LTrim(ctx, list, int64(len(events)), -1).Err(); err != nil {
+			return err
+		}
+		if err = l.flushed(key); err != nil {
+			return err
+		}
+
+		if int64(len(events)) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	laoziredis "github.com/seedboxtech/laozi/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRedisNamespace = "laozi-test"
+
+func TestRedisFlusherForgetsIdlePartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	r := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer r.Del(context.Background(), laoziredis.PartitionsKey(testRedisNamespace))
+
+	ctx := context.Background()
+	r.SAdd(ctx, laoziredis.PartitionsKey(testRedisNamespace), "a")
+
+	f := &RedisFlusher{Redis: r, Namespace: testRedisNamespace, loggers: map[string]*s3logger{}}
+	assert.NoError(f.drain())
+
+	n, err := r.SCard(ctx, laoziredis.PartitionsKey(testRedisNamespace)).Result()
+	assert.NoError(err)
+	assert.Equal(int64(0), n)
+}
@@ -0,0 +1,28 @@
+package s3
+
+import (
+	"testing"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerReportsFlushes(t *testing.T) {
+	assert := assert.New(t)
+
+	reports := make(chan laozi.DeliveryReport, 1)
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}}
+	lf := makeTestS3Factory(t, m)
+
+	l := lf.NewLogger("a").(laozi.ReportingLogger)
+	l.ReportTo(reports)
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	r := <-reports
+	assert.Equal("a", r.Partition)
+	assert.Equal("a", r.Key)
+	assert.Equal(1, r.Records)
+	assert.Equal(len("old\nnew\n"), r.Bytes)
+	assert.NoError(r.Err)
+}
@@ -0,0 +1,254 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const defaultRetryInterval = time.Minute
+
+// RetryQueue keeps on local disk the uploads of loggers that could not flush when closed, e.g.
+// while S3 is down, and retries them in the background every Interval (defaults to a minute),
+// see S3LoggerFactory.RetryQueue. Uploads left by a previous process are retried once the
+// factory makes its first logger. A retry doesn't overwrite an object another logger wrote to
+// meanwhile: the upload is moved aside to a .conflict file instead.
+type RetryQueue struct {
+	Dir      string
+	Interval time.Duration
+
+	once      sync.Once
+	closeOnce sync.Once
+	stop      chan struct{}
+	s3        *s3.S3
+	stats     *S3Stats
+}
+
+// retryUpload is a queued upload, with the conditions and Object Lock settings of the original.
+type retryUpload struct {
+	Bucket      string            `json:"bucket"`
+	Key         string            `json:"key"`
+	Body        []byte            `json:"body"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	IfMatch     string            `json:"ifMatch,omitempty"`
+	IfNoneMatch string            `json:"ifNoneMatch,omitempty"`
+	LockMode    string            `json:"lockMode,omitempty"`
+	RetainUntil time.Time         `json:"retainUntil,omitempty"`
+	LegalHold   bool              `json:"legalHold,omitempty"`
+	KMSKeyID    string            `json:"kmsKeyId,omitempty"`
+	KMSContext  string            `json:"kmsContext,omitempty"`
+	// Rotated objects failing the condition were uploaded by a previous attempt, if they hold
+	// the same events
+	Rotated bool `json:"rotated,omitempty"`
+}
+
+// start starts retrying the queued uploads with the client of the first logger of the factory.
+func (q *RetryQueue) start(svc *s3.S3, stats *S3Stats) {
+	q.once.Do(func() {
+		q.s3 = svc
+		q.stats = stats
+		q.stop = make(chan struct{})
+		names, _ := q.queued()
+		stats.pendingRetries(int64(len(names)))
+		go q.run()
+	})
+}
+
+// Close stops retrying uploads, leaving them queued. It can be called more than once.
+func (q *RetryQueue) Close() {
+	if q.stop != nil {
+		q.closeOnce.Do(func() { close(q.stop) })
+	}
+}
+
+func (q *RetryQueue) run() {
+	interval := q.Interval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-t.C:
+			q.Retry()
+		}
+	}
+}
+
+// Retry uploads the queued uploads, returning how many are still pending.
+func (q *RetryQueue) Retry() int {
+	names, err := q.queued()
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not list retried uploads: %s\n", err)
+		return 0
+	}
+
+	pending := 0
+	for _, name := range names {
+		if err := q.retry(name); err != nil {
+			fmt.Printf(" [laozi] Error! Could not retry upload, will retry: %s: %s\n", name, err)
+			pending++
+		}
+	}
+	return pending
+}
+
+func (q *RetryQueue) retry(name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var u retryUpload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(u.Bucket),
+		Key:      aws.String(u.Key),
+		Body:     bytes.NewReader(u.Body),
+		Metadata: aws.StringMap(u.Metadata),
+	}
+	if u.LockMode != "" {
+		input.ObjectLockMode = aws.String(u.LockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(u.RetainUntil)
+	}
+	if u.LegalHold {
+		input.ObjectLockLegalHoldStatus = aws.String(s3.ObjectLockLegalHoldStatusOn)
+	}
+	if u.LockMode != "" || u.LegalHold {
+		sum := md5.Sum(u.Body)
+		input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	conditions := map[string]string{}
+	if u.IfMatch != "" {
+		conditions["If-Match"] = u.IfMatch
+	}
+	if u.IfNoneMatch != "" {
+		conditions["If-None-Match"] = u.IfNoneMatch
+	}
+	kms := sseKMS{keyID: u.KMSKeyID, context: u.KMSContext}
+	_, err = q.s3.PutObjectWithContext(aws.BackgroundContext(), input, request.WithSetRequestHeaders(conditions), kms.option())
+
+	switch {
+	case isAlreadyUploaded(err) && u.Rotated:
+		// a previous attempt uploaded it, unless the object holds other events
+		err = checkUploaded(aws.BackgroundContext(), q.s3, u.Bucket, u.Key, u.Metadata[contentDigestMetadata])
+		var conflict *laozi.ErrConcurrentWrite
+		if errors.As(err, &conflict) {
+			fmt.Printf(" [laozi] Error! Object holds other events, keeping the retried upload aside: %s\n", u.Key)
+			err = os.Rename(name, name+".conflict")
+		} else if err == nil {
+			err = os.Remove(name)
+		}
+	case isAlreadyUploaded(err):
+		fmt.Printf(" [laozi] Error! Object was written meanwhile, keeping the retried upload aside: %s\n", u.Key)
+		err = os.Rename(name, name+".conflict")
+	case err == nil:
+		err = os.Remove(name)
+	}
+	if err != nil {
+		return err
+	}
+	q.stats.pendingRetries(-1)
+	return nil
+}
+
+// queued returns the files of the queued uploads, the oldest first.
+func (q *RetryQueue) queued() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(q.Dir, "*.retry"))
+	sort.Strings(names)
+	return names, err
+}
+
+// enqueue writes an upload to the queue.
+func (q *RetryQueue) enqueue(u retryUpload) error {
+	if err := os.MkdirAll(q.Dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(q.Dir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := ioutil.WriteFile(name+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name+".retry"); err != nil {
+		return err
+	}
+	q.stats.pendingRetries(1)
+	return nil
+}
+
+// queueFailed queues the upload of a logger whose last flush failed with err, returning nil
+// once queued. Uploads refused by a condition, or that succeeded but failed to checkpoint,
+// aren't queued.
+func (l *s3logger) queueFailed(err error) error {
+	if err == nil || l.retryQueue == nil || l.gzipMembers || l.conflict != nil ||
+		len(l.sealed) > 0 || l.buffer.Len() <= l.persisted {
+		return err
+	}
+
+	u := retryUpload{
+		Bucket:     l.bucket,
+		Key:        l.key,
+		Body:       l.compressBuffer(),
+		Metadata:   map[string]string{},
+		LockMode:   l.lockMode,
+		LegalHold:  l.legalHold,
+		KMSKeyID:   l.kms.keyID,
+		KMSContext: l.kms.context,
+	}
+	if n := atomic.LoadInt64(&l.sampledOut); n > 0 {
+		u.Metadata[sampledOutMetadata] = strconv.FormatInt(n, 10)
+	}
+	if l.keyRing != nil {
+		id, encrypted, kerr := l.keyRing.Encrypt(u.Body)
+		if kerr != nil {
+			return err
+		}
+		u.Body = encrypted
+		u.Metadata[keyIDMetadata] = id
+	}
+	if l.lockMode != "" {
+		u.RetainUntil = time.Now().Add(l.lockRetention)
+	}
+	switch {
+	case l.rotation > 0:
+		u.Key = l.rotatedKey()
+		u.IfNoneMatch = "*"
+		u.Rotated = true
+		u.Metadata[contentDigestMetadata] = contentDigest(l.buffer.Bytes())
+	case l.detectWriters && l.etagKnown && l.etag != "":
+		u.IfMatch = l.etag
+	case l.detectWriters && l.etagKnown:
+		u.IfNoneMatch = "*"
+	}
+
+	if qerr := l.retryQueue.enqueue(u); qerr != nil {
+		fmt.Printf(" [laozi] Error! Could not queue upload for retry: %s: %s\n", u.Key, qerr)
+		return err
+	}
+	fmt.Printf(" [laozi] Could not flush logger, queued for retry: %s: %s\n", u.Key, err)
+	return nil
+}
@@ -0,0 +1,148 @@
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryQueueRetriesFailedFlushes(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+	lf.Stats = &S3Stats{}
+	lf.RetryQueue = &RetryQueue{Dir: t.TempDir()}
+	defer lf.RetryQueue.Close()
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("event\n"))
+	assert.NoError(l.Close())
+	assert.Equal(int64(1), lf.Stats.Snapshot().PendingRetries)
+
+	assert.Equal(1, lf.RetryQueue.Retry())
+	assert.Nil(m.objects["/bucket/a"])
+
+	m.Lock()
+	m.failPuts = false
+	m.Unlock()
+	assert.Equal(0, lf.RetryQueue.Retry())
+	assert.Equal([]byte("event\n"), m.objects["/bucket/a"])
+	assert.Equal(int64(0), lf.Stats.Snapshot().PendingRetries)
+
+	names, _ := filepath.Glob(filepath.Join(lf.RetryQueue.Dir, "*"))
+	assert.Empty(names)
+}
+
+func TestRetryQueueResumesQueuedUploads(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+	lf.RetryQueue = &RetryQueue{Dir: dir}
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("event\n"))
+	assert.NoError(l.Close())
+	lf.RetryQueue.Close()
+
+	// as after a restart
+	m.failPuts = false
+	lf.Stats = &S3Stats{}
+	lf.RetryQueue = &RetryQueue{Dir: dir}
+	defer lf.RetryQueue.Close()
+	lf.NewLogger("b").Close()
+	assert.Equal(int64(1), lf.Stats.Snapshot().PendingRetries)
+
+	assert.Equal(0, lf.RetryQueue.Retry())
+	assert.Equal([]byte("event\n"), m.objects["/bucket/a"])
+}
+
+func TestRetryQueueKeepsConflictingUploadsAside(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.DetectConcurrentWriters = true
+	lf.RetryQueue = &RetryQueue{Dir: t.TempDir()}
+	defer lf.RetryQueue.Close()
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("event\n"))
+	assert.NoError(l.Close())
+
+	m.Lock()
+	m.failPuts = false
+	m.objects["/bucket/a"] = []byte("other\n")
+	m.Unlock()
+	assert.Equal(0, lf.RetryQueue.Retry())
+	assert.Equal([]byte("other\n"), m.objects["/bucket/a"])
+
+	names, _ := filepath.Glob(filepath.Join(lf.RetryQueue.Dir, "*.conflict"))
+	if assert.Len(names, 1) {
+		data, _ := ioutil.ReadFile(names[0])
+		assert.Contains(string(data), `"ifNoneMatch":"*"`)
+	}
+}
+
+func TestRetryQueueChecksRotatedObjectsFoundUploaded(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.RetryQueue = &RetryQueue{Dir: t.TempDir()}
+	defer lf.RetryQueue.Close()
+	key := "/bucket/" + rotating.Name("a", time.Now(), time.Hour, 1, 1)
+
+	for _, l := range []laozi.Logger{lf.NewLogger("a"), lf.NewLogger("a")} {
+		l.Log([]byte("event\n"))
+		assert.NoError(l.Close())
+	}
+	names, _ := filepath.Glob(filepath.Join(lf.RetryQueue.Dir, "*.retry"))
+	assert.Len(names, 2)
+
+	// the first retry uploads the events, the second finds them uploaded
+	m.Lock()
+	m.failPuts = false
+	m.Unlock()
+	assert.Equal(0, lf.RetryQueue.Retry())
+	assert.Equal([]byte("event\n"), m.objects[key])
+	names, _ = filepath.Glob(filepath.Join(lf.RetryQueue.Dir, "*"))
+	assert.Empty(names)
+
+	// other events were uploaded to the key meanwhile
+	m.Lock()
+	m.failPuts = true
+	m.Unlock()
+	l := lf.NewLogger("b")
+	l.Log([]byte("event\n"))
+	assert.NoError(l.Close())
+	key = "/bucket/" + rotating.Name("b", time.Now(), time.Hour, 1, 1)
+	m.Lock()
+	m.failPuts = false
+	m.objects[key] = []byte("other\n")
+	m.Unlock()
+	assert.Equal(0, lf.RetryQueue.Retry())
+	assert.Equal([]byte("other\n"), m.objects[key])
+	names, _ = filepath.Glob(filepath.Join(lf.RetryQueue.Dir, "*.conflict"))
+	assert.Len(names, 1)
+}
+
+func TestRetryQueueClosesMoreThanOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	q := &RetryQueue{Dir: t.TempDir()}
+	q.start(nil, &S3Stats{})
+	q.Close()
+	assert.NotPanics(q.Close)
+}
@@ -0,0 +1,62 @@
+package s3
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const defaultRoleSessionName = "laozi"
+
+// assumesRoles reports whether the factory assumes roles, see S3LoggerFactory.AssumeRoleARNs.
+func (lf S3LoggerFactory) assumesRoles() bool {
+	return lf.WebIdentityTokenFile != "" || len(lf.AssumeRoleARNs) > 0
+}
+
+// roles identifies the roles assumed by the factory, for its client to be shared.
+func (lf S3LoggerFactory) roles() string {
+	if !lf.assumesRoles() {
+		return ""
+	}
+	return strings.Join(append([]string{lf.WebIdentityTokenFile, lf.WebIdentityRoleARN,
+		lf.RoleSessionName, lf.STSEndpoint}, lf.AssumeRoleARNs...), "\n")
+}
+
+// credentials returns the credentials of the factory: those of the last role assumed, each
+// with the credentials of the previous one, starting with the web identity or Credentials.
+// They are refreshed by the SDK before they expire.
+func (lf S3LoggerFactory) credentials() *credentials.Credentials {
+	creds := lf.Credentials
+	if !lf.assumesRoles() {
+		return creds
+	}
+	name := lf.RoleSessionName
+	if name == "" {
+		name = defaultRoleSessionName
+	}
+
+	if lf.WebIdentityTokenFile != "" {
+		creds = stscreds.NewWebIdentityCredentials(lf.stsSession(creds), lf.WebIdentityRoleARN, name, lf.WebIdentityTokenFile)
+	}
+	for _, arn := range lf.AssumeRoleARNs {
+		creds = stscreds.NewCredentials(lf.stsSession(creds), arn, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = name
+		})
+	}
+	return creds
+}
+
+// stsSession returns a session calling STS with credentials, or the default chain if nil.
+func (lf S3LoggerFactory) stsSession(creds *credentials.Credentials) *session.Session {
+	c := &aws.Config{Credentials: creds}
+	if lf.Region != "" {
+		c.Region = aws.String(lf.Region)
+	}
+	if lf.STSEndpoint != "" {
+		c.Endpoint = aws.String(lf.STSEndpoint)
+	}
+	return session.New(c)
+}
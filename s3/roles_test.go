@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSTS issues credentials whose access key is the session of the role assumed, recording
+// the access keys requests were signed with.
+type mockSTS struct {
+	sync.Mutex
+	signedWith []string
+}
+
+func (m *mockSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.Lock()
+	m.signedWith = append(m.signedWith, accessKey(r))
+	m.Unlock()
+
+	action := r.Form.Get("Action")
+	id := r.Form.Get("RoleArn")[strings.LastIndex(r.Form.Get("RoleArn"), "/")+1:]
+	if action == "AssumeRoleWithWebIdentity" {
+		id += "-" + r.Form.Get("WebIdentityToken")
+	}
+	fmt.Fprintf(w, `<%[1]sResponse><%[1]sResult><Credentials><AccessKeyId>%s</AccessKeyId>`+
+		`<SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>`+
+		`<Expiration>2100-01-01T00:00:00Z</Expiration></Credentials></%[1]sResult></%[1]sResponse>`, action, id)
+}
+
+// accessKey returns the access key a request was signed with, if any.
+func accessKey(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if i := strings.Index(auth, "Credential="); i >= 0 {
+		return strings.SplitN(auth[i+len("Credential="):], "/", 2)[0]
+	}
+	return ""
+}
+
+func TestLoggerFactoryChainsRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	sts := &mockSTS{}
+	stsSrv := httptest.NewServer(sts)
+	defer stsSrv.Close()
+	m := &mockS3{objects: map[string][]byte{}}
+	var s3SignedWith string
+	s3Srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s3SignedWith = accessKey(r)
+		m.ServeHTTP(w, r)
+	}))
+	defer s3Srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(ioutil.WriteFile(tokenFile, []byte("web-token"), 0600))
+	lf := S3LoggerFactory{
+		Bucket:               "bucket",
+		Region:               "us-east-1",
+		Endpoint:             s3Srv.URL,
+		S3ForcePathStyle:     true,
+		SkipPreviousData:     true,
+		WebIdentityTokenFile: tokenFile,
+		WebIdentityRoleARN:   "arn:aws:iam::1:role/irsa",
+		AssumeRoleARNs:       []string{"arn:aws:iam::2:role/writer"},
+		STSEndpoint:          stsSrv.URL,
+	}
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("event\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal([]byte("event\n"), m.objects["/bucket/a"])
+	assert.Equal("writer", s3SignedWith)
+	// the web identity is exchanged without signing, the chained role is assumed with it
+	assert.Equal([]string{"", "irsa-web-token"}, sts.signedWith)
+}
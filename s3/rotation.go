@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+)
+
+// contentDigestMetadata is the object metadata holding the digest of the events of a rotated
+// object, telling a previous attempt of an upload from other events given the same key.
+const contentDigestMetadata = "Content-Digest"
+
+// rotatedKey returns the deterministic key of the object holding the events currently buffered.
+// It is made of the partition, the rotation window the first event was logged in and the
+// sequence range of the events, so retrying their upload always targets the same key. Events
+// logged again, e.g. replayed after a crash, get the key of the window they are logged in.
+func (l *s3logger) rotatedKey() string {
+	name := rotating.Name(l.key, l.batchStart, l.rotation, l.flushedSequence+1, l.sequence)
+	if l.idGenerator == nil {
+		return name
+	}
+	// the id is kept until the events are flushed, for retries to target the same key
+	if l.batchID == "" {
+		l.batchID = l.idGenerator.NewID(l.batchStart)
+	}
+	i := strings.LastIndex(name, "/") + 1
+	return name[:i] + l.batchID + rotating.IDSeparator + name[i:]
+}
+
+func (l *s3logger) windowPrefix(t time.Time) string {
+	return rotating.Window(l.key, t, l.rotation)
+}
+
+// resumeSequence continues the sequence of the objects already uploaded in the current
+// rotation window, so a restarted logger without a checkpoint doesn't reuse their keys.
+func (l *s3logger) resumeSequence(ctx aws.Context) error {
+	prefix := l.windowPrefix(time.Now()) + "/"
+	attempts := 0
+	err := l.S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(l.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			if seq, ok := rotating.ParseSequenceRange(aws.StringValue(o.Key)); ok && seq > l.sequence {
+				l.sequence = seq
+			}
+		}
+		return true
+	}, countAttempts(&attempts))
+	if err != nil {
+		return s3Error("ListObjectsV2", l.bucket, prefix, attempts, err)
+	}
+	l.flushedSequence = l.sequence
+	return nil
+}
+
+// contentDigest returns the digest of the events of a rotated object.
+func contentDigest(events []byte) string {
+	sum := sha256.Sum256(events)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkUploaded returns nil if the rotated object at key, found existing by a conditional put,
+// holds the events of digest, i.e. a previous attempt uploaded them, or *ErrConcurrentWrite if
+// it holds other events.
+func checkUploaded(ctx aws.Context, svc *s3.S3, bucket, key, digest string) error {
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(head.Metadata[contentDigestMetadata]) != digest {
+		return &laozi.ErrConcurrentWrite{Key: key}
+	}
+	return nil
+}
+
+// isAlreadyUploaded reports whether a conditional put failed because the object exists.
+func isAlreadyUploaded(err error) bool {
+	if rerr, ok := err.(awserr.RequestFailure); ok {
+		return rerr.StatusCode() == http.StatusPreconditionFailed
+	}
+	return false
+}
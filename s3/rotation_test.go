@@ -0,0 +1,167 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatedKeyIsDeterministic(t *testing.T) {
+	assert := assert.New(t)
+
+	l := makeTestLogger()
+	l.rotation = time.Hour
+	l.batchStart = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	l.flushedSequence = 10
+	l.sequence = 15
+
+	key := l.rotatedKey()
+	assert.Equal(testFile+"/20160102T030000Z/00000000000000000011-00000000000000000015", key)
+	assert.Equal(key, l.rotatedKey())
+
+	last, ok := rotating.ParseSequenceRange(key)
+	assert.True(ok)
+	assert.Equal(int64(15), last)
+
+	_, ok = rotating.ParseSequenceRange(testFile)
+	assert.False(ok)
+}
+
+func TestLoopTracksBatchStart(t *testing.T) {
+	assert := assert.New(t)
+
+	l := makeTestLogger()
+	l.rotation = time.Hour
+
+	go l.loop()
+
+	before := time.Now()
+	l.logChan <- []byte("a\n")
+	l.logChan <- []byte("b\n")
+
+	// the loop is done with the events once it returns the buffer
+	l.Buffered()
+
+	assert.Equal(int64(2), l.sequence)
+	assert.False(l.batchStart.Before(before))
+}
+
+func TestIsAlreadyUploaded(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isAlreadyUploaded(awserr.NewRequestFailure(awserr.New("PreconditionFailed", "", nil), 412, "id")))
+	assert.False(isAlreadyUploaded(awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "id")))
+	assert.False(isAlreadyUploaded(errors.New("some error")))
+	assert.False(isAlreadyUploaded(nil))
+}
+
+func TestS3LoggerFlushesEveryNRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.FlushInterval = time.Hour
+	lf.FlushEveryNRecords = 2
+
+	l := lf.NewLogger("a").(laozi.LogBatcher)
+	l.LogBatch([][]byte{[]byte("1\n"), []byte("2\n"), []byte("3\n"), []byte("4\n"), []byte("5\n")})
+	assert.NoError(l.(laozi.Logger).Close())
+
+	var objects []string
+	for _, data := range m.objects {
+		objects = append(objects, string(data))
+	}
+	sort.Strings(objects)
+	assert.Equal([]string{"1\n2\n", "3\n4\n", "5\n"}, objects)
+}
+
+func TestS3LoggerFlushesEveryNBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.FlushInterval = time.Hour
+	lf.FlushEveryNBytes = 4
+
+	l := lf.NewLogger("a").(*s3logger)
+	l.Log([]byte("12\n"))
+	l.Log([]byte("34\n"))
+	l.Log([]byte("5"))
+	l.Buffered()
+
+	m.Lock()
+	assert.Equal("12\n34\n", string(m.objects["/bucket/a"]))
+	m.Unlock()
+	assert.NoError(l.Close())
+}
+
+func TestS3LoggerChecksRotatedObjectsFoundUploaded(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.Checkpointer = &MockCheckpointer{checkpoints: map[string]laozi.Checkpoint{"a": {Partition: "a", Sequence: 5}}}
+	key := "/bucket/" + rotating.Name("a", time.Now(), time.Hour, 6, 7)
+
+	// a previous attempt uploaded the same events
+	m.objects[key] = []byte("1\n2\n")
+	m.headers[key] = http.Header{"X-Amz-Meta-Content-Digest": {contentDigest([]byte("1\n2\n"))}}
+	l := lf.NewLogger("a")
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+	assert.NoError(l.Close())
+
+	// other events were uploaded to the key, e.g. by a process that lost its checkpoint
+	m.objects[key] = []byte("old\n")
+	m.headers[key] = http.Header{"X-Amz-Meta-Content-Digest": {contentDigest([]byte("old\n"))}}
+	lf.Checkpointer = &MockCheckpointer{checkpoints: map[string]laozi.Checkpoint{"a": {Partition: "a", Sequence: 5}}}
+	l = lf.NewLogger("a")
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+	var conflict *laozi.ErrConcurrentWrite
+	assert.True(errors.As(l.Close(), &conflict))
+	assert.Equal("old\n", string(m.objects[key]))
+}
+
+func TestS3LoggerFailsWithoutRotatedSequence(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+	}))
+	defer srv.Close()
+	lf := S3LoggerFactory{
+		Bucket:           "bucket",
+		Region:           "us-east-1",
+		Endpoint:         srv.URL,
+		S3ForcePathStyle: true,
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		RotationInterval: time.Hour,
+	}
+
+	_, err := lf.NewLoggerContext(context.Background(), "a")
+	var s3Err *laozi.ErrS3
+	if assert.True(errors.As(err, &s3Err)) {
+		assert.Equal("ListObjectsV2", s3Err.Op)
+	}
+
+	// without a context, flushes fail rather than reuse the keys of the objects uploaded
+	l := lf.NewLogger("a")
+	l.Log([]byte("a\n"))
+	var prev *laozi.ErrPreviousData
+	assert.True(errors.As(l.Close(), &prev))
+}
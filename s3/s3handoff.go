@@ -0,0 +1,55 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// S3Handoff is a HandoffStore writing the handoff to a JSON object, e.g. for the successor of
+// an instance to find it wherever it runs.
+type S3Handoff struct {
+	S3     *s3.S3
+	Bucket string
+	Key    string
+}
+
+// WriteHandoff uploads the handoff, replacing the object.
+func (s *S3Handoff) WriteHandoff(h laozi.Handoff) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	_, err = s.S3.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(s.Key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// ReadHandoff fetches the handoff, if the object exists.
+func (s *S3Handoff) ReadHandoff() (laozi.Handoff, bool, error) {
+	var h laozi.Handoff
+	resp, err := s.S3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(s.Key),
+	})
+	if isNotFound(err) {
+		return h, false, nil
+	}
+	if err != nil {
+		return h, false, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return h, false, err
+	}
+	return h, true, json.Unmarshal(data, &h)
+}
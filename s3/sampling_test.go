@@ -0,0 +1,28 @@
+package s3
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerRecordsSampledOut(t *testing.T) {
+	assert := assert.New(t)
+
+	cp := &MockCheckpointer{checkpoints: map[string]laozi.Checkpoint{}}
+	l := makeTestLogger()
+	l.partition = "testkey"
+	l.checkpointer = cp
+	l.rotation = time.Hour
+
+	l.RecordSampledOut(3)
+	l.uploadedSampledOut = atomic.LoadInt64(&l.sampledOut)
+	l.RecordSampledOut(1)
+
+	assert.NoError(l.flushed(testFile))
+	assert.Equal(int64(3), cp.checkpoints["testkey"].SampledOut)
+	assert.Equal(int64(1), atomic.LoadInt64(&l.sampledOut))
+}
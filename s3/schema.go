@@ -0,0 +1,171 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// schemaVersionMetadata is the object metadata holding the schema version of its events.
+const schemaVersionMetadata = "Schema-Version"
+
+// SchemaVersion is a schema of the events of a partition, as recorded by loggers with
+// S3LoggerFactory.TrackSchemas: the JSON types of the top level fields of events, one of
+// string, number, boolean, object, array and null.
+type SchemaVersion struct {
+	Version     int               `json:"version"`
+	Fingerprint string            `json:"fingerprint"`
+	Fields      map[string]string `json:"fields"`
+	// Since is when the schema was first seen.
+	Since time.Time `json:"since"`
+}
+
+// inferSchema returns the schema of an event, with no version, unless it is not a JSON object.
+func inferSchema(e []byte) (SchemaVersion, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(e, &fields); err != nil || fields == nil {
+		return SchemaVersion{}, false
+	}
+	s := SchemaVersion{Fields: make(map[string]string, len(fields))}
+	names := make([]string, 0, len(fields))
+	for name, value := range fields {
+		s.Fields[name] = jsonType(value)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		// quoted, so names can't run into types
+		fmt.Fprintf(h, "%q:%s,", name, s.Fields[name])
+	}
+	s.Fingerprint = hex.EncodeToString(h.Sum(nil)[:8])
+	return s, true
+}
+
+// jsonType returns the JSON type of a valid JSON value.
+func jsonType(value json.RawMessage) string {
+	switch value[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// schemasKey returns the key of the schema versions of the objects of a key.
+func schemasKey(key string) string {
+	return key + ".schemas.json"
+}
+
+// ReadSchemaVersions returns the schema versions of the events of the objects of a key, e.g.
+// the partition key with the Prefix of the factory, in order, as named by the Schema-Version
+// metadata of the objects.
+func ReadSchemaVersions(svc *s3.S3, bucket, key string) ([]SchemaVersion, error) {
+	resp, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(schemasKey(key)),
+	})
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var versions []SchemaVersion
+	return versions, json.Unmarshal(data, &versions)
+}
+
+// trackSchema versions the schema of an event about to be buffered, if it changed. With
+// schemaRotation, the events of the previous schema are flushed first.
+func (l *s3logger) trackSchema(e []byte) {
+	if !l.trackSchemas {
+		return
+	}
+	s, ok := inferSchema(bytes.TrimSpace(e))
+	if !ok || s.Fingerprint == l.schema.Fingerprint {
+		return
+	}
+	if l.schemaRotation && l.buffer.Len() > 0 && l.schema.Fingerprint != "" {
+		if err := l.flush(); err != nil {
+			fmt.Printf(" [laozi] Error! Could not flush logger on schema change: %s: %s\n", l.partition, err)
+		}
+	}
+	if err := l.registerSchema(&s); err != nil {
+		fmt.Printf(" [laozi] Error! Could not record schema of %s: %s\n", l.partition, err)
+	}
+	l.schema = s
+}
+
+// registerSchema sets the version of a schema, adding it to the schema versions of the key
+// if new.
+func (l *s3logger) registerSchema(s *SchemaVersion) error {
+	if l.schemas == nil {
+		versions, err := ReadSchemaVersions(l.S3, l.bucket, l.key)
+		if err != nil {
+			return err
+		}
+		l.schemas = append([]SchemaVersion{}, versions...)
+	}
+	for _, v := range l.schemas {
+		if v.Fingerprint == s.Fingerprint {
+			s.Version, s.Since = v.Version, v.Since
+			return nil
+		}
+	}
+	s.Version, s.Since = 1, time.Now().UTC()
+	if n := len(l.schemas); n > 0 {
+		s.Version = l.schemas[n-1].Version + 1
+	}
+	schemas := append(l.schemas[:len(l.schemas):len(l.schemas)], *s)
+
+	data, err := json.Marshal(schemas)
+	if err != nil {
+		return err
+	}
+	_, err = l.S3.PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(schemasKey(l.key)),
+		Body:   bytes.NewReader(data),
+	}, l.kms.option())
+	if err != nil {
+		return err
+	}
+	l.schemas = schemas
+	return nil
+}
+
+// schemaMetadata sets the schema version of the events of an upload, if known.
+func (l *s3logger) schemaMetadata(metadata map[string]*string) {
+	if l.schema.Version > 0 {
+		metadata[schemaVersionMetadata] = aws.String(strconv.Itoa(l.schema.Version))
+	}
+}
+
+// ParseSchemaVersion returns the schema version of the Metadata of an object, 0 if it has none.
+func ParseSchemaVersion(metadata map[string]*string) int {
+	v, _ := strconv.Atoi(strings.TrimSpace(aws.StringValue(metadata[schemaVersionMetadata])))
+	return v
+}
@@ -0,0 +1,83 @@
+package s3
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInferSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	s, ok := inferSchema([]byte(`{"a":"x","b":1.5,"c":true,"d":null,"e":[1],"f":{"g":1}}`))
+	assert.True(ok)
+	assert.Equal(map[string]string{
+		"a": "string", "b": "number", "c": "boolean", "d": "null", "e": "array", "f": "object",
+	}, s.Fields)
+
+	// values don't change the schema, types do
+	same, _ := inferSchema([]byte(`{"f":{},"e":[],"d":null,"c":false,"b":-2,"a":"y"}`))
+	assert.Equal(s.Fingerprint, same.Fingerprint)
+	other, _ := inferSchema([]byte(`{"a":1,"b":1.5,"c":true,"d":null,"e":[1],"f":{"g":1}}`))
+	assert.NotEqual(s.Fingerprint, other.Fingerprint)
+
+	_, ok = inferSchema([]byte("not json"))
+	assert.False(ok)
+	_, ok = inferSchema([]byte("[1]"))
+	assert.False(ok)
+}
+
+func TestLoggerRotatesObjectsOnSchemaChange(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.TrackSchemas = true
+	lf.SchemaRotation = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte(`{"id":1}` + "\n"))
+	l.Log([]byte(`{"id":2}` + "\n"))
+	l.Log([]byte(`{"id":"3"}` + "\n"))
+	assert.NoError(l.Close())
+
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, "/bucket/a/") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if !assert.Len(keys, 2) {
+		return
+	}
+	assert.Equal(`{"id":1}`+"\n"+`{"id":2}`+"\n", string(m.objects[keys[0]]))
+	assert.Equal("1", m.headers[keys[0]].Get("X-Amz-Meta-Schema-Version"))
+	assert.Equal(`{"id":"3"}`+"\n", string(m.objects[keys[1]]))
+	assert.Equal("2", m.headers[keys[1]].Get("X-Amz-Meta-Schema-Version"))
+
+	svc := s3.New(session.New(), lf.s3Config())
+	versions, err := ReadSchemaVersions(svc, "bucket", "a")
+	assert.NoError(err)
+	if assert.Len(versions, 2) {
+		assert.Equal(map[string]string{"id": "number"}, versions[0].Fields)
+		assert.Equal(2, versions[1].Version)
+		assert.Equal(map[string]string{"id": "string"}, versions[1].Fields)
+	}
+
+	// later loggers of the key reuse the versions
+	l = lf.NewLogger("a")
+	l.Log([]byte(`{"id":4}` + "\n"))
+	assert.NoError(l.Close())
+	versions, _ = ReadSchemaVersions(svc, "bucket", "a")
+	assert.Len(versions, 2)
+	assert.Equal(1, ParseSchemaVersion(map[string]*string{"Schema-Version": aws.String("1")}))
+}
@@ -0,0 +1,122 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// shardManifestName is the name of the ShardManifest, after the Prefix of the factory.
+	shardManifestName    = "_laozi_shards.json"
+	maxShardPrefixLength = 8
+)
+
+// ShardManifest describes the hash prefixes of the object keys of an S3LoggerFactory with a
+// ShardPrefixLength, for readers to find the objects of a partition. Loggers write it to
+// <Prefix>_laozi_shards.json, see ReadShardManifest.
+type ShardManifest struct {
+	// Hash is the hash of the partition keys the prefixes are made of, "sha1", and Length the
+	// number of its hex digits they keep.
+	Hash   string `json:"hash"`
+	Length int    `json:"length"`
+	// Prefix is the Prefix of the factory, ahead of the hash prefixes.
+	Prefix string `json:"prefix"`
+}
+
+// ShardPrefix returns the hash prefix of the object keys of a partition, e.g. "a3/" with a
+// length of 2: the first hex digits of the SHA-1 of the partition key, and a slash. It is
+// empty if length is 0.
+func ShardPrefix(partition string, length int) string {
+	if length <= 0 {
+		return ""
+	}
+	sum := sha1.Sum([]byte(partition))
+	return hex.EncodeToString(sum[:])[:length] + "/"
+}
+
+// Key returns the key of the object of a partition, or the base of the keys of its rotated
+// objects.
+func (m ShardManifest) Key(partition string) string {
+	return m.Prefix + ShardPrefix(partition, m.Length) + partition
+}
+
+// Partition returns the partition of the key of an object not rotated, i.e. without the
+// prefixes.
+func (m ShardManifest) Partition(key string) string {
+	return trimShardPrefix(strings.TrimPrefix(key, m.Prefix), m.Length)
+}
+
+// trimShardPrefix removes the hash prefix of a key without the Prefix of its factory.
+func trimShardPrefix(name string, length int) string {
+	if length <= 0 || len(name) <= length || name[length] != '/' {
+		return name
+	}
+	return name[length+1:]
+}
+
+// ReadShardManifest fetches the ShardManifest of the loggers of a prefix, reporting false if
+// there is none, i.e. their object keys aren't sharded.
+func ReadShardManifest(c *s3.S3, bucket, prefix string) (ShardManifest, bool, error) {
+	var m ShardManifest
+	resp, err := c.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(prefix + shardManifestName),
+	})
+	if isNotFound(err) {
+		return m, false, nil
+	}
+	if err != nil {
+		return m, false, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return m, false, err
+	}
+	return m, true, json.Unmarshal(data, &m)
+}
+
+// shardManifests are the manifests written by the loggers of the process, by bucket and key.
+var shardManifests = struct {
+	sync.Mutex
+	written map[string]bool
+}{written: map[string]bool{}}
+
+// writeShardManifest writes the ShardManifest of the factory, if sharding keys, once per
+// process. Failing to write it doesn't fail the logger, the next one retries.
+func (lf S3LoggerFactory) writeShardManifest(c *s3.S3) {
+	if lf.ShardPrefixLength == 0 {
+		return
+	}
+	key := lf.Prefix + shardManifestName
+	shardManifests.Lock()
+	defer shardManifests.Unlock()
+	if shardManifests.written[lf.Bucket+"/"+key] {
+		return
+	}
+
+	data, err := json.Marshal(ShardManifest{Hash: "sha1", Length: lf.ShardPrefixLength, Prefix: lf.Prefix})
+	if err != nil {
+		return
+	}
+	_, err = c.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(lf.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not write shard manifest, will retry: %s: %s\n", key, err)
+		return
+	}
+	shardManifests.written[lf.Bucket+"/"+key] = true
+}
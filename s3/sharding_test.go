@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	// sha1("a") is 86f7e437...
+	assert.Equal("86/", ShardPrefix("a", 2))
+	assert.Equal("86f7e437/", ShardPrefix("a", 8))
+	assert.Equal("", ShardPrefix("a", 0))
+
+	m := ShardManifest{Hash: "sha1", Length: 2, Prefix: "logs/"}
+	assert.Equal("logs/86/a", m.Key("a"))
+	assert.Equal("a", m.Partition("logs/86/a"))
+	assert.Equal("b/c", m.Partition(m.Key("b/c")))
+}
+
+func TestS3LoggerShardsKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.Prefix = "sharded/"
+	lf.ShardPrefixLength = 2
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("x\n"))
+	assert.NoError(l.Close())
+	assert.Equal("x\n", string(m.objects["/bucket/sharded/86/a"]))
+
+	c := s3.New(session.New(), lf.s3Config())
+	manifest, found, err := ReadShardManifest(c, "bucket", "sharded/")
+	assert.NoError(err)
+	assert.True(found)
+	assert.Equal(ShardManifest{Hash: "sha1", Length: 2, Prefix: "sharded/"}, manifest)
+	assert.Equal("sharded/86/a", manifest.Key("a"))
+
+	// written once per process
+	delete(m.objects, "/bucket/sharded/_laozi_shards.json")
+	lf.NewLogger("b").Close()
+	_, found, err = ReadShardManifest(c, "bucket", "sharded/")
+	assert.NoError(err)
+	assert.False(found)
+
+	assert.Panics(func() {
+		lf.ShardPrefixLength = 9
+		lf.NewLogger("a")
+	})
+}
+
+func TestVerifierReadsShardedKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{
+		"/bucket/logs/_laozi_shards.json": []byte(`{"hash":"sha1","length":2,"prefix":"logs/"}`),
+		"/bucket/logs/86/a":               []byte("1\n2\n"),
+	}}
+	lf := makeTestS3Factory(t, m)
+	v := &Verifier{
+		S3:                s3.New(session.New(), lf.s3Config()),
+		Bucket:            "bucket",
+		Prefix:            "logs/",
+		ShardPrefixLength: 2,
+	}
+	reports, err := v.VerifyCounts(map[string]int{"a": 2})
+	assert.NoError(err)
+	assert.Equal([]VerifyReport{{Partition: "a", Expected: 2, Archived: 2}}, reports)
+}
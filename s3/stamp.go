@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// stampSeparator separates the sequence number stamped on a record from the event.
+const stampSeparator = '\t'
+
+// stamp returns the prefix of the record of the last event buffered, if stamping records.
+func (l *s3logger) stamp() []byte {
+	if !l.stampSequence {
+		return nil
+	}
+	return append(strconv.AppendInt(nil, l.sequence, 10), stampSeparator)
+}
+
+// terminate returns the event ending with a newline if stamping records, so an event without
+// one doesn't run into the stamp of the next.
+func (l *s3logger) terminate(e []byte) []byte {
+	if !l.stampSequence || bytes.HasSuffix(e, []byte("\n")) {
+		return e
+	}
+	return append(e[:len(e):len(e)], '\n')
+}
+
+// unstamp returns the event of a record, without its sequence number if stamping records.
+func (l *s3logger) unstamp(record []byte) []byte {
+	if !l.stampSequence {
+		return record
+	}
+	if _, event, ok := ParseSequenceStamp(record); ok {
+		return event
+	}
+	return record
+}
+
+// ParseSequenceStamp splits a record archived with S3LoggerFactory.SequenceStamp into its
+// sequence number and event.
+func ParseSequenceStamp(record []byte) (int64, []byte, bool) {
+	i := bytes.IndexByte(record, stampSeparator)
+	if i <= 0 {
+		return 0, record, false
+	}
+	// stamps are unsigned, unlike what ParseInt accepts
+	for _, c := range record[:i] {
+		if c < '0' || c > '9' {
+			return 0, record, false
+		}
+	}
+	seq, err := strconv.ParseInt(string(record[:i]), 10, 64)
+	if err != nil {
+		return 0, record, false
+	}
+	return seq, record[i+1:], true
+}
+
+// resumeStampedSequence continues the sequence of the records of the previous data, so a
+// restarted logger doesn't stamp the same numbers again.
+func (l *s3logger) resumeStampedSequence() {
+	if !l.stampSequence {
+		return
+	}
+	data := l.buffer.Bytes()
+	for _, record := range bytes.Split(data, []byte{'\n'}) {
+		if seq, _, ok := ParseSequenceStamp(record); ok && seq > l.sequence {
+			l.sequence = seq
+		}
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		l.buffer.Write([]byte{'\n'})
+	}
+}
+
+// lastByteWriter remembers the last byte written to w.
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if n > 0 {
+		lw.last = p[n-1]
+	}
+	return n, err
+}
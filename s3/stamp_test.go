@@ -0,0 +1,131 @@
+package s3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerStampsSequence(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("1\told\n2\told\n")}}
+	lf := makeTestS3Factory(t, m)
+	lf.SequenceStamp = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal("1\told\n2\told\n3\tnew\n", string(m.objects["/bucket/a"]))
+}
+
+func TestDedupeS3LoggerStampsSequence(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.SequenceStamp = true
+	lf.IsDupeFunc = func(event []byte, line []byte) bool { return string(event) == string(line) }
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("x\n"))
+	l.Log([]byte("y\n"))
+	l.Log([]byte("x\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal("1\tx\n2\ty\n", string(m.objects["/bucket/a"]))
+}
+
+func TestParseSequenceStamp(t *testing.T) {
+	assert := assert.New(t)
+
+	seq, event, ok := ParseSequenceStamp([]byte("42\tsome\tevent\n"))
+	assert.True(ok)
+	assert.Equal(int64(42), seq)
+	assert.Equal("some\tevent\n", string(event))
+
+	_, event, ok = ParseSequenceStamp([]byte("not stamped\n"))
+	assert.False(ok)
+	assert.Equal("not stamped\n", string(event))
+}
+
+func TestS3LoggerStampsUnterminatedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("1\told")}}
+	lf := makeTestS3Factory(t, m)
+	lf.SequenceStamp = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("x"))
+	assert.NoError(l.(laozi.ReaderLogger).LogReader(strings.NewReader("y")))
+	l.Log([]byte(""))
+	assert.NoError(l.Close())
+
+	assert.Equal("1\told\n2\tx\n3\ty\n4\t\n", string(m.objects["/bucket/a"]))
+
+	_, _, ok := ParseSequenceStamp([]byte("-1\tevent"))
+	assert.False(ok)
+	_, _, ok = ParseSequenceStamp([]byte("+1\tevent"))
+	assert.False(ok)
+}
+
+func TestDedupeS3LoggerKeepsUnterminatedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.IsDupeFunc = func(event []byte, line []byte) bool { return string(event) == string(line) }
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("x"))
+	l.Log([]byte("y"))
+	assert.NoError(l.Close())
+
+	assert.Equal("xy", string(m.objects["/bucket/a"]))
+}
+
+func FuzzSequenceStampFraming(f *testing.F) {
+	f.Add([]byte("event\n"), []byte("next"))
+	f.Add([]byte("1\t2\t3"), []byte(""))
+	f.Add([]byte("\x00\xff"), []byte("-1\tx\n"))
+	f.Fuzz(func(t *testing.T, first, second []byte) {
+		events := [][]byte{first, second}
+		for _, e := range events {
+			if bytes.IndexByte(bytes.TrimSuffix(e, []byte("\n")), '\n') >= 0 {
+				// records are lines, events embedding newlines span several
+				t.Skip()
+			}
+		}
+
+		l := &s3logger{buffer: newMemoryBuffer(nil), stampSequence: true}
+		for _, e := range events {
+			l.add(e)
+		}
+
+		records := bytes.SplitAfter(l.buffer.Bytes(), []byte("\n"))
+		if len(records) != len(events)+1 || len(records[len(events)]) != 0 {
+			t.Fatalf("%d records in %q", len(records), l.buffer.Bytes())
+		}
+		for i, e := range events {
+			seq, event, ok := ParseSequenceStamp(records[i])
+			if !ok || seq != int64(i+1) {
+				t.Fatalf("record %q stamped %d", records[i], seq)
+			}
+			if !bytes.Equal(bytes.TrimSuffix(event, []byte("\n")), bytes.TrimSuffix(e, []byte("\n"))) {
+				t.Fatalf("event %q framed as %q", e, event)
+			}
+		}
+
+		// a restarted logger continues the sequence
+		restarted := &s3logger{buffer: newMemoryBuffer(l.buffer.Bytes()), stampSequence: true}
+		restarted.resumeStampedSequence()
+		if restarted.sequence != int64(len(events)) {
+			t.Fatalf("resumed at %d", restarted.sequence)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package s3
+
+import (
+	"sync/atomic"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// State returns the size of the buffer, whether it is being uploaded and the last flushes.
+func (l *s3logger) State() laozi.LoggerState {
+	return laozi.LoggerState{
+		BufferedBytes: atomic.LoadInt64(&l.bufferedBytes),
+		Uploading:     atomic.LoadInt32(&l.uploading) == 1,
+		Flushes:       l.Flushes(),
+	}
+}
+
+// Sequences returns the sequence numbers of the last events flushed and logged.
+func (l *s3logger) Sequences() (flushed, logged int64) {
+	return l.reportedSequence, l.sequence
+}
+
+// storeBuffered records the size of the buffer for State.
+func (l *s3logger) storeBuffered() {
+	atomic.StoreInt64(&l.bufferedBytes, int64(len(l.sealedBytes())+l.buffer.Len()))
+}
@@ -0,0 +1,39 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerKeepsFlushHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.SkipPreviousData = true
+	lf.FlushHistory = 2
+
+	l := lf.newS3Logger("a")
+	l.add([]byte("a\n"))
+	assert.Error(l.flush())
+	m.failPuts = false
+	assert.NoError(l.flush())
+
+	flushes := l.State().Flushes
+	if assert.Len(flushes, 2) {
+		assert.Contains(flushes[0].Error, "AccessDenied")
+		assert.Equal("a", flushes[1].Key)
+		assert.Equal(1, flushes[1].Records)
+		assert.Equal(2, flushes[1].Bytes)
+		assert.Empty(flushes[1].Error)
+	}
+
+	l.add([]byte("b\n"))
+	assert.NoError(l.flush())
+	flushes = l.State().Flushes
+	if assert.Len(flushes, 2) {
+		assert.Empty(flushes[0].Error)
+		assert.Equal(4, flushes[1].Bytes)
+	}
+}
@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Stats counts what the loggers of an S3LoggerFactory sharing it do. It is safe for
+// concurrent use, read it with Snapshot. Give every factory its own S3Stats to count requests
+// per prefix.
+type S3Stats struct {
+	// SkippedUploads is the number of flushes skipped as nothing changed since the last upload.
+	SkippedUploads int64
+	// PutRequests counts the requests billed as PUT, COPY, POST or LIST by S3, GetRequests the
+	// GET, HEAD and other ones, retries included. UploadedBytes is the size of the objects put.
+	PutRequests   int64
+	GetRequests   int64
+	UploadedBytes int64
+	// PendingRetries is the number of uploads waiting in the RetryQueue of the factory.
+	PendingRetries int64
+	// RequestBudget optionally is the number of requests allowed per UTC day. Once it is
+	// exceeded, a warning is logged and loggers flush at most every OverBudgetFlushInterval,
+	// if set, until the end of the day.
+	RequestBudget           int64
+	OverBudgetFlushInterval time.Duration
+	// BudgetExceeded is optionally called, instead of logging a warning, once a day when the
+	// RequestBudget is exceeded.
+	BudgetExceeded func(requests int64)
+
+	// requests made during day, in days since the epoch
+	day         int64
+	dayRequests int64
+}
+
+// Snapshot returns a consistent copy of the counters.
+func (s *S3Stats) Snapshot() S3Stats {
+	return S3Stats{
+		SkippedUploads: atomic.LoadInt64(&s.SkippedUploads),
+		PutRequests:    atomic.LoadInt64(&s.PutRequests),
+		GetRequests:    atomic.LoadInt64(&s.GetRequests),
+		UploadedBytes:  atomic.LoadInt64(&s.UploadedBytes),
+		PendingRetries: atomic.LoadInt64(&s.PendingRetries),
+	}
+}
+
+// Counters returns the counters by name, for the laozi.AdminServer.
+func (s *S3Stats) Counters() map[string]int64 {
+	c := s.Snapshot()
+	return map[string]int64{
+		"skipped_uploads": c.SkippedUploads,
+		"put_requests":    c.PutRequests,
+		"get_requests":    c.GetRequests,
+		"uploaded_bytes":  c.UploadedBytes,
+		"pending_retries": c.PendingRetries,
+	}
+}
+
+func (s *S3Stats) skippedUpload() {
+	if s != nil {
+		atomic.AddInt64(&s.SkippedUploads, 1)
+	}
+}
+
+func (s *S3Stats) pendingRetries(n int64) {
+	if s != nil {
+		atomic.AddInt64(&s.PendingRetries, n)
+	}
+}
+
+// instrument makes the stats count the requests of an S3 client.
+func (s *S3Stats) instrument(c *s3.S3) {
+	if s != nil {
+		c.Handlers.Send.PushFront(s.request)
+	}
+}
+
+func (s *S3Stats) request(r *request.Request) {
+	switch {
+	case r.Operation.Name == "PutObject", r.Operation.Name == "UploadPart":
+		atomic.AddInt64(&s.PutRequests, 1)
+		atomic.AddInt64(&s.UploadedBytes, r.HTTPRequest.ContentLength)
+	case r.HTTPRequest.Method == http.MethodGet && r.Operation.Name != "ListObjects" && r.Operation.Name != "ListObjectsV2",
+		r.HTTPRequest.Method == http.MethodHead:
+		atomic.AddInt64(&s.GetRequests, 1)
+	default:
+		atomic.AddInt64(&s.PutRequests, 1)
+	}
+	s.spend(time.Now())
+}
+
+// spend counts a request against the budget of the day of now.
+func (s *S3Stats) spend(now time.Time) {
+	if s.RequestBudget <= 0 {
+		return
+	}
+	day := now.Unix() / int64(24*time.Hour/time.Second)
+	if current := atomic.LoadInt64(&s.day); current != day && atomic.CompareAndSwapInt64(&s.day, current, day) {
+		atomic.StoreInt64(&s.dayRequests, 0)
+	}
+	if n := atomic.AddInt64(&s.dayRequests, 1); n == s.RequestBudget+1 {
+		if s.BudgetExceeded != nil {
+			s.BudgetExceeded(n)
+		} else {
+			log.Printf("- [laozi] Daily S3 request budget of %d exceeded\n", s.RequestBudget)
+		}
+	}
+}
+
+// flushInterval returns how long loggers with interval d wait between flushes.
+func (s *S3Stats) flushInterval(d time.Duration) time.Duration {
+	if s == nil || s.RequestBudget <= 0 || s.OverBudgetFlushInterval <= d {
+		return d
+	}
+	day := time.Now().Unix() / int64(24*time.Hour/time.Second)
+	if atomic.LoadInt64(&s.day) == day && atomic.LoadInt64(&s.dayRequests) > s.RequestBudget {
+		return s.OverBudgetFlushInterval
+	}
+	return d
+}
@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerSkipsUnchangedUploads(t *testing.T) {
+	assert := assert.New(t)
+
+	stats := &S3Stats{}
+	l := makeTestLogger()
+	l.skipUnchanged = true
+	l.stats = stats
+	l.buffer.Write([]byte("some data"))
+	l.uploadedHash = l.payloadHash()
+
+	key, err := l.upload(context.Background())
+	assert.NoError(err)
+	assert.Equal("", key)
+	assert.Equal(int64(1), stats.Snapshot().SkippedUploads)
+}
+
+func TestPayloadHashChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	l := makeTestLogger()
+	l.buffer.Write([]byte("some data"))
+	h1 := l.payloadHash()
+
+	l.uploadedSampledOut = 1
+	h2 := l.payloadHash()
+
+	l.buffer.Write([]byte("more data"))
+	h3 := l.payloadHash()
+
+	assert.NotEqual(h1, h2)
+	assert.NotEqual(h2, h3)
+}
+
+func TestNilS3StatsIgnoresCounts(t *testing.T) {
+	var stats *S3Stats
+	stats.skippedUpload()
+}
+
+func TestS3StatsCountsRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	stats := &S3Stats{}
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.Stats = stats
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("some data\n"))
+	assert.NoError(l.Close())
+
+	s := stats.Snapshot()
+	assert.Equal(int64(1), s.GetRequests)
+	assert.Equal(int64(1), s.PutRequests)
+	assert.Equal(int64(len("some data\n")), s.UploadedBytes)
+}
+
+func TestS3StatsRequestBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	var exceeded []int64
+	stats := &S3Stats{
+		RequestBudget:           2,
+		OverBudgetFlushInterval: time.Hour,
+		BudgetExceeded:          func(n int64) { exceeded = append(exceeded, n) },
+	}
+
+	for i := 0; i < 4; i++ {
+		stats.spend(time.Now())
+	}
+	assert.Equal([]int64{3}, exceeded)
+	assert.Equal(time.Hour, stats.flushInterval(time.Second))
+
+	// the budget is reset every day
+	stats.spend(time.Now().Add(24 * time.Hour))
+	assert.Equal(int64(1), stats.dayRequests)
+	assert.Equal(time.Second, stats.flushInterval(time.Second))
+}
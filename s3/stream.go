@@ -0,0 +1,59 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// readRequest is an event to be read by the loop of a logger, done receiving the read error.
+type readRequest struct {
+	r    io.Reader
+	done chan error
+}
+
+// LogReader causes the event read from r to be written to the internal memory buffer.
+func (l *s3logger) LogReader(r io.Reader) error {
+	req := readRequest{r: r, done: make(chan error, 1)}
+	l.readChan <- req
+	l.active = time.Now()
+	return <-req.done
+}
+
+// addReader writes the event read from r to the buffer, leaving it unchanged if r fails.
+func (l *s3logger) addReader(r io.Reader) error {
+	l.sliceWindow()
+	n := l.buffer.Len()
+	l.buffered()
+	l.buffer.Write(l.stamp())
+	w := &lastByteWriter{w: l.buffer}
+	if _, err := io.Copy(w, r); err != nil {
+		l.buffer.Truncate(n)
+		l.sequence--
+		return err
+	}
+	if l.stampSequence && w.last != '\n' {
+		l.buffer.Write([]byte{'\n'})
+	}
+	return nil
+}
+
+// LogReader reads the event in memory, as dupes are looked for in the whole buffer.
+func (l *dedupeS3Logger) LogReader(r io.Reader) error {
+	e, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	l.Log(e)
+	return nil
+}
+
+// LogReader reads the event in memory and logs it synchronously.
+func (l *syncS3Logger) LogReader(r io.Reader) error {
+	e, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return l.LogSync(context.Background(), e)
+}
@@ -0,0 +1,65 @@
+package s3
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterLogsReaders(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	r := laozi.NewLaozi(&laozi.Config{
+		LoggerFactory:    makeTestS3Factory(t, m),
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "other", nil },
+	})
+	assert.NoError(r.LogReader("a", strings.NewReader("large\n")))
+	r.Close()
+
+	assert.Equal("large\n", string(m.objects["/bucket/a"]))
+	assert.Equal(laozi.ErrClosed, r.LogReader("a", strings.NewReader("late\n")))
+}
+
+func TestS3LoggerDiscardsFailedReaders(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.SequenceStamp = true
+
+	l := lf.NewLogger("a").(laozi.ReaderLogger)
+	failing := io.MultiReader(strings.NewReader("partial"), brokenReader{})
+	assert.Error(l.LogReader(failing))
+	assert.NoError(l.LogReader(strings.NewReader("ok\n")))
+	assert.NoError(l.Close())
+
+	assert.Equal("1\tok\n", string(m.objects["/bucket/a"]))
+}
+
+func TestDedupeS3LoggerLogsReaders(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.IsDupeFunc = func(event []byte, line []byte) bool { return string(event) == string(line) }
+
+	l := lf.NewLogger("a").(laozi.ReaderLogger)
+	assert.NoError(l.LogReader(strings.NewReader("same\n")))
+	assert.NoError(l.LogReader(strings.NewReader("same\n")))
+	assert.NoError(l.Close())
+
+	assert.Equal("same\n", string(m.objects["/bucket/a"]))
+}
+
+type brokenReader struct{}
+
+func (brokenReader) Read([]byte) (int, error) {
+	return 0, errors.New("broken")
+}
@@ -0,0 +1,85 @@
+package s3
+
+import (
+	"compress/gzip"
+	"io"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// streaming reports whether uploads are compressed while being uploaded, see
+// S3LoggerFactory.StreamUploads.
+func (l *s3logger) streaming() bool {
+	return l.streamUploads && l.compression == "gzip" && l.keyRing == nil && l.lockMode == "" &&
+		!l.legalHold && l.cache == nil && !l.gzipMembers
+}
+
+// streamUpload uploads the buffer compressed through a pipe, returning the size of the upload.
+func (l *s3logger) streamUpload(ctx aws.Context, key string, metadata map[string]*string, opts []request.Option) (int, error) {
+	pr, pw := io.Pipe()
+	var size int64
+	compressed := make(chan struct{})
+	go func() {
+		defer close(compressed)
+		gw := gzip.NewWriter(&countingWriter{pw, &size})
+		r := l.buffer.Reader()
+		_, err := io.Copy(gw, r)
+		r.Close()
+		if err == nil {
+			err = gw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	progress := l.newProgress(key, -1)
+	uploader := s3manager.NewUploaderWithClient(l.S3, func(u *s3manager.Uploader) {
+		u.Concurrency = 1
+	})
+	out, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:   aws.String(l.bucket),
+		Key:      aws.String(key),
+		Body:     pr,
+		Metadata: metadata,
+	}, s3manager.WithUploaderRequestOptions(objectRequests(opts), progress.option(), l.kms.option()))
+	// unblocks the compression if the upload failed early
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-compressed
+
+	if mu, ok := err.(s3manager.MultiUploadFailure); ok && mu.OrigErr() != nil {
+		// e.g. the conditions failing the completion
+		err = mu.OrigErr()
+	}
+	if err != nil {
+		return 0, err
+	}
+	l.etag, l.etagKnown = aws.StringValue(out.ETag), true
+	l.uploadedVersion = aws.StringValue(out.VersionID)
+	progress.finish(atomic.LoadInt64(&size))
+	return int(atomic.LoadInt64(&size)), nil
+}
+
+// objectRequests applies request options only to the requests writing the object, not to
+// those uploading its parts.
+func objectRequests(opts []request.Option) request.Option {
+	return func(r *request.Request) {
+		switch r.Operation.Name {
+		case "PutObject", "CompleteMultipartUpload":
+			r.ApplyOptions(opts...)
+		}
+	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
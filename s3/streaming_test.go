@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerStreamsUploads(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.Compression = "gzip"
+	lf.StreamUploads = true
+	lf.SkipPreviousData = true
+	lf.DetectConcurrentWriters = true
+	lf.Stats = &S3Stats{}
+
+	// small uploads are put, large ones go in parts
+	small := []byte("event\n")
+	large := make([]byte, 6<<20)
+	rand.Read(large)
+	for _, data := range [][]byte{small, large} {
+		l := lf.newS3Logger("a")
+		assert.True(l.streaming())
+		l.add(data)
+		assert.NoError(l.flush())
+
+		gr, err := gzip.NewReader(bytes.NewReader(m.objects["/bucket/a"]))
+		assert.NoError(err)
+		uploaded, _ := ioutil.ReadAll(gr)
+		assert.True(bytes.Equal(data, uploaded))
+		assert.Equal(len(m.objects["/bucket/a"]), l.uploadedBytes)
+		assert.Equal(etag(m.objects["/bucket/a"]), l.etag)
+	}
+	assert.Equal(int64(len(m.objects["/bucket/a"])+len(compress.Compress("gzip", small))), lf.Stats.UploadedBytes)
+}
@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// NewSyncLogger returns an S3 logger for a corresponding partition key that uploads its
+// buffer on every LogSync.
+func (lf S3LoggerFactory) NewSyncLogger(key string) laozi.SyncLogger {
+	l := lf.newS3Logger(key)
+	l.waitPrevious()
+	sl := &syncS3Logger{s3logger: l, add: l.add}
+	if lf.IsDupeFunc != nil {
+		sl.add = (&dedupeS3Logger{l, lf.IsDupeFunc}).add
+	}
+	return sl
+}
+
+// syncS3Logger drives an s3logger from the calling goroutine instead of its loop.
+type syncS3Logger struct {
+	*s3logger
+	add func([]byte)
+	// pending is set while the buffer holds events that failed to be flushed
+	pending bool
+}
+
+// LogSync writes the event to the buffer and uploads it.
+func (l *syncS3Logger) LogSync(ctx context.Context, e []byte) error {
+	l.add(e)
+	l.active = time.Now()
+	l.pending = true
+	if err := l.flushContext(ctx); err != nil {
+		return err
+	}
+	l.pending = false
+	return nil
+}
+
+// Log is LogSync without a deadline.
+func (l *syncS3Logger) Log(e []byte) {
+	if err := l.LogSync(context.Background(), e); err != nil {
+		fmt.Printf(" [laozi] Error! Could not flush logger: %s: %s\n", l.partition, err)
+	}
+}
+
+// Detach returns the events that previously failed to be flushed, if any.
+func (l *syncS3Logger) Detach() [][]byte {
+	return l.unpersisted()
+}
+
+// Close flushes the events that previously failed to be, if any.
+func (l *syncS3Logger) Close() error {
+	if !l.pending {
+		return nil
+	}
+	return l.flush()
+}
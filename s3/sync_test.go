@@ -0,0 +1,12 @@
+package s3
+
+import (
+	"testing"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerFactoryMakesSyncLoggers(t *testing.T) {
+	assert.Implements(t, (*laozi.SyncLoggerFactory)(nil), S3LoggerFactory{})
+}
@@ -0,0 +1,29 @@
+package s3
+
+import "time"
+
+// flushThresholds returns the flush interval and the records and bytes thresholds of the
+// logger, those of its FlushThresholds that are set overriding those of its factory.
+func (l *s3logger) flushThresholds() (interval time.Duration, records, bytes int) {
+	interval, records, bytes = l.thresholds.Get()
+	if interval <= 0 {
+		interval = l.flushInterval
+	}
+	if records <= 0 {
+		records = l.maxRecords
+	}
+	if bytes <= 0 {
+		bytes = l.maxBytes
+	}
+	return interval, records, bytes
+}
+
+// nextFlush returns the channel receiving the time of the next periodic flush, nil if the
+// logger has no flush interval.
+func (l *s3logger) nextFlush() <-chan time.Time {
+	interval, _, _ := l.flushThresholds()
+	if interval <= 0 {
+		return nil
+	}
+	return time.After(l.stats.flushInterval(interval))
+}
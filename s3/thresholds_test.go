@@ -0,0 +1,52 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerAppliesFlushThresholds(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.FlushThresholds = &laozi.FlushThresholds{}
+	lf.RotationInterval = time.Hour
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+	// the loop is done with the events, and flushes they caused, once it returns the buffer
+	l.(*s3logger).Buffered()
+	m.Lock()
+	assert.Empty(m.objects)
+	m.Unlock()
+
+	lf.FlushThresholds.Set(0, 2, 0)
+	l.Log([]byte("3\n"))
+	l.Log([]byte("4\n"))
+	l.(*s3logger).Buffered()
+	m.Lock()
+	// the first 3 events reached the threshold, flushed with the third
+	assert.Len(m.objects, 1)
+	m.Unlock()
+
+	lf.FlushThresholds.Set(10*time.Millisecond, 0, 0)
+	assert.Eventually(func() bool {
+		m.Lock()
+		defer m.Unlock()
+		return len(m.objects) == 2
+	}, time.Second, time.Millisecond)
+
+	// forced flushes don't wait for the thresholds
+	lf.FlushThresholds.Set(0, 0, 0)
+	l.Log([]byte("5\n"))
+	assert.NoError(l.(laozi.FlushingLogger).Flush())
+	m.Lock()
+	assert.Len(m.objects, 3)
+	m.Unlock()
+	assert.NoError(l.Close())
+}
@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// TierTransitioner moves archived objects to a colder storage class once they reach a given
+// age, so recent objects stay in STANDARD for cheap reads while older ones cost less to keep.
+// Objects are copied in place with the new storage class, and the Transitioned callback can
+// keep any index of the objects up to date. Objects can't be appended to once in an archive
+// tier, so it is meant for factories with a RotationInterval.
+type TierTransitioner struct {
+	S3     *s3.S3
+	Bucket string
+	Prefix string
+	// Age is how long after their last modification objects are transitioned.
+	Age time.Duration
+	// StorageClass is the class objects are transitioned to, defaults to GLACIER.
+	StorageClass string
+	// Interval is how often the bucket is scanned, defaults to an hour.
+	Interval time.Duration
+	// Transitioned is optionally called with every object transitioned and its new class.
+	Transitioned func(key, storageClass string)
+
+	quitChan chan struct{}
+	doneChan chan struct{}
+}
+
+// NewTierTransitioner returns a transitioner of the objects of a bucket under prefix.
+func NewTierTransitioner(bucket, prefix, region string, age time.Duration) *TierTransitioner {
+	return &TierTransitioner{
+		S3:     s3.New(session.New(), &aws.Config{Region: aws.String(region)}),
+		Bucket: bucket,
+		Prefix: prefix,
+		Age:    age,
+	}
+}
+
+// Start transitions objects every Interval until Close is called.
+func (t *TierTransitioner) Start() {
+	if t.Age == time.Duration(0) {
+		panic("Age must not be zero")
+	}
+
+	t.quitChan = make(chan struct{})
+	t.doneChan = make(chan struct{})
+
+	go t.loop()
+}
+
+func (t *TierTransitioner) loop() {
+	defer close(t.doneChan)
+
+	interval := t.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for {
+		if err := t.Transition(); err != nil {
+			fmt.Printf(" [laozi] Error! Could not transition objects: %s\n", err)
+		}
+		select {
+		case <-time.After(interval):
+		case <-t.quitChan:
+			return
+		}
+	}
+}
+
+// Close stops the transitioner.
+func (t *TierTransitioner) Close() {
+	close(t.quitChan)
+	<-t.doneChan
+}
+
+// Transition moves the objects old enough to the StorageClass, returning the last error
+// encountered.
+func (t *TierTransitioner) Transition() error {
+	class := t.StorageClass
+	if class == "" {
+		class = s3.StorageClassGlacier
+	}
+
+	var old []string
+	err := t.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(t.Bucket),
+		Prefix: aws.String(t.Prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			current := aws.StringValue(o.StorageClass)
+			if (current == "" || current == s3.ObjectStorageClassStandard) && time.Since(aws.TimeValue(o.LastModified)) >= t.Age {
+				old = append(old, aws.StringValue(o.Key))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range old {
+		_, cerr := t.S3.CopyObject(&s3.CopyObjectInput{
+			Bucket:            aws.String(t.Bucket),
+			Key:               aws.String(key),
+			CopySource:        aws.String(t.Bucket + "/" + url.PathEscape(key)),
+			StorageClass:      aws.String(class),
+			MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+		})
+		if cerr != nil {
+			err = fmt.Errorf("could not transition %s: %s", key, cerr)
+			continue
+		}
+		if t.Transitioned != nil {
+			t.Transitioned(key, class)
+		}
+	}
+	return err
+}
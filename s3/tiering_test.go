@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTierTransitionerTransitionsOldObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	copies := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			old := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+			recent := time.Now().UTC().Format(time.RFC3339)
+			fmt.Fprintf(w, `<ListBucketResult>
+<Contents><Key>logs/old</Key><LastModified>%s</LastModified><StorageClass>STANDARD</StorageClass></Contents>
+<Contents><Key>logs/archived</Key><LastModified>%s</LastModified><StorageClass>GLACIER</StorageClass></Contents>
+<Contents><Key>logs/recent</Key><LastModified>%s</LastModified><StorageClass>STANDARD</StorageClass></Contents>
+</ListBucketResult>`, old, old, recent)
+		case http.MethodPut:
+			copies[r.URL.Path] = r.Header.Get("X-Amz-Storage-Class")
+			fmt.Fprint(w, `<CopyObjectResult></CopyObjectResult>`)
+		}
+	}))
+	defer srv.Close()
+
+	var transitioned []string
+	tt := &TierTransitioner{
+		S3: s3.New(session.New(), &aws.Config{
+			Region:           aws.String("us-east-1"),
+			Endpoint:         aws.String(srv.URL),
+			S3ForcePathStyle: aws.Bool(true),
+			Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		}),
+		Bucket: "bucket",
+		Prefix: "logs/",
+		Age:    24 * time.Hour,
+		Transitioned: func(key, class string) {
+			transitioned = append(transitioned, key+":"+class)
+		},
+	}
+
+	assert.NoError(tt.Transition())
+	assert.Equal(map[string]string{"/bucket/logs/old": "GLACIER"}, copies)
+	assert.Equal([]string{"logs/old:GLACIER"}, transitioned)
+}
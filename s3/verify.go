@@ -0,0 +1,279 @@
+package s3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+)
+
+// Verifier reads back the objects archived under a prefix to audit delivery, reporting the
+// records missing from or duplicated in every partition.
+type Verifier struct {
+	S3     *s3.S3
+	Bucket string
+	Prefix string
+	// KeyRing decrypts the objects written with client-side encryption, if any.
+	KeyRing *KeyRing
+	// From and To optionally restrict the verification to rotated objects of windows starting
+	// in that range. Objects not rotated hold all the events of their partition, they are
+	// verified if modified after From.
+	From time.Time
+	To   time.Time
+	// SequenceStamp must be set if the objects were written with S3LoggerFactory.SequenceStamp.
+	// Stamps are then removed from records, and gaps and repeats in the sequence numbers are
+	// reported as missing and duplicate records.
+	SequenceStamp bool
+	// PartitionKeyFunc and KeySanitizer are those of the router, needed by VerifyEvents.
+	// KeySanitizer defaults to SanitizeKey.
+	PartitionKeyFunc func([]byte) (string, error)
+	KeySanitizer     func(string) string
+	// ShardPrefixLength must be set if the objects were written with
+	// S3LoggerFactory.ShardPrefixLength, for partitions to be told apart from hash prefixes.
+	ShardPrefixLength int
+}
+
+// VerifyReport is the result of the verification of a partition.
+type VerifyReport struct {
+	Partition string
+	// Expected and Archived are the number of records expected and found.
+	Expected int
+	Archived int
+	// Missing and Duplicates are the number of records expected but not found, and found more
+	// than once.
+	Missing    int
+	Duplicates int
+}
+
+// VerifyCounts compares the records archived to the number of records expected per partition.
+// Records archived more than once are counted as duplicates, which must be unique for that,
+// e.g. having an id, unless SequenceStamp is set.
+func (v *Verifier) VerifyCounts(expected map[string]int) ([]VerifyReport, error) {
+	archived, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := map[string]*VerifyReport{}
+	for partition, n := range expected {
+		reports[partition] = &VerifyReport{Partition: partition, Expected: n}
+	}
+	for partition, a := range archived {
+		r := reports[partition]
+		if r == nil {
+			r = &VerifyReport{Partition: partition}
+			reports[partition] = r
+		}
+		r.Archived = len(a.records)
+		r.Duplicates = a.duplicates()
+		if missing := r.Expected - (r.Archived - r.Duplicates); missing > 0 {
+			r.Missing = missing
+		}
+		if gaps := a.gaps(); gaps > r.Missing {
+			r.Missing = gaps
+		}
+	}
+	for _, r := range reports {
+		if _, found := archived[r.Partition]; !found {
+			r.Missing = r.Expected
+		}
+	}
+	return sortReports(reports), nil
+}
+
+// VerifyEvents compares the records archived to the events returned by next until it returns
+// false, e.g. read from the source of the events. It requires the PartitionKeyFunc. Events
+// whose key can't be determined are skipped.
+func (v *Verifier) VerifyEvents(next func() ([]byte, bool)) ([]VerifyReport, error) {
+	sanitize := v.KeySanitizer
+	if sanitize == nil {
+		sanitize = laozi.SanitizeKey
+	}
+	expected := map[string]map[string]int{}
+	for e, ok := next(); ok; e, ok = next() {
+		key, err := v.PartitionKeyFunc(e)
+		if err != nil {
+			continue
+		}
+		key = sanitize(key)
+		if expected[key] == nil {
+			expected[key] = map[string]int{}
+		}
+		expected[key][string(e)]++
+	}
+
+	archived, err := v.read()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := map[string]*VerifyReport{}
+	for partition, events := range expected {
+		r := &VerifyReport{Partition: partition}
+		reports[partition] = r
+		found := archived[partition].counts()
+		for e, n := range events {
+			r.Expected += n
+			if found[e] < n {
+				r.Missing += n - found[e]
+			}
+		}
+	}
+	for partition, a := range archived {
+		r := reports[partition]
+		if r == nil {
+			r = &VerifyReport{Partition: partition}
+			reports[partition] = r
+		}
+		r.Archived = len(a.records)
+		for e, n := range a.counts() {
+			if want := expected[partition][e]; n > want && want > 0 {
+				r.Duplicates += n - want
+			}
+		}
+		if gaps := a.gaps(); gaps > r.Missing {
+			r.Missing = gaps
+		}
+	}
+	return sortReports(reports), nil
+}
+
+// archivedPartition holds the records read back of a partition.
+type archivedPartition struct {
+	records   [][]byte
+	sequences []int64
+}
+
+// counts returns the number of times every record was archived.
+func (a *archivedPartition) counts() map[string]int {
+	counts := map[string]int{}
+	if a == nil {
+		return counts
+	}
+	for _, r := range a.records {
+		counts[string(r)]++
+	}
+	return counts
+}
+
+// duplicates returns the number of records archived more than once, by sequence number if
+// stamped.
+func (a *archivedPartition) duplicates() int {
+	n := 0
+	if len(a.sequences) > 0 {
+		seen := map[int64]bool{}
+		for _, seq := range a.sequences {
+			if seen[seq] {
+				n++
+			}
+			seen[seq] = true
+		}
+		return n
+	}
+	for _, count := range a.counts() {
+		n += count - 1
+	}
+	return n
+}
+
+// gaps returns the number of sequence numbers missing between the first and last stamped.
+func (a *archivedPartition) gaps() int {
+	if len(a.sequences) == 0 {
+		return 0
+	}
+	seen := map[int64]bool{}
+	first, last := a.sequences[0], a.sequences[0]
+	for _, seq := range a.sequences {
+		seen[seq] = true
+		if seq < first {
+			first = seq
+		}
+		if seq > last {
+			last = seq
+		}
+	}
+	return int(last-first+1) - len(seen)
+}
+
+// read returns the records archived under the prefix by partition.
+func (v *Verifier) read() (map[string]*archivedPartition, error) {
+	var keys []string
+	err := v.S3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(v.Bucket),
+		Prefix: aws.String(v.Prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			if aws.StringValue(o.Key) == v.Prefix+shardManifestName {
+				continue
+			}
+			if v.includes(aws.StringValue(o.Key), aws.TimeValue(o.LastModified)) {
+				keys = append(keys, aws.StringValue(o.Key))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := map[string]*archivedPartition{}
+	for _, key := range keys {
+		data, err := readArchive(v.S3, v.Bucket, key, v.KeyRing)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %s", key, err)
+		}
+		partition, _, _ := v.partition(key)
+		a := partitions[partition]
+		if a == nil {
+			a = &archivedPartition{}
+			partitions[partition] = a
+		}
+		for _, record := range splitRecords(data) {
+			if v.SequenceStamp {
+				if seq, event, ok := ParseSequenceStamp(record); ok {
+					a.sequences = append(a.sequences, seq)
+					record = event
+				}
+			}
+			a.records = append(a.records, record)
+		}
+	}
+	return partitions, nil
+}
+
+// partition returns the partition of an object key and the start of its window if rotated.
+func (v *Verifier) partition(key string) (string, time.Time, bool) {
+	name := trimShardPrefix(strings.TrimPrefix(key, v.Prefix), v.ShardPrefixLength)
+	if _, ok := rotating.ParseSequenceRange(name); ok {
+		parts := strings.Split(name, "/")
+		if len(parts) >= 3 {
+			if start, err := time.Parse(rotating.WindowFormat, parts[len(parts)-2]); err == nil {
+				return strings.Join(parts[:len(parts)-2], "/"), start, true
+			}
+		}
+	}
+	return name, time.Time{}, false
+}
+
+// includes reports whether an object is in the time range verified.
+func (v *Verifier) includes(key string, modified time.Time) bool {
+	_, start, rotated := v.partition(key)
+	if !rotated {
+		return v.From.IsZero() || !modified.Before(v.From)
+	}
+	return (v.From.IsZero() || !start.Before(v.From)) && (v.To.IsZero() || start.Before(v.To))
+}
+
+func sortReports(reports map[string]*VerifyReport) []VerifyReport {
+	var sorted []VerifyReport
+	for _, r := range reports {
+		sorted = append(sorted, *r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Partition < sorted[j].Partition })
+	return sorted
+}
@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTestVerifier(t *testing.T) *Verifier {
+	m := &mockS3{objects: map[string][]byte{
+		"/bucket/logs/a": []byte("1\n2\n2\n"),
+		"/bucket/logs/b/20260101T000000Z/" + rotating.SequenceRange(1, 2): []byte("1\tx\n2\ty\n"),
+		"/bucket/logs/b/20260101T000000Z/" + rotating.SequenceRange(4, 4): []byte("4\tz\n"),
+		"/bucket/logs/b/20250101T000000Z/" + rotating.SequenceRange(1, 1): []byte("1\told\n"),
+	}}
+	lf := makeTestS3Factory(t, m)
+	return &Verifier{
+		S3:            s3.New(session.New(), lf.s3Config()),
+		Bucket:        "bucket",
+		Prefix:        "logs/",
+		From:          time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		SequenceStamp: true,
+	}
+}
+
+func TestVerifierVerifiesCounts(t *testing.T) {
+	assert := assert.New(t)
+
+	v := makeTestVerifier(t)
+	reports, err := v.VerifyCounts(map[string]int{"a": 4, "b": 4, "c": 1})
+	assert.NoError(err)
+
+	assert.Equal([]VerifyReport{
+		{Partition: "a", Expected: 4, Archived: 3, Missing: 2, Duplicates: 1},
+		{Partition: "b", Expected: 4, Archived: 3, Missing: 1},
+		{Partition: "c", Expected: 1, Missing: 1},
+	}, reports)
+}
+
+func TestVerifierVerifiesEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	v := makeTestVerifier(t)
+	v.PartitionKeyFunc = func(e []byte) (string, error) {
+		if e[0] >= 'x' {
+			return "b", nil
+		}
+		return "a", nil
+	}
+	source := [][]byte{[]byte("1\n"), []byte("2\n"), []byte("3\n"), []byte("x\n"), []byte("y\n")}
+	next := func() ([]byte, bool) {
+		if len(source) == 0 {
+			return nil, false
+		}
+		e := source[0]
+		source = source[1:]
+		return e, true
+	}
+
+	reports, err := v.VerifyEvents(next)
+	assert.NoError(err)
+
+	assert.Equal([]VerifyReport{
+		{Partition: "a", Expected: 3, Archived: 3, Missing: 1, Duplicates: 1},
+		{Partition: "b", Expected: 2, Archived: 3, Missing: 1},
+	}, reports)
+}
@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// VersionedReader reads archived partitions as they were at a point in time, in buckets with
+// versioning enabled, so replays aren't affected by later overwrites, e.g. appends or previous
+// data discarded by a restarted archiver, nor by deletions. Objects are read decompressed and
+// decrypted as loggers wrote them.
+type VersionedReader struct {
+	S3     *s3.S3
+	Bucket string
+	Prefix string
+	// KeyRing decrypts the objects written with client-side encryption, if any.
+	KeyRing *KeyRing
+	// ShardPrefixLength must be set if the objects were written with
+	// S3LoggerFactory.ShardPrefixLength.
+	ShardPrefixLength int
+}
+
+// ReadAsOf returns the events of a partition as of t: those of its object, or of its rotated
+// objects in key order, in the versions that were current at t.
+func (v *VersionedReader) ReadAsOf(partition string, t time.Time) ([]byte, error) {
+	base := v.Prefix + ShardPrefix(partition, v.ShardPrefixLength) + partition
+	current := map[string]*s3.ObjectVersion{}
+	consider := func(key string, version *s3.ObjectVersion, modified time.Time) {
+		if (key != base && !strings.HasPrefix(key, base+"/")) || modified.After(t) {
+			return
+		}
+		if c, ok := current[key]; ok && aws.TimeValue(c.LastModified).After(modified) {
+			return
+		}
+		current[key] = version
+	}
+	err := v.S3.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(v.Bucket),
+		Prefix: aws.String(base),
+	}, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+		for _, o := range page.Versions {
+			consider(aws.StringValue(o.Key), o, aws.TimeValue(o.LastModified))
+		}
+		for _, m := range page.DeleteMarkers {
+			// deleted objects have no current version
+			consider(aws.StringValue(m.Key), &s3.ObjectVersion{LastModified: m.LastModified}, aws.TimeValue(m.LastModified))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, version := range current {
+		if version.VersionId != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var events []byte
+	for _, key := range keys {
+		data, err := v.ReadVersion(key, aws.StringValue(current[key].VersionId))
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, data...)
+	}
+	return events, nil
+}
+
+// ReadVersion returns the events of a version of an object, e.g. the one of a Checkpoint.
+func (v *VersionedReader) ReadVersion(key, versionID string) ([]byte, error) {
+	return readArchiveVersion(v.S3, v.Bucket, key, versionID, v.KeyRing)
+}
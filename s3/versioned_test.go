@@ -0,0 +1,105 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/stretchr/testify/assert"
+)
+
+// versionedS3 serves the versions of the objects of a versioned bucket, by version id.
+type versionedS3 struct {
+	versions      []mockVersion
+	deleteMarkers []mockVersion
+}
+
+type mockVersion struct {
+	key, id, data string
+	modified      time.Time
+}
+
+func (m *versionedS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.URL.Query()["versions"]; ok {
+		fmt.Fprint(w, `<ListVersionsResult>`)
+		for _, v := range m.versions {
+			fmt.Fprintf(w, `<Version><Key>%s</Key><VersionId>%s</VersionId><LastModified>%s</LastModified></Version>`,
+				v.key, v.id, v.modified.Format(time.RFC3339))
+		}
+		for _, v := range m.deleteMarkers {
+			fmt.Fprintf(w, `<DeleteMarker><Key>%s</Key><VersionId>%s</VersionId><LastModified>%s</LastModified></DeleteMarker>`,
+				v.key, v.id, v.modified.Format(time.RFC3339))
+		}
+		fmt.Fprint(w, `</ListVersionsResult>`)
+		return
+	}
+	for _, v := range m.versions {
+		if "/bucket/"+v.key == r.URL.Path && v.id == r.URL.Query().Get("versionId") {
+			fmt.Fprint(w, v.data)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestVersionedReaderReadsAsOf(t *testing.T) {
+	assert := assert.New(t)
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &versionedS3{
+		versions: []mockVersion{
+			{"logs/a", "1", "old\n", t0},
+			{"logs/a", "2", "old\nnew\n", t0.Add(time.Hour)},
+			{"logs/a/2020/1-1", "3", "rotated\n", t0},
+			{"logs/ab", "4", "other\n", t0},
+			{"logs/a/2020/2-2", "5", "deleted\n", t0},
+		},
+		deleteMarkers: []mockVersion{{"logs/a/2020/2-2", "6", "", t0.Add(time.Hour)}},
+	}
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	v := &VersionedReader{
+		S3: s3.New(session.New(), &aws.Config{
+			Region:           aws.String("us-east-1"),
+			Endpoint:         aws.String(srv.URL),
+			S3ForcePathStyle: aws.Bool(true),
+			Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		}),
+		Bucket: "bucket",
+		Prefix: "logs/",
+	}
+
+	events, err := v.ReadAsOf("a", t0.Add(time.Minute))
+	assert.NoError(err)
+	assert.Equal("old\nrotated\ndeleted\n", string(events))
+
+	events, err = v.ReadAsOf("a", t0.Add(2*time.Hour))
+	assert.NoError(err)
+	assert.Equal("old\nnew\nrotated\n", string(events))
+
+	events, err = v.ReadVersion("logs/a", "1")
+	assert.NoError(err)
+	assert.Equal("old\n", string(events))
+}
+
+func TestS3LoggerCheckpointsVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	cp := &MockCheckpointer{checkpoints: map[string]laozi.Checkpoint{}}
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.Checkpointer = cp
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	assert.NotEmpty(cp.checkpoints["a"].VersionID)
+}
@@ -0,0 +1,67 @@
+package s3
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// windowBuffer holds the events of a past rotation window, sealed once an event of a later
+// window was logged, until flushed, see S3LoggerFactory.WindowBuffers.
+type windowBuffer struct {
+	data []byte
+	// start is when the first event was logged, sequence the number of the last event, and
+	// batchID the id of the object key once generated
+	start    time.Time
+	sequence int64
+	batchID  string
+}
+
+// sliceWindow seals the buffer if it holds events of a rotation window before the current one,
+// for the events about to be logged to go to an object of their own window.
+func (l *s3logger) sliceWindow() {
+	if !l.windowBuffers || l.batchStart.IsZero() || l.buffer.Len() <= l.persisted {
+		return
+	}
+	if !time.Now().Truncate(l.rotation).After(l.batchStart.Truncate(l.rotation)) {
+		return
+	}
+	l.sealed = append(l.sealed, windowBuffer{
+		data:     append([]byte(nil), l.buffer.Bytes()[l.persisted:]...),
+		start:    l.batchStart,
+		sequence: l.sequence,
+		batchID:  l.batchID,
+	})
+	l.buffer.Reset()
+	l.persisted = 0
+	l.batchStart = time.Time{}
+	l.batchID = ""
+}
+
+// flushSealed flushes the sealed windows in order, swapping them in the buffer one at a time,
+// and stops at the first that fails so objects keep consecutive sequence ranges.
+func (l *s3logger) flushSealed(ctx aws.Context) error {
+	for len(l.sealed) > 0 {
+		w := &l.sealed[0]
+		buffer, start, sequence, batchID := l.buffer, l.batchStart, l.sequence, l.batchID
+		l.buffer, l.batchStart, l.sequence, l.batchID = newMemoryBuffer(w.data), w.start, w.sequence, w.batchID
+		err := l.flushBuffer(ctx)
+		// retries target the same key
+		w.batchID = l.batchID
+		l.buffer, l.batchStart, l.sequence, l.batchID = buffer, start, sequence, batchID
+		if err != nil {
+			return err
+		}
+		l.sealed = l.sealed[1:]
+	}
+	return nil
+}
+
+// sealedBytes returns the events of the sealed windows, the oldest first.
+func (l *s3logger) sealedBytes() []byte {
+	var data []byte
+	for _, w := range l.sealed {
+		data = append(data, w.data...)
+	}
+	return data
+}
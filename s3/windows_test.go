@@ -0,0 +1,67 @@
+package s3
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3LoggerBuffersWindowsApart(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+	lf.WindowBuffers = true
+
+	l := lf.newS3Logger("a")
+	now := time.Now()
+	l.add([]byte("a\n"))
+	l.add([]byte("b\n"))
+	l.batchStart = now.Add(-time.Hour)
+	l.add([]byte("c\n"))
+	assert.Len(l.sealed, 1)
+	assert.Equal([]byte("a\nb\nc\n"), l.Buffered())
+	assert.Equal([][]byte{[]byte("a\nb\n"), []byte("c\n")}, l.unpersisted())
+	l.storeBuffered()
+	assert.Equal(int64(6), l.State().BufferedBytes)
+
+	// the sealed window is kept until it is flushed
+	assert.Error(l.flush())
+	assert.Len(l.sealed, 1)
+	assert.Empty(m.objects)
+
+	m.failPuts = false
+	assert.NoError(l.flush())
+	assert.Empty(l.sealed)
+	assert.Equal(map[string][]byte{
+		"/bucket/" + rotating.Name("a", now.Add(-time.Hour), time.Hour, 1, 2): []byte("a\nb\n"),
+		"/bucket/" + rotating.Name("a", now, time.Hour, 3, 3):                 []byte("c\n"),
+	}, m.objects)
+	assert.Equal(int64(3), l.flushedSequence)
+
+	assert.Panics(func() {
+		lf.RotationInterval = 0
+		lf.NewLogger("a")
+	})
+}
+
+func TestS3LoggerWithoutWindowBuffersMixesWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3Factory(t, m)
+	lf.RotationInterval = time.Hour
+
+	l := lf.newS3Logger("a")
+	start := time.Now().Add(-time.Hour)
+	l.add([]byte("a\n"))
+	l.batchStart = start
+	l.add([]byte("b\n"))
+	assert.NoError(l.flush())
+	assert.Equal(map[string][]byte{
+		"/bucket/" + rotating.Name("a", start, time.Hour, 1, 2): []byte("a\nb\n"),
+	}, m.objects)
+}
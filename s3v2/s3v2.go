@@ -0,0 +1,262 @@
+// Package s3v2 archives the partitions of a laozi router to S3 with aws-sdk-go-v2.
+package s3v2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+)
+
+const maxRetries = 10
+
+// S3V2LoggerFactory makes loggers writing partitions to S3 with aws-sdk-go-v2, configured by an
+// aws.Config of the v2 SDK, e.g. from config.LoadDefaultConfig. It has the basic settings of
+// s3.S3LoggerFactory, which keeps using aws-sdk-go v1: each partition is an object of the key,
+// overwritten on every flush, and loggers start with the previous data of their key.
+type S3V2LoggerFactory struct {
+	Config           awsv2.Config
+	Bucket           string
+	Prefix           string
+	FlushInterval    time.Duration
+	Compression      string
+	SkipPreviousData bool
+	// UsePathStyle addresses buckets in the path of requests, for s3-compatible services.
+	UsePathStyle bool
+	// Client optionally is the S3 client shared by the loggers, e.g. made once with
+	// s3.NewFromConfig, instead of one per logger made from Config and UsePathStyle.
+	Client *s3v2.Client
+}
+
+// NewLogger return a new instance of an S3 Logger for a corresponding partition key. If the
+// previous data of the key can't be fetched, its flushes fail with *ErrPreviousData rather
+// than overwrite it.
+func (lf S3V2LoggerFactory) NewLogger(key string) laozi.Logger {
+	l, err := lf.newLogger(context.Background(), key)
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not fetch previous data, flushes will fail: %s: %s\n", key, err)
+		l.conflict = &laozi.ErrPreviousData{Key: l.key, Cause: err}
+	}
+	go l.loop()
+	return l
+}
+
+// NewLoggerContext is NewLogger failing if the previous data of the key exists but could not
+// be fetched before ctx is done, instead of starting without it.
+func (lf S3V2LoggerFactory) NewLoggerContext(ctx context.Context, key string) (laozi.Logger, error) {
+	l, err := lf.newLogger(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	go l.loop()
+	return l, nil
+}
+
+// newLogger makes the logger of a key loaded with its previous data, without starting its
+// loop. It returns the error of fetching the previous data along with a logger starting
+// without it.
+func (lf S3V2LoggerFactory) newLogger(ctx context.Context, key string) (*s3v2logger, error) {
+	l := &s3v2logger{
+		S3:               lf.s3Client(),
+		bucket:           lf.Bucket,
+		key:              fmt.Sprintf("%s%s", lf.Prefix, key),
+		buffer:           bytes.NewBuffer([]byte{}),
+		active:           time.Now(),
+		logChan:          make(chan []byte),
+		quitChan:         make(chan struct{}),
+		stopped:          make(chan struct{}),
+		compression:      lf.Compression,
+		flushInterval:    lf.FlushInterval,
+		bufferedRequests: make(chan chan []byte),
+	}
+
+	if lf.SkipPreviousData {
+		return l, nil
+	}
+	return l, l.fetchPreviousData(ctx)
+}
+
+// s3Client returns the S3 client of a logger of the factory.
+func (lf S3V2LoggerFactory) s3Client() *s3v2.Client {
+	if lf.Client != nil {
+		return lf.Client
+	}
+	return s3v2.NewFromConfig(lf.Config, func(o *s3v2.Options) {
+		o.UsePathStyle = lf.UsePathStyle
+	})
+}
+
+// s3v2logger is the logger of S3V2LoggerFactory.
+type s3v2logger struct {
+	S3            *s3v2.Client
+	bucket        string
+	key           string
+	buffer        *bytes.Buffer
+	active        time.Time
+	logChan       chan []byte
+	quitChan      chan struct{}
+	compression   string
+	flushInterval time.Duration
+	// conflict fails flushes, if the previous data could not be fetched
+	conflict error
+	// bufferedRequests receives the calls to Buffered while the loop runs, and stopped is
+	// closed once it returned
+	bufferedRequests chan chan []byte
+	stopped          chan struct{}
+}
+
+// Log causes event event to br written to internal memory buffer.
+func (l *s3v2logger) Log(e []byte) {
+	l.logChan <- e
+	l.active = time.Now()
+}
+
+func (l *s3v2logger) loop() {
+	defer close(l.stopped)
+	var flushChan <-chan time.Time
+	if l.flushInterval > 0 {
+		t := time.NewTicker(l.flushInterval)
+		defer t.Stop()
+		flushChan = t.C
+	}
+
+	for {
+		select {
+		case <-flushChan:
+			l.flush(context.Background())
+		case e := <-l.logChan:
+			l.buffer.Write(e)
+		case done := <-l.bufferedRequests:
+			done <- append([]byte(nil), l.buffer.Bytes()...)
+		case <-l.quitChan:
+			return
+		}
+	}
+}
+
+// Close is called when logger timeouts. Will cause internal memory buffer to be written to s3.
+func (l *s3v2logger) Close() error {
+	l.quitChan <- struct{}{}
+	return l.flush(context.Background())
+}
+
+// LastActive returns the last time the logger was used.
+func (l *s3v2logger) LastActive() time.Time {
+	return l.active
+}
+
+// Buffered returns the content of the buffer, i.e. the whole object.
+func (l *s3v2logger) Buffered() []byte {
+	done := make(chan []byte, 1)
+	select {
+	case l.bufferedRequests <- done:
+		return <-done
+	case <-l.stopped:
+		return append([]byte(nil), l.buffer.Bytes()...)
+	}
+}
+
+func (l *s3v2logger) flush(ctx context.Context) error {
+	if l.conflict != nil {
+		return l.conflict
+	}
+	body := compress.Compress(l.compression, l.buffer.Bytes())
+
+	var err error
+	attempts := 0
+	// retry write to s3 for max tries
+	for i := 0; i < maxRetries; i++ {
+		_, err = l.S3.PutObject(ctx, &s3v2.PutObjectInput{
+			Bucket: awsv2.String(l.bucket),
+			Key:    awsv2.String(l.key),
+			Body:   bytes.NewReader(body),
+		}, countAttemptsV2(&attempts))
+		if err == nil {
+			return nil
+		}
+	}
+	return s3V2Error("PutObject", l.bucket, l.key, attempts, err)
+}
+
+// fetchPreviousData fetches the previous data of the key, if any.
+func (l *s3v2logger) fetchPreviousData(ctx context.Context) error {
+	attempts := 0
+	resp, err := l.S3.GetObject(ctx, &s3v2.GetObjectInput{
+		Bucket: awsv2.String(l.bucket),
+		Key:    awsv2.String(l.key),
+	}, countAttemptsV2(&attempts))
+	var rerr *awshttp.ResponseError
+	if errors.As(err, &rerr) && rerr.HTTPStatusCode() == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return s3V2Error("GetObject", l.bucket, l.key, attempts, err)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if compress.IsGzip(data) {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if data, err = ioutil.ReadAll(gr); err != nil {
+			return err
+		}
+		// keep the object compressed, appending plain data to it would corrupt it
+		l.compression = "gzip"
+	}
+	l.buffer.Write(data)
+	return nil
+}
+
+// s3V2Error wraps the error of an S3 request of aws-sdk-go-v2, if it is one.
+func s3V2Error(op, bucket, key string, attempts int, err error) error {
+	var aerr smithy.APIError
+	var rerr *awshttp.ResponseError
+	if !errors.As(err, &aerr) && !errors.As(err, &rerr) {
+		return err
+	}
+	e := &laozi.ErrS3{Op: op, Bucket: bucket, Key: key, Attempts: attempts, Cause: err}
+	if aerr != nil {
+		e.Code = aerr.ErrorCode()
+	}
+	if errors.As(err, &rerr) {
+		e.StatusCode = rerr.HTTPStatusCode()
+		e.RequestID = rerr.ServiceRequestID()
+	}
+	var herr interface{ ServiceHostID() string }
+	if errors.As(err, &herr) {
+		e.HostID = herr.ServiceHostID()
+	}
+	return e
+}
+
+// countAttemptsV2 adds to n how many times a request of aws-sdk-go-v2 was sent.
+func countAttemptsV2(n *int) func(*s3v2.Options) {
+	return func(o *s3v2.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("countAttempts",
+				func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+					middleware.FinalizeOutput, middleware.Metadata, error) {
+					*n++
+					return next.HandleFinalize(ctx, in)
+				}), middleware.After)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package s3v2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	credentialsv2 "github.com/aws/aws-sdk-go-v2/credentials"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockS3 is a minimal S3 API storing objects in memory.
+type mockS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+	// failPuts makes uploads fail as forbidden, and failGets downloads
+	failPuts bool
+	failGets bool
+}
+
+func (m *mockS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m.Lock()
+		defer m.Unlock()
+		if m.failGets {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+			return
+		}
+		data, ok := m.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		w.Write(data)
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		m.Lock()
+		defer m.Unlock()
+		if m.failPuts {
+			w.Header().Set("X-Amz-Request-Id", "request-id")
+			w.Header().Set("X-Amz-Id-2", "host-id")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<Error><Code>AccessDenied</Code></Error>`)
+			return
+		}
+		m.objects[r.URL.Path] = data
+	}
+}
+
+func makeTestS3V2Factory(t *testing.T, m *mockS3) S3V2LoggerFactory {
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return S3V2LoggerFactory{
+		Config: awsv2.Config{
+			Region:                     "us-east-1",
+			BaseEndpoint:               awsv2.String(srv.URL),
+			Credentials:                awsv2.NewCredentialsCache(credentialsv2.NewStaticCredentialsProvider("id", "secret", "")),
+			RequestChecksumCalculation: awsv2.RequestChecksumCalculationWhenRequired,
+			ResponseChecksumValidation: awsv2.ResponseChecksumValidationWhenRequired,
+		},
+		Bucket:       "bucket",
+		UsePathStyle: true,
+	}
+}
+
+func TestS3V2LoggerAppendsToPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}}
+	lf := makeTestS3V2Factory(t, m)
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	assert.NoError(l.Close())
+
+	assert.Equal([]byte("old\nnew\n"), m.objects["/bucket/a"])
+}
+
+func TestS3V2LoggerCompresses(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3V2Factory(t, m)
+	lf.Compression = "gzip"
+	lf.Prefix = "events/"
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("event\n"))
+	assert.NoError(l.Close())
+	assert.True(compress.IsGzip(m.objects["/bucket/events/a"]))
+
+	l = lf.NewLogger("a")
+	assert.Equal([]byte("event\n"), l.(*s3v2logger).Buffered())
+	assert.NoError(l.Close())
+}
+
+func TestS3V2LoggerErrorsHoldS3RequestIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}, failPuts: true}
+	lf := makeTestS3V2Factory(t, m)
+	lf.SkipPreviousData = true
+
+	l := lf.NewLogger("a")
+	l.Log([]byte("event\n"))
+	err := l.Close()
+
+	var s3Err *laozi.ErrS3
+	if assert.True(errors.As(err, &s3Err)) {
+		assert.Equal(403, s3Err.StatusCode)
+		assert.Equal("AccessDenied", s3Err.Code)
+		assert.Equal("request-id", s3Err.RequestID)
+		assert.Equal("host-id", s3Err.HostID)
+		assert.Equal(maxRetries, s3Err.Attempts)
+	}
+}
+
+func TestS3V2LoggersShareClients(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{}}
+	lf := makeTestS3V2Factory(t, m)
+	lf.SkipPreviousData = true
+
+	a, b := lf.NewLogger("a"), lf.NewLogger("b")
+	assert.NotSame(a.(*s3v2logger).S3, b.(*s3v2logger).S3)
+	assert.NoError(a.Close())
+	assert.NoError(b.Close())
+
+	lf.Client = s3v2.NewFromConfig(lf.Config, func(o *s3v2.Options) { o.UsePathStyle = true })
+	a, b = lf.NewLogger("a"), lf.NewLogger("b")
+	assert.Same(lf.Client, a.(*s3v2logger).S3)
+	assert.Same(lf.Client, b.(*s3v2logger).S3)
+	a.Log([]byte("event\n"))
+	assert.NoError(a.Close())
+	assert.NoError(b.Close())
+	assert.Equal([]byte("event\n"), m.objects["/bucket/a"])
+}
+
+func TestS3V2LoggerFailsWithoutPreviousData(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &mockS3{objects: map[string][]byte{"/bucket/a": []byte("old\n")}, failGets: true}
+	lf := makeTestS3V2Factory(t, m)
+
+	l, err := lf.NewLoggerContext(context.Background(), "a")
+	assert.Error(err)
+	assert.Nil(l)
+
+	// without a context, flushes fail rather than overwrite the previous data
+	l = lf.NewLogger("a")
+	l.Log([]byte("new\n"))
+	var prev *laozi.ErrPreviousData
+	assert.True(errors.As(l.Close(), &prev))
+	assert.Equal([]byte("old\n"), m.objects["/bucket/a"])
+}
@@ -0,0 +1,20 @@
+package laozi
+
+import (
+	"math/rand"
+	"regexp"
+)
+
+// SamplingRecorder is implemented by loggers that keep count of the events of their partition
+// that were sampled out.
+type SamplingRecorder interface {
+	RecordSampledOut(n int64)
+}
+
+// SampleKeys returns a SamplingFunc keeping roughly a rate (from 0 to 1) of the events whose
+// partition key matches the pattern, and all other events.
+func SampleKeys(pattern *regexp.Regexp, rate float64) func(key string, e []byte) bool {
+	return func(key string, e []byte) bool {
+		return !pattern.MatchString(key) || rand.Float64() < rate
+	}
+}
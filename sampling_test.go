@@ -0,0 +1,68 @@
+package laozi
+
+import (
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSampledLogger struct {
+	MockLogger
+	sampledOut int64
+}
+
+func (m *MockSampledLogger) RecordSampledOut(n int64) {
+	atomic.AddInt64(&m.sampledOut, n)
+}
+
+type MockSampledLoggerFactory struct{}
+
+func (mf *MockSampledLoggerFactory) NewLogger(file string) Logger {
+	return &MockSampledLogger{MockLogger: MockLogger{fileName: file}}
+}
+
+func TestSampleKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	none := SampleKeys(regexp.MustCompile("^debug/"), 0)
+	assert.False(none("debug/a", nil))
+	assert.True(none("audit/a", nil))
+
+	all := SampleKeys(regexp.MustCompile("^debug/"), 1)
+	assert.True(all("debug/a", nil))
+}
+
+func TestRouterSamplesEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockSampledLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			SamplingFunc:     SampleKeys(regexp.MustCompile("^2$"), 0),
+		},
+	}
+	go l.route()
+
+	l.EventChan <- []byte("1")
+	l.EventChan <- []byte("2")
+	l.EventChan <- []byte("2")
+	l.EventChan <- []byte("1")
+
+	l.awaitRouted(4)
+
+	l.Lock()
+	defer l.Unlock()
+	kept := l.routingMap["1"].(*MockSampledLogger)
+	dropped := l.routingMap["2"].(*MockSampledLogger)
+	assert.Equal([]byte("11"), kept.bytes)
+	assert.Equal(int64(0), atomic.LoadInt64(&kept.sampledOut))
+	assert.Equal(0, len(dropped.bytes))
+	assert.Equal(int64(2), atomic.LoadInt64(&dropped.sampledOut))
+}
@@ -0,0 +1,224 @@
+// Package sftp uploads the partitions of a laozi router to an SFTP server as rotated files.
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/sftp"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultSFTPPoolSize = 4
+	defaultSFTPRotation = time.Hour
+)
+
+// SFTPPool is a pool of SFTP connections to a server, shared by the loggers of a factory.
+type SFTPPool struct {
+	dial  func() (*sftp.Client, error)
+	idle  chan *sftp.Client
+	slots chan struct{}
+}
+
+// NewSFTPPool returns a pool opening at most size connections to the SSH server at addr.
+func NewSFTPPool(addr string, config *ssh.ClientConfig, size int) *SFTPPool {
+	return newSFTPPool(func() (*sftp.Client, error) {
+		conn, err := ssh.Dial("tcp", addr, config)
+		if err != nil {
+			return nil, err
+		}
+		c, err := sftp.NewClient(conn)
+		if err != nil {
+			conn.Close()
+		}
+		return c, err
+	}, size)
+}
+
+func newSFTPPool(dial func() (*sftp.Client, error), size int) *SFTPPool {
+	if size <= 0 {
+		size = defaultSFTPPoolSize
+	}
+	return &SFTPPool{
+		dial:  dial,
+		idle:  make(chan *sftp.Client, size),
+		slots: make(chan struct{}, size),
+	}
+}
+
+// get returns an idle connection or opens a new one, waiting if the pool is exhausted.
+func (p *SFTPPool) get() (*sftp.Client, error) {
+	p.slots <- struct{}{}
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	c, err := p.dial()
+	if err != nil {
+		<-p.slots
+	}
+	return c, err
+}
+
+// put gives a connection back, closing it if it failed as it may be broken.
+func (p *SFTPPool) put(c *sftp.Client, err error) {
+	if err != nil {
+		c.Close()
+	} else {
+		p.idle <- c
+	}
+	<-p.slots
+}
+
+// Close closes the idle connections of the pool.
+func (p *SFTPPool) Close() error {
+	for {
+		select {
+		case c := <-p.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// SFTPLoggerFactory is a logger factory for creating loggers that upload received events to
+// an SFTP server. Every flush uploads a new file holding the events logged since the previous
+// one, named like rotated S3 objects: <Dir><key>/<window>/<first>-<last>. Files are written
+// under a temporary name and renamed once complete, so readers never see partial files.
+type SFTPLoggerFactory struct {
+	Pool          *SFTPPool
+	Dir           string
+	FlushInterval time.Duration
+	// RotationInterval is the length of the windows files are grouped by, defaults to an hour.
+	RotationInterval time.Duration
+	Compression      string
+}
+
+// NewLogger returns a new instance of an SFTP logger for a corresponding partition key. If the
+// files of the partition can't be listed to resume its sequence, its flushes fail.
+func (lf SFTPLoggerFactory) NewLogger(key string) laozi.Logger {
+	return lf.writer(key).NewLogger(key, lf.FlushInterval)
+}
+
+// NewLoggerContext is NewLogger failing if the files of the partition can't be listed. The
+// listing isn't cancelled with ctx.
+func (lf SFTPLoggerFactory) NewLoggerContext(ctx context.Context, key string) (laozi.Logger, error) {
+	l, err := lf.writer(key).Start(key, lf.FlushInterval)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// writer returns the writer of the files of a partition key.
+func (lf SFTPLoggerFactory) writer(key string) *rotating.Writer {
+	rotation := lf.RotationInterval
+	if rotation <= 0 {
+		rotation = defaultSFTPRotation
+	}
+	return &rotating.Writer{
+		FS:          lf.Pool,
+		Name:        fmt.Sprintf("%s%s", lf.Dir, key),
+		Rotation:    rotation,
+		Compression: lf.Compression,
+	}
+}
+
+// Exists reports whether a file exists on the server.
+func (p *SFTPPool) Exists(name string) (bool, error) {
+	c, err := p.get()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = c.Stat(name)
+	if os.IsNotExist(err) {
+		p.put(c, nil)
+		return false, nil
+	}
+	p.put(c, err)
+	return err == nil, err
+}
+
+// WriteFile creates a file and its parent directories on the server.
+func (p *SFTPPool) WriteFile(name string, data []byte) error {
+	c, err := p.get()
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		if err := c.MkdirAll(path.Dir(name)); err != nil {
+			return err
+		}
+		f, err := c.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}()
+	p.put(c, err)
+	return err
+}
+
+func (p *SFTPPool) ReadFile(name string) ([]byte, error) {
+	c, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := func() ([]byte, error) {
+		f, err := c.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ioutil.ReadAll(f)
+	}()
+	p.put(c, err)
+	return data, err
+}
+
+func (p *SFTPPool) Rename(from, to string) error {
+	c, err := p.get()
+	if err != nil {
+		return err
+	}
+
+	err = c.Rename(from, to)
+	p.put(c, err)
+	return err
+}
+
+func (p *SFTPPool) List(dir string) ([]string, error) {
+	c, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := c.ReadDir(dir)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	p.put(c, err)
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	return names, err
+}
@@ -0,0 +1,88 @@
+package sftp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestSFTPPool returns a pool of connections to an in-process SFTP server.
+func makeTestSFTPPool() *SFTPPool {
+	return newSFTPPool(func() (*sftp.Client, error) {
+		server, client := net.Pipe()
+		s, err := sftp.NewServer(server)
+		if err != nil {
+			return nil, err
+		}
+		go s.Serve()
+		return sftp.NewClientPipe(client, client)
+	}, 2)
+}
+
+func TestSFTPLoggerUploadsRotatedFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	lf := SFTPLoggerFactory{
+		Pool:        makeTestSFTPPool(),
+		Dir:         dir + "/events/",
+		Compression: "gzip",
+	}
+	defer lf.Pool.Close()
+
+	l := lf.NewLogger("a")
+	assert.Implements((*laozi.Logger)(nil), l)
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+	assert.NoError(l.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "events", "a", "*", "*"))
+	assert.NoError(err)
+	assert.Equal(1, len(files))
+	assert.Equal("00000000000000000001-00000000000000000002", filepath.Base(files[0]))
+
+	b, err := ioutil.ReadFile(files[0])
+	assert.NoError(err)
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	assert.NoError(err)
+	data, _ := ioutil.ReadAll(r)
+	assert.Equal([]byte("1\n2\n"), data)
+
+	// a new logger for the same partition continues the sequence
+	l = lf.NewLogger("a")
+	l.Log([]byte("3\n"))
+	assert.NoError(l.Close())
+
+	files, _ = filepath.Glob(filepath.Join(dir, "events", "a", "*", "*"))
+	assert.Equal(2, len(files))
+	assert.Equal("00000000000000000003-00000000000000000003", filepath.Base(files[1]))
+}
+
+func TestSFTPWriterIsIdempotent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	w := &rotating.Writer{FS: makeTestSFTPPool(), Name: dir + "/a", Rotation: time.Hour, Compression: "gzip"}
+	b := &laozi.Batch{Events: [][]byte{[]byte("1\n")}, Start: time.Now(), First: 1}
+
+	assert.NoError(w.Write(b))
+	assert.NoError(w.Write(b))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "a", "*", "*"))
+	assert.Equal(1, len(files))
+
+	// other events given the same name, e.g. by a restarted logger, don't count as written
+	other := &laozi.Batch{Events: [][]byte{[]byte("2\n")}, Start: b.Start, First: 1}
+	var conflict *laozi.ErrConcurrentWrite
+	assert.True(errors.As(w.Write(other), &conflict))
+}
@@ -0,0 +1,213 @@
+package laozi
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCloseTimeout is the error of partitions whose logger was still closing at the deadline
+// of CloseWithTimeout.
+var ErrCloseTimeout = errors.New("logger did not close before the deadline")
+
+// UnpersistedPartition is a partition CloseWithTimeout could not persist.
+type UnpersistedPartition struct {
+	Key string
+	// Data holds the events of the partition that were not persisted, if the logger
+	// implements BufferedLogger. For loggers still closing at the deadline, it holds the
+	// events buffered when the close started, some of which may be persisted meanwhile.
+	Data []byte
+	Err  error
+}
+
+// BufferedLogger is implemented by loggers able to return the events they hold in memory, so
+// they can be saved elsewhere when they fail to be flushed.
+type BufferedLogger interface {
+	// Buffered returns the events not persisted yet. It is called before Close, while the
+	// logger may still be flushing, as well as once Close returned.
+	Buffered() []byte
+}
+
+type closeResult struct {
+	key string
+	l   Logger
+	err error
+}
+
+// CloseWithTimeout closes all loggers in parallel, like Close, but returns once the deadline
+// d has passed. It returns the partitions that could not be persisted, with their events when
+// possible. Loggers still closing at the deadline keep closing in the background. If the router
+// is already closing, it waits for that close until the deadline and returns what it reports.
+func (r *laozi) CloseWithTimeout(d time.Duration) []UnpersistedPartition {
+	deadline := time.After(d)
+	if !r.startClose() {
+		if r.closeDone != nil {
+			select {
+			case <-r.closeDone:
+			case <-deadline:
+			}
+		}
+		return r.closeReport.unpersisted()
+	}
+	defer r.closeReturned()
+	r.stopRouting()
+	r.routeRemaining()
+	r.reportHeld()
+
+	r.Lock()
+	loggers := r.routingMap
+	r.routingMap = map[string]Logger{}
+	pending := map[string]*closingLogger{}
+	waiting := map[string]*closingLogger{}
+	for key, c := range r.closing {
+		if c.started {
+			waiting[key] = c
+			continue
+		}
+		c.started = true
+		pending[key] = c
+	}
+	r.Unlock()
+	for key, l := range loggers {
+		r.closeReport.start(key, l)
+	}
+	for key, c := range pending {
+		r.closeReport.start(key, c.Logger)
+	}
+
+	results := make(chan closeResult, len(loggers)+len(pending)+len(waiting))
+	unclosed := map[string]bool{}
+	snapshots := &bufferSnapshots{data: map[string][]byte{}}
+	for key, l := range loggers {
+		unclosed[key] = true
+		go func(key string, l Logger) {
+			snapshots.take(key, l)
+			err := r.closeFailed(key, l, l.Close())
+			r.unlock(key)
+			r.closeReport.done(key, l, err)
+			results <- closeResult{key, l, err}
+		}(key, l)
+	}
+	for key, c := range pending {
+		unclosed[key] = true
+		go func(key string, c *closingLogger) {
+			snapshots.take(key, c.Logger)
+			err := r.closeLogger(key, c)
+			r.closeReport.done(key, c.Logger, err)
+			results <- closeResult{key, c.Logger, err}
+		}(key, c)
+	}
+	for key, c := range waiting {
+		unclosed[key] = true
+		// closing in the background, which reports its own failure
+		go func(key string, c *closingLogger) {
+			<-c.done
+			results <- closeResult{key: key}
+		}(key, c)
+	}
+
+	var failed []UnpersistedPartition
+	for len(unclosed) > 0 {
+		select {
+		case res := <-results:
+			delete(unclosed, res.key)
+			if res.err == nil {
+				continue
+			}
+			p := UnpersistedPartition{Key: res.key, Err: res.err}
+			if bl := buffered(res.l); bl != nil {
+				p.Data = bl.Buffered()
+			}
+			failed = append(failed, p)
+		case <-deadline:
+			// loggers already closing in the background when CloseWithTimeout was called have
+			// no snapshot
+			for key := range unclosed {
+				failed = append(failed, UnpersistedPartition{Key: key, Data: snapshots.get(key), Err: ErrCloseTimeout})
+			}
+			return failed
+		}
+	}
+	return failed
+}
+
+// closeReport tracks the loggers closed by the close in flight, for the CloseWithTimeout calls
+// made meanwhile to report them.
+type closeReport struct {
+	sync.Mutex
+	closing map[string]Logger
+	failed  []UnpersistedPartition
+}
+
+func (c *closeReport) start(key string, l Logger) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closing == nil {
+		c.closing = map[string]Logger{}
+	}
+	c.closing[key] = l
+}
+
+func (c *closeReport) done(key string, l Logger, err error) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.closing, key)
+	if err == nil {
+		return
+	}
+	p := UnpersistedPartition{Key: key, Err: err}
+	if bl := buffered(l); bl != nil {
+		p.Data = bl.Buffered()
+	}
+	c.failed = append(c.failed, p)
+}
+
+// unpersisted returns the partitions that failed to close, and those still closing.
+func (c *closeReport) unpersisted() []UnpersistedPartition {
+	c.Lock()
+	defer c.Unlock()
+	failed := append([]UnpersistedPartition(nil), c.failed...)
+	for key, l := range c.closing {
+		p := UnpersistedPartition{Key: key, Err: ErrCloseTimeout}
+		if bl := buffered(l); bl != nil {
+			p.Data = bl.Buffered()
+		}
+		failed = append(failed, p)
+	}
+	return failed
+}
+
+// bufferSnapshots holds the events buffered by loggers when their close started, for those
+// still closing at the deadline of CloseWithTimeout.
+type bufferSnapshots struct {
+	sync.Mutex
+	data map[string][]byte
+}
+
+func (s *bufferSnapshots) take(key string, l Logger) {
+	bl := buffered(l)
+	if bl == nil {
+		return
+	}
+	data := bl.Buffered()
+	s.Lock()
+	s.data[key] = data
+	s.Unlock()
+}
+
+func (s *bufferSnapshots) get(key string) []byte {
+	s.Lock()
+	defer s.Unlock()
+	return s.data[key]
+}
+
+// buffered returns the BufferedLogger l is or wraps, if any.
+func buffered(l Logger) BufferedLogger {
+	var bl BufferedLogger
+	unwrap(l, func(l Logger) bool {
+		var ok bool
+		bl, ok = l.(BufferedLogger)
+		return ok
+	})
+	return bl
+}
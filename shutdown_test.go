@@ -0,0 +1,107 @@
+package laozi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// HangingMockLogger never finishes closing.
+type HangingMockLogger struct {
+	MockLogger
+}
+
+func (m *HangingMockLogger) Close() error {
+	select {}
+}
+
+func TestRouterClosesWithTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{err: errors.New("sink is down")}
+	failing := NewBatchLogger("b", sink.write, time.Hour, 0, 0)
+	failing.Log([]byte("1\n"))
+
+	ok := &MockLogger{}
+	r := &laozi{
+		routingMap: map[string]Logger{
+			"a": ok,
+			"b": failing,
+			"c": &HangingMockLogger{},
+		},
+		Config: &Config{},
+	}
+
+	start := time.Now()
+	failed := r.CloseWithTimeout(10 * time.Millisecond)
+	assert.True(time.Since(start) < time.Second)
+	assert.True(ok.closed)
+	assert.Equal(0, len(r.routingMap))
+
+	byKey := map[string]UnpersistedPartition{}
+	for _, p := range failed {
+		byKey[p.Key] = p
+	}
+	assert.Equal(2, len(byKey))
+	assert.Equal([]byte("1\n"), byKey["b"].Data)
+	assert.Error(byKey["b"].Err)
+	assert.Equal(ErrCloseTimeout, byKey["c"].Err)
+}
+
+func TestRouterClosesPendingLoggersWithTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozi{routingMap: map[string]Logger{}, Config: &Config{}}
+	l := &MockLogger{}
+	r.Lock()
+	r.closeLater("a", l, make(chan struct{}))
+	r.Unlock()
+
+	assert.Empty(r.CloseWithTimeout(time.Second))
+	assert.True(l.closed)
+}
+
+func TestRouterReturnsEventsOfLoggersClosingAtTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	hanging := NewBatchLogger("a", func(*Batch) error { select {} }, time.Hour, 0, 0)
+	hanging.Log([]byte("1\n"))
+	hanging.Log([]byte("2\n"))
+
+	r := &laozi{routingMap: map[string]Logger{"a": hanging}, Config: &Config{}}
+	failed := r.CloseWithTimeout(50 * time.Millisecond)
+
+	assert.Equal([]UnpersistedPartition{{Key: "a", Data: []byte("1\n2\n"), Err: ErrCloseTimeout}}, failed)
+}
+
+func TestRouterClosesWithTimeoutWhileClosing(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	l := NewBatchLogger("a", func(*Batch) error {
+		<-release
+		return errors.New("sink is down")
+	}, time.Hour, 0, 0)
+	l.Log([]byte("1\n"))
+
+	r := &laozi{routingMap: map[string]Logger{"a": l}, Config: &Config{}, closeDone: make(chan struct{})}
+	go r.Close()
+	assert.Eventually(r.isClosed, time.Second, time.Millisecond)
+
+	// the close in flight is still closing a at the deadline
+	var failed []UnpersistedPartition
+	assert.Eventually(func() bool {
+		failed = r.CloseWithTimeout(time.Millisecond)
+		return len(failed) > 0
+	}, time.Second, time.Millisecond)
+	assert.Equal([]UnpersistedPartition{{Key: "a", Data: []byte("1\n"), Err: ErrCloseTimeout}}, failed)
+
+	close(release)
+	failed = r.CloseWithTimeout(time.Second)
+	assert.Equal(1, len(failed))
+	assert.Equal("a", failed[0].Key)
+	assert.Equal([]byte("1\n"), failed[0].Data)
+	assert.Contains(failed[0].Err.Error(), "sink is down")
+}
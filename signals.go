@@ -0,0 +1,34 @@
+package laozi
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleSignals closes the router when the process receives one of the signals, by default
+// os.Interrupt or SIGTERM, so buffered events are flushed on shutdown. The returned channel is
+// closed once the router is closed, for main to wait on before returning:
+//
+//	done := laozi.HandleSignals(l)
+//	...
+//	<-done
+func HandleSignals(l Laozi, signals ...os.Signal) <-chan struct{} {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	return handleSignals(l, c)
+}
+
+func handleSignals(l Laozi, c chan os.Signal) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		<-c
+		signal.Stop(c)
+		l.Close()
+		close(done)
+	}()
+	return done
+}
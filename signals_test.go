@@ -0,0 +1,27 @@
+package laozi
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleSignalsCloses(t *testing.T) {
+	assert := assert.New(t)
+
+	log1 := &MockLogger{}
+	l := &laozi{routingMap: map[string]Logger{"testkey1": log1}}
+
+	c := make(chan os.Signal, 1)
+	done := handleSignals(l, c)
+	c <- os.Interrupt
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("router not closed")
+	}
+	assert.True(log1.closed)
+}
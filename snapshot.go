@@ -0,0 +1,111 @@
+package laozi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// SnapshotLogger is implemented by loggers that can hand over the events they hold in memory
+// instead of flushing them, see Snapshot.
+type SnapshotLogger interface {
+	Logger
+	// Detach stops the logger without flushing it, returning the events not persisted yet.
+	// Consecutive events may be returned joined together.
+	Detach() [][]byte
+}
+
+// snapshot is the state written by Snapshot.
+type snapshot struct {
+	Partitions []partitionSnapshot `json:"partitions"`
+	// Unrouted are the events that were still waiting in the event channel.
+	Unrouted [][]byte `json:"unrouted"`
+}
+
+type partitionSnapshot struct {
+	Key    string   `json:"key"`
+	Events [][]byte `json:"events"`
+}
+
+// Snapshot closes the router like Close, except the events still in memory are written to w
+// instead of being flushed, e.g. for an orchestrated restart to persist them to disk and
+// Restore them in the next process. Loggers that aren't SnapshotLoggers are closed.
+func (r *laozi) Snapshot(w io.Writer) error {
+	if r.stop == nil {
+		return errors.New("Snapshot requires a router made by NewLaozi")
+	}
+	if !r.startClose() {
+		return ErrClosed
+	}
+	defer r.closeReturned()
+	r.stopRouting()
+
+	s := snapshot{Unrouted: r.remaining()}
+	for _, h := range r.takeHeld() {
+		s.Unrouted = append(s.Unrouted, h.events...)
+	}
+
+	r.Lock()
+	loggers := r.routingMap
+	r.routingMap = map[string]Logger{}
+	var waiting []*closingLogger
+	for key, c := range r.closing {
+		if c.started {
+			waiting = append(waiting, c)
+			continue
+		}
+		c.started = true
+		loggers[key] = c.Logger
+		delete(r.closing, key)
+		close(c.done)
+	}
+	r.Unlock()
+
+	for key, l := range loggers {
+		if sl, ok := l.(SnapshotLogger); ok {
+			if events := sl.Detach(); len(events) > 0 {
+				s.Partitions = append(s.Partitions, partitionSnapshot{Key: key, Events: events})
+			}
+		} else {
+			r.closeFailed(key, l, l.Close())
+		}
+		r.unlock(key)
+	}
+	for _, c := range waiting {
+		<-c.done
+	}
+
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Restore logs the events of a snapshot written by Snapshot. The events of partitions are
+// logged to their partition as is, and the unrouted events are routed again. It returns
+// ErrClosed once the router is closed.
+func (r *laozi) Restore(rd io.Reader) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+	var s snapshot
+	if err := json.NewDecoder(rd).Decode(&s); err != nil {
+		return err
+	}
+
+	for _, p := range s.Partitions {
+		key := p.Key
+		newLogger := func() (Logger, error) { return r.newLogger(key) }
+		if r.SyncMode {
+			newLogger = func() (Logger, error) { return r.LoggerFactory.(SyncLoggerFactory).NewSyncLogger(key), nil }
+		}
+		l, ok := r.loggerFor(key, p.Events, newLogger)
+		if !ok {
+			continue
+		}
+		for _, e := range p.Events {
+			l.Log(e)
+		}
+	}
+	for _, e := range s.Unrouted {
+		r.logOne(e)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package laozi
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSnapshotLoggerFactory struct {
+	sync.Mutex
+	loggers map[string]*MockSnapshotLogger
+}
+
+func (mf *MockSnapshotLoggerFactory) NewLogger(key string) Logger {
+	mf.Lock()
+	defer mf.Unlock()
+	l := &MockSnapshotLogger{}
+	mf.loggers[key] = l
+	return l
+}
+
+// MockSnapshotLogger holds its events until detached.
+type MockSnapshotLogger struct {
+	MockLogger
+	mu     sync.Mutex
+	events [][]byte
+}
+
+func (m *MockSnapshotLogger) Log(e []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+}
+
+func (m *MockSnapshotLogger) Detach() [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.events
+}
+
+func TestRouterSnapshotsAndRestores(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := &MockSnapshotLoggerFactory{loggers: map[string]*MockSnapshotLogger{}}
+	r := NewLaozi(&Config{
+		LoggerFactory:    lf,
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+		EventChannelSize: 10,
+	})
+	r.Log([]byte("a"))
+	r.Log([]byte("a"))
+	r.(*laozi).awaitRouted(2)
+
+	// events waiting in the channel are snapshotted too
+	r.Pause()
+	r.Log([]byte("b"))
+
+	var buf bytes.Buffer
+	assert.NoError(r.Snapshot(&buf))
+	assert.Equal(ErrClosed, r.TryLog([]byte("c")))
+
+	lf = &MockSnapshotLoggerFactory{loggers: map[string]*MockSnapshotLogger{}}
+	r = NewLaozi(&Config{
+		LoggerFactory:    lf,
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+	})
+	assert.NoError(r.Restore(&buf))
+	// b is routed again if it was snapshotted unrouted
+	assert.Eventually(func() bool {
+		lf.Lock()
+		defer lf.Unlock()
+		return lf.loggers["b"] != nil && len(lf.loggers["b"].Detach()) > 0
+	}, time.Second, time.Millisecond)
+
+	lf.Lock()
+	defer lf.Unlock()
+	assert.Equal([][]byte{[]byte("a"), []byte("a")}, lf.loggers["a"].Detach())
+	assert.Equal([][]byte{[]byte("b")}, lf.loggers["b"].Detach())
+}
+
+func TestRouterSnapshotClosesOtherLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+	})
+	r.Log([]byte("a"))
+	r.(*laozi).awaitRouted(1)
+	r.(*laozi).Lock()
+	l := r.(*laozi).routingMap["a"].(*MockLogger)
+	r.(*laozi).Unlock()
+
+	var buf bytes.Buffer
+	assert.NoError(r.Snapshot(&buf))
+	assert.True(l.closed)
+	assert.JSONEq(`{"partitions":null,"unrouted":null}`, buf.String())
+}
+
+func TestRouterDoesNotRestoreOnceClosed(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := &MockSnapshotLoggerFactory{loggers: map[string]*MockSnapshotLogger{}}
+	r := NewLaozi(&Config{
+		LoggerFactory:    lf,
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+	})
+	r.Close()
+
+	s := `{"partitions":[{"key":"a","events":["YQ=="]}],"unrouted":["Yg=="]}`
+	assert.Equal(ErrClosed, r.Restore(strings.NewReader(s)))
+	lf.Lock()
+	defer lf.Unlock()
+	assert.Empty(lf.loggers)
+}
@@ -0,0 +1,87 @@
+// Package journal follows the systemd journal into a laozi router.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sync"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// JournalSource follows the systemd journal with journalctl and logs its entries to a router
+// as they are written, in journalctl's JSON format ended by a newline, e.g. partitioned by
+// their _SYSTEMD_UNIT field.
+type JournalSource struct {
+	// Router receives the entries. It is not closed by the source.
+	Router laozi.Laozi
+	// AfterCursor optionally resumes the journal after the entry of this cursor, e.g. the last
+	// Cursor of a previous process, instead of starting with the entries written from now.
+	AfterCursor string
+	// Args optionally are more arguments of journalctl, e.g. "--unit=nginx" to filter entries.
+	Args []string
+	// Command is the journalctl command, "journalctl" by default.
+	Command string
+
+	lock   sync.Mutex
+	cursor string
+}
+
+// Run logs the entries of the journal until ctx is done, or journalctl exits.
+func (s *JournalSource) Run(ctx context.Context) error {
+	command := s.Command
+	if command == "" {
+		command = "journalctl"
+	}
+	args := []string{"--follow", "--output=json"}
+	if s.AfterCursor != "" {
+		args = append(args, "--after-cursor="+s.AfterCursor)
+	} else {
+		args = append(args, "--lines=0")
+	}
+	cmd := exec.CommandContext(ctx, command, append(args, s.Args...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		entry := bytes.TrimSpace(scanner.Bytes())
+		if len(entry) == 0 {
+			continue
+		}
+		var fields struct {
+			Cursor string `json:"__CURSOR"`
+		}
+		if err := json.Unmarshal(entry, &fields); err != nil {
+			fmt.Printf(" [laozi] Error! Could not decode journal entry: %s\n", err)
+			continue
+		}
+		s.Router.Log(append(append([]byte(nil), entry...), '\n'))
+		s.lock.Lock()
+		s.cursor = fields.Cursor
+		s.lock.Unlock()
+	}
+	err = scanner.Err()
+	if werr := cmd.Wait(); err == nil && ctx.Err() == nil {
+		err = werr
+	}
+	return err
+}
+
+// Cursor returns the cursor of the last entry logged, to resume the journal after it with
+// AfterCursor.
+func (s *JournalSource) Cursor() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cursor
+}
@@ -0,0 +1,40 @@
+package journal
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seedboxtech/laozi/internal/laozitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalSourceLogsEntries(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	command := filepath.Join(dir, "journalctl")
+	script := `#!/bin/sh
+echo "$@" > ` + filepath.Join(dir, "args") + `
+echo '{"__CURSOR":"s=1","MESSAGE":"a","_SYSTEMD_UNIT":"nginx.service"}'
+echo
+echo 'not json'
+echo '{"__CURSOR":"s=2","MESSAGE":"b"}'
+`
+	assert.NoError(ioutil.WriteFile(command, []byte(script), 0700))
+
+	r := &laozitest.Router{}
+	s := &JournalSource{Router: r, Command: command, AfterCursor: "s=0", Args: []string{"--unit=nginx"}}
+	assert.NoError(s.Run(context.Background()))
+
+	assert.JSONEq(`{"__CURSOR":"s=1","MESSAGE":"a","_SYSTEMD_UNIT":"nginx.service"}`, string(r.Next(t)))
+	assert.Equal(`{"__CURSOR":"s=2","MESSAGE":"b"}`+"\n", string(r.Next(t)))
+	assert.Len(r.Logged(), 2)
+	assert.Equal("s=2", s.Cursor())
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.NoError(err)
+	assert.Equal("--follow --output=json --after-cursor=s=0 --unit=nginx", strings.TrimSpace(string(args)))
+}
@@ -0,0 +1,105 @@
+// Package mqtt subscribes a laozi router to the topics of an MQTT broker.
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+// MQTTMessage is the record of an MQTT message, as logged by an MQTTSource.
+type MQTTMessage struct {
+	Topic    string    `json:"topic"`
+	Retained bool      `json:"retained,omitempty"`
+	Received time.Time `json:"received"`
+	// Event is the payload if it is JSON, otherwise Data is.
+	Event json.RawMessage `json:"event,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+}
+
+// OpenMQTTMessage returns the message of a record logged by an MQTTSource, e.g. in a
+// PartitionKeyFunc partitioning by topic.
+func OpenMQTTMessage(record []byte) (MQTTMessage, error) {
+	var m MQTTMessage
+	err := json.Unmarshal(record, &m)
+	return m, err
+}
+
+// Payload returns the payload of the message.
+func (m MQTTMessage) Payload() []byte {
+	if m.Event != nil {
+		return m.Event
+	}
+	return m.Data
+}
+
+// MQTTTopicPartitionKey is a PartitionKeyFunc partitioning the records of an MQTTSource by the
+// topic of their messages, e.g. fleet/<device>/telemetry.
+func MQTTTopicPartitionKey(e []byte) (string, error) {
+	m, err := OpenMQTTMessage(e)
+	if err != nil {
+		return "", err
+	}
+	return m.Topic, nil
+}
+
+// MQTTSource subscribes to MQTT topics and logs their messages to a router as JSON MQTTMessages
+// ended by a newline, so IoT fleets archive their telemetry through laozi:
+//
+//	s := &mqtt.MQTTSource{Router: l, Topics: map[string]byte{"fleet/+/telemetry": 1}}
+//	opts := paho.NewClientOptions().AddBroker("tcp://broker:1883").SetOnConnectHandler(s.OnConnect)
+//	client := paho.NewClient(opts)
+//	client.Connect()
+//
+// Messages are logged as they are received, so the router applies backpressure to the broker.
+// Messages of QoS 1 or 2 are acknowledged once logged, not flushed.
+type MQTTSource struct {
+	// Router receives the messages. It is not closed by the source.
+	Router laozi.Laozi
+	// Topics are the topic filters subscribed to, and their QoS.
+	Topics map[string]byte
+	// Raw logs the payloads as received, ended by a newline, instead of MQTTMessages.
+	Raw bool
+}
+
+// Subscribe subscribes the client to the Topics.
+func (s *MQTTSource) Subscribe(client paho.Client) error {
+	token := client.SubscribeMultiple(s.Topics, s.handle)
+	token.Wait()
+	return token.Error()
+}
+
+// OnConnect subscribes the client to the Topics, to be its OnConnectHandler so subscriptions
+// are renewed when it reconnects.
+func (s *MQTTSource) OnConnect(client paho.Client) {
+	if err := s.Subscribe(client); err != nil {
+		fmt.Printf(" [laozi] Error! Could not subscribe to MQTT topics: %s\n", err)
+	}
+}
+
+func (s *MQTTSource) handle(_ paho.Client, msg paho.Message) {
+	payload := msg.Payload()
+	if s.Raw {
+		s.Router.Log(append(append([]byte(nil), payload...), '\n'))
+		return
+	}
+	m := MQTTMessage{
+		Topic:    msg.Topic(),
+		Retained: msg.Retained(),
+		Received: time.Now().UTC(),
+	}
+	if json.Valid(payload) {
+		m.Event = payload
+	} else {
+		m.Data = payload
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not encode MQTT message: %s\n", err)
+		return
+	}
+	s.Router.Log(append(data, '\n'))
+}
@@ -0,0 +1,92 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/laozitest"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockMQTTToken struct {
+	paho.Token
+	err error
+}
+
+func (t mockMQTTToken) Wait() bool   { return true }
+func (t mockMQTTToken) Error() error { return t.err }
+
+// mockMQTTClient records the subscriptions.
+type mockMQTTClient struct {
+	paho.Client
+	filters  map[string]byte
+	callback paho.MessageHandler
+	err      error
+}
+
+func (c *mockMQTTClient) SubscribeMultiple(filters map[string]byte, callback paho.MessageHandler) paho.Token {
+	c.filters, c.callback = filters, callback
+	return mockMQTTToken{err: c.err}
+}
+
+type mockMQTTMessage struct {
+	paho.Message
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+func (m mockMQTTMessage) Topic() string   { return m.topic }
+func (m mockMQTTMessage) Payload() []byte { return m.payload }
+func (m mockMQTTMessage) Retained() bool  { return m.retained }
+
+func TestMQTTSourceLogsMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozitest.Router{}
+	client := &mockMQTTClient{}
+	s := &MQTTSource{Router: r, Topics: map[string]byte{"fleet/+/telemetry": 1}}
+	assert.NoError(s.Subscribe(client))
+	assert.Equal(s.Topics, client.filters)
+
+	client.callback(client, mockMQTTMessage{topic: "fleet/d1/telemetry", payload: []byte(`{"temp":21}`), retained: true})
+	client.callback(client, mockMQTTMessage{topic: "fleet/d2/telemetry", payload: []byte("raw")})
+
+	data := r.Next(t)
+	assert.Equal(byte('\n'), data[len(data)-1])
+	m, err := OpenMQTTMessage(data)
+	assert.NoError(err)
+	assert.Equal("fleet/d1/telemetry", m.Topic)
+	assert.True(m.Retained)
+	assert.False(m.Received.IsZero())
+	assert.Equal(`{"temp":21}`, string(m.Payload()))
+	key, err := MQTTTopicPartitionKey(data)
+	assert.NoError(err)
+	assert.Equal("fleet/d1/telemetry", key)
+
+	m, err = OpenMQTTMessage(r.Next(t))
+	assert.NoError(err)
+	assert.Equal("raw", string(m.Payload()))
+}
+
+func TestMQTTSourceLogsRawPayloads(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozitest.Router{}
+	client := &mockMQTTClient{}
+	s := &MQTTSource{Router: r, Topics: map[string]byte{"a": 0}, Raw: true}
+	assert.NoError(s.Subscribe(client))
+
+	client.callback(client, mockMQTTMessage{topic: "a", payload: []byte("1")})
+	assert.Equal("1\n", string(r.Next(t)))
+}
+
+func TestMQTTSourceSubscribeFails(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockMQTTClient{err: errors.New("not authorized")}
+	s := &MQTTSource{Router: laozi.MockLaozi{}, Topics: map[string]byte{"a": 0}}
+	assert.EqualError(s.Subscribe(client), "not authorized")
+}
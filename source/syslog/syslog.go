@@ -0,0 +1,236 @@
+// Package syslog receives syslog messages over udp or tcp and logs them to a laozi router, so
+// infrastructure logs are archived with the partition logic of application events.
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const maxSyslogMessage = 64 << 10
+
+// SyslogEntry is a syslog message, as logged by a SyslogSource.
+type SyslogEntry struct {
+	Facility  int    `json:"facility"`
+	Severity  int    `json:"severity"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+	AppName   string `json:"app_name,omitempty"`
+	ProcID    string `json:"proc_id,omitempty"`
+	MsgID     string `json:"msg_id,omitempty"`
+	// StructuredData is the structured data elements of RFC 5424 messages, as sent.
+	StructuredData string `json:"structured_data,omitempty"`
+	Message        string `json:"message"`
+	// Received is when the message was received, and Peer the address it was received from.
+	Received time.Time `json:"received"`
+	Peer     string    `json:"peer,omitempty"`
+}
+
+// SyslogSource receives syslog messages, RFC 5424 or RFC 3164 ones, and logs them to a router
+// as JSON SyslogEntries ended by a newline, so infrastructure logs are archived with the
+// partition logic of application events, e.g. by app_name:
+//
+//	conn, err := net.ListenPacket("udp", ":514")
+//	go s.ServeUDP(conn)
+type SyslogSource struct {
+	// Router receives the entries. It is not closed by the source.
+	Router laozi.Laozi
+	// Raw logs the messages as received, ended by a newline, instead of SyslogEntries.
+	Raw bool
+}
+
+// ServeUDP logs the messages of the datagrams received on conn, one per datagram, until conn
+// is closed.
+func (s *SyslogSource) ServeUDP(conn net.PacketConn) error {
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if isClosedConn(err) {
+				return nil
+			}
+			return err
+		}
+		s.log(buf[:n], addr)
+	}
+}
+
+// ServeTCP logs the messages of the connections accepted on l until it is closed. Messages
+// are framed by octet counting, or else ended by a newline, see RFC 6587.
+func (s *SyslogSource) ServeTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if isClosedConn(err) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *SyslogSource) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readSyslogFrame(r)
+		if len(msg) > 0 {
+			s.log(msg, conn.RemoteAddr())
+		}
+		if err != nil {
+			if err != io.EOF && !isClosedConn(err) {
+				fmt.Printf(" [laozi] Error! Could not read syslog message from %s: %s\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads a message framed by octet counting, if it starts with a digit, or
+// else ended by a newline.
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		line, err := r.ReadBytes('\n')
+		return bytes.TrimRight(line, "\r\n"), err
+	}
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil || n > maxSyslogMessage {
+		return nil, fmt.Errorf("invalid message length %q", length)
+	}
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+	return msg, err
+}
+
+func (s *SyslogSource) log(msg []byte, addr net.Addr) {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	if len(msg) == 0 {
+		return
+	}
+	if s.Raw {
+		s.Router.Log(append(append([]byte(nil), msg...), '\n'))
+		return
+	}
+	e := ParseSyslog(msg)
+	e.Received = time.Now().UTC()
+	if addr != nil {
+		e.Peer = addr.String()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		fmt.Printf(" [laozi] Error! Could not encode syslog entry: %s\n", err)
+		return
+	}
+	s.Router.Log(append(data, '\n'))
+}
+
+// ParseSyslog parses an RFC 5424 or RFC 3164 syslog message. The parts of messages not
+// following either end up in the Message, with the user facility and notice severity if they
+// have no priority.
+func ParseSyslog(msg []byte) SyslogEntry {
+	e := SyslogEntry{Facility: 1, Severity: 5}
+	rest := string(msg)
+	if end := strings.IndexByte(rest, '>'); strings.HasPrefix(rest, "<") && end > 1 && end <= 4 {
+		if pri, err := strconv.Atoi(rest[1:end]); err == nil && pri <= 191 {
+			e.Facility, e.Severity = pri/8, pri%8
+			rest = rest[end+1:]
+		}
+	}
+
+	if strings.HasPrefix(rest, "1 ") {
+		parseSyslog5424(&e, rest[2:])
+	} else {
+		parseSyslog3164(&e, rest)
+	}
+	return e
+}
+
+// parseSyslog5424 parses the part of an RFC 5424 message following its version.
+func parseSyslog5424(e *SyslogEntry, rest string) {
+	fields := make([]string, 5)
+	for i := range fields {
+		field := rest
+		if end := strings.IndexByte(rest, ' '); end >= 0 {
+			field, rest = rest[:end], rest[end+1:]
+		} else {
+			rest = ""
+		}
+		if field != "-" {
+			fields[i] = field
+		}
+	}
+	e.Timestamp, e.Hostname, e.AppName, e.ProcID, e.MsgID = fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		// elements are enclosed in brackets, in which quoted values may escape them
+		end, quoted, escaped := 0, false, false
+	scan:
+		for ; end < len(rest); end++ {
+			c := rest[end]
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				quoted = !quoted
+			case c == ' ' && !quoted && end > 0 && rest[end-1] == ']':
+				break scan
+			}
+		}
+		e.StructuredData, rest = rest[:end], rest[end:]
+	}
+	e.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+}
+
+// parseSyslog3164 parses the part of an RFC 3164 message following its priority.
+func parseSyslog3164(e *SyslogEntry, rest string) {
+	e.Message = rest
+	if len(rest) < len(time.Stamp)+1 {
+		return
+	}
+	if _, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err != nil {
+		return
+	}
+	e.Timestamp = rest[:len(time.Stamp)]
+	rest = rest[len(time.Stamp)+1:]
+
+	if end := strings.IndexByte(rest, ' '); end > 0 {
+		e.Hostname, rest = rest[:end], rest[end+1:]
+	}
+	// the tag ends with a colon, after the pid in brackets if any
+	if end := strings.IndexByte(rest, ':'); end > 0 && !strings.ContainsRune(rest[:end], ' ') {
+		tag := rest[:end]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			tag, e.ProcID = tag[:open], tag[open+1:len(tag)-1]
+		}
+		e.AppName, rest = tag, strings.TrimPrefix(rest[end+1:], " ")
+	}
+	e.Message = rest
+}
+
+// isClosedConn reports whether err is the error of a closed connection or listener.
+func isClosedConn(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
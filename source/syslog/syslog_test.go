@@ -0,0 +1,104 @@
+package syslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/seedboxtech/laozi/internal/laozitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSyslog(t *testing.T) {
+	assert := assert.New(t)
+
+	e := ParseSyslog([]byte(`<165>1 2026-10-11T22:14:15.003Z host.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventID="1011"][x a="b]"] An application event`))
+	assert.Equal(SyslogEntry{
+		Facility:       20,
+		Severity:       5,
+		Timestamp:      "2026-10-11T22:14:15.003Z",
+		Hostname:       "host.example.com",
+		AppName:        "evntslog",
+		MsgID:          "ID47",
+		StructuredData: `[exampleSDID@32473 iut="3" eventID="1011"][x a="b]"]`,
+		Message:        "An application event",
+	}, e)
+
+	e = ParseSyslog([]byte("<13>1 - - - - - -"))
+	assert.Equal(SyslogEntry{Facility: 1, Severity: 5}, e)
+
+	e = ParseSyslog([]byte("<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8"))
+	assert.Equal(SyslogEntry{
+		Facility:  4,
+		Severity:  2,
+		Timestamp: "Oct 11 22:14:15",
+		Hostname:  "mymachine",
+		AppName:   "su",
+		ProcID:    "123",
+		Message:   "'su root' failed for lonvick on /dev/pts/8",
+	}, e)
+
+	e = ParseSyslog([]byte("no header: at all"))
+	assert.Equal(SyslogEntry{Facility: 1, Severity: 5, Message: "no header: at all"}, e)
+}
+
+func TestSyslogSourceServesUDP(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozitest.Router{}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	s := &SyslogSource{Router: r}
+	done := make(chan error)
+	go func() { done <- s.ServeUDP(conn) }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer client.Close()
+	fmt.Fprint(client, "<14>Oct 11 22:14:15 web nginx: GET /\n")
+
+	var e SyslogEntry
+	data := r.Next(t)
+	assert.Equal(byte('\n'), data[len(data)-1])
+	assert.NoError(json.Unmarshal(data, &e))
+	assert.Equal("nginx", e.AppName)
+	assert.Equal("GET /", e.Message)
+	assert.Equal(client.LocalAddr().String(), e.Peer)
+	assert.False(e.Received.IsZero())
+
+	conn.Close()
+	assert.NoError(<-done)
+}
+
+func TestSyslogSourceServesTCP(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozitest.Router{}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	s := &SyslogSource{Router: r, Raw: true}
+	done := make(chan error)
+	go func() { done <- s.ServeTCP(l) }()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	// octet counted messages may hold newlines
+	fmt.Fprint(client, "<14>a\r\n9 <14>b\nc\nd<14>e\n")
+	client.Close()
+
+	assert.Equal("<14>a\n", string(r.Next(t)))
+	assert.Equal("<14>b\nc\nd\n", string(r.Next(t)))
+	assert.Equal("<14>e\n", string(r.Next(t)))
+
+	l.Close()
+	assert.NoError(<-done)
+}
@@ -0,0 +1,284 @@
+// Package tail tails log files into a laozi router, like a minimal filebeat, to archive the log
+// files of legacy apps to partitioned S3:
+//
+//	t := &tail.Tailer{Router: l, Globs: []string{"/var/log/app/*.log"}, Checkpoint: "/var/lib/laozi/tail.json"}
+//	go t.Run(ctx)
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const (
+	defaultPollInterval = time.Second
+	// headSize is the size of the start of files checkpointed to recognize them
+	headSize = 64
+	// maxLineSize is the size of the lines logged in parts
+	maxLineSize = 1 << 20
+)
+
+// Tailer logs the lines of the files matching its globs to a router, ended by a newline, as
+// they are appended. Files are followed across renames, e.g. by logrotate, and read from their
+// start again once truncated, e.g. with copytruncate. Files removed or renamed out of the globs
+// are read to their end before being closed, their last line logged even if unterminated.
+type Tailer struct {
+	// Router receives the lines. It is not closed by the Tailer.
+	Router laozi.Laozi
+	// Globs are the patterns of the files tailed, see filepath.Match. They are matched again
+	// every PollInterval, defaults to a second, so new files are tailed from their start.
+	Globs        []string
+	PollInterval time.Duration
+	// FromStart reads the files found when Run starts without a Checkpoint from their start
+	// instead of their end. Files found otherwise are read from their start.
+	FromStart bool
+	// Checkpoint optionally is the file the offsets of the lines logged are saved to every
+	// PollInterval, for a restarted Tailer to resume the files where the previous one stopped.
+	// Files are recognized by their path, or else by their first 64 bytes when renamed
+	// meanwhile. Lines logged but not flushed by the router before a crash are lost.
+	Checkpoint string
+}
+
+// tailedFile is a file being tailed.
+type tailedFile struct {
+	path string
+	file *os.File
+	info os.FileInfo
+	// offset is the end of the last line logged, partial the start of the next line
+	offset  int64
+	partial []byte
+}
+
+// fileCheckpoint is the offset of a file in the Checkpoint.
+type fileCheckpoint struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	// Head is the start of the file, to recognize it
+	Head []byte `json:"head"`
+}
+
+// Run tails the files until ctx is done, then saves the Checkpoint. It returns the error of
+// the Checkpoint failing to be read or saved.
+func (t *Tailer) Run(ctx context.Context) error {
+	saved, err := t.readCheckpoint()
+	if err != nil {
+		return err
+	}
+	interval := t.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var files []*tailedFile
+	defer func() {
+		for _, f := range files {
+			f.file.Close()
+		}
+	}()
+	// without a checkpoint, the lines written before Run are skipped unless FromStart
+	fromEnd := saved == nil && !t.FromStart
+	for ; ; fromEnd = false {
+		files, saved = t.poll(files, saved, fromEnd)
+		if err := t.writeCheckpoint(files); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll tails the files matching the globs, returning those still tailed and the checkpoints
+// of files not found yet. The files already tailed are read first, so the end of a rotated
+// file is logged before the start of the file replacing it. New files are read from their
+// start, or end if fromEnd.
+func (t *Tailer) poll(files []*tailedFile, saved []fileCheckpoint, fromEnd bool) ([]*tailedFile, []fileCheckpoint) {
+	var tailed []*tailedFile
+	found := map[*tailedFile]bool{}
+	var newPaths []string
+	var newInfos []os.FileInfo
+	for _, path := range t.paths() {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		f := sameFile(files, info)
+		if f == nil {
+			newPaths, newInfos = append(newPaths, path), append(newInfos, info)
+			continue
+		}
+		if found[f] {
+			// matched by several globs
+			continue
+		}
+		found[f] = true
+		f.path, f.info = path, info
+		if info.Size() < f.offset+int64(len(f.partial)) {
+			// truncated
+			f.offset, f.partial = 0, nil
+		}
+		t.read(f)
+		tailed = append(tailed, f)
+	}
+
+	for _, f := range files {
+		if !found[f] {
+			// removed or renamed away, so nothing will be appended to it
+			t.read(f)
+			if len(f.partial) > 0 {
+				t.Router.Log(append(f.partial, '\n'))
+			}
+			f.file.Close()
+		}
+	}
+
+	for i, path := range newPaths {
+		if sameFile(tailed, newInfos[i]) != nil {
+			continue
+		}
+		f, rest, err := t.open(path, newInfos[i], saved, fromEnd)
+		if err != nil {
+			fmt.Printf(" [laozi] Error! Could not tail %s: %s\n", path, err)
+			continue
+		}
+		saved = rest
+		t.read(f)
+		tailed = append(tailed, f)
+	}
+	return tailed, saved
+}
+
+// paths returns the paths matching the globs, in order.
+func (t *Tailer) paths() []string {
+	var paths []string
+	for _, glob := range t.Globs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			fmt.Printf(" [laozi] Error! Invalid glob %s: %s\n", glob, err)
+			continue
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sameFile returns the tailed file info is of, if any.
+func sameFile(files []*tailedFile, info os.FileInfo) *tailedFile {
+	for _, f := range files {
+		if os.SameFile(f.info, info) {
+			return f
+		}
+	}
+	return nil
+}
+
+// open starts tailing a file found, at the offset of its checkpoint if any, which is removed
+// from saved.
+func (t *Tailer) open(path string, info os.FileInfo, saved []fileCheckpoint, fromEnd bool) (*tailedFile, []fileCheckpoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, saved, err
+	}
+	f := &tailedFile{path: path, file: file, info: info}
+	if fromEnd {
+		f.offset = info.Size()
+	}
+
+	head := make([]byte, headSize)
+	n, _ := file.ReadAt(head, 0)
+	head = head[:n]
+	// checkpoints of the same path first
+	sort.SliceStable(saved, func(i, j int) bool { return saved[i].Path == path && saved[j].Path != path })
+	for i, c := range saved {
+		if c.Offset <= info.Size() && len(c.Head) > 0 && bytes.HasPrefix(head, c.Head) {
+			f.offset = c.Offset
+			return f, append(saved[:i:i], saved[i+1:]...), nil
+		}
+	}
+	return f, saved, nil
+}
+
+// read logs the lines appended to a file since it was last read.
+func (t *Tailer) read(f *tailedFile) {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := f.file.ReadAt(buf, f.offset+int64(len(f.partial)))
+		data := append(f.partial, buf[:n]...)
+		for {
+			end := bytes.IndexByte(data, '\n') + 1
+			if end == 0 && len(data) >= maxLineSize {
+				end = len(data)
+			}
+			if end == 0 {
+				break
+			}
+			line := append([]byte(nil), data[:end]...)
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			t.Router.Log(line)
+			f.offset += int64(end)
+			data = data[end:]
+		}
+		f.partial = append([]byte(nil), data...)
+
+		if err != nil || n == 0 {
+			if err != nil && err != io.EOF {
+				fmt.Printf(" [laozi] Error! Could not read %s: %s\n", f.path, err)
+			}
+			return
+		}
+	}
+}
+
+// readCheckpoint returns the checkpoints of the files of the Checkpoint, if any.
+func (t *Tailer) readCheckpoint() ([]fileCheckpoint, error) {
+	if t.Checkpoint == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(t.Checkpoint)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	saved := []fileCheckpoint{}
+	return saved, json.Unmarshal(data, &saved)
+}
+
+// writeCheckpoint replaces the Checkpoint with the offsets of the files.
+func (t *Tailer) writeCheckpoint(files []*tailedFile) error {
+	if t.Checkpoint == "" {
+		return nil
+	}
+	saved := make([]fileCheckpoint, 0, len(files))
+	for _, f := range files {
+		head := make([]byte, headSize)
+		n, _ := f.file.ReadAt(head, 0)
+		saved = append(saved, fileCheckpoint{Path: f.path, Offset: f.offset, Head: head[:n]})
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(t.Checkpoint+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(t.Checkpoint+".tmp", t.Checkpoint)
+}
@@ -0,0 +1,128 @@
+package tail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seedboxtech/laozi/internal/laozitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTailer(dir string) (*Tailer, *laozitest.Router) {
+	r := &laozitest.Router{}
+	return &Tailer{
+		Router:     r,
+		Globs:      []string{filepath.Join(dir, "*.log*")},
+		FromStart:  true,
+		Checkpoint: filepath.Join(dir, "checkpoint.json"),
+	}, r
+}
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailerLogsAppendedLines(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	tailer, r := newTailer(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "one\ntw")
+
+	files, saved := tailer.poll(nil, nil, false)
+	assert.Equal([]string{"one\n"}, r.Logged())
+
+	// the partial line is logged once ended
+	appendFile(t, path, "o\nthree\n")
+	files, _ = tailer.poll(files, saved, false)
+	assert.Equal([]string{"one\n", "two\n", "three\n"}, r.Logged())
+	assert.Equal(int64(14), files[0].offset)
+}
+
+func TestTailerSkipsExistingLinesByDefault(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	tailer, r := newTailer(dir)
+	appendFile(t, filepath.Join(dir, "old.log"), "old\n")
+
+	files, saved := tailer.poll(nil, nil, true)
+	assert.Empty(r.Logged())
+
+	// files created later are read from their start
+	appendFile(t, filepath.Join(dir, "old.log"), "appended\n")
+	appendFile(t, filepath.Join(dir, "new.log"), "new\n")
+	tailer.poll(files, saved, false)
+	assert.Equal([]string{"appended\n", "new\n"}, r.Logged())
+}
+
+func TestTailerFollowsRotation(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	tailer, r := newTailer(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "one\n")
+	files, saved := tailer.poll(nil, nil, false)
+
+	// written before and after logrotate renames the file
+	appendFile(t, path, "two\n")
+	assert.NoError(os.Rename(path, path+".1"))
+	appendFile(t, path, "three\n")
+	files, saved = tailer.poll(files, saved, false)
+	assert.Equal([]string{"one\n", "two\n", "three\n"}, r.Logged())
+	assert.Len(files, 2)
+
+	// rotated out of the globs, its last line is logged even if unterminated
+	appendFile(t, path+".1", "four")
+	assert.NoError(os.Rename(path+".1", filepath.Join(dir, "app.old")))
+	files, _ = tailer.poll(files, saved, false)
+	assert.Equal([]string{"one\n", "two\n", "three\n", "four\n"}, r.Logged())
+	assert.Len(files, 1)
+}
+
+func TestTailerRereadsTruncatedFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	tailer, r := newTailer(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "before truncation\n")
+	files, saved := tailer.poll(nil, nil, false)
+
+	assert.NoError(os.Truncate(path, 0))
+	appendFile(t, path, "after\n")
+	tailer.poll(files, saved, false)
+	assert.Equal([]string{"before truncation\n", "after\n"}, r.Logged())
+}
+
+func TestTailerResumesFromCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	tailer, r := newTailer(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "one\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(tailer.Run(ctx))
+	assert.Equal([]string{"one\n"}, r.Logged())
+
+	// rotated while stopped
+	appendFile(t, path, "two\n")
+	assert.NoError(os.Rename(path, path+".1"))
+	appendFile(t, path, "three\n")
+
+	restarted, r := newTailer(dir)
+	restarted.FromStart = false
+	restarted.PollInterval = time.Millisecond
+	assert.NoError(restarted.Run(ctx))
+	assert.ElementsMatch([]string{"two\n", "three\n"}, r.Logged())
+}
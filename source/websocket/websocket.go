@@ -0,0 +1,117 @@
+// Package websocket ingests the events streamed by WebSocket clients into a laozi router.
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	laozi "github.com/seedboxtech/laozi"
+)
+
+const defaultWebSocketMaxEventSize = 1 << 20
+
+// WebSocketServer is an http.Handler ingesting the events streamed by its WebSocket clients,
+// for high-frequency browser or edge producers to keep a connection open instead of sending a
+// request per event:
+//
+//	ws := &websocket.WebSocketServer{Router: l, Authorize: checkToken}
+//	http.Handle("/events", ws)
+//
+// Every text or binary message is an event, logged ended by a newline. A message is read once
+// the previous one is logged, so a router that can't keep up slows its clients down through
+// TCP flow control rather than buffering their events.
+type WebSocketServer struct {
+	// Router receives the events. It is not closed by the server.
+	Router laozi.Laozi
+	// Authorize optionally authorizes connections from their upgrade request, e.g. a bearer
+	// token. Unauthorized ones are refused with a 401 and the error.
+	Authorize func(r *http.Request) error
+	// CheckOrigin optionally authorizes the Origin of browsers, same origin only by default.
+	CheckOrigin func(r *http.Request) bool
+	// MaxEventSize is the max size of events, defaults to 1 MiB. Connections sending bigger
+	// ones are closed.
+	MaxEventSize int64
+
+	lock   sync.Mutex
+	conns  map[*websocket.Conn]struct{}
+	closed bool
+}
+
+func (s *WebSocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Authorize != nil {
+		if err := s.Authorize(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	upgrader := websocket.Upgrader{CheckOrigin: s.CheckOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader replied with the error
+		return
+	}
+	if !s.track(conn) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+	defer s.untrack(conn)
+
+	maxSize := s.MaxEventSize
+	if maxSize <= 0 {
+		maxSize = defaultWebSocketMaxEventSize
+	}
+	conn.SetReadLimit(maxSize)
+	for {
+		_, e, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, net.ErrClosed) {
+				fmt.Printf(" [laozi] Error! Could not read event from %s: %s\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		e = bytes.TrimRight(e, "\r\n")
+		if len(e) > 0 {
+			s.Router.Log(append(e, '\n'))
+		}
+	}
+}
+
+// track adds a connection to those closed by Close, unless the server is closed.
+func (s *WebSocketServer) track(conn *websocket.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*websocket.Conn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *WebSocketServer) untrack(conn *websocket.Conn) {
+	s.lock.Lock()
+	delete(s.conns, conn)
+	s.lock.Unlock()
+	conn.Close()
+}
+
+// Close closes the connections of the clients, e.g. before closing the router, and refuses new
+// ones. The events already read are logged.
+func (s *WebSocketServer) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
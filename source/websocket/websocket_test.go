@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/laozitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebSocketServerLogsEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozitest.Router{}
+	ws := &WebSocketServer{Router: r}
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(conn.WriteMessage(websocket.TextMessage, []byte(`{"a":1}`)))
+	assert.NoError(conn.WriteMessage(websocket.BinaryMessage, []byte("b\n")))
+
+	assert.Equal("{\"a\":1}\n", string(r.Next(t)))
+	assert.Equal("b\n", string(r.Next(t)))
+
+	// closed clients get a close message
+	ws.Close()
+	_, _, err = conn.ReadMessage()
+	assert.True(websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
+
+func TestWebSocketServerAuthorizesConnections(t *testing.T) {
+	assert := assert.New(t)
+
+	ws := &WebSocketServer{
+		Router: laozi.MockLaozi{},
+		Authorize: func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return errors.New("invalid token")
+			}
+			return nil
+		},
+	}
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Equal(websocket.ErrBadHandshake, err)
+	if assert.NotNil(resp) {
+		assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer secret"}})
+	if assert.NoError(err) {
+		conn.Close()
+	}
+}
+
+func TestWebSocketServerClosesConnectionsOfBigEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(&WebSocketServer{Router: laozi.MockLaozi{}, MaxEventSize: 4})
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(conn.WriteMessage(websocket.TextMessage, []byte("too big")))
+	_, _, err = conn.ReadMessage()
+	assert.True(websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+}
@@ -0,0 +1,88 @@
+package laozi
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+const (
+	defaultSplitInterval = time.Minute
+	defaultSplitShards   = 4
+)
+
+// partitionVolume is the size of the events routed to a partition key in the current
+// SplitInterval, until it is split.
+type partitionVolume struct {
+	bytes int64
+	split bool
+}
+
+// shardKey returns the key of the logger of an event of a partition key: the key itself, or the
+// sub-partition of the event once the key was split, see Config.SplitBytes.
+func (r *laozi) shardKey(key string, e []byte) string {
+	r.splitLock.Lock()
+	v, split := r.countVolume(key, e)
+	r.splitLock.Unlock()
+
+	if !v.split {
+		return key
+	}
+	shards := r.SplitShards
+	if shards <= 0 {
+		shards = defaultSplitShards
+	}
+	if split && r.OnSplit != nil {
+		r.OnSplit(key, shards)
+	}
+	h := fnv.New32a()
+	h.Write(e)
+	return fmt.Sprintf("%s/shard-%d", key, h.Sum32()%uint32(shards))
+}
+
+// countVolume adds an event to the volume of its partition key, returning true if it made the
+// key split. It must be called with the splitLock held.
+func (r *laozi) countVolume(key string, e []byte) (*partitionVolume, bool) {
+	interval := r.SplitInterval
+	if interval <= 0 {
+		interval = defaultSplitInterval
+	}
+	if now := time.Now(); r.volumes == nil || now.Sub(r.volumeStart) >= interval {
+		// split keys stay split
+		volumes := map[string]*partitionVolume{}
+		for k, v := range r.volumes {
+			if v.split {
+				volumes[k] = v
+			}
+		}
+		r.volumes = volumes
+		r.volumeStart = now
+	}
+
+	v := r.volumes[key]
+	if v == nil {
+		v = &partitionVolume{}
+		r.volumes[key] = v
+	}
+	if v.split {
+		return v, false
+	}
+	v.bytes += int64(len(e))
+	v.split = v.bytes > r.SplitBytes
+	return v, v.split
+}
+
+// splitKeys returns the partition keys that were split.
+func (r *laozi) splitKeys() []string {
+	r.splitLock.Lock()
+	defer r.splitLock.Unlock()
+	var keys []string
+	for key, v := range r.volumes {
+		if v.split {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,55 @@
+package laozi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterSplitsLargePartitions(t *testing.T) {
+	assert := assert.New(t)
+
+	var splits []string
+	l := &laozi{
+		EventChan:  make(chan []byte),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: func(e []byte) (string, error) { return "key", nil },
+			SplitBytes:       3,
+			SplitShards:      2,
+			OnSplit:          func(key string, shards int) { splits = append(splits, key) },
+		},
+	}
+	go l.route()
+
+	for _, e := range []string{"aa", "bb", "cc", "dd", "ee", "ff"} {
+		l.EventChan <- []byte(e)
+	}
+
+	l.awaitRouted(6)
+
+	var b bytes.Buffer
+	assert.NoError(l.DumpState(&b))
+	var state routerState
+	assert.NoError(json.Unmarshal(b.Bytes(), &state))
+	assert.Equal([]string{"key"}, state.Split)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal([]string{"key"}, splits)
+	assert.Equal([]byte("aa"), l.routingMap["key"].(*MockLogger).bytes)
+	var sharded int
+	for key, logger := range l.routingMap {
+		if key != "key" {
+			assert.True(strings.HasPrefix(key, "key/shard-"))
+			sharded += len(logger.(*MockLogger).bytes)
+		}
+	}
+	assert.Equal(10, sharded)
+}
@@ -0,0 +1,61 @@
+package laozi
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// split returns the events of a payload logged, split by the SplitterFunc if set.
+func (r *laozi) split(e []byte) [][]byte {
+	if r.Config == nil || r.SplitterFunc == nil {
+		return [][]byte{e}
+	}
+	return r.SplitterFunc(e)
+}
+
+// SplitLines is a SplitterFunc splitting NDJSON blobs, or any payload of lines, into its
+// non-empty lines, keeping their trailing newline.
+func SplitLines(payload []byte) [][]byte {
+	var events [][]byte
+	for len(payload) > 0 {
+		n := bytes.IndexByte(payload, '\n') + 1
+		if n == 0 {
+			n = len(payload)
+		}
+		if line := payload[:n]; len(bytes.TrimSpace(line)) > 0 {
+			events = append(events, line)
+		}
+		payload = payload[n:]
+	}
+	return events
+}
+
+// SplitJSONArray returns a SplitterFunc splitting payloads holding a JSON array of records,
+// e.g. the Records of SQS and S3 notification bodies, into the records, compacted and followed
+// by a newline.
+// The array is the payload itself if field is empty, or the field of the payload object.
+// Payloads that hold no such array are returned as they are.
+func SplitJSONArray(field string) func([]byte) [][]byte {
+	return func(payload []byte) [][]byte {
+		array := json.RawMessage(payload)
+		if field != "" {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(payload, &fields); err != nil || fields[field] == nil {
+				return [][]byte{payload}
+			}
+			array = fields[field]
+		}
+		var records []json.RawMessage
+		if err := json.Unmarshal(array, &records); err != nil {
+			return [][]byte{payload}
+		}
+		events := make([][]byte, len(records))
+		for i, record := range records {
+			// records span a single line
+			var b bytes.Buffer
+			json.Compact(&b, record)
+			events[i] = append(b.Bytes(), '\n')
+		}
+		return events
+	}
+}
@@ -0,0 +1,80 @@
+package laozi
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLines(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([][]byte{[]byte("a\n"), []byte("b\n"), []byte("c")}, SplitLines([]byte("a\nb\n\n  \nc")))
+	assert.Empty(SplitLines(nil))
+}
+
+func TestSplitJSONArray(t *testing.T) {
+	assert := assert.New(t)
+
+	body := []byte(`{"Records": [
+		{"id": 1},
+		{"id": 2}
+	]}`)
+	assert.Equal([][]byte{[]byte(`{"id":1}` + "\n"), []byte(`{"id":2}` + "\n")}, SplitJSONArray("Records")(body))
+	assert.Equal([][]byte{[]byte("1\n"), []byte("\"a\"\n")}, SplitJSONArray("")([]byte(`[1, "a"]`)))
+	// payloads without the array are kept whole
+	assert.Equal([][]byte{body}, SplitJSONArray("records")(body))
+	assert.Equal([][]byte{[]byte("a")}, SplitJSONArray("")([]byte("a")))
+}
+
+func TestRouterSplitsPayloads(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := &mockSink{}
+	r := NewLaozi(&Config{
+		LoggerFactory: MockReportingLoggerFactory{sink},
+		LoggerTimeout: time.Hour,
+		PartitionKeyFunc: func(e []byte) (string, error) {
+			return strings.SplitN(string(e), ":", 2)[0], nil
+		},
+		SplitterFunc:     SplitLines,
+		EventChannelSize: 10,
+	})
+	r.Log([]byte("a:1\nb:1\na:2\n"))
+	assert.NoError(r.TryLog([]byte("b:2\n")))
+	r.LogWithPriority([]byte("c:1\nc:2\n"), PriorityHigh)
+	r.Close()
+
+	sink.Lock()
+	defer sink.Unlock()
+	events := map[string][]string{}
+	for _, b := range sink.batches {
+		for _, e := range b.Events {
+			key := strings.SplitN(string(e), ":", 2)[0]
+			events[key] = append(events[key], string(e))
+		}
+	}
+	assert.Equal([]string{"a:1\n", "a:2\n"}, events["a"])
+	assert.Equal([]string{"b:1\n", "b:2\n"}, events["b"])
+	assert.Equal([]string{"c:1\n", "c:2\n"}, events["c"])
+}
+
+func TestSyncRouterSplitsPayloads(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockSyncLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: func(e []byte) (string, error) { return "a", nil },
+		SyncMode:         true,
+		SplitterFunc:     SplitJSONArray(""),
+	})
+	assert.NoError(r.LogSync(context.Background(), []byte(`[1, 2]`)))
+
+	l := r.(*laozi).routingMap["a"].(*MockSyncLogger)
+	assert.Equal([][]byte{[]byte("1\n"), []byte("2\n")}, l.synced)
+	r.Close()
+}
@@ -0,0 +1,210 @@
+package laozi
+
+import "time"
+
+// The router moves events through stages: the ingest stage holds the events logged until they
+// are routed, the partition stage keys them, the buffer stage gathers consecutive events of a
+// partition key and the delivery stage logs them to the logger of their partition. The
+// partition and delivery stages can be wrapped, see Config.PartitionStage and
+// Config.DeliveryStage.
+
+// Partitioner is the partition stage of the router, returning the partition key of an event
+// as routed, i.e. rewritten, sanitized and aliased.
+type Partitioner interface {
+	PartitionKey(e []byte) (string, error)
+}
+
+// PartitionerFunc is a func implementing Partitioner.
+type PartitionerFunc func(e []byte) (string, error)
+
+// PartitionKey returns f(e).
+func (f PartitionerFunc) PartitionKey(e []byte) (string, error) {
+	return f(e)
+}
+
+// Delivery is the delivery stage of the router, logging consecutive events of a partition key
+// returned by the partition stage.
+type Delivery interface {
+	Deliver(key string, events [][]byte)
+}
+
+// DeliveryFunc is a func implementing Delivery.
+type DeliveryFunc func(key string, events [][]byte)
+
+// Deliver calls f(key, events).
+func (f DeliveryFunc) Deliver(key string, events [][]byte) {
+	f(key, events)
+}
+
+// TeeDelivery returns a delivery stage delivering events to each of the stages in turn, e.g.
+// the router's own and one logging them to a second sink. Every stage but the last is handed a
+// copy of the slice of events, as the router's own reuses it.
+func TeeDelivery(stages ...Delivery) Delivery {
+	return DeliveryFunc(func(key string, events [][]byte) {
+		for i, s := range stages {
+			if i < len(stages)-1 {
+				s.Deliver(key, append([][]byte(nil), events...))
+				continue
+			}
+			s.Deliver(key, events)
+		}
+	})
+}
+
+// ingest is the ingest stage of the router, the events logged waiting to be routed.
+type ingest interface {
+	// receive waits for the next event, PriorityHigh ones first, returning false once stop is
+	// closed or the stage is.
+	receive(stop <-chan struct{}) ([]byte, bool)
+	// poll returns the next event waiting, or received before timeout if set, with false for
+	// open once the stage is closed.
+	poll(timeout <-chan time.Time) (e []byte, ok bool, open bool)
+}
+
+// channelIngest is the ingest stage of the EventChan, fed by the elastic queue if any, and of
+// the channel of PriorityHigh events.
+type channelIngest struct {
+	priority <-chan []byte
+	events   <-chan []byte
+}
+
+func (in channelIngest) receive(stop <-chan struct{}) ([]byte, bool) {
+	select {
+	case e := <-in.priority:
+		return e, true
+	default:
+	}
+	select {
+	case e := <-in.priority:
+		return e, true
+	case e, ok := <-in.events:
+		return e, ok
+	case <-stop:
+		return nil, false
+	}
+}
+
+func (in channelIngest) poll(timeout <-chan time.Time) (e []byte, ok bool, open bool) {
+	if timeout == nil {
+		select {
+		case e, open = <-in.events:
+			return e, open, open
+		default:
+			return nil, false, true
+		}
+	}
+	select {
+	case e, open = <-in.events:
+		return e, open, open
+	case <-timeout:
+		return nil, false, true
+	}
+}
+
+// buffer is the buffer stage of the router, gathering the events of a partition key to be
+// delivered at once.
+type buffer interface {
+	// gather returns the events of a partition key to deliver, starting with e, along with the
+	// first event of another partition received meanwhile if any, and false for open once the
+	// ingest stage is closed.
+	gather(key string, e []byte) (events [][]byte, next []byte, hasNext bool, open bool)
+}
+
+// unbuffered delivers events one at a time.
+type unbuffered struct{}
+
+func (unbuffered) gather(key string, e []byte) ([][]byte, []byte, bool, bool) {
+	return [][]byte{e}, nil, false, true
+}
+
+// coalescer gathers the events following in the ingest stage as long as they are of the same
+// partition key, up to size events or until delay has passed, see Config.RouteBatchSize. By
+// default only the events already waiting are gathered. Events whose partition key fails are
+// passed to skip.
+type coalescer struct {
+	in        ingest
+	partition func(e []byte) (string, error)
+	size      int
+	delay     time.Duration
+	skip      func(err error)
+}
+
+func (c *coalescer) gather(key string, e []byte) (events [][]byte, next []byte, hasNext bool, open bool) {
+	var timeout <-chan time.Time
+	if c.delay > 0 {
+		t := time.NewTimer(c.delay)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	events = [][]byte{e}
+	for len(events) < c.size {
+		e, ok, open := c.in.poll(timeout)
+		if !open {
+			return events, nil, false, false
+		}
+		if !ok {
+			return events, nil, false, true
+		}
+
+		k, err := c.partition(e)
+		if err != nil {
+			c.skip(err)
+			continue
+		}
+		if k != key {
+			return events, e, true, true
+		}
+		events = append(events, e)
+	}
+	return events, nil, false, true
+}
+
+// ingestStage returns the ingest stage of the router.
+func (r *laozi) ingestStage() ingest {
+	return channelIngest{priority: r.priorityChan, events: r.EventChan}
+}
+
+// bufferStage returns the buffer stage of the router, coalescing events with RouteBatchSize.
+func (r *laozi) bufferStage(in ingest) buffer {
+	if r.RouteBatchSize <= 1 {
+		return unbuffered{}
+	}
+	return &coalescer{
+		in:        in,
+		partition: r.partitionKey,
+		size:      r.RouteBatchSize,
+		delay:     r.RouteBatchDelay,
+		skip: func(err error) {
+			r.handleError(err)
+			r.routed(1)
+		},
+	}
+}
+
+// partitionStage returns the partition stage of the router, its own unless wrapped.
+func (r *laozi) partitionStage() Partitioner {
+	if r.partitioner == nil {
+		return PartitionerFunc(r.routerKey)
+	}
+	return r.partitioner
+}
+
+// deliveryStage returns the delivery stage of the router, its own unless wrapped.
+func (r *laozi) deliveryStage() Delivery {
+	if r.delivery == nil {
+		return DeliveryFunc(r.deliver)
+	}
+	return r.delivery
+}
+
+// wrapStages wraps the stages of the router with Config.PartitionStage and
+// Config.DeliveryStage, if set.
+func (r *laozi) wrapStages() {
+	if r.PartitionStage != nil {
+		r.partitioner = r.PartitionStage(PartitionerFunc(r.routerKey))
+	}
+	if r.DeliveryStage != nil {
+		r.delivery = r.DeliveryStage(DeliveryFunc(r.deliver))
+	}
+}
@@ -0,0 +1,111 @@
+package laozi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescerGathersEventsOfKey(t *testing.T) {
+	assert := assert.New(t)
+
+	events := make(chan []byte, 10)
+	var skipped []error
+	c := &coalescer{
+		in: channelIngest{events: events},
+		partition: func(e []byte) (string, error) {
+			if len(e) == 0 {
+				return "", ErrPartitionKey
+			}
+			return string(e[:1]), nil
+		},
+		size: 3,
+		skip: func(err error) { skipped = append(skipped, err) },
+	}
+	for _, e := range []string{"a2", "", "a3", "a4", "b1"} {
+		events <- []byte(e)
+	}
+
+	gathered, _, hasNext, open := c.gather("a", []byte("a1"))
+	assert.Equal([][]byte{[]byte("a1"), []byte("a2"), []byte("a3")}, gathered)
+	assert.False(hasNext)
+	assert.True(open)
+	assert.Len(skipped, 1)
+
+	gathered, next, hasNext, open := c.gather("a", <-events)
+	assert.Equal([][]byte{[]byte("a4")}, gathered)
+	assert.True(hasNext)
+	assert.Equal([]byte("b1"), next)
+	assert.True(open)
+
+	close(events)
+	_, _, _, open = c.gather("b", next)
+	assert.False(open)
+}
+
+func TestTeeDeliveryCopiesEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	var first, second [][]byte
+	tee := TeeDelivery(
+		DeliveryFunc(func(key string, events [][]byte) {
+			first = append(first, events...)
+			events[0] = []byte("reused")
+		}),
+		DeliveryFunc(func(key string, events [][]byte) {
+			second = append(second, events...)
+		}),
+	)
+	tee.Deliver("a", [][]byte{[]byte("1"), []byte("2")})
+
+	assert.Equal([][]byte{[]byte("1"), []byte("2")}, first)
+	assert.Equal([][]byte{[]byte("1"), []byte("2")}, second)
+}
+
+func TestRouterWrapsStages(t *testing.T) {
+	assert := assert.New(t)
+
+	var teed []string
+	l := &laozi{
+		EventChan:  make(chan []byte, 10),
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockBatchLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			ErrorHandler:     func(error) {},
+			PartitionStage: func(p Partitioner) Partitioner {
+				return PartitionerFunc(func(e []byte) (string, error) {
+					if strings.HasPrefix(string(e), "!") {
+						panic("bad event")
+					}
+					return p.PartitionKey(e)
+				})
+			},
+			DeliveryStage: func(d Delivery) Delivery {
+				return TeeDelivery(d, DeliveryFunc(func(key string, events [][]byte) {
+					for _, e := range events {
+						teed = append(teed, key+":"+string(e))
+					}
+				}))
+			},
+		},
+	}
+	l.wrapStages()
+	for _, e := range []string{"a", "!", "b"} {
+		l.EventChan <- []byte(e)
+	}
+	close(l.EventChan)
+	l.route()
+
+	assert.Equal([]string{"a:a", "b:b"}, teed)
+	assert.Equal([][]string{{"a"}}, l.routingMap["a"].(*MockBatchLogger).calls)
+	assert.Equal([][]string{{"b"}}, l.routingMap["b"].(*MockBatchLogger).calls)
+
+	_, err := l.partitionKey([]byte("!"))
+	var panicErr *ErrPanic
+	assert.True(errors.As(err, &panicErr))
+}
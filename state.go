@@ -0,0 +1,113 @@
+package laozi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// LoggerState describes the in-memory state of a logger, see StateLogger.
+type LoggerState struct {
+	// BufferedBytes is the size of the events held in memory.
+	BufferedBytes int64 `json:"buffered_bytes"`
+	// Uploading is set while the logger is flushing.
+	Uploading bool `json:"uploading"`
+	// Flushes is the last flushes of the logger, the oldest first, if it keeps them, see
+	// s3.S3LoggerFactory.FlushHistory.
+	Flushes []FlushRecord `json:"flushes,omitempty"`
+}
+
+// StateLogger is implemented by loggers describing their state in DumpState.
+type StateLogger interface {
+	Logger
+	// State must be safe to call while the logger is in use.
+	State() LoggerState
+}
+
+// partitionState is a partition in the output of DumpState.
+type partitionState struct {
+	Key        string    `json:"key"`
+	Logger     string    `json:"logger"`
+	LastActive time.Time `json:"last_active"`
+	// Closing is set for timed out loggers being closed.
+	Closing bool `json:"closing"`
+	*LoggerState
+}
+
+type routerState struct {
+	Partitions []partitionState `json:"partitions"`
+	// Queued is the number of events waiting in the event channels.
+	Queued int  `json:"queued"`
+	Paused bool `json:"paused"`
+	Closed bool `json:"closed"`
+	// Split is the partition keys split into sub-partitions, see Config.SplitBytes.
+	Split []string `json:"split,omitempty"`
+	// Keys is the number of partition keys routed recently, see Config.CardinalityThreshold.
+	Keys int `json:"keys,omitempty"`
+	// Workers is the number of events waiting for each worker, see Config.RouterConcurrency.
+	Workers []int `json:"workers,omitempty"`
+}
+
+// DumpState writes a JSON description of the active partitions and their loggers, e.g. to
+// attach to incident reports when archiving falls behind.
+func (r *laozi) DumpState(w io.Writer) error {
+	s := routerState{
+		Queued:  r.queued(),
+		Paused:  r.paused() != nil,
+		Closed:  r.isClosed(),
+		Split:   r.splitKeys(),
+		Keys:    r.cardinality(),
+		Workers: r.workersQueued(),
+	}
+
+	r.RLock()
+	for key, l := range r.routingMap {
+		s.Partitions = append(s.Partitions, describePartition(key, l, false))
+	}
+	for key, c := range r.closing {
+		s.Partitions = append(s.Partitions, describePartition(key, c.Logger, true))
+	}
+	r.RUnlock()
+
+	sort.Slice(s.Partitions, func(i, j int) bool { return s.Partitions[i].Key < s.Partitions[j].Key })
+	return json.NewEncoder(w).Encode(s)
+}
+
+func describePartition(key string, l Logger, closing bool) partitionState {
+	p := partitionState{
+		Key:        key,
+		Logger:     fmt.Sprintf("%T", l),
+		LastActive: l.LastActive(),
+		Closing:    closing,
+	}
+	unwrap(l, func(l Logger) bool {
+		sl, ok := l.(StateLogger)
+		if ok {
+			state := sl.State()
+			p.LoggerState = &state
+		}
+		return ok
+	})
+	return p
+}
+
+// Sequences returns the sequence numbers of the last events written and logged.
+func (l *BatchLogger) Sequences() (flushed, logged int64) {
+	if l.pending == nil {
+		return l.sequence, l.sequence
+	}
+	return l.pending.First - 1, l.sequence
+}
+
+// State returns the size of the pending batch, whether it is being written and the last
+// flushes.
+func (l *BatchLogger) State() LoggerState {
+	return LoggerState{
+		BufferedBytes: atomic.LoadInt64(&l.bufferedBytes),
+		Uploading:     atomic.LoadInt32(&l.uploading) == 1,
+		Flushes:       l.Flushes(),
+	}
+}
@@ -0,0 +1,36 @@
+package laozi
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterDumpsState(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &laozi{
+		EventChan:  make(chan []byte, 1),
+		routingMap: map[string]Logger{},
+	}
+	l.EventChan <- []byte("queued")
+	l.routingMap["b"] = &MockLogger{}
+	bl := NewBatchLogger("a", func(*Batch) error { return nil }, 0, 0, 0)
+	bl.add([]byte("some data"))
+	l.routingMap["a"] = bl
+
+	var buf bytes.Buffer
+	assert.NoError(l.DumpState(&buf))
+
+	var s routerState
+	assert.NoError(json.Unmarshal(buf.Bytes(), &s))
+	assert.Equal(1, s.Queued)
+	assert.Equal(2, len(s.Partitions))
+	assert.Equal("a", s.Partitions[0].Key)
+	assert.Equal("*laozi.BatchLogger", s.Partitions[0].Logger)
+	assert.Equal(int64(len("some data")), s.Partitions[0].BufferedBytes)
+	assert.Equal("b", s.Partitions[1].Key)
+	assert.Nil(s.Partitions[1].LoggerState)
+}
@@ -0,0 +1,80 @@
+package laozi
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+)
+
+// ReaderLogger is a Logger that can also log an event read from an io.Reader, so it is copied
+// to the buffer without being held in memory by the caller first.
+type ReaderLogger interface {
+	Logger
+	// LogReader writes the event read from r, returning once r was read.
+	LogReader(r io.Reader) error
+}
+
+// LogReader logs the event read from rd to the partition key, e.g. for multi-MB payloads, and
+// returns once rd was read. The event skips the event channel, so it may be logged before events
+// logged earlier unless with StrictOrdering, and the PartitionKeyFunc and SamplingFunc. Loggers not implementing
+// ReaderLogger, and the DeniedFunc and NotOwnedFunc, are passed the event read in memory, as
+// are all loggers with an Envelope. While the router is paused, LogReader waits for it to be
+// resumed, returning ErrClosed if it is closed instead.
+func (r *laozi) LogReader(key string, rd io.Reader) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+	if resume := r.paused(); resume != nil {
+		select {
+		case <-resume:
+		case <-r.stop:
+		}
+		if r.isClosed() {
+			return ErrClosed
+		}
+	}
+	if r.StrictOrdering && !r.SyncMode && !r.Embedded {
+		r.awaitRouted(atomic.LoadInt64(&r.sequenced))
+	}
+	key, err := r.routingKey(key)
+	if err != nil {
+		return err
+	}
+	if !r.allowed(key) {
+		e, err := ioutil.ReadAll(rd)
+		if err == nil {
+			r.deny(key, e)
+		}
+		return err
+	}
+
+	newLogger := func() (Logger, error) { return r.newLogger(key) }
+	if r.SyncMode {
+		r.expireSyncLoggers()
+		lf := r.LoggerFactory.(SyncLoggerFactory)
+		newLogger = func() (Logger, error) { return lf.NewSyncLogger(key), nil }
+	}
+	l, ok := r.loggerFor(key, nil, newLogger)
+	if !ok {
+		e, err := ioutil.ReadAll(rd)
+		if err == nil && r.NotOwnedFunc != nil {
+			r.NotOwnedFunc(key, e)
+		}
+		return err
+	}
+	if rl, ok := l.(ReaderLogger); ok && !r.Envelope {
+		return rl.LogReader(rd)
+	}
+
+	e, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	e = r.envelope(key, e)
+	if sl, ok := l.(SyncLogger); ok && r.SyncMode {
+		return sl.LogSync(context.Background(), e)
+	}
+	l.Log(e)
+	return nil
+}
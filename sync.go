@@ -0,0 +1,89 @@
+package laozi
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SyncLogger is a Logger that can also log an event synchronously, see Config.SyncMode. Its
+// methods must not rely on background goroutines.
+type SyncLogger interface {
+	Logger
+	// LogSync writes the event and flushes it before returning.
+	LogSync(ctx context.Context, e []byte) error
+}
+
+// SyncLoggerFactory is implemented by logger factories able to make loggers for SyncMode.
+type SyncLoggerFactory interface {
+	NewSyncLogger(key string) SyncLogger
+}
+
+// LogSync routes an event and flushes it within the calling goroutine, returning once it is
+// persisted. It requires SyncMode.
+func (r *laozi) LogSync(ctx context.Context, e []byte) error {
+	if !r.SyncMode {
+		return errors.New("LogSync requires SyncMode")
+	}
+	for _, e := range r.split(e) {
+		if err := r.logSync(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logSync routes and flushes an event split by the SplitterFunc.
+func (r *laozi) logSync(ctx context.Context, e []byte) error {
+	if r.isClosed() {
+		return ErrClosed
+	}
+	if resume := r.paused(); resume != nil {
+		select {
+		case <-resume:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	key, err := r.partitionKey(e)
+	if err != nil {
+		return err
+	}
+	if !r.allowed(key) {
+		r.deny(key, e)
+		return nil
+	}
+	r.expireSyncLoggers()
+	r.countKey(key)
+	if r.SplitBytes > 0 {
+		key = r.shardKey(key, e)
+	}
+
+	lf := r.LoggerFactory.(SyncLoggerFactory)
+	l, ok := r.loggerFor(key, [][]byte{e}, func() (Logger, error) { return lf.NewSyncLogger(key), nil })
+	if !ok || r.sampledOut(key, l, e) {
+		return nil
+	}
+	r.audit(key, l, e)
+	return l.(SyncLogger).LogSync(ctx, r.envelope(key, e))
+}
+
+// expireSyncLoggers closes timed out loggers in SyncMode or Embedded, where no goroutine
+// monitors them.
+func (r *laozi) expireSyncLoggers() {
+	r.Lock()
+	defer r.Unlock()
+	if time.Since(r.expired) < r.LoggerTimeout/2 {
+		return
+	}
+	r.expired = time.Now()
+
+	for key, l := range r.routingMap {
+		if time.Since(l.LastActive()) >= r.LoggerTimeout {
+			r.closeFailed(key, l, l.Close())
+			delete(r.routingMap, key)
+			r.unlock(key)
+		}
+	}
+}
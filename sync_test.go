@@ -0,0 +1,156 @@
+package laozi
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSyncLoggerFactory struct {
+	MockLoggerFactory
+	err error
+}
+
+func (mf *MockSyncLoggerFactory) NewSyncLogger(key string) SyncLogger {
+	return &MockSyncLogger{MockLogger: MockLogger{fileName: key}, err: mf.err}
+}
+
+// MockSyncLogger records the events that were logged synchronously.
+type MockSyncLogger struct {
+	MockLogger
+	synced [][]byte
+	err    error
+}
+
+func (m *MockSyncLogger) LogSync(ctx context.Context, e []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.synced = append(m.synced, e)
+	return nil
+}
+
+func TestRouterLogsSynchronously(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockSyncLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+		SyncMode:         true,
+	})
+
+	assert.NoError(r.LogSync(context.Background(), []byte("a")))
+	r.Log([]byte("a"))
+
+	// nothing was routed in the background
+	l := r.(*laozi).routingMap["a"].(*MockSyncLogger)
+	assert.Equal([][]byte{[]byte("a"), []byte("a")}, l.synced)
+	r.Close()
+	assert.True(l.closed)
+}
+
+func TestRouterReturnsSyncErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockSyncLoggerFactory{err: errors.New("s3 is down")},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+		SyncMode:         true,
+	})
+	assert.Error(r.LogSync(context.Background(), []byte("a")))
+
+	r = NewLaozi(&Config{
+		LoggerFactory:    &MockLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+	})
+	assert.Error(r.LogSync(context.Background(), []byte("a")))
+}
+
+func TestRouterExpiresSyncLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozi{
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockSyncLoggerFactory{},
+			LoggerTimeout:    time.Millisecond,
+			PartitionKeyFunc: MockPartitionFunc,
+			SyncMode:         true,
+		},
+	}
+	assert.NoError(r.LogSync(context.Background(), []byte("a")))
+	l := r.routingMap["a"].(*MockSyncLogger)
+
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(r.LogSync(context.Background(), []byte("b")))
+	assert.True(l.closed)
+	_, found := r.routingMap["a"]
+	assert.False(found)
+}
+
+func TestSyncModeRequiresSyncLoggerFactory(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Panics(func() {
+		NewLaozi(&Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Minute,
+			PartitionKeyFunc: MockPartitionFunc,
+			SyncMode:         true,
+		})
+	})
+}
+
+func TestEmbeddedRouterRoutesInline(t *testing.T) {
+	assert := assert.New(t)
+
+	goroutines := runtime.NumGoroutine()
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+		Embedded:         true,
+	})
+	assert.True(runtime.NumGoroutine() <= goroutines)
+
+	assert.NoError(r.ProcessOne([]byte("a")))
+	r.Log([]byte("a"))
+	l := r.(*laozi).routingMap["a"].(*MockLogger)
+	assert.Equal([]byte("aa"), l.bytes)
+
+	r.Close()
+	assert.True(l.closed)
+	assert.Equal(ErrClosed, r.ProcessOne([]byte("a")))
+}
+
+func TestEmbeddedRouterExpiresLoggers(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &laozi{
+		routingMap: map[string]Logger{},
+		Config: &Config{
+			LoggerFactory:    &MockLoggerFactory{},
+			LoggerTimeout:    time.Millisecond,
+			PartitionKeyFunc: MockPartitionFunc,
+			Embedded:         true,
+		},
+	}
+	assert.NoError(r.ProcessOne([]byte("a")))
+	l := r.routingMap["a"].(*MockLogger)
+
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(r.ProcessOne([]byte("b")))
+	assert.True(l.closed)
+	_, found := r.routingMap["a"]
+	assert.False(found)
+
+	r.Embedded = false
+	assert.Error(r.ProcessOne([]byte("a")))
+}
@@ -0,0 +1,31 @@
+package laozi
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// FlushThresholds override at runtime the FlushInterval, FlushEveryNRecords and
+// FlushEveryNBytes of the loggers of the S3LoggerFactories sharing them, e.g. from the
+// AdminServer. Zero values keep the settings of the factories. It is safe for concurrent use.
+type FlushThresholds struct {
+	interval int64
+	records  int64
+	bytes    int64
+}
+
+// Set replaces the thresholds. Loggers apply a new interval from their next flush.
+func (t *FlushThresholds) Set(interval time.Duration, records, bytes int) {
+	atomic.StoreInt64(&t.interval, int64(interval))
+	atomic.StoreInt64(&t.records, int64(records))
+	atomic.StoreInt64(&t.bytes, int64(bytes))
+}
+
+// Get returns the thresholds.
+func (t *FlushThresholds) Get() (interval time.Duration, records, bytes int) {
+	if t == nil {
+		return 0, 0, 0
+	}
+	return time.Duration(atomic.LoadInt64(&t.interval)), int(atomic.LoadInt64(&t.records)),
+		int(atomic.LoadInt64(&t.bytes))
+}
@@ -0,0 +1,66 @@
+package laozi
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrStalled is the error reported when the router routed no event for StallTimeout while events
+// were waiting, e.g. because a logger blocks. Key is the partition it is delivering to, if any.
+type ErrStalled struct {
+	Since  time.Time
+	Queued int
+	Key    string
+}
+
+func (e *ErrStalled) Error() string {
+	return fmt.Sprintf("routing stalled since %s with %d events queued, delivering to %q",
+		e.Since.Format(time.RFC3339), e.Queued, e.Key)
+}
+
+// routeProgress is what the router was last doing.
+type routeProgress struct {
+	at      time.Time
+	key     string
+	waiting bool
+}
+
+// progress records what the router is doing, for the watchdog.
+func (r *laozi) progress(key string, waiting bool) {
+	if r.Config != nil && r.StallTimeout > 0 {
+		r.lastProgress.Store(routeProgress{at: time.Now(), key: key, waiting: waiting})
+	}
+}
+
+// watchdog reports the stalls of the router with the ErrorHandler, once per stall, until
+// routing stops.
+func (r *laozi) watchdog() {
+	t := time.NewTicker(r.StallTimeout / 4)
+	defer t.Stop()
+
+	stalled := false
+	for {
+		select {
+		case <-r.routeDone:
+			return
+		case <-t.C:
+		}
+
+		p, _ := r.lastProgress.Load().(routeProgress)
+		queued := r.queued()
+		stall := !p.waiting && time.Since(p.at) >= r.StallTimeout && queued > 0 && r.paused() == nil
+		if stall && !stalled {
+			r.handleError(&ErrStalled{Since: p.at, Queued: queued, Key: p.key})
+		}
+		stalled = stall
+	}
+}
+
+// queued returns the number of events waiting to be routed.
+func (r *laozi) queued() int {
+	n := len(r.EventChan) + len(r.priorityChan)
+	if r.queue != nil {
+		n += r.queue.len()
+	}
+	return n
+}
@@ -0,0 +1,66 @@
+package laozi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockBlockingLogger struct {
+	MockLogger
+	unblock chan struct{}
+}
+
+func (m *MockBlockingLogger) Log(e []byte) {
+	<-m.unblock
+}
+
+type MockBlockingLoggerFactory struct {
+	unblock chan struct{}
+}
+
+func (mf *MockBlockingLoggerFactory) NewLogger(key string) Logger {
+	return &MockBlockingLogger{MockLogger{fileName: key}, mf.unblock}
+}
+
+func TestWatchdogReportsStalls(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var errs []error
+	unblock := make(chan struct{})
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockBlockingLoggerFactory{unblock},
+		LoggerTimeout:    time.Hour,
+		PartitionKeyFunc: MockPartitionFunc,
+		EventChannelSize: 10,
+		StallTimeout:     20 * time.Millisecond,
+		ErrorHandler: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	// idle isn't stalled
+	time.Sleep(50 * time.Millisecond)
+	r.Log([]byte("a"))
+	r.Log([]byte("b"))
+	assert.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) > 0
+	}, time.Second, time.Millisecond)
+	close(unblock)
+	r.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(1, len(errs))
+	var stalled *ErrStalled
+	assert.True(errors.As(errs[0], &stalled))
+	assert.Equal("a", stalled.Key)
+	assert.Equal(1, stalled.Queued)
+}
@@ -0,0 +1,34 @@
+package laozi
+
+import "sync/atomic"
+
+// utilization returns how full the event queue is, from 0 to 1.
+func (r *laozi) utilization() float64 {
+	if r.queue != nil {
+		r.queue.Lock()
+		defer r.queue.Unlock()
+		return float64(r.queue.bytes) / float64(r.queue.maxBytes)
+	}
+	if cap(r.EventChan) == 0 {
+		return 0
+	}
+	return float64(len(r.EventChan)) / float64(cap(r.EventChan))
+}
+
+// checkWatermarks calls the watermark callbacks when the utilization of the event queue
+// crosses them, once per crossing.
+func (r *laozi) checkWatermarks() {
+	if r.Config == nil || r.HighWatermark <= 0 {
+		return
+	}
+	u := r.utilization()
+	if u >= r.HighWatermark && atomic.CompareAndSwapInt32(&r.aboveWatermark, 0, 1) {
+		if r.OnHighWatermark != nil {
+			r.OnHighWatermark(u)
+		}
+	} else if u <= r.LowWatermark && atomic.CompareAndSwapInt32(&r.aboveWatermark, 1, 0) {
+		if r.OnLowWatermark != nil {
+			r.OnLowWatermark(u)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package laozi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterCallsWatermarkCallbacks(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls []float64
+	l := &laozi{
+		EventChan: make(chan []byte, 10),
+		Config: &Config{
+			HighWatermark:   0.8,
+			LowWatermark:    0.5,
+			OnHighWatermark: func(u float64) { calls = append(calls, u) },
+			OnLowWatermark:  func(u float64) { calls = append(calls, -u) },
+		},
+	}
+
+	for i := 0; i < 9; i++ {
+		l.TryLog([]byte("e"))
+	}
+	assert.Equal([]float64{0.8}, calls)
+
+	for i := 0; i < 4; i++ {
+		<-l.EventChan
+		l.checkWatermarks()
+	}
+	assert.Equal([]float64{0.8, -0.5}, calls)
+
+	l.checkWatermarks()
+	assert.Equal(2, len(calls))
+}
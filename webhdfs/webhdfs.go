@@ -0,0 +1,224 @@
+// Package webhdfs uploads the partitions of a laozi router to HDFS as rotated files.
+package webhdfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+)
+
+const defaultWebHDFSRotation = time.Hour
+
+// WebHDFSLoggerFactory is a logger factory for creating loggers that upload received events to
+// HDFS through its WebHDFS REST API. Every flush uploads a new file, like sftp.SFTPLoggerFactory
+// does, so events land in data lake directories partitioned by key and rotation window.
+type WebHDFSLoggerFactory struct {
+	// Addr is the address of the namenode HTTP server, e.g. "http://namenode:9870".
+	Addr string
+	// User is the user requests are made as, when HDFS runs without Kerberos.
+	User          string
+	Dir           string
+	FlushInterval time.Duration
+	// RotationInterval is the length of the windows files are grouped by, defaults to an hour.
+	RotationInterval time.Duration
+	Compression      string
+	// Client is the HTTP client used, defaults to a client with no timeout.
+	Client *http.Client
+}
+
+// NewLogger returns a new instance of a WebHDFS logger for a corresponding partition key. If
+// the files of the partition can't be listed to resume its sequence, its flushes fail.
+func (lf WebHDFSLoggerFactory) NewLogger(key string) laozi.Logger {
+	return lf.writer(key).NewLogger(key, lf.FlushInterval)
+}
+
+// NewLoggerContext is NewLogger failing if the files of the partition can't be listed. The
+// listing isn't cancelled with ctx.
+func (lf WebHDFSLoggerFactory) NewLoggerContext(ctx context.Context, key string) (laozi.Logger, error) {
+	l, err := lf.writer(key).Start(key, lf.FlushInterval)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// writer returns the writer of the files of a partition key.
+func (lf WebHDFSLoggerFactory) writer(key string) *rotating.Writer {
+	client := &http.Client{}
+	if lf.Client != nil {
+		c := *lf.Client
+		client = &c
+	}
+	// data is sent to the datanode a CREATE redirects to, not to the namenode
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	rotation := lf.RotationInterval
+	if rotation <= 0 {
+		rotation = defaultWebHDFSRotation
+	}
+	return &rotating.Writer{
+		FS:          &webHDFS{addr: strings.TrimRight(lf.Addr, "/"), user: lf.User, client: client},
+		Name:        path.Join("/", fmt.Sprintf("%s%s", lf.Dir, key)),
+		Rotation:    rotation,
+		Compression: lf.Compression,
+	}
+}
+
+type webHDFS struct {
+	addr   string
+	user   string
+	client *http.Client
+}
+
+type webHDFSError struct {
+	RemoteException struct {
+		Exception string `json:"exception"`
+		Message   string `json:"message"`
+	} `json:"RemoteException"`
+}
+
+func (h *webHDFS) url(name, op string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", op)
+	if h.user != "" {
+		params.Set("user.name", h.user)
+	}
+	return fmt.Sprintf("%s/webhdfs/v1%s?%s", h.addr, path.Clean("/"+name), params.Encode())
+}
+
+// do makes a request, returning an error unless the response has the expected status.
+func (h *webHDFS) do(method, u string, body []byte, status ...int) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range status {
+		if resp.StatusCode == s {
+			return resp, nil
+		}
+	}
+
+	defer resp.Body.Close()
+	var e webHDFSError
+	json.NewDecoder(resp.Body).Decode(&e)
+	return nil, fmt.Errorf("webhdfs %s: %s: %s %s", method, resp.Status, e.RemoteException.Exception, e.RemoteException.Message)
+}
+
+func (h *webHDFS) Exists(name string) (bool, error) {
+	resp, err := h.do("GET", h.url(name, "GETFILESTATUS", nil), nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// WriteFile creates a file in two steps: the namenode redirects to the datanode the data is
+// then sent to. Missing parent directories are created by HDFS.
+func (h *webHDFS) WriteFile(name string, data []byte) error {
+	params := url.Values{"overwrite": {"true"}}
+	resp, err := h.do("PUT", h.url(name, "CREATE", params), nil, http.StatusTemporaryRedirect)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = h.do("PUT", resp.Header.Get("Location"), data, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ReadFile reads a file from the datanode the namenode redirects to.
+func (h *webHDFS) ReadFile(name string) ([]byte, error) {
+	resp, err := h.do("GET", h.url(name, "OPEN", nil), nil, http.StatusTemporaryRedirect)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	resp, err = h.do("GET", resp.Header.Get("Location"), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (h *webHDFS) Rename(from, to string) error {
+	params := url.Values{"destination": {path.Clean("/" + to)}}
+	resp, err := h.do("PUT", h.url(from, "RENAME", params), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Boolean bool `json:"boolean"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Boolean {
+		return fmt.Errorf("webhdfs could not rename %s to %s", from, to)
+	}
+	return nil
+}
+
+func (h *webHDFS) List(dir string) ([]string, error) {
+	resp, err := h.do("GET", h.url(dir, "LISTSTATUS", nil), nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		ioutil.ReadAll(resp.Body)
+		return nil, nil
+	}
+
+	var result struct {
+		FileStatuses struct {
+			FileStatus []struct {
+				PathSuffix string `json:"pathSuffix"`
+			} `json:"FileStatus"`
+		} `json:"FileStatuses"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range result.FileStatuses.FileStatus {
+		names = append(names, f.PathSuffix)
+	}
+	return names, nil
+}
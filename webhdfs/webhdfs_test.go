@@ -0,0 +1,160 @@
+package webhdfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	laozi "github.com/seedboxtech/laozi"
+	"github.com/seedboxtech/laozi/internal/rotating"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockNamenode is an in-memory WebHDFS server, acting as both namenode and datanode.
+type mockNamenode struct {
+	sync.Mutex
+	files map[string][]byte
+}
+
+func (m *mockNamenode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if r.URL.Path == "/datanode" && r.Method == http.MethodGet {
+		w.Write(m.files[r.URL.Query().Get("path")])
+		return
+	}
+	if r.URL.Path == "/datanode" {
+		b, _ := ioutil.ReadAll(r.Body)
+		m.files[r.URL.Query().Get("path")] = b
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/webhdfs/v1")
+	switch r.URL.Query().Get("op") {
+	case "GETFILESTATUS":
+		if _, found := m.files[name]; !found {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"RemoteException":{"exception":"FileNotFoundException"}}`)
+		}
+	case "CREATE", "OPEN":
+		w.Header().Set("Location", "http://"+r.Host+"/datanode?path="+name)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	case "RENAME":
+		to := r.URL.Query().Get("destination")
+		m.files[to] = m.files[name]
+		delete(m.files, name)
+		fmt.Fprint(w, `{"boolean":true}`)
+	case "LISTSTATUS":
+		var statuses []map[string]string
+		for f := range m.files {
+			if path.Dir(f) == name {
+				statuses = append(statuses, map[string]string{"pathSuffix": path.Base(f)})
+			}
+		}
+		if len(statuses) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"FileStatuses": map[string]interface{}{"FileStatus": statuses}})
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestWebHDFSLoggerUploadsRotatedFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	nn := &mockNamenode{files: map[string][]byte{}}
+	server := httptest.NewServer(nn)
+	defer server.Close()
+
+	lf := WebHDFSLoggerFactory{Addr: server.URL, User: "laozi", Dir: "/lake/events/"}
+	l := lf.NewLogger("a")
+	assert.Implements((*laozi.Logger)(nil), l)
+	l.Log([]byte("1\n"))
+	l.Log([]byte("2\n"))
+	assert.NoError(l.Close())
+
+	l = lf.NewLogger("a")
+	l.Log([]byte("3\n"))
+	assert.NoError(l.Close())
+
+	var names []string
+	for name := range nn.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	assert.Equal(2, len(names))
+	assert.True(strings.HasPrefix(names[0], "/lake/events/a/"))
+	assert.True(strings.HasSuffix(names[0], "/00000000000000000001-00000000000000000002"))
+	assert.True(strings.HasSuffix(names[1], "/00000000000000000003-00000000000000000003"))
+	assert.Equal([]byte("1\n2\n"), nn.files[names[0]])
+}
+
+func TestWebHDFSWriterIsIdempotent(t *testing.T) {
+	assert := assert.New(t)
+
+	nn := &mockNamenode{files: map[string][]byte{}}
+	server := httptest.NewServer(nn)
+	defer server.Close()
+
+	h := &webHDFS{addr: server.URL, client: &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+	w := &rotating.Writer{FS: h, Name: "/a", Rotation: time.Hour, Compression: "zstd"}
+	b := &laozi.Batch{Events: [][]byte{[]byte("1\n")}, Start: time.Now(), First: 1}
+
+	assert.NoError(w.Write(b))
+	assert.NoError(w.Write(b))
+	assert.Equal(1, len(nn.files))
+
+	other := &laozi.Batch{Events: [][]byte{[]byte("2\n")}, Start: b.Start, First: 1}
+	var conflict *laozi.ErrConcurrentWrite
+	assert.True(errors.As(w.Write(other), &conflict))
+}
+
+func TestWebHDFSLoggerFailsWithoutSequence(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	lf := WebHDFSLoggerFactory{Addr: server.URL, Dir: "/lake/events/"}
+	_, err := lf.NewLoggerContext(context.Background(), "a")
+	assert.Error(err)
+
+	// without a context, flushes fail rather than reuse the names of the files uploaded
+	l := lf.NewLogger("a")
+	l.Log([]byte("1\n"))
+	assert.Error(l.Close())
+}
+
+func TestWebHDFSReportsRemoteExceptions(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"RemoteException":{"exception":"AccessControlException","message":"Permission denied"}}`)
+	}))
+	defer server.Close()
+
+	h := &webHDFS{addr: server.URL, client: http.DefaultClient}
+	_, err := h.Exists("/a")
+	assert.Error(err)
+	assert.Contains(err.Error(), "Permission denied")
+}
@@ -0,0 +1,87 @@
+package laozi
+
+import "hash/fnv"
+
+// routedEvents are consecutive events of a partition key, for a worker to deliver.
+type routedEvents struct {
+	key    string
+	events [][]byte
+}
+
+// startWorkers starts the workers delivering events with RouterConcurrency, if set: one per
+// PinnedKeys, after RouterConcurrency shared by the other keys.
+func (r *laozi) startWorkers() {
+	if r.RouterConcurrency <= 1 && len(r.PinnedKeys) == 0 {
+		return
+	}
+	r.pinned = map[string]int{}
+	for _, key := range r.PinnedKeys {
+		if _, ok := r.pinned[key]; !ok {
+			r.pinned[key] = r.sharedWorkers() + len(r.pinned)
+		}
+	}
+	r.workers = make([]chan routedEvents, r.sharedWorkers()+len(r.pinned))
+	for i := range r.workers {
+		r.workers[i] = make(chan routedEvents, r.EventChannelSize)
+		r.workersDone.Add(1)
+		go r.work(r.workers[i])
+	}
+}
+
+func (r *laozi) sharedWorkers() int {
+	if r.RouterConcurrency < 1 {
+		return 1
+	}
+	return r.RouterConcurrency
+}
+
+func (r *laozi) work(events chan routedEvents) {
+	defer r.workersDone.Done()
+	for re := range events {
+		r.safely(re.events, func() { r.deliveryStage().Deliver(re.key, re.events) })
+		r.routed(len(re.events))
+	}
+}
+
+// stopWorkers waits for the workers to deliver the events they were handed, and stops them.
+func (r *laozi) stopWorkers() {
+	for _, w := range r.workers {
+		close(w)
+	}
+	r.workersDone.Wait()
+}
+
+// dispatch delivers consecutive events of a partition key, handing them to its worker if any.
+func (r *laozi) dispatch(key string, events [][]byte) {
+	if r.workers == nil {
+		r.safely(events, func() { r.deliveryStage().Deliver(key, events) })
+		r.routed(len(events))
+		return
+	}
+	r.workers[r.WorkerFor(key)] <- routedEvents{key: key, events: events}
+}
+
+// WorkerFor returns the worker delivering the events of a partition key, as routed, i.e.
+// sanitized and aliased, see Config.RouterConcurrency: 0 to RouterConcurrency-1 for shared
+// workers, and the following ones for the PinnedKeys in order. It is 0 when events are
+// delivered by the router itself.
+func (r *laozi) WorkerFor(key string) int {
+	if r.workers == nil {
+		return 0
+	}
+	if i, ok := r.pinned[key]; ok {
+		return i
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(r.sharedWorkers()))
+}
+
+// workersQueued returns the number of events waiting for each worker.
+func (r *laozi) workersQueued() []int {
+	var queued []int
+	for _, w := range r.workers {
+		queued = append(queued, len(w))
+	}
+	return queued
+}
@@ -0,0 +1,85 @@
+package laozi
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingLoggerFactory makes loggers whose Log blocks for a key until release is closed.
+type blockingLoggerFactory struct {
+	sync.Mutex
+	blocked string
+	release chan struct{}
+	logged  []string
+}
+
+func (f *blockingLoggerFactory) NewLogger(key string) Logger {
+	return &blockingLogger{MockLogger: MockLogger{fileName: key}, f: f}
+}
+
+func (f *blockingLoggerFactory) loggedKeys() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.logged...)
+}
+
+type blockingLogger struct {
+	MockLogger
+	f *blockingLoggerFactory
+}
+
+func (l *blockingLogger) Log(e []byte) {
+	if l.fileName == l.f.blocked {
+		<-l.f.release
+	}
+	l.f.Lock()
+	defer l.f.Unlock()
+	l.f.logged = append(l.f.logged, l.fileName)
+}
+
+func TestRouterPinsKeysToWorkers(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := &blockingLoggerFactory{blocked: "heavy", release: make(chan struct{})}
+	r := NewLaozi(&Config{
+		LoggerFactory:     lf,
+		LoggerTimeout:     time.Minute,
+		PartitionKeyFunc:  MockPartitionFunc,
+		EventChannelSize:  10,
+		RouterConcurrency: 2,
+		PinnedKeys:        []string{"heavy"},
+	})
+
+	assert.Equal(2, r.WorkerFor("heavy"))
+	assert.True(r.WorkerFor("a") < 2)
+	assert.Equal(r.WorkerFor("a"), r.WorkerFor("a"))
+
+	// the pinned key holds up none of the others
+	r.Log([]byte("heavy"))
+	r.Log([]byte("heavy"))
+	r.Log([]byte("a"))
+	r.Log([]byte("b"))
+	assert.Eventually(func() bool { return len(lf.loggedKeys()) == 2 }, time.Second, time.Millisecond)
+	assert.ElementsMatch([]string{"a", "b"}, lf.loggedKeys())
+
+	close(lf.release)
+	r.Close()
+	assert.ElementsMatch([]string{"a", "b", "heavy", "heavy"}, lf.loggedKeys())
+}
+
+func TestRouterWithoutWorkersDelivers(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewLaozi(&Config{
+		LoggerFactory:    &MockLoggerFactory{},
+		LoggerTimeout:    time.Minute,
+		PartitionKeyFunc: MockPartitionFunc,
+	}).(*laozi)
+	assert.Nil(r.workers)
+	assert.Equal(0, r.WorkerFor("a"))
+	r.Log([]byte("a"))
+	r.Close()
+}